@@ -2,11 +2,13 @@ package deps
 
 import (
 	"fmt"
+	"time"
 
 	"ride-hail/internal/services/admin"
 	driver "ride-hail/internal/services/driver/api"
 	"ride-hail/internal/services/ride"
 	"ride-hail/internal/shared/config"
+	"ride-hail/pkg/server"
 )
 
 type ApiDeps struct {
@@ -34,7 +36,7 @@ func WithRideApi(app *AppDeps, config config.Config) apiOption {
 		if app.RideService == nil || app.AuthService == nil {
 			return fmt.Errorf("missing dependencies for RideApi")
 		}
-		deps.RideApi = *ride.NewRideApi(app.AuthService, app.RideService, config.Ports.Ride())
+		deps.RideApi = *ride.NewRideApi(app.AuthService, app.RideService, config.Ports.Ride(), socketConfig(config))
 		return nil
 	}
 }
@@ -44,7 +46,7 @@ func WithDriverApi(app *AppDeps, config config.Config) apiOption {
 		if app.DriverService == nil || app.AuthService == nil {
 			return fmt.Errorf("missing dependencies for DriverApi")
 		}
-		deps.DriverApi = *driver.NewDriverApi(app.AuthService, app.DriverService, config.Ports.DriverLocation())
+		deps.DriverApi = *driver.NewDriverApi(app.AuthService, app.DriverService, config.Ports.DriverLocation(), socketConfig(config))
 		return nil
 	}
 }
@@ -54,7 +56,22 @@ func WithAdminApi(app *AppDeps, config config.Config) apiOption {
 		if app.AdminService == nil || app.AuthService == nil {
 			return fmt.Errorf("missing dependencies for AdminApi")
 		}
-		deps.AdminApi = *admin.NewAdminApi(app.AuthService, app.AdminService, config.Ports.Admin())
+		// a nil *DeadLetterQueue would make a non-nil interface
+		var deadLetters admin.DeadLetters
+		if app.DeadLetters != nil {
+			deadLetters = app.DeadLetters
+		}
+		deps.AdminApi = *admin.NewAdminApi(app.AuthService, app.AdminService, deadLetters, config.Ports.Admin())
 		return nil
 	}
 }
+
+// socketConfig is the websocket buffering and replay tuning of config
+func socketConfig(config config.Config) server.ManagerConfig {
+	return server.ManagerConfig{
+		OutboundBuffer: config.WebSocket.OutboundBuffer,
+		SlowConsumer:   server.SlowConsumerPolicy(config.WebSocket.SlowConsumerPolicy),
+		ReplayFrames:   config.WebSocket.ReplayFrames,
+		ReplayWindow:   time.Duration(config.WebSocket.ReplayWindowSeconds) * time.Second,
+	}
+}
@@ -2,11 +2,15 @@ package deps
 
 import (
 	"fmt"
+	"time"
 
 	"ride-hail/internal/auth"
 	"ride-hail/internal/services/admin"
 	"ride-hail/internal/services/driver"
 	"ride-hail/internal/services/ride"
+	"ride-hail/internal/shared/config"
+	"ride-hail/internal/shared/idempotency"
+	"ride-hail/internal/shared/outbox"
 	"ride-hail/pkg/mq"
 	"ride-hail/pkg/sqlc"
 )
@@ -16,6 +20,10 @@ type AppDeps struct {
 	RideService   *ride.RideService
 	DriverService *driver.DriverService
 	AdminService  *admin.AdminService
+	OutboxRelay   *outbox.Relay
+	// MessageCleaner expires the processed message IDs idempotency guards record
+	MessageCleaner *idempotency.Cleaner
+	DeadLetters    *mq.DeadLetterQueue // nil without RabbitMQ
 }
 
 type appOption func(*AppDeps) error
@@ -42,26 +50,73 @@ func WithAuthService(infra *InfraDeps) appOption {
 	}
 }
 
-func WithRideService(infra *InfraDeps) appOption {
+func WithRideService(infra *InfraDeps, config config.Config) appOption {
 	return func(deps *AppDeps) error {
-		if infra.Pool == nil || infra.RabbitMQ == nil {
+		if infra.Pool == nil || infra.Broker == nil {
 			return fmt.Errorf("missing dependencies for RideService")
 		}
 
 		queries := sqlc.New(infra.Pool)
-		publisher := mq.NewRideEventPublisher(infra.RabbitMQ)
-		deps.RideService = ride.NewRideService(infra.Pool, queries, publisher)
+		timeouts := make(ride.RequestTimeouts, len(config.Ride.RequestTimeouts))
+		for vehicleType, seconds := range config.Ride.RequestTimeouts {
+			timeouts[vehicleType] = time.Duration(seconds) * time.Second
+		}
+		matching := ride.Matching{
+			RadiusKm:     float64(config.Matching.RadiusMeters) / 1000,
+			OfferTimeout: time.Duration(config.Matching.OfferTimeoutSeconds) * time.Second,
+		}
+		deps.RideService = ride.NewRideService(infra.Pool, queries, timeouts, matching)
 		return nil
 	}
 }
 
-func WithDriverService(infra *InfraDeps) appOption {
+func WithDriverService(infra *InfraDeps, config config.Config) appOption {
 	return func(deps *AppDeps) error {
-		if infra.Pool == nil || infra.RabbitMQ == nil || deps.AuthService == nil {
+		if infra.Pool == nil || infra.Broker == nil || deps.AuthService == nil {
 			return fmt.Errorf("missing dependencies for DriverService")
 		}
 		queries := sqlc.New(infra.Pool)
-		deps.DriverService = driver.NewDriverService(infra.Pool, queries, infra.RabbitMQ)
+		arrival := driver.ArrivalDetection{
+			RadiusKm: float64(config.Driver.ArrivalRadiusMeters) / 1000,
+			Updates:  config.Driver.ArrivalUpdates,
+		}
+		deps.DriverService = driver.NewDriverService(infra.Pool, queries, infra.Broker, arrival)
+		return nil
+	}
+}
+
+func WithOutboxRelay(infra *InfraDeps, config config.Config) appOption {
+	return func(deps *AppDeps) error {
+		if infra.Pool == nil || infra.Broker == nil {
+			return fmt.Errorf("missing dependencies for OutboxRelay")
+		}
+		interval := time.Duration(config.Outbox.RelayIntervalMillis) * time.Millisecond
+		publisher := mq.NewPublisher(infra.Broker)
+		deps.OutboxRelay = outbox.NewRelay(infra.Pool, sqlc.New(infra.Pool), publisher, interval, config.Outbox.BatchSize, config.Outbox.MaxAttempts)
+		return nil
+	}
+}
+
+func WithMessageCleaner(infra *InfraDeps, config config.Config) appOption {
+	return func(deps *AppDeps) error {
+		if infra.Pool == nil {
+			return fmt.Errorf("missing dependencies for MessageCleaner")
+		}
+		ttl := time.Duration(config.Messages.ProcessedTTLHours) * time.Hour
+		interval := time.Duration(config.Messages.CleanupIntervalSeconds) * time.Second
+		deps.MessageCleaner = idempotency.NewCleaner(sqlc.New(infra.Pool), ttl, interval)
+		return nil
+	}
+}
+
+// WithDeadLetters inspects RabbitMQ's dead letter queue. Without RabbitMQ,
+// e.g. on a memory broker, DeadLetters stays nil
+func WithDeadLetters(infra *InfraDeps) appOption {
+	return func(deps *AppDeps) error {
+		if infra.RabbitMQ == nil {
+			return nil
+		}
+		deps.DeadLetters = mq.NewDeadLetterQueue(infra.RabbitMQ)
 		return nil
 	}
 }
@@ -9,12 +9,14 @@ import (
 	"ride-hail/pkg/mq"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type InfraDeps struct {
 	Pool     *pgxpool.Pool
 	RabbitMQ *mq.Client
+	// Broker is what services publish to and consume from: RabbitMQ, or the
+	// broker given to WithBroker
+	Broker mq.Broker
 }
 
 type infraOption func(*InfraDeps) error
@@ -65,32 +67,60 @@ func WithPostgres(ctx context.Context, config config.Config) infraOption {
 
 func WithRabbit(ctx context.Context, config config.Config) infraOption {
 	return func(deps *InfraDeps) error {
-		conn, err := amqp.DialConfig(
-
-			config.RabbitMQURL(),
-
-			amqp.Config{
-				Heartbeat: 10 * time.Second,
-				Locale:    "en_US",
-				Dial:      amqp.DefaultDial(5 * time.Second),
-			},
-		)
+		// the client keeps its config so it can dial again after losing the connection
+		mqClient, err := mq.NewClientWithReconnect(RabbitConfig(config))
 		if err != nil {
 			return fmt.Errorf("rabbit connect: %w", err)
 		}
+		deps.RabbitMQ = mqClient
+		deps.Broker = mqClient
 
-		// Wrap connection in mq.Client
-		mqClient, err := mq.NewClient(conn)
-		if err != nil {
-			conn.Close()
-			return fmt.Errorf("failed to create mq client: %w", err)
+		return nil
+	}
+}
+
+// WithTopology declares topology on the broker, so it must come after
+// WithRabbit or WithBroker
+func WithTopology(topology mq.Topology) infraOption {
+	return func(deps *InfraDeps) error {
+		if deps.Broker == nil {
+			return fmt.Errorf("missing broker for topology")
 		}
-		deps.RabbitMQ = mqClient
+		if err := topology.Apply(deps.Broker); err != nil {
+			return fmt.Errorf("declare topology: %w", err)
+		}
+		return nil
+	}
+}
 
+func RabbitConfig(config config.Config) mq.Config {
+	return mq.Config{
+		Host:           config.RabbitMQ.Host,
+		Port:           config.RabbitMQ.Port,
+		UserName:       config.RabbitMQ.User,
+		Password:       config.RabbitMQ.Password,
+		ManagementPort: config.RabbitMQ.ManagementPort,
+	}
+}
+
+// WithBroker runs the services on broker instead of RabbitMQ, e.g. an
+// mq.MemoryBroker to run them in one process
+func WithBroker(broker mq.Broker) infraOption {
+	return func(deps *InfraDeps) error {
+		deps.Broker = broker
 		return nil
 	}
 }
 
+// WithBrokerOrRabbit runs the services on broker when one is given, e.g. the
+// memory broker the standalone runner shares, and on RabbitMQ otherwise
+func WithBrokerOrRabbit(ctx context.Context, config config.Config, broker mq.Broker) infraOption {
+	if broker != nil {
+		return WithBroker(broker)
+	}
+	return WithRabbit(ctx, config)
+}
+
 func CloseInfraDeps(deps *InfraDeps) error {
 	if deps.Pool != nil {
 		deps.Pool.Close()
@@ -102,5 +132,11 @@ func CloseInfraDeps(deps *InfraDeps) error {
 		}
 	}
 
+	if deps.Broker != nil && deps.Broker != mq.Broker(deps.RabbitMQ) {
+		if err := deps.Broker.Close(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
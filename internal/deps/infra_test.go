@@ -0,0 +1,73 @@
+package deps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ride-hail/internal/shared/config"
+	"ride-hail/pkg/mq"
+)
+
+func TestWithBrokerOrRabbit_PublishesThroughMemoryBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := mq.NewMemoryBroker()
+	infra, err := NewInfraDeps(
+		WithBrokerOrRabbit(ctx, config.Config{}, broker),
+		WithTopology(mq.DefaultTopology()),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected infra error: %v", err)
+	}
+	defer CloseInfraDeps(infra)
+
+	if infra.Broker != mq.Broker(broker) || infra.RabbitMQ != nil {
+		t.Fatalf("Expected the services to run on the memory broker only")
+	}
+
+	responses := make(chan mq.DriverResponseMessage, 1)
+	consumer := mq.NewConsumer(infra.Broker, mq.ConsumerConfig{
+		Queue: mq.DriverResponsesQueue,
+		Handler: func(ctx context.Context, message mq.Message) error {
+			response, err := mq.DecodeAs[mq.DriverResponseMessage](message)
+			if err != nil {
+				return err
+			}
+			responses <- response
+			return nil
+		},
+	})
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+
+	publisher := mq.NewDriverEventPublisher(infra.Broker, "driver-location-service")
+	err = publisher.PublishDriverResponse(ctx, "ride-1", mq.DriverResponseMessage{RideID: "ride-1", DriverID: "driver-1", Accepted: true})
+	if err != nil {
+		t.Fatalf("Unexpected publish error: %v", err)
+	}
+
+	select {
+	case response := <-responses:
+		if response.RideID != "ride-1" || response.DriverID != "driver-1" || !response.Accepted {
+			t.Errorf("Unexpected driver response %+v", response)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the driver response")
+	}
+}
+
+func TestWithDeadLetters_WithoutRabbit(t *testing.T) {
+	infra := &InfraDeps{Broker: mq.NewMemoryBroker()}
+	defer CloseInfraDeps(infra)
+
+	app, err := NewAppDeps(WithDeadLetters(infra))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if app.DeadLetters != nil {
+		t.Errorf("Expected no dead letter queue without RabbitMQ")
+	}
+}
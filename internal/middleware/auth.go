@@ -2,12 +2,15 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 
 	"ride-hail/internal/auth"
 	"ride-hail/internal/shared/core"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/uuid"
 )
 
 type contextKey string
@@ -66,3 +69,21 @@ func GetUserFromContext(ctx context.Context) (auth.JWTClaims, bool) {
 	user, ok := ctx.Value(UserContextKey).(auth.JWTClaims)
 	return user, ok
 }
+
+// SocketAuth authenticates /ws/{role}/{id} sockets: the token must belong to a
+// user with role whose ID is the {id} in the path
+func SocketAuth(authService auth.AuthService, role core.UserRole) server.Authenticate {
+	return func(r *http.Request, token string) (uuid.UUID, error) {
+		session, err := authService.ParseToken(token)
+		if err != nil {
+			return uuid.UUID{}, fmt.Errorf("%w: %v", server.ErrUnauthorized, err)
+		}
+		if session.Role != role.String() {
+			return uuid.UUID{}, fmt.Errorf("%w: user %s is not authorized", server.ErrForbidden, session.Role)
+		}
+		if session.UserID.String() != r.PathValue("id") {
+			return uuid.UUID{}, fmt.Errorf("%w: cannot open websocket for another user", server.ErrForbidden)
+		}
+		return session.UserID, nil
+	}
+}
@@ -12,11 +12,19 @@ import (
 	"ride-hail/internal/deps"
 	"ride-hail/internal/shared/config"
 	"ride-hail/pkg/group"
+	"ride-hail/pkg/mq"
 )
 
 func AdminRun(ctx context.Context, config config.Config) error {
+	return adminRun(ctx, config, nil)
+}
+
+// adminRun runs on broker, or on RabbitMQ when broker is nil
+func adminRun(ctx context.Context, config config.Config, broker mq.Broker) error {
 	infra, err := deps.NewInfraDeps(
 		deps.WithPostgres(ctx, config),
+		deps.WithBrokerOrRabbit(ctx, config, broker),
+		deps.WithTopology(mq.DefaultTopology()),
 	)
 	if err != nil {
 		return err
@@ -24,6 +32,7 @@ func AdminRun(ctx context.Context, config config.Config) error {
 	app, err := deps.NewAppDeps(
 		deps.WithAuthService(infra),
 		deps.WithAdminService(infra),
+		deps.WithDeadLetters(infra),
 	)
 	if err != nil {
 		return err
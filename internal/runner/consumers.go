@@ -0,0 +1,23 @@
+package runner
+
+import (
+	"time"
+
+	"ride-hail/internal/shared/config"
+)
+
+const (
+	// consumerTimeout bounds the handling of one message
+	consumerTimeout         = 30 * time.Second
+	consumerMetricsInterval = time.Minute
+)
+
+// longestRequestTimeout is how long a ride may wait for a driver, plus time
+// for the offer still open when it is cancelled; matching stops after that
+func longestRequestTimeout(config config.Config) time.Duration {
+	var longest time.Duration
+	for _, seconds := range config.Ride.RequestTimeouts {
+		longest = max(longest, time.Duration(seconds)*time.Second)
+	}
+	return longest + consumerTimeout
+}
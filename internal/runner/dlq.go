@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ride-hail/internal/deps"
+	"ride-hail/internal/services/admin"
+	"ride-hail/internal/shared/config"
+	"ride-hail/pkg/mq"
+)
+
+// DLQRun inspects, replays or purges the dead letter queue:
+//
+//	ride-hail dlq list   [-queue q] [-routing-key k] [-correlation-id c] [-id m1,m2] [-limit n]
+//	ride-hail dlq replay [filters] [-all]
+//	ride-hail dlq purge  [filters] [-all]
+func DLQRun(ctx context.Context, config config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("dlq: expected list, replay or purge")
+	}
+	action := args[0]
+
+	flags := flag.NewFlagSet("dlq "+action, flag.ContinueOnError)
+	queue := flags.String("queue", "", "only messages dead-lettered from this queue")
+	routingKey := flags.String("routing-key", "", "only messages with this routing key")
+	correlationID := flags.String("correlation-id", "", "only messages with this correlation id")
+	ids := flags.String("id", "", "comma separated message ids")
+	limit := flags.Int("limit", 0, "stop after this many messages")
+	all := flags.Bool("all", false, "replay or purge every message when no filter is given")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	request := admin.DeadLetterActionRequest{
+		Queue:         *queue,
+		RoutingKey:    *routingKey,
+		CorrelationID: *correlationID,
+		Limit:         *limit,
+		All:           *all || action == "list",
+	}
+	if *ids != "" {
+		request.MessageIDs = strings.Split(*ids, ",")
+	}
+	filter, err := request.Filter()
+	if err != nil {
+		return fmt.Errorf("dlq %s: %w", action, err)
+	}
+
+	infra, err := deps.NewInfraDeps(
+		deps.WithRabbit(ctx, config),
+	)
+	if err != nil {
+		return err
+	}
+	defer deps.CloseInfraDeps(infra)
+
+	dlq := mq.NewDeadLetterQueue(infra.RabbitMQ)
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+
+	switch action {
+	case "list":
+		letters, err := dlq.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+		response := admin.DeadLettersResponse{
+			Messages: make([]admin.DeadLetterResponse, 0, len(letters)),
+			Count:    len(letters),
+		}
+		for _, letter := range letters {
+			response.Messages = append(response.Messages, admin.NewDeadLetterResponse(letter))
+		}
+		return out.Encode(response)
+	case "replay":
+		count, err := dlq.Replay(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("replayed %d messages before failing: %w", count, err)
+		}
+		return out.Encode(admin.DeadLetterActionResponse{Action: action, Count: count})
+	case "purge":
+		count, err := dlq.Purge(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("purged %d messages before failing: %w", count, err)
+		}
+		return out.Encode(admin.DeadLetterActionResponse{Action: action, Count: count})
+	default:
+		return fmt.Errorf("dlq: unknown action %s, expected list, replay or purge", action)
+	}
+}
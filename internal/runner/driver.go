@@ -10,13 +10,22 @@ import (
 	"time"
 
 	"ride-hail/internal/deps"
+	"ride-hail/internal/services/driver"
 	"ride-hail/internal/shared/config"
 	"ride-hail/pkg/group"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
 )
 
 func DriverRun(ctx context.Context, config config.Config) error {
+	return driverRun(ctx, config, nil)
+}
+
+// driverRun runs on broker, or on RabbitMQ when broker is nil
+func driverRun(ctx context.Context, config config.Config, broker mq.Broker) error {
 	infra, err := deps.NewInfraDeps(
-		deps.WithRabbit(ctx, config),
+		deps.WithBrokerOrRabbit(ctx, config, broker),
+		deps.WithTopology(mq.DefaultTopology()),
 		deps.WithPostgres(ctx, config),
 	)
 	if err != nil {
@@ -24,7 +33,8 @@ func DriverRun(ctx context.Context, config config.Config) error {
 	}
 	app, err := deps.NewAppDeps(
 		deps.WithAuthService(infra),
-		deps.WithDriverService(infra),
+		deps.WithDriverService(infra, config),
+		deps.WithOutboxRelay(infra, config),
 	)
 	if err != nil {
 		return err
@@ -45,6 +55,49 @@ func DriverRun(ctx context.Context, config config.Config) error {
 	wsManager := api.DriverApi.GetWebsocketManager()
 	wsManager.StartWrite(ctx)
 
+	matcher := driver.NewMatcher(app.DriverService, wsManager, driver.MatchingDefaults{
+		RadiusKm:     float64(config.Matching.RadiusMeters) / 1000,
+		OfferTimeout: time.Duration(config.Matching.OfferTimeoutSeconds) * time.Second,
+	})
+	socket := driver.NewSocketHandler(matcher, app.DriverService, wsManager)
+
+	metrics := mq.NewMetrics()
+	// matching waits on drivers' answers until the ride times out
+	matching := mq.StandardMiddleware(metrics, longestRequestTimeout(config))
+
+	consumers := mq.NewConsumerGroup()
+	consumers.Add(mq.NewConsumer(infra.Broker, mq.ConsumerConfig{
+		Handler:       matching(matcher.HandleRideRequest),
+		Queue:         mq.DriverMatchingQueue,
+		ConsumerTag:   "driver-matching",
+		PrefetchCount: 20,
+		Workers:       20,
+	}))
+
+	g.Go(func() error {
+		return consumers.StartAll(gCtx)
+	})
+
+	// lets every replica push to sockets held by any other
+	g.Go(func() error {
+		return wsManager.RunRelay(gCtx, server.NewBrokerRelay(infra.Broker, "driver-location-service"))
+	})
+
+	g.Go(func() error {
+		metrics.Report(gCtx, consumerMetricsInterval)
+		return nil
+	})
+
+	// both services write to the outbox; the relay lock lets one instance send
+	g.Go(func() error {
+		app.OutboxRelay.Run(gCtx)
+		return nil
+	})
+
+	g.Go(func() error {
+		socket.Run(gCtx)
+		return nil
+	})
 
 	g.Go(func() error {
 		if err := api.DriverApi.Start(); err != nil && err != http.ErrServerClosed {
@@ -74,6 +127,11 @@ func DriverRun(ctx context.Context, config config.Config) error {
 		<-gCtx.Done()
 		ctxWithTimeout, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancelShutdown()
+
+		if err := consumers.StopAll(ctxWithTimeout); err != nil {
+			slog.Error("failed to stop driver consumers", slog.String("error", err.Error()))
+		}
+
 		err := api.DriverApi.StopServer(ctxWithTimeout)
 		if err != nil {
 			slog.Error("failed to stop Driver API server", slog.String("error", err.Error()))
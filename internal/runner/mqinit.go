@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"ride-hail/internal/deps"
+	"ride-hail/internal/shared/config"
+	"ride-hail/pkg/mq"
+)
+
+// MQInitRun declares the broker topology, or with -verify only reports how
+// the live broker differs from it:
+//
+//	ride-hail mq-init [-verify]
+func MQInitRun(ctx context.Context, config config.Config, args []string) error {
+	flags := flag.NewFlagSet("mq-init", flag.ContinueOnError)
+	verify := flags.Bool("verify", false, "report drift against the live broker instead of declaring")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	topology := mq.DefaultTopology()
+
+	if *verify {
+		drifts, err := topology.Verify(ctx, mq.NewManagementClient(deps.RabbitConfig(config)))
+		if err != nil {
+			return fmt.Errorf("verify topology: %w", err)
+		}
+		for _, drift := range drifts {
+			fmt.Println(drift)
+		}
+		if len(drifts) > 0 {
+			return fmt.Errorf("topology drift: %d differences", len(drifts))
+		}
+		slog.Info("RabbitMQ topology matches")
+		return nil
+	}
+
+	infra, err := deps.NewInfraDeps(
+		deps.WithRabbit(ctx, config),
+		deps.WithTopology(topology),
+	)
+	if err != nil {
+		return err
+	}
+	defer deps.CloseInfraDeps(infra)
+
+	slog.Info("RabbitMQ topology initialized",
+		"exchanges", len(topology.Exchanges),
+		"queues", len(topology.Queues),
+		"bindings", len(topology.Bindings))
+	return nil
+}
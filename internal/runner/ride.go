@@ -10,14 +10,25 @@ import (
 	"time"
 
 	"ride-hail/internal/deps"
+	"ride-hail/internal/services/ride"
 	"ride-hail/internal/shared/config"
+	"ride-hail/internal/shared/idempotency"
 	"ride-hail/pkg/group"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/sqlc"
 )
 
 // RideRun initializes and runs the Ride service.
 func RideRun(ctx context.Context, config config.Config) error {
+	return rideRun(ctx, config, nil)
+}
+
+// rideRun runs on broker, or on RabbitMQ when broker is nil
+func rideRun(ctx context.Context, config config.Config, broker mq.Broker) error {
 	infra, err := deps.NewInfraDeps(
-		deps.WithRabbit(ctx, config),
+		deps.WithBrokerOrRabbit(ctx, config, broker),
+		deps.WithTopology(mq.DefaultTopology()),
 		deps.WithPostgres(ctx, config),
 	)
 	if err != nil {
@@ -25,7 +36,9 @@ func RideRun(ctx context.Context, config config.Config) error {
 	}
 	app, err := deps.NewAppDeps(
 		deps.WithAuthService(infra),
-		deps.WithRideService(infra),
+		deps.WithRideService(infra, config),
+		deps.WithOutboxRelay(infra, config),
+		deps.WithMessageCleaner(infra, config),
 	)
 	if err != nil {
 		return err
@@ -43,6 +56,85 @@ func RideRun(ctx context.Context, config config.Config) error {
 
 	g, gCtx := group.WithContext(ctx)
 
+	wsManager := api.RideApi.GetWebsocketManager()
+	wsManager.StartWrite(ctx)
+
+	responses := ride.NewDriverResponseHandler(app.RideService, wsManager)
+	locations := ride.NewLocationHandler(app.RideService, wsManager)
+	statuses := ride.NewRideStatusHandler(app.RideService, wsManager)
+	sweeper := ride.NewTimeoutSweeper(app.RideService, wsManager, time.Duration(config.Ride.TimeoutSweepSeconds)*time.Second)
+
+	// guards skip redelivered and replayed messages, so a duplicated acceptance
+	// cannot match a ride twice
+	queries := sqlc.New(infra.Pool)
+	responsesGuard := idempotency.NewGuard(infra.Pool, queries, mq.DriverResponsesQueue)
+	statusesGuard := idempotency.NewGuard(infra.Pool, queries, mq.RideStatusQueue)
+
+	metrics := mq.NewMetrics()
+	standard := mq.StandardMiddleware(metrics, consumerTimeout)
+
+	consumers := mq.NewConsumerGroup()
+	consumers.Add(mq.NewConsumer(infra.Broker, mq.ConsumerConfig{
+		Handler:       standard(responsesGuard.Wrap(responses.Handle)),
+		Queue:         mq.DriverResponsesQueue,
+		ConsumerTag:   "ride-driver-responses",
+		PrefetchCount: 20,
+		Workers:       10,
+	}))
+	// a single worker keeps each driver's updates in the order they were sent
+	consumers.Add(mq.NewConsumer(infra.Broker, mq.ConsumerConfig{
+		Handler:       standard(locations.Handle),
+		Queue:         mq.LocationUpdatesRideQueue,
+		ConsumerTag:   "ride-location-updates",
+		PrefetchCount: 50,
+		Workers:       1,
+	}))
+
+	consumers.Add(mq.NewConsumer(infra.Broker, mq.ConsumerConfig{
+		Handler:       standard(statusesGuard.Wrap(statuses.Handle)),
+		Queue:         mq.RideStatusQueue,
+		ConsumerTag:   "ride-status",
+		PrefetchCount: 20,
+		Workers:       1,
+	}))
+
+	g.Go(func() error {
+		return consumers.StartAll(gCtx)
+	})
+
+	// lets every replica push to sockets held by any other
+	g.Go(func() error {
+		return wsManager.RunRelay(gCtx, server.NewBrokerRelay(infra.Broker, "ride-service"))
+	})
+
+	// passengers send no frames of their own yet; the router answers pings and
+	// rejects anything else, so their sockets never block on reads
+	g.Go(func() error {
+		server.NewRouter().Run(gCtx, wsManager)
+		return nil
+	})
+
+	g.Go(func() error {
+		metrics.Report(gCtx, consumerMetricsInterval)
+		return nil
+	})
+
+	// both services write to the outbox; the relay lock lets one instance send
+	g.Go(func() error {
+		app.OutboxRelay.Run(gCtx)
+		return nil
+	})
+
+	g.Go(func() error {
+		sweeper.Run(gCtx)
+		return nil
+	})
+
+	g.Go(func() error {
+		app.MessageCleaner.Run(gCtx)
+		return nil
+	})
+
 	g.Go(func() error {
 		if err := api.RideApi.Start(); err != nil && err != http.ErrServerClosed {
 			slog.Error("Ride API server error", slog.String("error", err.Error()))
@@ -71,6 +163,11 @@ func RideRun(ctx context.Context, config config.Config) error {
 
 		ctxWithTimeout, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancelShutdown()
+
+		if err := consumers.StopAll(ctxWithTimeout); err != nil {
+			slog.Error("failed to stop ride consumers", slog.String("error", err.Error()))
+		}
+
 		err := api.RideApi.StopServer(ctxWithTimeout)
 		if err != nil {
 			slog.Error("failed to stop Ride API server", slog.String("error", err.Error()))
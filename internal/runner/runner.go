@@ -32,6 +32,12 @@ func Run(ctx context.Context, config config.Config) error {
 		return RideRun(ctx, config)
 	case "admin":
 		return AdminRun(ctx, config)
+	case "standalone":
+		return StandaloneRun(ctx, config)
+	case "dlq":
+		return DLQRun(ctx, config, args[1:])
+	case "mq-init":
+		return MQInitRun(ctx, config, args[1:])
 	default:
 		printHelp()
 		return fmt.Errorf("unknown command: %s", command)
@@ -45,6 +51,9 @@ Commands:
   driver	Start the application in driver mode
   rider		Start the application in rider mode
   admin	 	Start the application in admin mode
+  standalone	Start the ride, driver and admin services in one process, without RabbitMQ
+  dlq		List, replay or purge dead-lettered messages (dlq list|replay|purge)
+  mq-init	Declare the RabbitMQ topology, or report drift with -verify
 
 Use "ride-hail [command] --help" for more information about a command.
 `
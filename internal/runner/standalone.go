@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"context"
+
+	"ride-hail/internal/shared/config"
+	"ride-hail/pkg/group"
+	"ride-hail/pkg/mq"
+)
+
+// StandaloneRun runs the ride, driver and admin services in one process on a
+// shared memory broker, so no RabbitMQ is needed. Messages in flight are lost
+// when the process exits, and there is no dead letter queue to inspect
+func StandaloneRun(ctx context.Context, config config.Config) error {
+	broker := mq.NewMemoryBroker()
+	defer broker.Close()
+
+	g, gCtx := group.WithContext(ctx)
+	g.Go(func() error {
+		return rideRun(gCtx, config, broker)
+	})
+	g.Go(func() error {
+		return driverRun(gCtx, config, broker)
+	})
+	g.Go(func() error {
+		return adminRun(gCtx, config, broker)
+	})
+
+	return g.Wait()
+}
@@ -15,9 +15,9 @@ type AdminApi struct {
 	server         http.Server
 }
 
-func NewAdminApi(authService *auth.AuthService, adminService *AdminService, port string) *AdminApi {
+func NewAdminApi(authService *auth.AuthService, adminService *AdminService, deadLetters DeadLetters, port string) *AdminApi {
 	authMiddleware := middleware.AuthMiddleware(*authService, core.UserRoleAdmin)
-	handler := newHandler(*adminService, authService)
+	handler := newHandler(*adminService, authService, deadLetters)
 
 	api := &AdminApi{
 		authMiddleware: authMiddleware,
@@ -38,6 +38,13 @@ func (a *AdminApi) Start() error {
 
 	mux.Handle("GET /admin/overview", chain(a.handler.overview))
 	mux.Handle("GET /admin/rides/active", chain(a.handler.active))
+
+	// without a dead letter queue, e.g. on a memory broker, the endpoints are not served
+	if a.handler.deadLetters != nil {
+		mux.Handle("GET /admin/dlq", chain(a.handler.listDeadLetters))
+		mux.Handle("POST /admin/dlq/replay", chain(a.handler.replayDeadLetters))
+		mux.Handle("POST /admin/dlq/purge", chain(a.handler.purgeDeadLetters))
+	}
 	a.server.Handler = mux
 	return a.server.ListenAndServe()
 }
@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"ride-hail/internal/middleware"
+	"ride-hail/pkg/mq"
+)
+
+// DeadLetters is the dead letter queue behind the /admin/dlq endpoints
+type DeadLetters interface {
+	List(ctx context.Context, filter mq.DeadLetterFilter) ([]mq.DeadLetter, error)
+	Replay(ctx context.Context, filter mq.DeadLetterFilter) (int, error)
+	Purge(ctx context.Context, filter mq.DeadLetterFilter) (int, error)
+}
+
+func (h handler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := mq.DeadLetterFilter{
+		Queue:         query.Get("queue"),
+		RoutingKey:    query.Get("routing_key"),
+		CorrelationID: query.Get("correlation_id"),
+		Limit:         50,
+	}
+	if ids := query["message_id"]; len(ids) > 0 {
+		filter.MessageIDs = ids
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err := parsePositiveInt(limitStr); err == nil && limit > 0 && limit <= 500 {
+			filter.Limit = limit
+		}
+	}
+
+	adminID, _ := middleware.GetUserIDFromContext(ctx)
+	slog.Info("admin listed dead letters",
+		slog.String("admin_id", adminID.String()),
+		slog.String("action", "list_dead_letters"),
+		slog.String("queue", filter.Queue))
+
+	letters, err := h.deadLetters.List(ctx, filter)
+	if err != nil {
+		slog.Error("Failed to list dead letters",
+			slog.String("admin_id", adminID.String()),
+			slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := DeadLettersResponse{
+		Messages: make([]DeadLetterResponse, 0, len(letters)),
+		Count:    len(letters),
+	}
+	for _, letter := range letters {
+		response.Messages = append(response.Messages, NewDeadLetterResponse(letter))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h handler) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	h.deadLetterAction(w, r, "replay", h.deadLetters.Replay)
+}
+
+func (h handler) purgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	h.deadLetterAction(w, r, "purge", h.deadLetters.Purge)
+}
+
+func (h handler) deadLetterAction(w http.ResponseWriter, r *http.Request, action string, apply func(context.Context, mq.DeadLetterFilter) (int, error)) {
+	ctx := r.Context()
+
+	var input DeadLetterActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	filter, err := input.Filter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Audit log: dead letters are gone or redelivered after this
+	adminID, _ := middleware.GetUserIDFromContext(ctx)
+	count, err := apply(ctx, filter)
+	if err != nil {
+		slog.Error("Failed to "+action+" dead letters",
+			slog.String("admin_id", adminID.String()),
+			slog.Int("count", count),
+			slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("admin changed dead letters",
+		slog.String("admin_id", adminID.String()),
+		slog.String("action", action+"_dead_letters"),
+		slog.Int("count", count),
+		slog.String("queue", filter.Queue),
+		slog.Int("selected", len(filter.MessageIDs)))
+
+	writeJSON(w, http.StatusOK, DeadLetterActionResponse{Action: action, Count: count})
+}
+
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode response", slog.String("error", err.Error()))
+	}
+}
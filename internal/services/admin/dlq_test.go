@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ride-hail/pkg/mq"
+)
+
+type fakeDeadLetters struct {
+	letters []mq.DeadLetter
+	filter  mq.DeadLetterFilter
+}
+
+func (f *fakeDeadLetters) List(ctx context.Context, filter mq.DeadLetterFilter) ([]mq.DeadLetter, error) {
+	f.filter = filter
+	return f.letters, nil
+}
+
+func (f *fakeDeadLetters) Replay(ctx context.Context, filter mq.DeadLetterFilter) (int, error) {
+	f.filter = filter
+	return len(filter.MessageIDs), nil
+}
+
+func (f *fakeDeadLetters) Purge(ctx context.Context, filter mq.DeadLetterFilter) (int, error) {
+	f.filter = filter
+	return 0, nil
+}
+
+func TestListDeadLetters(t *testing.T) {
+	dlq := &fakeDeadLetters{letters: []mq.DeadLetter{
+		{MessageID: "m1", RoutingKey: "ride.request.XL", Queue: "driver_matching", Body: []byte(`{"ride_id":"r1"}`)},
+		{MessageID: "m2", RoutingKey: "ride.status.MATCHED", Queue: "ride_status", Body: []byte("not json")},
+	}}
+	h := newHandler(AdminService{}, nil, dlq)
+
+	rec := httptest.NewRecorder()
+	h.listDeadLetters(rec, httptest.NewRequest(http.MethodGet, "/admin/dlq?queue=driver_matching&limit=10", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if dlq.filter.Queue != "driver_matching" || dlq.filter.Limit != 10 {
+		t.Errorf("Unexpected filter %+v", dlq.filter)
+	}
+
+	var response DeadLettersResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Count != 2 || string(response.Messages[0].Payload) != `{"ride_id":"r1"}` || string(response.Messages[1].Payload) != `"not json"` {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+func TestDeadLetterAction_RequiresSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "nothing selected", body: `{}`, wantCode: http.StatusBadRequest},
+		{name: "all", body: `{"all":true}`, wantCode: http.StatusOK},
+		{name: "selected ids", body: `{"message_ids":["m1","m2"]}`, wantCode: http.StatusOK},
+		{name: "negative limit", body: `{"queue":"ride_status","limit":-1}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHandler(AdminService{}, nil, &fakeDeadLetters{})
+			rec := httptest.NewRecorder()
+			h.replayDeadLetters(rec, httptest.NewRequest(http.MethodPost, "/admin/dlq/replay", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("Expected %d, got %d", tt.wantCode, rec.Code)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package admin
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ride-hail/pkg/mq"
+)
 
 type OverviewResponse struct {
 	Timestamp          time.Time      `json:"timestamp"`
@@ -18,6 +24,8 @@ type SystemMetrics struct {
 	AverageWaitTimeMinutes float64 `json:"average_wait_time_minutes"`
 	AverageRideDurationMin float64 `json:"average_ride_duration_minutes"`
 	CancellationRate       float64 `json:"cancellation_rate"`
+	OutboxBacklog          int     `json:"outbox_backlog"`
+	OutboxDead             int     `json:"outbox_dead"`
 }
 
 type Hotspot struct {
@@ -57,3 +65,79 @@ type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
 }
+
+type DeadLettersResponse struct {
+	Messages []DeadLetterResponse `json:"messages"`
+	Count    int                  `json:"count"`
+}
+
+type DeadLetterResponse struct {
+	MessageID     string          `json:"message_id"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Exchange      string          `json:"exchange"`
+	RoutingKey    string          `json:"routing_key"`
+	Queue         string          `json:"queue"`
+	Reason        string          `json:"reason"`
+	LastError     string          `json:"last_error,omitempty"`
+	Retries       int             `json:"retries"`
+	Deaths        []mq.Death      `json:"x_death"`
+	Timestamp     *time.Time      `json:"timestamp,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// NewDeadLetterResponse shows the payload as JSON when it is JSON and as a
+// string otherwise
+func NewDeadLetterResponse(letter mq.DeadLetter) DeadLetterResponse {
+	response := DeadLetterResponse{
+		MessageID:     letter.MessageID,
+		CorrelationID: letter.CorrelationID,
+		Exchange:      letter.Exchange,
+		RoutingKey:    letter.RoutingKey,
+		Queue:         letter.Queue,
+		Reason:        letter.Reason,
+		LastError:     letter.LastError,
+		Retries:       letter.Retries,
+		Deaths:        letter.Deaths,
+		Payload:       letter.Body,
+	}
+	if !letter.Timestamp.IsZero() {
+		response.Timestamp = &letter.Timestamp
+	}
+	if !json.Valid(letter.Body) {
+		response.Payload, _ = json.Marshal(string(letter.Body))
+	}
+	return response
+}
+
+// DeadLetterActionRequest selects the dead letters to replay or purge. A
+// request selecting nothing must set All
+type DeadLetterActionRequest struct {
+	MessageIDs    []string `json:"message_ids,omitempty"`
+	Queue         string   `json:"queue,omitempty"`
+	RoutingKey    string   `json:"routing_key,omitempty"`
+	CorrelationID string   `json:"correlation_id,omitempty"`
+	Limit         int      `json:"limit,omitempty"`
+	All           bool     `json:"all,omitempty"`
+}
+
+func (r DeadLetterActionRequest) Filter() (mq.DeadLetterFilter, error) {
+	filter := mq.DeadLetterFilter{
+		MessageIDs:    r.MessageIDs,
+		Queue:         r.Queue,
+		RoutingKey:    r.RoutingKey,
+		CorrelationID: r.CorrelationID,
+		Limit:         r.Limit,
+	}
+	if r.Limit < 0 {
+		return filter, fmt.Errorf("limit must not be negative")
+	}
+	if filter.IsEmpty() && !r.All {
+		return filter, fmt.Errorf("select messages with message_ids or a filter, or set all")
+	}
+	return filter, nil
+}
+
+type DeadLetterActionResponse struct {
+	Action string `json:"action"`
+	Count  int    `json:"count"`
+}
@@ -14,14 +14,16 @@ import (
 )
 
 type handler struct {
-	service AdminService
-	auth    *auth.AuthService
+	service     AdminService
+	auth        *auth.AuthService
+	deadLetters DeadLetters
 }
 
-func newHandler(service AdminService, auth *auth.AuthService) *handler {
+func newHandler(service AdminService, auth *auth.AuthService, deadLetters DeadLetters) *handler {
 	return &handler{
-		service: service,
-		auth:    auth,
+		service:     service,
+		auth:        auth,
+		deadLetters: deadLetters,
 	}
 }
 
@@ -69,6 +69,12 @@ func (s *AdminService) GetSystemMetrics(ctx context.Context) (*SystemMetrics, er
 		return nil, fmt.Errorf("failed to get cancellation rate: %w", err)
 	}
 
+	// Query outbox messages still to publish and those given up on
+	outbox, err := s.queries.GetOutboxBacklog(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox backlog: %w", err)
+	}
+
 	// Convert types
 	revenueFloat := numericToFloat64(todayRevenue)
 	waitTimeFloat := numericToFloat64(avgWaitTime)
@@ -90,6 +96,8 @@ func (s *AdminService) GetSystemMetrics(ctx context.Context) (*SystemMetrics, er
 		AverageWaitTimeMinutes: waitTimeFloat,
 		AverageRideDurationMin: durationFloat,
 		CancellationRate:       cancellationFloat,
+		OutboxBacklog:          int(outbox.Pending),
+		OutboxDead:             int(outbox.Dead),
 	}
 
 	return metrics, nil
@@ -18,8 +18,8 @@ type DriverApi struct {
 	server           *http.Server
 }
 
-func NewDriverApi(authService *auth.AuthService, driverService *driver.DriverService, port string) *DriverApi {
-	wsManager := server.NewManager()
+func NewDriverApi(authService *auth.AuthService, driverService *driver.DriverService, port string, socketConfig server.ManagerConfig) *DriverApi {
+	wsManager := server.NewManager(socketConfig)
 	authMiddleware := middleware.AuthMiddleware(*authService, core.UserRoleDriver)
 	handler := newHandler(driverService, authService, wsManager)
 
@@ -45,9 +45,12 @@ func (d *DriverApi) Start() error {
 	mux.Handle("POST /drivers/{driver_id}/online", chain(d.handler.online))
 	mux.Handle("POST /drivers/{driver_id}/offline", chain(d.handler.offline))
 	mux.Handle("POST /drivers/{driver_id}/location", chain(d.handler.location))
+	mux.Handle("POST /drivers/{driver_id}/en-route", chain(d.handler.enRoute))
+	mux.Handle("POST /drivers/{driver_id}/arrived", chain(d.handler.arrived))
 	mux.Handle("POST /drivers/{driver_id}/start", chain(d.handler.start))
 	mux.Handle("POST /drivers/{driver_id}/complete", chain(d.handler.complete))
-	mux.Handle("GET /ws/drivers/{id}", chain(d.handler.websocket))
+	// sockets authenticate themselves, see server.Manager.ServeWS
+	mux.Handle("GET /ws/drivers/{id}", middleware.LoggingMiddleware(d.handler.websocket))
 
 	d.server.Handler = mux
 	return d.server.ListenAndServe()
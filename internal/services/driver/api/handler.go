@@ -1,14 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http"
+
 	"ride-hail/internal/auth"
 	"ride-hail/internal/middleware"
 	"ride-hail/internal/services/driver"
+	"ride-hail/internal/services/driver/models"
 	"ride-hail/internal/shared/core"
+	appErrors "ride-hail/internal/shared/errors"
 	"ride-hail/pkg/server"
+	"ride-hail/pkg/uuid"
 )
 
 type handler struct {
@@ -75,47 +82,167 @@ func (h handler) login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) online(w http.ResponseWriter, r *http.Request) {
-	// claims, err := middleware.GetClaimsFromContext(r.Context())
-	// if err != nil {
-	// 	http.Error(w, "unauthorized: invalid user context", http.StatusUnauthorized)
-	// 	return
-	// }
+	driverID, ok := pathDriverID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.OnlineRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.DriverID = driverID
+
+	session, err := h.service.Online(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
+	writeJSON(w, http.StatusOK, models.OnlineResponse{
+		Status:    core.DriverStatusAvailable.String(),
+		SessionID: session.String(),
+		Message:   "You are now online and ready to accept rides",
+	})
 }
 
 func (h *handler) offline(w http.ResponseWriter, r *http.Request) {
+	driverID, ok := pathDriverID(w, r)
+	if !ok {
+		return
+	}
+
+	out, err := h.service.Offline(r.Context(), driverID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.OfflineResponse{
+		Status:    core.DriverStatusOffline.String(),
+		SessionID: out.SessionID,
+		SessionSummary: &models.SessionSummary{
+			DurationHours:  out.DurationHours,
+			RidesCompleted: out.RidesCompleted,
+			Earnings:       out.Earnings,
+		},
+		Message: "You are now offline",
+	})
 }
 
 func (h *handler) location(w http.ResponseWriter, r *http.Request) {
+	driverID, ok := pathDriverID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.LocationUpdateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.DriverID = driverID
 
+	out, err := h.service.Location(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.LocationUpdateResponse{
+		CoordinateID: out.CoordinateID,
+		UpdatedAt:    out.UpdatedAt,
+	})
 }
 
-func (h *handler) start(w http.ResponseWriter, r *http.Request) {
+func (h *handler) enRoute(w http.ResponseWriter, r *http.Request) {
+	h.progress(w, r, h.service.EnRoute, "Passenger has been notified that you are on the way")
+}
 
+func (h *handler) arrived(w http.ResponseWriter, r *http.Request) {
+	h.progress(w, r, h.service.Arrived, "Passenger has been notified that you have arrived")
 }
 
-func (h *handler) complete(w http.ResponseWriter, r *http.Request) {
+func (h *handler) progress(w http.ResponseWriter, r *http.Request, transition func(context.Context, models.RideProgressRequest) (models.RideProgressOutput, error), message string) {
+	driverID, ok := pathDriverID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.RideProgressRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.DriverID = driverID
+
+	out, err := transition(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
+	writeJSON(w, http.StatusOK, models.RideProgressResponse{
+		RideID:    out.RideID,
+		Status:    out.Status,
+		UpdatedAt: out.UpdatedAt,
+		Message:   message,
+	})
 }
 
-func (h *handler) websocket(w http.ResponseWriter, r *http.Request) {
-	claims, ok := r.Context().Value(middleware.UserContextKey).(auth.JWTClaims)
+func (h *handler) start(w http.ResponseWriter, r *http.Request) {
+	driverID, ok := pathDriverID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.StartRideRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.DriverID = driverID
+
+	out, err := h.service.Start(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.StartRideResponse{
+		RideID:    out.RideID,
+		Status:    out.Status,
+		StartedAt: out.StartedAt,
+		Message:   "Ride started successfully",
+	})
+}
+
+func (h *handler) complete(w http.ResponseWriter, r *http.Request) {
+	driverID, ok := pathDriverID(w, r)
 	if !ok {
-		http.Error(w, "unauthorized: invalid user context", http.StatusUnauthorized)
 		return
 	}
 
-	driverID := r.PathValue("id")
-	if driverID == "" {
-		http.Error(w, "driver_id is required", http.StatusBadRequest)
+	var req models.CompleteRideRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
-	if claims.UserID.String() != driverID {
-		http.Error(w, "forbidden: cannot open websocket for another driver", http.StatusForbidden)
+	req.DriverID = driverID
+
+	out, err := h.service.Complete(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	h.wsManager.ServeWS(w, r)
+	writeJSON(w, http.StatusOK, models.CompleteRideResponse{
+		RideID:         out.RideID,
+		Status:         out.Status,
+		CompletedAt:    out.CompletedAt,
+		DriverEarnings: out.DriverEarnings,
+		Message:        "Ride completed successfully",
+	})
+}
+
+func (h *handler) websocket(w http.ResponseWriter, r *http.Request) {
+	h.wsManager.ServeWS(w, r, middleware.SocketAuth(*h.auth, core.UserRoleDriver))
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -127,3 +254,48 @@ func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
 	bytes, _ := json.Marshal(payload)
 	_, _ = w.Write(bytes)
 }
+
+// pathDriverID returns the {driver_id} path value after checking it belongs to the caller
+func pathDriverID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, appErrors.NewUnauthorizedError("invalid user context"))
+		return uuid.Nil, false
+	}
+
+	driverID, err := uuid.FromString(r.PathValue("driver_id"))
+	if err != nil {
+		writeError(w, appErrors.NewInvalidInputError("invalid driver_id format"))
+		return uuid.Nil, false
+	}
+	if driverID != userID {
+		writeError(w, appErrors.NewForbiddenError("cannot act on behalf of another driver"))
+		return uuid.Nil, false
+	}
+
+	return driverID, true
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		writeError(w, appErrors.NewInvalidInputError("invalid json"))
+		return false
+	}
+	return true
+}
+
+// writeError maps AppErrors to their status code and hides anything else behind a 500
+func writeError(w http.ResponseWriter, err error) {
+	var appErr *appErrors.AppError
+	if !errors.As(err, &appErr) {
+		slog.Error("Driver request failed", "error", err)
+		appErr = appErrors.NewInternalError("internal server error", err)
+	}
+
+	status, body := appErr.ToHTTPResponse("")
+	writeJSON(w, status, models.ErrorResponse{
+		Error:   body.Type,
+		Message: body.Message,
+	})
+}
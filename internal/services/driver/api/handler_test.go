@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ride-hail/internal/auth"
+	"ride-hail/internal/middleware"
+	"ride-hail/internal/services/driver/models"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/pkg/uuid"
+)
+
+func requestAs(userID uuid.UUID, pathDriverID string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/drivers/"+pathDriverID+"/online", nil)
+	req.SetPathValue("driver_id", pathDriverID)
+	ctx := context.WithValue(req.Context(), middleware.UserContextKey, auth.JWTClaims{UserID: userID})
+	return req.WithContext(ctx)
+}
+
+func TestPathDriverID(t *testing.T) {
+	driverID := uuid.New()
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantOK     bool
+		wantStatus int
+	}{
+		{
+			name:   "matching driver",
+			req:    requestAs(driverID, driverID.String()),
+			wantOK: true,
+		},
+		{
+			name:       "another driver",
+			req:        requestAs(driverID, uuid.New().String()),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "malformed driver id",
+			req:        requestAs(driverID, "not-a-uuid"),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing claims",
+			req:        httptest.NewRequest(http.MethodPost, "/drivers/x/online", nil),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			got, ok := pathDriverID(rec, tt.req)
+
+			if ok != tt.wantOK {
+				t.Fatalf("Expected ok=%v, got %v", tt.wantOK, ok)
+			}
+			if ok {
+				if got != driverID {
+					t.Errorf("Expected driver %s, got %s", driverID.String(), got.String())
+				}
+				return
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string
+	}{
+		{
+			name:       "conflict",
+			err:        appErrors.NewConflictError("driver already online"),
+			wantStatus: http.StatusConflict,
+			wantType:   string(appErrors.ErrorTypeConflict),
+		},
+		{
+			name:       "wrapped app error",
+			err:        errors.Join(errors.New("context"), appErrors.NewNotFoundError("ride")),
+			wantStatus: http.StatusNotFound,
+			wantType:   string(appErrors.ErrorTypeNotFound),
+		},
+		{
+			name:       "plain error",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantType:   string(appErrors.ErrorTypeInternalError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			var body models.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected JSON body, got %v", err)
+			}
+			if body.Error != tt.wantType {
+				t.Errorf("Expected error type %s, got %s", tt.wantType, body.Error)
+			}
+			if tt.wantStatus == http.StatusInternalServerError && body.Message != "internal server error" {
+				t.Errorf("Expected internal details to be hidden, got %q", body.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package driver
+
+import (
+	"sync"
+
+	"ride-hail/pkg/uuid"
+)
+
+// ArrivalDetection configures when location updates auto-mark a ride ARRIVED.
+// RadiusKm is also how close to the pickup the driver must be to report
+// arrival or start the ride
+type ArrivalDetection struct {
+	RadiusKm float64
+	Updates  int // consecutive updates within RadiusKm of the pickup
+}
+
+type arrivalStreak struct {
+	rideID uuid.UUID
+	count  int
+}
+
+// arrivalTracker counts consecutive in-radius location updates per driver so a
+// single noisy GPS fix near the pickup does not mark the ride ARRIVED
+type arrivalTracker struct {
+	mu      sync.Mutex
+	config  ArrivalDetection
+	streaks map[uuid.UUID]arrivalStreak
+}
+
+func newArrivalTracker(config ArrivalDetection) *arrivalTracker {
+	if config.Updates < 1 {
+		config.Updates = 1
+	}
+	return &arrivalTracker{
+		config:  config,
+		streaks: make(map[uuid.UUID]arrivalStreak),
+	}
+}
+
+func (t *arrivalTracker) within(distanceKm float64) bool {
+	return distanceKm <= t.config.RadiusKm
+}
+
+// observe records one update for the driver's ride and reports whether the
+// streak has reached the configured number of updates
+func (t *arrivalTracker) observe(driverID, rideID uuid.UUID, distanceKm float64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.within(distanceKm) {
+		delete(t.streaks, driverID)
+		return false
+	}
+
+	streak := t.streaks[driverID]
+	if streak.rideID != rideID {
+		streak = arrivalStreak{rideID: rideID}
+	}
+	streak.count++
+	t.streaks[driverID] = streak
+
+	return streak.count >= t.config.Updates
+}
+
+func (t *arrivalTracker) reset(driverID uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.streaks, driverID)
+}
@@ -0,0 +1,47 @@
+package driver
+
+import (
+	"testing"
+
+	"ride-hail/pkg/uuid"
+)
+
+func TestArrivalTracker_RequiresConsecutiveUpdates(t *testing.T) {
+	tracker := newArrivalTracker(ArrivalDetection{RadiusKm: 0.1, Updates: 2})
+	driverID, rideID := uuid.New(), uuid.New()
+
+	if tracker.observe(driverID, rideID, 0.05) {
+		t.Fatal("Expected a single update within the radius not to count as arrival")
+	}
+	if tracker.observe(driverID, rideID, 0.3) {
+		t.Fatal("Expected an update outside the radius not to count as arrival")
+	}
+	if tracker.observe(driverID, rideID, 0.05) {
+		t.Fatal("Expected the streak to restart after leaving the radius")
+	}
+	if !tracker.observe(driverID, rideID, 0.08) {
+		t.Error("Expected the second consecutive update within the radius to count as arrival")
+	}
+}
+
+func TestArrivalTracker_StreakIsPerRide(t *testing.T) {
+	tracker := newArrivalTracker(ArrivalDetection{RadiusKm: 0.1, Updates: 2})
+	driverID := uuid.New()
+
+	tracker.observe(driverID, uuid.New(), 0.01)
+	if tracker.observe(driverID, uuid.New(), 0.01) {
+		t.Error("Expected updates for a different ride not to extend the streak")
+	}
+
+	tracker.reset(driverID)
+	if tracker.observe(driverID, uuid.New(), 0.01) {
+		t.Error("Expected reset to clear the streak")
+	}
+}
+
+func TestArrivalTracker_AtLeastOneUpdate(t *testing.T) {
+	tracker := newArrivalTracker(ArrivalDetection{RadiusKm: 0.1})
+	if !tracker.observe(uuid.New(), uuid.New(), 0.1) {
+		t.Error("Expected an unset update count to fall back to a single update")
+	}
+}
@@ -0,0 +1,467 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ride-hail/internal/services/driver/models"
+	"ride-hail/internal/shared/core"
+	"ride-hail/internal/shared/driverinfo"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/pkg/geo"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+)
+
+const (
+	maxMatchCandidates = 10
+	distanceWeight     = 0.7
+	ratingWeight       = 0.3
+	minDriverRating    = 1.0
+	maxDriverRating    = 5.0
+	expiredOfferTTL    = 5 * time.Minute
+)
+
+var (
+	ErrOfferNotFound = appErrors.NewNotFoundError("ride offer")
+	ErrOfferExpired  = appErrors.NewConflictError("ride offer has expired")
+	ErrOfferMismatch = appErrors.NewInvalidInputError("response does not match the active offer")
+
+	errDriverHasOffer = errors.New("driver already has a pending offer")
+)
+
+// OfferResponse is a driver's answer to a ride offer
+type OfferResponse struct {
+	Location *mq.LocationCoordinates
+	OfferID  string
+	Reason   string
+	RideID   uuid.UUID
+	DriverID uuid.UUID
+	Accepted bool
+}
+
+type offer struct {
+	ID        string
+	RideID    uuid.UUID
+	DriverID  uuid.UUID
+	ExpiresAt time.Time
+	response  chan OfferResponse
+}
+
+// offerRegistry tracks the single live offer each driver may hold, and remembers
+// recently expired offers so late responses can be told apart from bogus ones
+type offerRegistry struct {
+	mu       sync.Mutex
+	byDriver map[uuid.UUID]*offer
+	expired  map[string]time.Time
+	origin   string // the replica whose matcher waits on the offers, see offerOrigin
+}
+
+func newOfferRegistry(origin string) *offerRegistry {
+	return &offerRegistry{
+		byDriver: make(map[uuid.UUID]*offer),
+		expired:  make(map[string]time.Time),
+		origin:   origin,
+	}
+}
+
+func (r *offerRegistry) open(rideID, driverID uuid.UUID, expiresAt time.Time) (*offer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byDriver[driverID]; exists {
+		return nil, false
+	}
+
+	id := fmt.Sprintf("offer_%s", uuid.New().String())
+	if r.origin != "" {
+		id = fmt.Sprintf("offer_%s_%s", r.origin, uuid.New().String())
+	}
+	o := &offer{
+		ID:        id,
+		RideID:    rideID,
+		DriverID:  driverID,
+		ExpiresAt: expiresAt,
+		response:  make(chan OfferResponse, 1),
+	}
+	r.byDriver[driverID] = o
+	return o, true
+}
+
+// offerOrigin is the replica that made offerID, or "" for an offer ID that
+// names none
+func offerOrigin(offerID string) string {
+	parts := strings.Split(strings.TrimPrefix(offerID, "offer_"), "_")
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+func (r *offerRegistry) remove(o *offer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, exists := r.byDriver[o.DriverID]; exists && current == o {
+		delete(r.byDriver, o.DriverID)
+	}
+}
+
+func (r *offerRegistry) expire(o *offer, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, exists := r.byDriver[o.DriverID]; exists && current == o {
+		delete(r.byDriver, o.DriverID)
+	}
+	r.expired[o.ID] = now
+
+	for id, expiredAt := range r.expired {
+		if now.Sub(expiredAt) > expiredOfferTTL {
+			delete(r.expired, id)
+		}
+	}
+}
+
+func (r *offerRegistry) resolve(resp OfferResponse, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	o, exists := r.byDriver[resp.DriverID]
+	if !exists {
+		if _, late := r.expired[resp.OfferID]; late {
+			return ErrOfferExpired
+		}
+		return ErrOfferNotFound
+	}
+	if o.ID != resp.OfferID || o.RideID != resp.RideID {
+		return ErrOfferMismatch
+	}
+	if now.After(o.ExpiresAt) {
+		return ErrOfferExpired
+	}
+
+	delete(r.byDriver, resp.DriverID)
+	o.response <- resp
+	return nil
+}
+
+type candidate struct {
+	DriverID   uuid.UUID
+	DistanceKm float64
+	Rating     float64
+	Latitude   float64
+	Longitude  float64
+	score      float64
+}
+
+// rankCandidates orders drivers by a weighted score of pickup distance and rating,
+// lower scores first. radiusKm must be positive
+func rankCandidates(candidates []candidate, radiusKm float64) []candidate {
+	ranked := make([]candidate, len(candidates))
+	copy(ranked, candidates)
+
+	for i := range ranked {
+		rating := ranked[i].Rating
+		if rating < minDriverRating {
+			rating = minDriverRating
+		}
+		if rating > maxDriverRating {
+			rating = maxDriverRating
+		}
+
+		distanceScore := ranked[i].DistanceKm / radiusKm
+		ratingScore := (maxDriverRating - rating) / (maxDriverRating - minDriverRating)
+		ranked[i].score = distanceWeight*distanceScore + ratingWeight*ratingScore
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score < ranked[j].score
+	})
+
+	return ranked
+}
+
+// MatchingDefaults apply to ride requests that carry no radius or offer timeout
+type MatchingDefaults struct {
+	RadiusKm     float64
+	OfferTimeout time.Duration
+}
+
+// Matcher turns ride requests from the driver_matching queue into sequential
+// WebSocket offers to nearby drivers
+type Matcher struct {
+	service  *DriverService
+	manager  *server.Manager
+	offers   *offerRegistry
+	defaults MatchingDefaults
+}
+
+func NewMatcher(service *DriverService, manager *server.Manager, defaults MatchingDefaults) *Matcher {
+	var origin string
+	if manager != nil {
+		origin = manager.InstanceID()
+	}
+	return &Matcher{
+		service:  service,
+		manager:  manager,
+		offers:   newOfferRegistry(origin),
+		defaults: defaults,
+	}
+}
+
+// Respond delivers a driver's answer to the matcher waiting on their live offer
+func (m *Matcher) Respond(resp OfferResponse) error {
+	return m.offers.resolve(resp, time.Now())
+}
+
+// HandleRideRequest is the mq.MessageHandler for the driver_matching queue
+func (m *Matcher) HandleRideRequest(ctx context.Context, message mq.Message) error {
+	req, err := mq.DecodeAs[mq.RideRequestMessage](message)
+	if err != nil {
+		return fmt.Errorf("invalid ride request: %w", err)
+	}
+
+	rideID, err := uuid.FromString(req.RideID)
+	if err != nil {
+		return mq.Permanent(fmt.Errorf("invalid ride_id %q: %w", req.RideID, err))
+	}
+
+	radiusKm := req.MaxDistanceKm
+	if radiusKm <= 0 {
+		radiusKm = m.defaults.RadiusKm
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = m.defaults.OfferTimeout
+	}
+
+	rows, err := m.service.queries.FindNearbyDrivers(ctx, sqlc.FindNearbyDriversParams{
+		Longitude:   req.PickupLocation.Longitude,
+		Latitude:    req.PickupLocation.Latitude,
+		VehicleType: &req.VehicleType,
+		RadiusKm:    radiusKm,
+		MaxResults:  maxMatchCandidates,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find nearby drivers: %w", err)
+	}
+
+	candidates := make([]candidate, 0, len(rows))
+	for _, row := range rows {
+		candidates = append(candidates, candidate{
+			DriverID:   row.ID,
+			DistanceKm: row.DistanceKm,
+			Rating:     sqlc.FloatFromNumeric(row.Rating),
+			Latitude:   sqlc.FloatFromNumeric(row.Latitude),
+			Longitude:  sqlc.FloatFromNumeric(row.Longitude),
+		})
+	}
+
+	slog.InfoContext(ctx, "Matching ride",
+		"ride_id", req.RideID,
+		"vehicle_type", req.VehicleType,
+		"candidates", len(candidates),
+		"correlation_id", message.CorrelationID,
+	)
+
+	for _, c := range rankCandidates(candidates, radiusKm) {
+		// an offer to a driver without a socket would only wait out its timeout.
+		// A driver on another replica answers there, and the answer is
+		// forwarded back here by the offer ID
+		if !m.manager.Connected(c.DriverID) {
+			slog.DebugContext(ctx, "Skipping driver without a websocket", "ride_id", req.RideID, "driver_id", c.DriverID.String())
+			continue
+		}
+
+		requested, err := m.rideStillRequested(ctx, rideID)
+		if err != nil {
+			return err
+		}
+		if !requested {
+			slog.InfoContext(ctx, "Ride no longer awaiting a driver, stopping matching", "ride_id", req.RideID)
+			return nil
+		}
+
+		resp, err := m.offer(ctx, req, rideID, c, timeout)
+		switch {
+		case errors.Is(err, errDriverHasOffer):
+			slog.DebugContext(ctx, "Skipping driver with pending offer", "ride_id", req.RideID, "driver_id", c.DriverID.String())
+			continue
+		case errors.Is(err, ErrOfferExpired):
+			slog.InfoContext(ctx, "Ride offer timed out", "ride_id", req.RideID, "driver_id", c.DriverID.String())
+			continue
+		case err != nil:
+			return err
+		}
+
+		if !resp.Accepted {
+			if err := m.publishResponse(ctx, req, c, resp); err != nil {
+				slog.ErrorContext(ctx, "Failed to publish declined ride offer", "ride_id", req.RideID, "error", err)
+			}
+			slog.InfoContext(ctx, "Ride offer declined",
+				"ride_id", req.RideID,
+				"driver_id", c.DriverID.String(),
+				"reason", resp.Reason,
+			)
+			continue
+		}
+
+		// claim the driver before the ride service hears of the acceptance, so a
+		// driver who went offline or was matched elsewhere meanwhile is never assigned
+		claimed, err := m.transitionDriver(ctx, c.DriverID, core.DriverStatusAvailable, core.DriverStatusBusy)
+		if err != nil {
+			return fmt.Errorf("failed to mark driver busy: %w", err)
+		}
+		if !claimed {
+			slog.InfoContext(ctx, "Accepting driver no longer available", "ride_id", req.RideID, "driver_id", c.DriverID.String())
+			continue
+		}
+
+		if err := m.publishResponse(ctx, req, c, resp); err != nil {
+			if _, relErr := m.transitionDriver(ctx, c.DriverID, core.DriverStatusBusy, core.DriverStatusAvailable); relErr != nil {
+				slog.ErrorContext(ctx, "Failed to release driver after publish failure", "driver_id", c.DriverID.String(), "error", relErr)
+			}
+			return err
+		}
+
+		slog.InfoContext(ctx, "Ride offer accepted", "ride_id", req.RideID, "driver_id", c.DriverID.String())
+		return nil
+	}
+
+	slog.WarnContext(ctx, "No driver accepted ride", "ride_id", req.RideID, "candidates", len(candidates))
+	return nil
+}
+
+// offer sends a ride offer to one driver and blocks until they answer or the offer expires
+func (m *Matcher) offer(ctx context.Context, req mq.RideRequestMessage, rideID uuid.UUID, c candidate, timeout time.Duration) (OfferResponse, error) {
+	expiresAt := time.Now().Add(timeout)
+
+	o, ok := m.offers.open(rideID, c.DriverID, expiresAt)
+	if !ok {
+		return OfferResponse{}, errDriverHasOffer
+	}
+	defer m.offers.remove(o)
+
+	rideDistanceKm := geo.Distance(
+		req.PickupLocation.Latitude, req.PickupLocation.Longitude,
+		req.DestinationLocation.Latitude, req.DestinationLocation.Longitude,
+	)
+
+	payload, err := json.Marshal(models.RideOfferMessage{
+		Type:       models.MessageTypeRideOffer,
+		OfferID:    o.ID,
+		RideID:     req.RideID,
+		RideNumber: req.RideNumber,
+		PickupLocation: models.WsLocation{
+			Latitude:  req.PickupLocation.Latitude,
+			Longitude: req.PickupLocation.Longitude,
+			Address:   req.PickupLocation.Address,
+		},
+		DestinationLocation: models.WsLocation{
+			Latitude:  req.DestinationLocation.Latitude,
+			Longitude: req.DestinationLocation.Longitude,
+			Address:   req.DestinationLocation.Address,
+		},
+		EstimatedFare:                req.EstimatedFare,
+		DriverEarnings:               req.EstimatedFare * driverEarningsRate,
+		DistanceToPickupKm:           c.DistanceKm,
+		EstimatedRideDurationMinutes: int(rideDistanceKm / defaultSpeedKmh * 60),
+		ExpiresAt:                    expiresAt,
+	})
+	if err != nil {
+		return OfferResponse{}, fmt.Errorf("failed to marshal ride offer: %w", err)
+	}
+
+	select {
+	case m.manager.WriteChannel() <- server.ResponseWs{Payload: payload, ConsumerID: c.DriverID}:
+	case <-ctx.Done():
+		return OfferResponse{}, ctx.Err()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-o.response:
+		return resp, nil
+	case <-timer.C:
+		m.offers.expire(o, time.Now())
+		return OfferResponse{}, ErrOfferExpired
+	case <-ctx.Done():
+		return OfferResponse{}, ctx.Err()
+	}
+}
+
+func (m *Matcher) rideStillRequested(ctx context.Context, rideID uuid.UUID) (bool, error) {
+	ride, err := m.service.queries.GetRideByID(ctx, rideID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load ride: %w", err)
+	}
+	return ride.Status != nil && *ride.Status == core.RideStatusRequested.String(), nil
+}
+
+// transitionDriver moves the driver from one status to another, reporting
+// false when the driver was no longer in the expected status
+func (m *Matcher) transitionDriver(ctx context.Context, driverID uuid.UUID, from, to core.DriverStatus) (bool, error) {
+	rows, err := m.service.queries.TransitionDriverStatus(ctx, sqlc.TransitionDriverStatusParams{
+		NewStatus:  to.String(),
+		ID:         driverID,
+		FromStatus: from.String(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// publishResponse forwards the driver's answer to the ride service on driver_topic
+func (m *Matcher) publishResponse(ctx context.Context, req mq.RideRequestMessage, c candidate, resp OfferResponse) error {
+	now := time.Now().UTC()
+	message := mq.DriverResponseMessage{
+		RespondedAt:   now,
+		RideID:        req.RideID,
+		DriverID:      c.DriverID.String(),
+		Reason:        resp.Reason,
+		CorrelationID: req.CorrelationID,
+		Accepted:      resp.Accepted,
+	}
+
+	if resp.Accepted {
+		location := mq.LocationCoordinates{Latitude: c.Latitude, Longitude: c.Longitude}
+		if resp.Location != nil {
+			location = *resp.Location
+		}
+
+		distanceKm := geo.Distance(
+			location.Latitude, location.Longitude,
+			req.PickupLocation.Latitude, req.PickupLocation.Longitude,
+		)
+		etaMinutes := int(math.Ceil(distanceKm / defaultSpeedKmh * 60))
+
+		message.DriverLocation = &location
+		message.EstimatedArrivalMinutes = etaMinutes
+		message.EstimatedArrival = now.Add(time.Duration(etaMinutes) * time.Minute)
+
+		profile, err := m.service.queries.GetDriverProfile(ctx, c.DriverID)
+		if err != nil {
+			return fmt.Errorf("failed to load driver profile: %w", err)
+		}
+		message.DriverInfo = driverinfo.FromProfile(profile)
+	}
+
+	if err := m.service.driverPublisher.PublishDriverResponseWithCorrelation(ctx, req.RideID, req.CorrelationID, message); err != nil {
+		return fmt.Errorf("failed to publish driver response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package driver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ride-hail/pkg/uuid"
+)
+
+func TestRankCandidates_PrefersCloserDrivers(t *testing.T) {
+	near := candidate{DriverID: uuid.New(), DistanceKm: 0.5, Rating: 4.5}
+	far := candidate{DriverID: uuid.New(), DistanceKm: 4.5, Rating: 4.5}
+
+	ranked := rankCandidates([]candidate{far, near}, 5.0)
+
+	if ranked[0].DriverID != near.DriverID {
+		t.Errorf("Expected nearest driver first, got distance %.1f", ranked[0].DistanceKm)
+	}
+}
+
+func TestRankCandidates_RatingBreaksTies(t *testing.T) {
+	low := candidate{DriverID: uuid.New(), DistanceKm: 1.0, Rating: 3.0}
+	high := candidate{DriverID: uuid.New(), DistanceKm: 1.0, Rating: 5.0}
+
+	ranked := rankCandidates([]candidate{low, high}, 5.0)
+
+	if ranked[0].DriverID != high.DriverID {
+		t.Errorf("Expected higher rated driver first, got rating %.1f", ranked[0].Rating)
+	}
+}
+
+func TestRankCandidates_HighRatingOutweighsSmallDistance(t *testing.T) {
+	closeButPoor := candidate{DriverID: uuid.New(), DistanceKm: 1.0, Rating: 1.0}
+	slightlyFurther := candidate{DriverID: uuid.New(), DistanceKm: 1.5, Rating: 5.0}
+
+	ranked := rankCandidates([]candidate{closeButPoor, slightlyFurther}, 5.0)
+
+	if ranked[0].DriverID != slightlyFurther.DriverID {
+		t.Errorf("Expected well rated driver first, got rating %.1f", ranked[0].Rating)
+	}
+}
+
+func TestRankCandidates_DoesNotMutateInput(t *testing.T) {
+	input := []candidate{
+		{DriverID: uuid.New(), DistanceKm: 3.0, Rating: 4.0},
+		{DriverID: uuid.New(), DistanceKm: 1.0, Rating: 4.0},
+	}
+	first := input[0].DriverID
+
+	_ = rankCandidates(input, 5.0)
+
+	if input[0].DriverID != first {
+		t.Error("rankCandidates should not reorder the input slice")
+	}
+}
+
+func TestOfferRegistry_OneOfferPerDriver(t *testing.T) {
+	r := newOfferRegistry("")
+	driverID := uuid.New()
+
+	if _, ok := r.open(uuid.New(), driverID, time.Now().Add(time.Minute)); !ok {
+		t.Fatal("Expected first offer to open")
+	}
+	if _, ok := r.open(uuid.New(), driverID, time.Now().Add(time.Minute)); ok {
+		t.Error("Expected second concurrent offer to the same driver to be refused")
+	}
+}
+
+func TestOfferRegistry_Resolve(t *testing.T) {
+	r := newOfferRegistry("")
+	rideID := uuid.New()
+	driverID := uuid.New()
+	now := time.Now()
+
+	o, _ := r.open(rideID, driverID, now.Add(time.Minute))
+
+	tests := []struct {
+		name    string
+		resp    OfferResponse
+		wantErr error
+	}{
+		{
+			name:    "unknown driver",
+			resp:    OfferResponse{OfferID: o.ID, RideID: rideID, DriverID: uuid.New()},
+			wantErr: ErrOfferNotFound,
+		},
+		{
+			name:    "wrong offer id",
+			resp:    OfferResponse{OfferID: "offer_other", RideID: rideID, DriverID: driverID},
+			wantErr: ErrOfferMismatch,
+		},
+		{
+			name:    "wrong ride id",
+			resp:    OfferResponse{OfferID: o.ID, RideID: uuid.New(), DriverID: driverID},
+			wantErr: ErrOfferMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.resolve(tt.resp, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	resp := OfferResponse{OfferID: o.ID, RideID: rideID, DriverID: driverID, Accepted: true}
+	if err := r.resolve(resp, now); err != nil {
+		t.Fatalf("Expected matching response to resolve, got %v", err)
+	}
+
+	select {
+	case got := <-o.response:
+		if !got.Accepted {
+			t.Error("Expected accepted response to be delivered")
+		}
+	default:
+		t.Error("Expected response to be delivered to the waiting offer")
+	}
+
+	if err := r.resolve(resp, now); !errors.Is(err, ErrOfferNotFound) {
+		t.Errorf("Expected duplicate response to be rejected, got %v", err)
+	}
+}
+
+func TestOfferRegistry_ResolveExpired(t *testing.T) {
+	r := newOfferRegistry("")
+	rideID := uuid.New()
+	driverID := uuid.New()
+	now := time.Now()
+
+	o, _ := r.open(rideID, driverID, now.Add(-time.Second))
+
+	err := r.resolve(OfferResponse{OfferID: o.ID, RideID: rideID, DriverID: driverID}, now)
+	if !errors.Is(err, ErrOfferExpired) {
+		t.Errorf("Expected expired offer error, got %v", err)
+	}
+}
+
+func TestOfferRegistry_RemoveOnlyCurrentOffer(t *testing.T) {
+	r := newOfferRegistry("")
+	driverID := uuid.New()
+
+	stale, _ := r.open(uuid.New(), driverID, time.Now().Add(time.Minute))
+	r.remove(stale)
+
+	current, ok := r.open(uuid.New(), driverID, time.Now().Add(time.Minute))
+	if !ok {
+		t.Fatal("Expected new offer after removal")
+	}
+
+	r.remove(stale)
+	if _, ok := r.open(uuid.New(), driverID, time.Now().Add(time.Minute)); ok {
+		t.Error("Removing a stale offer must not drop the current one")
+	}
+	r.remove(current)
+}
+
+func TestOfferRegistry_LateResponseAfterTimeout(t *testing.T) {
+	r := newOfferRegistry("")
+	rideID := uuid.New()
+	driverID := uuid.New()
+	now := time.Now()
+
+	o, _ := r.open(rideID, driverID, now.Add(time.Second))
+	r.expire(o, now.Add(time.Second))
+
+	err := r.resolve(OfferResponse{OfferID: o.ID, RideID: rideID, DriverID: driverID}, now.Add(2*time.Second))
+	if !errors.Is(err, ErrOfferExpired) {
+		t.Errorf("Expected late response to report expiry, got %v", err)
+	}
+
+	err = r.resolve(OfferResponse{OfferID: "offer_unknown", RideID: rideID, DriverID: driverID}, now)
+	if !errors.Is(err, ErrOfferNotFound) {
+		t.Errorf("Expected unknown offer to be not found, got %v", err)
+	}
+}
+
+func TestOfferOrigin(t *testing.T) {
+	origin := uuid.New().String()
+	o, ok := newOfferRegistry(origin).open(uuid.New(), uuid.New(), time.Now().Add(time.Minute))
+	if !ok {
+		t.Fatal("Expected the offer to open")
+	}
+	if got := offerOrigin(o.ID); got != origin {
+		t.Errorf("Expected offer %s to name replica %s, got %q", o.ID, origin, got)
+	}
+
+	for _, offerID := range []string{"offer_" + uuid.New().String(), "offer_456", ""} {
+		if got := offerOrigin(offerID); got != "" {
+			t.Errorf("Expected %q to name no replica, got %q", offerID, got)
+		}
+	}
+}
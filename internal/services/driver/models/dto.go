@@ -51,42 +51,54 @@ func (r *LocationUpdateRequest) Validate() error {
 	return nil
 }
 
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+func (c *Coordinates) Validate() error {
+	if c.Latitude < -90 || c.Latitude > 90 {
+		return errors.New("invalid latitude: must be between -90 and 90")
+	}
+	if c.Longitude < -180 || c.Longitude > 180 {
+		return errors.New("invalid longitude: must be between -180 and 180")
+	}
+	return nil
+}
+
 type StartRideRequest struct {
-	RideID    string  `json:"ride_id"`
-	Latitude  float64 `json:"driver_location.latitude"`
-	Longitude float64 `json:"driver_location.longitude"`
+	DriverID       uuid.UUID   `json:"-"`
+	RideID         string      `json:"ride_id"`
+	DriverLocation Coordinates `json:"driver_location"`
 }
 
 func (r *StartRideRequest) Validate() error {
 	if r.RideID == "" {
 		return errors.New("ride_id is required")
 	}
-	if r.Latitude < -90 || r.Latitude > 90 {
-		return errors.New("invalid latitude")
-	}
-	if r.Longitude < -180 || r.Longitude > 180 {
-		return errors.New("invalid longitude")
+	if _, err := uuid.FromString(r.RideID); err != nil {
+		return errors.New("invalid ride_id format")
 	}
-	return nil
+	return r.DriverLocation.Validate()
 }
 
 type CompleteRideRequest struct {
-	RideID                string  `json:"ride_id"`
-	FinalLatitude         float64 `json:"final_location.latitude"`
-	FinalLongitude        float64 `json:"final_location.longitude"`
-	ActualDistanceKm      float64 `json:"actual_distance_km"`
-	ActualDurationMinutes int     `json:"actual_duration_minutes"`
+	DriverID              uuid.UUID   `json:"-"`
+	RideID                string      `json:"ride_id"`
+	FinalLocation         Coordinates `json:"final_location"`
+	ActualDistanceKm      float64     `json:"actual_distance_km"`
+	ActualDurationMinutes int         `json:"actual_duration_minutes"`
 }
 
 func (r *CompleteRideRequest) Validate() error {
 	if r.RideID == "" {
 		return errors.New("ride_id is required")
 	}
-	if r.FinalLatitude < -90 || r.FinalLatitude > 90 {
-		return errors.New("invalid final latitude")
+	if _, err := uuid.FromString(r.RideID); err != nil {
+		return errors.New("invalid ride_id format")
 	}
-	if r.FinalLongitude < -180 || r.FinalLongitude > 180 {
-		return errors.New("invalid final longitude")
+	if err := r.FinalLocation.Validate(); err != nil {
+		return err
 	}
 	if r.ActualDistanceKm < 0 {
 		return errors.New("actual_distance_km cannot be negative")
@@ -97,6 +109,26 @@ func (r *CompleteRideRequest) Validate() error {
 	return nil
 }
 
+// RideProgressRequest reports that the driver is heading to, or has reached, the pickup
+type RideProgressRequest struct {
+	DriverID       uuid.UUID    `json:"-"`
+	RideID         string       `json:"ride_id"`
+	DriverLocation *Coordinates `json:"driver_location,omitempty"`
+}
+
+func (r *RideProgressRequest) Validate() error {
+	if r.RideID == "" {
+		return errors.New("ride_id is required")
+	}
+	if _, err := uuid.FromString(r.RideID); err != nil {
+		return errors.New("invalid ride_id format")
+	}
+	if r.DriverLocation != nil {
+		return r.DriverLocation.Validate()
+	}
+	return nil
+}
+
 type OnlineResponse struct {
 	Status    string `json:"status"`
 	SessionID string `json:"session_id"`
@@ -136,6 +168,13 @@ type CompleteRideResponse struct {
 	Message        string    `json:"message"`
 }
 
+type RideProgressResponse struct {
+	RideID    string    `json:"ride_id"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Message   string    `json:"message"`
+}
+
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
@@ -196,6 +235,12 @@ type StartRideOutput struct {
 	StartedAt time.Time
 }
 
+type RideProgressOutput struct {
+	RideID    string
+	Status    string
+	UpdatedAt time.Time
+}
+
 type CompleteRideOutput struct {
 	RideID         string
 	Status         string
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStartRideRequest_DecodesNestedLocation(t *testing.T) {
+	body := `{
+		"ride_id": "550e8400-e29b-41d4-a716-446655440000",
+		"driver_location": {"latitude": 43.238949, "longitude": 76.889709}
+	}`
+
+	var req StartRideRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("Expected request to decode, got %v", err)
+	}
+	if req.DriverLocation.Latitude != 43.238949 || req.DriverLocation.Longitude != 76.889709 {
+		t.Errorf("Expected driver_location to be decoded, got %+v", req.DriverLocation)
+	}
+	if err := req.Validate(); err != nil {
+		t.Errorf("Expected valid request, got %v", err)
+	}
+}
+
+func TestCompleteRideRequest_Validate(t *testing.T) {
+	valid := CompleteRideRequest{
+		RideID:                "550e8400-e29b-41d4-a716-446655440000",
+		FinalLocation:         Coordinates{Latitude: 43.222015, Longitude: 76.851511},
+		ActualDistanceKm:      5.5,
+		ActualDurationMinutes: 16,
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(r *CompleteRideRequest)
+		wantErr bool
+	}{
+		{name: "valid", mutate: func(r *CompleteRideRequest) {}},
+		{name: "missing ride id", mutate: func(r *CompleteRideRequest) { r.RideID = "" }, wantErr: true},
+		{name: "malformed ride id", mutate: func(r *CompleteRideRequest) { r.RideID = "ride-1" }, wantErr: true},
+		{name: "bad latitude", mutate: func(r *CompleteRideRequest) { r.FinalLocation.Latitude = 91 }, wantErr: true},
+		{name: "negative distance", mutate: func(r *CompleteRideRequest) { r.ActualDistanceKm = -1 }, wantErr: true},
+		{name: "negative duration", mutate: func(r *CompleteRideRequest) { r.ActualDurationMinutes = -1 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.mutate(&req)
+			err := req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRideProgressMessage_ArrivedRequiresLocation(t *testing.T) {
+	message := RideProgressMessage{
+		Type:   "ride_progress",
+		RideID: "550e8400-e29b-41d4-a716-446655440000",
+		Status: "ARRIVED",
+	}
+	if err := message.Validate(); err == nil {
+		t.Error("Expected ARRIVED without current_location to be rejected")
+	}
+
+	message.Status = "EN_ROUTE"
+	if err := message.Validate(); err != nil {
+		t.Errorf("Expected EN_ROUTE without a location to be valid, got %v", err)
+	}
+}
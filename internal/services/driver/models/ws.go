@@ -0,0 +1,155 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"ride-hail/pkg/uuid"
+)
+
+const (
+	MessageTypeRideOffer      = "ride_offer"
+	MessageTypeRideResponse   = "ride_response"
+	MessageTypeRideProgress   = "ride_progress"
+	MessageTypeLocationUpdate = "location_update"
+)
+
+// Error codes of rejected driver frames, on top of the server.ErrorCode ones
+const (
+	ErrorCodeOfferNotFound     = "OFFER_NOT_FOUND"
+	ErrorCodeOfferExpired      = "OFFER_EXPIRED"
+	ErrorCodeOfferMismatch     = "OFFER_MISMATCH"
+	ErrorCodeRideNotFound      = "RIDE_NOT_FOUND"
+	ErrorCodeInvalidTransition = "INVALID_TRANSITION"
+	ErrorCodeNotAtPickup       = "NOT_AT_PICKUP"
+)
+
+type WsLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Address   string  `json:"address,omitempty"`
+}
+
+func (l *WsLocation) Validate() error {
+	if l.Latitude < -90 || l.Latitude > 90 {
+		return errors.New("invalid latitude: must be between -90 and 90")
+	}
+	if l.Longitude < -180 || l.Longitude > 180 {
+		return errors.New("invalid longitude: must be between -180 and 180")
+	}
+	return nil
+}
+
+// RideOfferMessage is sent to a driver's WebSocket when they are selected for a ride
+type RideOfferMessage struct {
+	Type                         string     `json:"type"`
+	OfferID                      string     `json:"offer_id"`
+	RideID                       string     `json:"ride_id"`
+	RideNumber                   string     `json:"ride_number"`
+	PickupLocation               WsLocation `json:"pickup_location"`
+	DestinationLocation          WsLocation `json:"destination_location"`
+	EstimatedFare                float64    `json:"estimated_fare"`
+	DriverEarnings               float64    `json:"driver_earnings"`
+	DistanceToPickupKm           float64    `json:"distance_to_pickup_km"`
+	EstimatedRideDurationMinutes int        `json:"estimated_ride_duration_minutes"`
+	ExpiresAt                    time.Time  `json:"expires_at"`
+}
+
+// RideResponseMessage is a driver's answer to a ride offer
+type RideResponseMessage struct {
+	CurrentLocation *WsLocation `json:"current_location,omitempty"`
+	Type            string      `json:"type"`
+	OfferID         string      `json:"offer_id"`
+	RideID          string      `json:"ride_id"`
+	Reason          string      `json:"reason,omitempty"`
+	Accepted        bool        `json:"accepted"`
+}
+
+func (m *RideResponseMessage) Validate() error {
+	if m.OfferID == "" {
+		return errors.New("offer_id is required")
+	}
+	if m.RideID == "" {
+		return errors.New("ride_id is required")
+	}
+	if _, err := uuid.FromString(m.RideID); err != nil {
+		return errors.New("invalid ride_id format")
+	}
+	if len(m.Reason) > 500 {
+		return errors.New("reason too long (max 500 characters)")
+	}
+	if m.Accepted && m.CurrentLocation == nil {
+		return errors.New("current_location is required when accepting")
+	}
+	if m.CurrentLocation != nil {
+		if err := m.CurrentLocation.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RideProgressMessage is sent by a driver when they set off for, or reach, the pickup
+type RideProgressMessage struct {
+	CurrentLocation *WsLocation `json:"current_location,omitempty"`
+	Type            string      `json:"type"`
+	RideID          string      `json:"ride_id"`
+	Status          string      `json:"status"`
+}
+
+func (m *RideProgressMessage) Validate() error {
+	if m.RideID == "" {
+		return errors.New("ride_id is required")
+	}
+	if _, err := uuid.FromString(m.RideID); err != nil {
+		return errors.New("invalid ride_id format")
+	}
+	if m.Status != "EN_ROUTE" && m.Status != "ARRIVED" {
+		return errors.New("status must be EN_ROUTE or ARRIVED")
+	}
+	if m.Status == "ARRIVED" && m.CurrentLocation == nil {
+		return errors.New("current_location is required when ARRIVED")
+	}
+	if m.CurrentLocation != nil {
+		return m.CurrentLocation.Validate()
+	}
+	return nil
+}
+
+// LocationUpdateMessage is a driver's position sent over the socket, the
+// counterpart of POST /drivers/{id}/location
+type LocationUpdateMessage struct {
+	Type           string  `json:"type"`
+	RideID         string  `json:"ride_id,omitempty"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	AccuracyMeters float64 `json:"accuracy_meters,omitempty"`
+	SpeedKmh       float64 `json:"speed_kmh,omitempty"`
+	HeadingDegrees float64 `json:"heading_degrees,omitempty"`
+}
+
+func (m *LocationUpdateMessage) Validate() error {
+	if m.RideID != "" {
+		if _, err := uuid.FromString(m.RideID); err != nil {
+			return errors.New("invalid ride_id format")
+		}
+	}
+	request := m.Request(uuid.UUID{})
+	return request.Validate()
+}
+
+// Request is the update of driverID the message carries
+func (m *LocationUpdateMessage) Request(driverID uuid.UUID) LocationUpdateRequest {
+	request := LocationUpdateRequest{
+		DriverID:       driverID,
+		Latitude:       m.Latitude,
+		Longitude:      m.Longitude,
+		AccuracyMeters: m.AccuracyMeters,
+		SpeedKmh:       m.SpeedKmh,
+		HeadingDegrees: m.HeadingDegrees,
+	}
+	if rideID, err := uuid.FromString(m.RideID); err == nil {
+		request.RideID = &rideID
+	}
+	return request
+}
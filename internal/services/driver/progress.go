@@ -0,0 +1,217 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"ride-hail/internal/services/driver/models"
+	"ride-hail/internal/shared/core"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/internal/shared/outbox"
+	"ride-hail/pkg/geo"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EnRoute marks a MATCHED ride as EN_ROUTE once the driver sets off for the pickup
+func (s *DriverService) EnRoute(ctx context.Context, arg models.RideProgressRequest) (models.RideProgressOutput, error) {
+	return s.progress(ctx, arg, core.RideStatusEnRoute)
+}
+
+// Arrived marks the ride ARRIVED so the passenger knows to walk out. The driver
+// must report a location within the pickup radius
+func (s *DriverService) Arrived(ctx context.Context, arg models.RideProgressRequest) (models.RideProgressOutput, error) {
+	return s.progress(ctx, arg, core.RideStatusArrived)
+}
+
+func (s *DriverService) progress(ctx context.Context, arg models.RideProgressRequest, next core.RideStatus) (models.RideProgressOutput, error) {
+	if err := arg.Validate(); err != nil {
+		return models.RideProgressOutput{}, appErrors.NewInvalidInputError(err.Error())
+	}
+	rideID, _ := uuid.FromString(arg.RideID)
+
+	current, err := s.driverRide(ctx, rideID, arg.DriverID)
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+	status, err := core.RideStatusFromDB(current.Status)
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+	if !status.CanTransitionTo(next) {
+		return models.RideProgressOutput{}, ErrRideNotAtPickup
+	}
+
+	if next == core.RideStatusArrived {
+		if arg.DriverLocation == nil {
+			return models.RideProgressOutput{}, ErrArrivalLocationRequired
+		}
+		distanceKm, err := s.distanceToPickup(ctx, current, arg.DriverLocation.Latitude, arg.DriverLocation.Longitude)
+		if err != nil {
+			return models.RideProgressOutput{}, err
+		}
+		if !s.arrivals.within(distanceKm) {
+			return models.RideProgressOutput{}, ErrDriverNotAtPickup
+		}
+	}
+
+	eventType := core.RideEventStatusChanged
+	driverStatus := core.DriverStatusEnRoute
+	if next == core.RideStatusArrived {
+		eventType = core.RideEventArrived
+		driverStatus = core.DriverStatusBusy
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+	qtx := s.queries.WithTx(tx)
+
+	updated, err := qtx.TransitionRideStatus(ctx, sqlc.TransitionRideStatusParams{
+		NewStatus:      next.String(),
+		ID:             rideID,
+		ExpectedStatus: status.String(),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrRideNotAtPickup
+		return models.RideProgressOutput{}, err
+	}
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+
+	eventData := map[string]interface{}{
+		"old_status": status.String(),
+		"new_status": next.String(),
+		"driver_id":  arg.DriverID.String(),
+	}
+	if arg.DriverLocation != nil {
+		eventData["location"] = arg.DriverLocation
+	}
+	err = createRideEvent(ctx, qtx, rideID, eventType, eventData)
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+
+	err = qtx.UpdateDriverStatus(ctx, sqlc.UpdateDriverStatusParams{
+		Status: driverStatus.String(),
+		ID:     arg.DriverID,
+	})
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+
+	err = queueRideStatus(ctx, qtx, updated, status, next)
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return models.RideProgressOutput{}, err
+	}
+
+	if next == core.RideStatusArrived {
+		s.arrivals.reset(arg.DriverID)
+	}
+
+	updatedAt := updated.UpdatedAt
+	if next == core.RideStatusArrived && updated.ArrivedAt != nil {
+		updatedAt = *updated.ArrivedAt
+	}
+
+	return models.RideProgressOutput{
+		RideID:    arg.RideID,
+		Status:    next.String(),
+		UpdatedAt: updatedAt,
+	}, nil
+}
+
+// detectArrival marks the driver's active ride ARRIVED once enough consecutive
+// location updates land within the arrival radius of the pickup. The update
+// itself is already stored, so failures here are only logged
+func (s *DriverService) detectArrival(ctx context.Context, args models.LocationUpdateRequest) {
+	current, err := s.queries.GetActiveRideByDriver(ctx, args.DriverID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.arrivals.reset(args.DriverID)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load active ride for arrival detection", "driver_id", args.DriverID.String(), "error", err)
+		return
+	}
+
+	status, err := core.RideStatusFromDB(current.Status)
+	if err != nil || !status.CanTransitionTo(core.RideStatusArrived) {
+		s.arrivals.reset(args.DriverID)
+		return
+	}
+
+	distanceKm, err := s.distanceToPickup(ctx, current, args.Latitude, args.Longitude)
+	if err != nil {
+		slog.Error("Failed to compute distance to pickup", "ride_id", current.ID.String(), "error", err)
+		return
+	}
+	if !s.arrivals.observe(args.DriverID, current.ID, distanceKm) {
+		return
+	}
+
+	_, err = s.Arrived(ctx, models.RideProgressRequest{
+		DriverID:       args.DriverID,
+		RideID:         current.ID.String(),
+		DriverLocation: &models.Coordinates{Latitude: args.Latitude, Longitude: args.Longitude},
+	})
+	if errors.Is(err, ErrRideNotAtPickup) {
+		// the driver reported arrival themselves in the meantime
+		s.arrivals.reset(args.DriverID)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to auto-mark ride as arrived", "ride_id", current.ID.String(), "driver_id", args.DriverID.String(), "error", err)
+		return
+	}
+
+	slog.Info("Driver arrived at pickup",
+		"ride_id", current.ID.String(),
+		"driver_id", args.DriverID.String(),
+		"distance_km", distanceKm,
+	)
+}
+
+func (s *DriverService) distanceToPickup(ctx context.Context, ride sqlc.Ride, lat, lng float64) (float64, error) {
+	pickup, err := s.queries.GetCoordinateByID(ctx, ride.PickupCoordinateID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pickup location: %w", err)
+	}
+	return geo.Distance(lat, lng, sqlc.FloatFromNumeric(pickup.Latitude), sqlc.FloatFromNumeric(pickup.Longitude)), nil
+}
+
+// queueRideStatus writes the transition to the outbox as ride.status.{status}
+// so the ride service can notify the passenger once the transaction commits
+func queueRideStatus(ctx context.Context, qtx *sqlc.Queries, ride sqlc.Ride, old, next core.RideStatus) error {
+	message := mq.RideStatusMessage{
+		UpdatedAt:     time.Now().UTC(),
+		RideID:        ride.ID.String(),
+		RideNumber:    ride.RideNumber,
+		PassengerID:   ride.PassengerID.String(),
+		DriverID:      ride.DriverID.String(),
+		OldStatus:     old.String(),
+		NewStatus:     next.String(),
+		CorrelationID: ride.ID.String(),
+	}
+	return outbox.RideEvents(qtx, ride.ID, eventProducer).PublishRideStatusWithCorrelation(ctx, next.String(), message.CorrelationID, message)
+}
@@ -2,6 +2,11 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
 	"ride-hail/internal/services/driver/models"
 	"ride-hail/internal/shared/core"
 	"ride-hail/pkg/sqlc"
@@ -26,7 +31,6 @@ func statusOffline(ctx context.Context, qtx sqlc.Querier, driverID uuid.UUID) er
 }
 
 func createSession(ctx context.Context, qtx sqlc.Querier, driverID uuid.UUID) (uuid.UUID, error) {
-	
 
 	session, err := qtx.CreateDriverSession(ctx, driverID)
 	if err != nil {
@@ -35,3 +39,45 @@ func createSession(ctx context.Context, qtx sqlc.Querier, driverID uuid.UUID) (u
 
 	return session.ID, nil
 }
+
+// endSession closes the driver's open session, keeping the totals accumulated by completed rides
+func endSession(ctx context.Context, qtx sqlc.Querier, driverID uuid.UUID) (models.OfflineOutput, error) {
+	current, err := qtx.GetCurrentDriverSession(ctx, driverID)
+	if err != nil {
+		return models.OfflineOutput{}, err
+	}
+
+	session, err := qtx.EndDriverSession(ctx, sqlc.EndDriverSessionParams{
+		ID:            current.ID,
+		TotalRides:    current.TotalRides,
+		TotalEarnings: current.TotalEarnings,
+	})
+	if err != nil {
+		return models.OfflineOutput{}, err
+	}
+
+	endedAt := time.Now()
+	if session.EndedAt != nil {
+		endedAt = *session.EndedAt
+	}
+
+	return models.OfflineOutput{
+		SessionID:      session.ID.String(),
+		DurationHours:  math.Round(endedAt.Sub(session.StartedAt).Hours()*100) / 100,
+		RidesCompleted: int(session.TotalRides.Int32),
+		Earnings:       sqlc.FloatFromNumeric(session.TotalEarnings),
+	}, nil
+}
+
+func createRideEvent(ctx context.Context, qtx sqlc.Querier, rideID uuid.UUID, eventType core.RideEventType, data map[string]interface{}) error {
+	eventData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ride event: %w", err)
+	}
+
+	return qtx.CreateRideEvent(ctx, sqlc.CreateRideEventParams{
+		RideID:    rideID,
+		EventType: eventType.String(),
+		EventData: eventData,
+	})
+}
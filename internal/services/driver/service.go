@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"ride-hail/internal/services/driver/models"
 	"ride-hail/internal/services/driver/specification"
 	"ride-hail/internal/shared/core"
 	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/internal/shared/fare"
+	"ride-hail/internal/shared/outbox"
 	"ride-hail/pkg/mq"
 	"ride-hail/pkg/sqlc"
 	"ride-hail/pkg/uuid"
@@ -19,26 +22,45 @@ import (
 )
 
 const (
-	defaultMatchRadiusKm   = 5.0
-	defaultOfferTimeoutSec = 30
-	defaultSpeedKmh        = 30.0
-	locationRateLimit      = 3 * time.Second
-	driverEarningsRate     = 0.8
+	defaultSpeedKmh    = 30.0
+	locationRateLimit  = 3 * time.Second
+	driverEarningsRate = 0.8
+	noSurge            = 1.0
+	// eventProducer is the producer in the envelopes of the events published here
+	eventProducer = "driver-location-service"
+)
+
+var (
+	ErrRideNotFound            = appErrors.NewNotFoundError("ride")
+	ErrRideNotAssigned         = appErrors.NewForbiddenError("ride is not assigned to this driver")
+	ErrRideNotStartable        = appErrors.NewConflictError("ride cannot be started from its current status")
+	ErrRideNotInProgress       = appErrors.NewConflictError("ride must be IN_PROGRESS to complete")
+	ErrDriverNotAtPickup       = appErrors.NewConflictError("driver is too far from the pickup location")
+	ErrRideNotAtPickup         = appErrors.NewConflictError("ride is not awaiting pickup")
+	ErrArrivalLocationRequired = appErrors.NewInvalidInputError("driver_location is required to mark a ride ARRIVED")
 )
 
 type DriverService struct {
-	db       *pgxpool.Pool
-	queries  *sqlc.Queries
-	mqClient *mq.Client
-	spec     *specification.DriverSpecification
+	db                *pgxpool.Pool
+	queries           *sqlc.Queries
+	mqClient          mq.Broker
+	driverPublisher   *mq.DriverEventPublisher
+	locationPublisher *mq.LocationEventPublisher
+	fares             *fare.Calculator
+	spec              *specification.DriverSpecification
+	arrivals          *arrivalTracker
 }
 
-func NewDriverService(db *pgxpool.Pool, queries *sqlc.Queries, mqClient *mq.Client) *DriverService {
+func NewDriverService(db *pgxpool.Pool, queries *sqlc.Queries, mqClient mq.Broker, arrival ArrivalDetection) *DriverService {
 	return &DriverService{
-		db:       db,
-		queries:  queries,
-		mqClient: mqClient,
-		spec:     specification.NewDriverSpecification(queries),
+		db:                db,
+		queries:           queries,
+		mqClient:          mqClient,
+		driverPublisher:   mq.NewDriverEventPublisher(mqClient, eventProducer),
+		locationPublisher: mq.NewLocationEventPublisher(mqClient, eventProducer),
+		fares:             fare.NewCalculator(),
+		spec:              specification.NewDriverSpecification(queries),
+		arrivals:          newArrivalTracker(arrival),
 	}
 }
 
@@ -83,37 +105,79 @@ func (s *DriverService) Online(ctx context.Context, arg models.OnlineRequest) (s
 		return uuid.Nil, err
 	}
 
+	if err = qtx.MarkDriverCoordinatesAsOld(ctx, arg.DriverID); err != nil {
+		return uuid.Nil, err
+	}
+	_, err = qtx.CreateCoordinateForDriver(ctx, sqlc.CreateCoordinateForDriverParams{
+		EntityID:  arg.DriverID,
+		Address:   "",
+		Latitude:  sqlc.NumericFromFloat(arg.Latitude),
+		Longitude: sqlc.NumericFromFloat(arg.Longitude),
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
 	return session, nil
 }
 
-func (s *DriverService) Offline(ctx context.Context, driverID uuid.UUID) error {
+// Offline ends the driver's open session and reports what was earned during it
+func (s *DriverService) Offline(ctx context.Context, driverID uuid.UUID) (models.OfflineOutput, error) {
 	err := s.spec.Offline(ctx, driverID)
 	if err != nil {
-		return err
+		return models.OfflineOutput{}, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.OfflineOutput{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+	qtx := s.queries.WithTx(tx)
+
+	err = statusOffline(ctx, qtx, driverID)
+	if err != nil {
+		return models.OfflineOutput{}, err
+	}
+
+	session, err := endSession(ctx, qtx, driverID)
+	if err != nil {
+		return models.OfflineOutput{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return models.OfflineOutput{}, err
 	}
-	err = statusOffline(ctx, s.queries, driverID)
-	return err
+
+	return session, nil
 }
 
-func (s *DriverService) Location(ctx context.Context, args models.LocationUpdateRequest) error {
+func (s *DriverService) Location(ctx context.Context, args models.LocationUpdateRequest) (models.LocationOutput, error) {
 	if s.spec != nil {
 		if err := s.spec.UpdateLocation(ctx, args); err != nil {
-			return err
+			return models.LocationOutput{}, err
 		}
 	}
 
 	current, err := s.queries.GetDriverCurrentLocation(ctx, args.DriverID)
 	if err == nil {
 		if time.Since(current.UpdatedAt) < locationRateLimit {
-			return appErrors.NewConflictError("location updates are too frequent")
+			return models.LocationOutput{}, appErrors.NewConflictError("location updates are too frequent")
 		}
 	} else if !errors.Is(err, pgx.ErrNoRows) {
-		return err
+		return models.LocationOutput{}, err
 	}
 
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return err
+		return models.LocationOutput{}, err
 	}
 	defer func() {
 		if err != nil {
@@ -126,17 +190,17 @@ func (s *DriverService) Location(ctx context.Context, args models.LocationUpdate
 	qtx := s.queries.WithTx(tx)
 
 	if err = qtx.MarkDriverCoordinatesAsOld(ctx, args.DriverID); err != nil {
-		return err
+		return models.LocationOutput{}, err
 	}
 
-	_, err = qtx.CreateCoordinateForDriver(ctx, sqlc.CreateCoordinateForDriverParams{
+	coordinate, err := qtx.CreateCoordinateForDriver(ctx, sqlc.CreateCoordinateForDriverParams{
 		EntityID:  args.DriverID,
 		Address:   "",
 		Latitude:  sqlc.NumericFromFloat(args.Latitude),
 		Longitude: sqlc.NumericFromFloat(args.Longitude),
 	})
 	if err != nil {
-		return err
+		return models.LocationOutput{}, err
 	}
 
 	if args.RideID != nil {
@@ -150,19 +214,313 @@ func (s *DriverService) Location(ctx context.Context, args models.LocationUpdate
 			RideID:         *args.RideID,
 		})
 		if err != nil {
-			return err
+			return models.LocationOutput{}, err
 		}
 	}
 
-	return nil
+	err = tx.Commit(ctx)
+	if err != nil {
+		return models.LocationOutput{}, err
+	}
+
+	s.publishLocation(ctx, args, coordinate.UpdatedAt)
+	s.detectArrival(ctx, args)
+
+	return models.LocationOutput{
+		CoordinateID: coordinate.ID.String(),
+		UpdatedAt:    coordinate.UpdatedAt,
+	}, nil
 }
 
-func (s *DriverService) Start(ctx context.Context, driverID uuid.UUID) error {
-	return nil
+// publishLocation fans an accepted update out on location_fanout; the update is
+// already stored, so a broker failure is only logged
+func (s *DriverService) publishLocation(ctx context.Context, args models.LocationUpdateRequest, recordedAt time.Time) {
+	message := mq.LocationUpdateMessage{
+		Timestamp:  recordedAt,
+		EntityID:   args.DriverID.String(),
+		EntityType: "driver",
+		Location: &mq.LocationCoordinates{
+			Latitude:  args.Latitude,
+			Longitude: args.Longitude,
+		},
+		Accuracy: args.AccuracyMeters,
+		Speed:    args.SpeedKmh,
+		Heading:  args.HeadingDegrees,
+	}
 
+	var err error
+	if args.RideID != nil {
+		message.RideID = args.RideID.String()
+		err = s.locationPublisher.PublishLocationUpdateWithCorrelation(ctx, message.RideID, message)
+	} else {
+		err = s.locationPublisher.PublishLocationUpdate(ctx, message)
+	}
+	if err != nil {
+		slog.Error("Failed to publish location update", "driver_id", message.EntityID, "error", err)
+	}
 }
 
-func (s *DriverService) Complete(ctx context.Context, driverID uuid.UUID) error {
+// Start moves a ride owned by the driver to IN_PROGRESS once the driver is
+// within the pickup radius of the pickup point
+func (s *DriverService) Start(ctx context.Context, arg models.StartRideRequest) (models.StartRideOutput, error) {
+	if err := arg.Validate(); err != nil {
+		return models.StartRideOutput{}, appErrors.NewInvalidInputError(err.Error())
+	}
+	rideID, _ := uuid.FromString(arg.RideID)
+
+	current, err := s.driverRide(ctx, rideID, arg.DriverID)
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+	status, err := core.RideStatusFromDB(current.Status)
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+	if !status.CanTransitionTo(core.RideStatusInProgress) {
+		return models.StartRideOutput{}, ErrRideNotStartable
+	}
+
+	distanceKm, err := s.distanceToPickup(ctx, current, arg.DriverLocation.Latitude, arg.DriverLocation.Longitude)
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+	if !s.arrivals.within(distanceKm) {
+		return models.StartRideOutput{}, ErrDriverNotAtPickup
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+	qtx := s.queries.WithTx(tx)
+
+	started, err := qtx.UpdateRideStarted(ctx, sqlc.UpdateRideStartedParams{
+		ID:             rideID,
+		DriverID:       arg.DriverID,
+		ExpectedStatus: status.String(),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrRideNotStartable
+		return models.StartRideOutput{}, err
+	}
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
 
-	return nil
+	err = createRideEvent(ctx, qtx, rideID, core.RideEventStarted, map[string]interface{}{
+		"old_status": status.String(),
+		"new_status": core.RideStatusInProgress.String(),
+		"driver_id":  arg.DriverID.String(),
+		"location":   arg.DriverLocation,
+	})
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+
+	err = qtx.UpdateDriverStatus(ctx, sqlc.UpdateDriverStatusParams{
+		Status: core.DriverStatusBusy.String(),
+		ID:     arg.DriverID,
+	})
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+
+	err = queueRideStatus(ctx, qtx, started, status, core.RideStatusInProgress)
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return models.StartRideOutput{}, err
+	}
+
+	s.arrivals.reset(arg.DriverID)
+
+	startedAt := time.Now().UTC()
+	if started.StartedAt != nil {
+		startedAt = *started.StartedAt
+	}
+
+	return models.StartRideOutput{
+		RideID:    arg.RideID,
+		Status:    core.DriverStatusBusy.String(),
+		StartedAt: startedAt,
+	}, nil
+}
+
+// Complete closes an IN_PROGRESS ride with a fare computed from the actual
+// distance and duration, credits the driver and their session, and frees the driver
+func (s *DriverService) Complete(ctx context.Context, arg models.CompleteRideRequest) (models.CompleteRideOutput, error) {
+	if err := arg.Validate(); err != nil {
+		return models.CompleteRideOutput{}, appErrors.NewInvalidInputError(err.Error())
+	}
+	rideID, _ := uuid.FromString(arg.RideID)
+
+	current, err := s.driverRide(ctx, rideID, arg.DriverID)
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+	status, err := core.RideStatusFromDB(current.Status)
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+	if !status.CanTransitionTo(core.RideStatusCompleted) {
+		return models.CompleteRideOutput{}, ErrRideNotInProgress
+	}
+
+	var vehicleType string
+	if current.VehicleType != nil {
+		vehicleType = *current.VehicleType
+	}
+	finalFare, err := s.fares.CalculateFare(vehicleType, arg.ActualDistanceKm, float64(arg.ActualDurationMinutes), noSurge)
+	if err != nil {
+		return models.CompleteRideOutput{}, fmt.Errorf("failed to calculate fare: %w", err)
+	}
+	earnings := finalFare * driverEarningsRate
+
+	session, err := s.queries.GetCurrentDriverSession(ctx, arg.DriverID)
+	hasSession := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.CompleteRideOutput{}, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+	qtx := s.queries.WithTx(tx)
+
+	completed, err := qtx.UpdateRideCompleted(ctx, sqlc.UpdateRideCompletedParams{
+		ID:             rideID,
+		FinalFare:      sqlc.NumericFromFloat(finalFare),
+		DriverID:       arg.DriverID,
+		ExpectedStatus: status.String(),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrRideNotInProgress
+		return models.CompleteRideOutput{}, err
+	}
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	err = createRideEvent(ctx, qtx, rideID, core.RideEventCompleted, map[string]interface{}{
+		"old_status":       core.RideStatusInProgress.String(),
+		"new_status":       core.RideStatusCompleted.String(),
+		"driver_id":        arg.DriverID.String(),
+		"location":         arg.FinalLocation,
+		"final_fare":       finalFare,
+		"distance_km":      arg.ActualDistanceKm,
+		"duration_minutes": arg.ActualDurationMinutes,
+	})
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	err = qtx.UpdateDriverStats(ctx, sqlc.UpdateDriverStatsParams{
+		ID:            arg.DriverID,
+		TotalEarnings: sqlc.NumericFromFloat(earnings),
+	})
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	if hasSession {
+		err = qtx.UpdateSessionStats(ctx, sqlc.UpdateSessionStatsParams{
+			ID:            session.ID,
+			TotalEarnings: sqlc.NumericFromFloat(earnings),
+		})
+		if err != nil {
+			return models.CompleteRideOutput{}, err
+		}
+	}
+
+	// the drop-off becomes the driver's current position for the next match
+	if err = qtx.MarkDriverCoordinatesAsOld(ctx, arg.DriverID); err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+	_, err = qtx.CreateCoordinateForDriver(ctx, sqlc.CreateCoordinateForDriverParams{
+		EntityID:  arg.DriverID,
+		Address:   "",
+		Latitude:  sqlc.NumericFromFloat(arg.FinalLocation.Latitude),
+		Longitude: sqlc.NumericFromFloat(arg.FinalLocation.Longitude),
+	})
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	err = qtx.UpdateDriverStatus(ctx, sqlc.UpdateDriverStatusParams{
+		Status: core.DriverStatusAvailable.String(),
+		ID:     arg.DriverID,
+	})
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	completedAt := time.Now().UTC()
+	if completed.CompletedAt != nil {
+		completedAt = *completed.CompletedAt
+	}
+
+	message := mq.RideCompletedMessage{
+		EndTime:       completedAt,
+		CompletedAt:   completedAt,
+		RideID:        arg.RideID,
+		RideNumber:    completed.RideNumber,
+		PassengerID:   completed.PassengerID.String(),
+		DriverID:      arg.DriverID.String(),
+		Duration:      arg.ActualDurationMinutes,
+		Distance:      arg.ActualDistanceKm,
+		EstimatedFare: sqlc.FloatFromNumeric(completed.EstimatedFare),
+		FinalFare:     finalFare,
+	}
+	if completed.StartedAt != nil {
+		message.StartTime = *completed.StartedAt
+	}
+	err = outbox.RideEvents(qtx, rideID, eventProducer).PublishRideStatusWithCorrelation(ctx, core.RideStatusCompleted.String(), arg.RideID, message)
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return models.CompleteRideOutput{}, err
+	}
+
+	return models.CompleteRideOutput{
+		RideID:         arg.RideID,
+		Status:         core.DriverStatusAvailable.String(),
+		CompletedAt:    completedAt,
+		DriverEarnings: earnings,
+	}, nil
+}
+
+// driverRide loads a ride and checks that it is assigned to driverID
+func (s *DriverService) driverRide(ctx context.Context, rideID, driverID uuid.UUID) (sqlc.Ride, error) {
+	current, err := s.queries.GetRideByID(ctx, rideID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sqlc.Ride{}, ErrRideNotFound
+	}
+	if err != nil {
+		return sqlc.Ride{}, err
+	}
+	if current.DriverID != driverID {
+		return sqlc.Ride{}, ErrRideNotAssigned
+	}
+	return current, nil
 }
@@ -0,0 +1,178 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"ride-hail/internal/services/driver/models"
+	"ride-hail/internal/shared/core"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/uuid"
+)
+
+// rideResponseLimit leaves room for a 500 character reason
+const rideResponseLimit = 2048
+
+// SocketHandler handles inbound frames from /ws/drivers/{id} by message type
+type SocketHandler struct {
+	matcher *Matcher
+	service *DriverService
+	manager *server.Manager
+	router  *server.Router
+}
+
+func NewSocketHandler(matcher *Matcher, service *DriverService, manager *server.Manager) *SocketHandler {
+	h := &SocketHandler{
+		matcher: matcher,
+		service: service,
+		manager: manager,
+		router:  server.NewRouter(),
+	}
+	server.Handle(h.router, models.MessageTypeRideResponse, h.handleRideResponse, server.WithReadLimit(rideResponseLimit))
+	server.Handle(h.router, models.MessageTypeRideProgress, h.handleRideProgress)
+	server.Handle(h.router, models.MessageTypeLocationUpdate, h.handleLocationUpdate)
+	return h
+}
+
+// Run handles the manager's inbound frames until ctx is done or the manager shuts down
+func (h *SocketHandler) Run(ctx context.Context) {
+	h.router.Run(ctx, h.manager)
+}
+
+func (h *SocketHandler) handleRideResponse(ctx context.Context, request server.Request, message models.RideResponseMessage) (any, error) {
+	// Validate has checked ride_id already; this keeps a bad one from becoming uuid.Nil
+	rideID, err := uuid.FromString(message.RideID)
+	if err != nil {
+		return nil, &server.Error{
+			Code:    server.ErrorCodeInvalidMessage,
+			Message: "invalid ride_id format",
+			Fields:  map[string]string{"offer_id": message.OfferID, "ride_id": message.RideID},
+		}
+	}
+	// the matcher waiting on the offer runs on the replica that made it
+	if origin := offerOrigin(message.OfferID); origin != "" && origin != h.manager.InstanceID() {
+		if err := h.manager.Forward(origin, request); err != nil {
+			return nil, err
+		}
+		return nil, server.ErrForwarded
+	}
+
+	resp := OfferResponse{
+		OfferID:  message.OfferID,
+		Reason:   message.Reason,
+		RideID:   rideID,
+		DriverID: request.UserID,
+		Accepted: message.Accepted,
+	}
+	if message.CurrentLocation != nil {
+		resp.Location = &mq.LocationCoordinates{
+			Latitude:  message.CurrentLocation.Latitude,
+			Longitude: message.CurrentLocation.Longitude,
+		}
+	}
+
+	if err := h.matcher.Respond(resp); err != nil {
+		slog.Warn("Rejected ride response",
+			"driver_id", request.UserID.String(),
+			"offer_id", message.OfferID,
+			"ride_id", message.RideID,
+			"error", err,
+		)
+		return nil, &server.Error{
+			Code:    offerErrorCode(err),
+			Message: errorMessage(err, "failed to process ride response"),
+			Fields:  map[string]string{"offer_id": message.OfferID, "ride_id": message.RideID},
+		}
+	}
+	return nil, nil
+}
+
+func (h *SocketHandler) handleRideProgress(ctx context.Context, request server.Request, message models.RideProgressMessage) (any, error) {
+	arg := models.RideProgressRequest{
+		DriverID: request.UserID,
+		RideID:   message.RideID,
+	}
+	if message.CurrentLocation != nil {
+		arg.DriverLocation = &models.Coordinates{
+			Latitude:  message.CurrentLocation.Latitude,
+			Longitude: message.CurrentLocation.Longitude,
+		}
+	}
+
+	var err error
+	if message.Status == core.RideStatusArrived.String() {
+		_, err = h.service.Arrived(ctx, arg)
+	} else {
+		_, err = h.service.EnRoute(ctx, arg)
+	}
+	if err != nil {
+		slog.Warn("Rejected ride progress",
+			"driver_id", request.UserID.String(),
+			"ride_id", message.RideID,
+			"status", message.Status,
+			"error", err,
+		)
+		return nil, &server.Error{
+			Code:    progressErrorCode(err),
+			Message: errorMessage(err, "failed to process ride progress"),
+			Fields:  map[string]string{"ride_id": message.RideID},
+		}
+	}
+	return nil, nil
+}
+
+// handleLocationUpdate acks with the stored coordinate, like the HTTP endpoint
+func (h *SocketHandler) handleLocationUpdate(ctx context.Context, request server.Request, message models.LocationUpdateMessage) (any, error) {
+	out, err := h.service.Location(ctx, message.Request(request.UserID))
+	if err != nil {
+		var appErr *appErrors.AppError
+		if errors.As(err, &appErr) && appErr.Type != appErrors.ErrorTypeInternalError {
+			return nil, &server.Error{Code: string(appErr.Type), Message: appErr.Message}
+		}
+		return nil, err
+	}
+	return models.LocationUpdateResponse{
+		CoordinateID: out.CoordinateID,
+		UpdatedAt:    out.UpdatedAt,
+	}, nil
+}
+
+func offerErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrOfferExpired):
+		return models.ErrorCodeOfferExpired
+	case errors.Is(err, ErrOfferNotFound):
+		return models.ErrorCodeOfferNotFound
+	case errors.Is(err, ErrOfferMismatch):
+		return models.ErrorCodeOfferMismatch
+	default:
+		return server.ErrorCodeInternal
+	}
+}
+
+func progressErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrRideNotAtPickup):
+		return models.ErrorCodeInvalidTransition
+	case errors.Is(err, ErrDriverNotAtPickup):
+		return models.ErrorCodeNotAtPickup
+	case errors.Is(err, ErrArrivalLocationRequired):
+		return server.ErrorCodeInvalidMessage
+	case errors.Is(err, ErrRideNotFound), errors.Is(err, ErrRideNotAssigned):
+		return models.ErrorCodeRideNotFound
+	default:
+		return server.ErrorCodeInternal
+	}
+}
+
+// errorMessage is the message of an AppError, or fallback for any other error
+func errorMessage(err error, fallback string) string {
+	var appErr *appErrors.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return fallback
+}
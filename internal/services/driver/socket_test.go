@@ -0,0 +1,34 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ride-hail/internal/services/driver/models"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/uuid"
+)
+
+func TestHandleRideResponse_RejectsMalformedRideID(t *testing.T) {
+	h := &SocketHandler{matcher: NewMatcher(nil, nil, MatchingDefaults{})}
+
+	_, err := h.handleRideResponse(context.Background(), server.Request{UserID: uuid.New()}, models.RideResponseMessage{
+		OfferID: "offer_1",
+		RideID:  "not-a-uuid",
+	})
+
+	var serverErr *server.Error
+	if !errors.As(err, &serverErr) || serverErr.Code != server.ErrorCodeInvalidMessage {
+		t.Errorf("Expected an invalid message error, got %v", err)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	if got := errorMessage(ErrArrivalLocationRequired, "failed to process ride progress"); got != ErrArrivalLocationRequired.Message {
+		t.Errorf("Expected the app error's message, got %q", got)
+	}
+	if got := errorMessage(errors.New("connection reset"), "failed to process ride progress"); got != "failed to process ride progress" {
+		t.Errorf("Expected the fallback for an internal error, got %q", got)
+	}
+}
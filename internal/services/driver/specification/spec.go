@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"ride-hail/internal/services/driver/models"
+	"ride-hail/internal/shared/core"
 	appErrors "ride-hail/internal/shared/errors"
 	"ride-hail/pkg/sqlc"
 	"ride-hail/pkg/uuid"
@@ -15,6 +16,7 @@ import (
 var (
 	ErrDriverAlreadyOnline  = appErrors.NewConflictError("driver already online")
 	ErrDriverAlreadyOffline = appErrors.NewConflictError("driver already offline")
+	ErrDriverOnActiveRide   = appErrors.NewConflictError("driver cannot go offline during an active ride")
 )
 
 type DriverSpecification struct {
@@ -61,7 +63,15 @@ func (s *DriverSpecification) Offline(ctx context.Context, driverID uuid.UUID) e
 		return err
 	}
 
-	return err
+	profile, err := s.queries.GetDriverProfile(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	if profile.Status == core.DriverStatusBusy.String() || profile.Status == core.DriverStatusEnRoute.String() {
+		return ErrDriverOnActiveRide
+	}
+
+	return nil
 }
 
 func (s *DriverSpecification) UpdateLocation(ctx context.Context, arg models.LocationUpdateRequest) error {
@@ -17,10 +17,10 @@ type RideApi struct {
 	server           *http.Server
 }
 
-func NewRideApi(authService *auth.AuthService, ride *RideService, port string) *RideApi {
-	wsManager := server.NewManager()
+func NewRideApi(authService *auth.AuthService, ride *RideService, port string, socketConfig server.ManagerConfig) *RideApi {
+	wsManager := server.NewManager(socketConfig)
 
-	authMiddleware := middleware.AuthMiddleware(*authService,core.UserRolePassenger)
+	authMiddleware := middleware.AuthMiddleware(*authService, core.UserRolePassenger)
 	handler := newHandler(ride, wsManager, authService)
 
 	api := &RideApi{
@@ -43,9 +43,14 @@ func (r *RideApi) Start() error {
 	mux.Handle("POST /login", middleware.LoggingMiddleware(r.handler.login))
 
 	mux.Handle("POST /rides", chain(r.handler.create))
+	mux.Handle("GET /rides", chain(r.handler.list))
+	mux.Handle("GET /rides/{id}", chain(r.handler.get))
+	mux.Handle("GET /rides/{id}/events", chain(r.handler.events))
+	mux.Handle("GET /rides/{id}/stream", chain(r.handler.stream))
 	mux.Handle("POST /rides/{id}/cancel", chain(r.handler.cancel))
 
-	mux.Handle("GET /ws/passengers/{id}", chain(r.handler.websocket))
+	// sockets authenticate themselves, see server.Manager.ServeWS
+	mux.Handle("GET /ws/passengers/{id}", middleware.LoggingMiddleware(r.handler.websocket))
 
 	r.server.Handler = mux
 	return r.server.ListenAndServe()
@@ -1,10 +1,12 @@
 package ride
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"ride-hail/internal/shared/core"
+	"ride-hail/pkg/mq"
 	"ride-hail/pkg/uuid"
 )
 
@@ -72,17 +74,79 @@ func (r *CancelRideRequest) Validate() error {
 	return nil
 }
 
+// GET /rides/{id}
 type RideResponse struct {
-	ID                string    `json:"id"`
-	RideNumber        string    `json:"ride_number"`
-	Status            string    `json:"status"`
-	VehicleType       string    `json:"vehicle_type,omitempty"`
-	EstimatedFare     float64   `json:"estimated_fare,omitempty"`
-	EstimatedDuration int       `json:"estimated_duration_minutes,omitempty"`
-	EstimatedDistance float64   `json:"estimated_distance_km,omitempty"`
-	RequestedAt       time.Time `json:"requested_at"`
-	PickupLocation    Location  `json:"pickup_location,omitempty"`
-	DestLocation      Location  `json:"destination_location,omitempty"`
+	ID                 string        `json:"id"`
+	RideNumber         string        `json:"ride_number"`
+	Status             string        `json:"status"`
+	VehicleType        string        `json:"vehicle_type,omitempty"`
+	EstimatedFare      float64       `json:"estimated_fare,omitempty"`
+	FinalFare          *float64      `json:"final_fare,omitempty"`
+	EstimatedDuration  int           `json:"estimated_duration_minutes,omitempty"`
+	EstimatedDistance  float64       `json:"estimated_distance_km,omitempty"`
+	RequestedAt        time.Time     `json:"requested_at"`
+	MatchedAt          *time.Time    `json:"matched_at,omitempty"`
+	ArrivedAt          *time.Time    `json:"arrived_at,omitempty"`
+	StartedAt          *time.Time    `json:"started_at,omitempty"`
+	CompletedAt        *time.Time    `json:"completed_at,omitempty"`
+	CancelledAt        *time.Time    `json:"cancelled_at,omitempty"`
+	CancellationReason string        `json:"cancellation_reason,omitempty"`
+	PickupLocation     Location      `json:"pickup_location,omitempty"`
+	DestLocation       Location      `json:"destination_location,omitempty"`
+	Driver             *WsDriverInfo `json:"driver,omitempty"`
+}
+
+// GET /rides
+type ListRidesRequest struct {
+	PassengerID uuid.UUID
+	Status      *core.RideStatus
+	From        *time.Time // inclusive, on requested_at
+	To          *time.Time // exclusive, on requested_at
+	Cursor      string
+	Limit       int
+}
+
+func (r *ListRidesRequest) Validate() error {
+	if r.Limit < 1 || r.Limit > maxRidePageSize {
+		return fmt.Errorf("limit must be between 1 and %d", maxRidePageSize)
+	}
+	if r.From != nil && r.To != nil && !r.From.Before(*r.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	return nil
+}
+
+type RideListResponse struct {
+	Rides      []RideSummary `json:"rides"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+type RideSummary struct {
+	ID                 string     `json:"id"`
+	RideNumber         string     `json:"ride_number"`
+	Status             string     `json:"status"`
+	VehicleType        string     `json:"vehicle_type,omitempty"`
+	DriverID           string     `json:"driver_id,omitempty"`
+	EstimatedFare      float64    `json:"estimated_fare,omitempty"`
+	FinalFare          *float64   `json:"final_fare,omitempty"`
+	RequestedAt        time.Time  `json:"requested_at"`
+	CompletedAt        *time.Time `json:"completed_at,omitempty"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+	PickupAddress      string     `json:"pickup_address"`
+	DestinationAddress string     `json:"destination_address"`
+}
+
+// GET /rides/{id}/events
+type RideEventsResponse struct {
+	RideID string              `json:"ride_id"`
+	Events []RideEventResponse `json:"events"`
+}
+
+type RideEventResponse struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"event_type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
 }
 
 type CancelRideResponse struct {
@@ -98,6 +162,45 @@ type Location struct {
 	Address   string  `json:"address"`
 }
 
+const (
+	MessageTypeRideStatusUpdate     = "ride_status_update"
+	MessageTypeDriverLocationUpdate = "driver_location_update"
+)
+
+// RideStatusUpdateMessage is pushed to the passenger's WebSocket on every status change
+type RideStatusUpdateMessage struct {
+	Type          string        `json:"type"`
+	RideID        string        `json:"ride_id"`
+	RideNumber    string        `json:"ride_number,omitempty"`
+	Status        string        `json:"status"`
+	DriverInfo    *WsDriverInfo `json:"driver_info,omitempty"`
+	Message       string        `json:"message,omitempty"`
+	FinalFare     *float64      `json:"final_fare,omitempty"` // set once COMPLETED
+	CorrelationID string        `json:"correlation_id,omitempty"`
+}
+
+type WsDriverInfo struct {
+	DriverID string          `json:"driver_id"`
+	Name     string          `json:"name"`
+	Rating   float64         `json:"rating"`
+	Vehicle  *mq.VehicleInfo `json:"vehicle,omitempty"`
+}
+
+// DriverLocationUpdateMessage streams the matched driver's position to the passenger
+type DriverLocationUpdateMessage struct {
+	Type                    string    `json:"type"`
+	RideID                  string    `json:"ride_id"`
+	DriverLocation          WsLatLng  `json:"driver_location"`
+	EstimatedArrival        time.Time `json:"estimated_arrival"`
+	DistanceToPickupKm      *float64  `json:"distance_to_pickup_km,omitempty"`
+	DistanceToDestinationKm *float64  `json:"distance_to_destination_km,omitempty"`
+}
+
+type WsLatLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
@@ -125,18 +228,57 @@ type CancelRideInput struct {
 }
 
 type RideOutput struct {
-	ID                string
-	RideNumber        string
-	Status            core.RideStatus
-	VehicleType       string
-	EstimatedFare     float64
-	EstimatedDuration int
-	EstimatedDistance float64
-	RequestedAt       time.Time
-	PickupLat         float64
-	PickupLng         float64
-	PickupAddress     string
-	DestLat           float64
-	DestLng           float64
-	DestAddress       string
+	ID                 string
+	RideNumber         string
+	Status             core.RideStatus
+	VehicleType        string
+	EstimatedFare      float64
+	FinalFare          *float64
+	EstimatedDuration  int
+	EstimatedDistance  float64
+	RequestedAt        time.Time
+	MatchedAt          *time.Time
+	ArrivedAt          *time.Time
+	StartedAt          *time.Time
+	CompletedAt        *time.Time
+	CancelledAt        *time.Time
+	CancellationReason string
+	PickupLat          float64
+	PickupLng          float64
+	PickupAddress      string
+	DestLat            float64
+	DestLng            float64
+	DestAddress        string
+	Driver             *WsDriverInfo
+}
+
+func (o RideOutput) Response() RideResponse {
+	return RideResponse{
+		ID:                 o.ID,
+		RideNumber:         o.RideNumber,
+		Status:             o.Status.String(),
+		VehicleType:        o.VehicleType,
+		EstimatedFare:      o.EstimatedFare,
+		FinalFare:          o.FinalFare,
+		EstimatedDuration:  o.EstimatedDuration,
+		EstimatedDistance:  o.EstimatedDistance,
+		RequestedAt:        o.RequestedAt,
+		MatchedAt:          o.MatchedAt,
+		ArrivedAt:          o.ArrivedAt,
+		StartedAt:          o.StartedAt,
+		CompletedAt:        o.CompletedAt,
+		CancelledAt:        o.CancelledAt,
+		CancellationReason: o.CancellationReason,
+		PickupLocation: Location{
+			Latitude:  o.PickupLat,
+			Longitude: o.PickupLng,
+			Address:   o.PickupAddress,
+		},
+		DestLocation: Location{
+			Latitude:  o.DestLat,
+			Longitude: o.DestLng,
+			Address:   o.DestAddress,
+		},
+		Driver: o.Driver,
+	}
 }
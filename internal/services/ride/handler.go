@@ -2,12 +2,19 @@ package ride
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"ride-hail/internal/auth"
 	"ride-hail/internal/middleware"
 	"ride-hail/internal/shared/core"
+	appErrors "ride-hail/internal/shared/errors"
 	"ride-hail/pkg/server"
 	"ride-hail/pkg/uuid"
 )
@@ -111,21 +118,10 @@ func (h handler) cancel(w http.ResponseWriter, r *http.Request) {
 	// Cancel the ride
 	response, err := h.service.CancelRide(r.Context(), rideID, passengerID, cancelReq.Reason)
 	if err != nil {
-		// Check for specific error types
-		if err.Error() == "ride not found: no rows in result set" || err.Error() == "ride not found: sql: no rows in result set" {
-			http.Error(w, "ride not found", http.StatusNotFound)
-			return
-		}
-		if err.Error() == "unauthorized: ride does not belong to passenger" {
-			http.Error(w, "unauthorized: you can only cancel your own rides", http.StatusForbidden)
-			return
-		}
-		if err.Error() == "cannot cancel completed ride" {
-			http.Error(w, "cannot cancel completed ride", http.StatusBadRequest)
-			return
-		}
-		if err.Error() == "ride is already cancelled" {
-			http.Error(w, "ride is already cancelled", http.StatusBadRequest)
+		// Not found, not the passenger's or not cancellable in its status
+		var appErr *appErrors.AppError
+		if errors.As(err, &appErr) {
+			http.Error(w, appErr.Message, appErr.StatusCode)
 			return
 		}
 		http.Error(w, "failed to cancel ride: "+err.Error(), http.StatusInternalServerError)
@@ -139,8 +135,191 @@ func (h handler) cancel(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
+func (h handler) get(w http.ResponseWriter, r *http.Request) {
+	rideID, err := uuid.FromString(r.PathValue("id"))
+	if err != nil {
+		writeError(w, appErrors.NewInvalidInputError("invalid ride ID format"))
+		return
+	}
+
+	passengerID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, appErrors.NewUnauthorizedError("invalid user context"))
+		return
+	}
+
+	ride, err := h.service.GetRide(r.Context(), rideID, passengerID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ride.Response())
+}
+
+func (h handler) list(w http.ResponseWriter, r *http.Request) {
+	passengerID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, appErrors.NewUnauthorizedError("invalid user context"))
+		return
+	}
+
+	req, err := parseListRidesRequest(r.URL.Query())
+	if err != nil {
+		writeError(w, appErrors.NewInvalidInputError(err.Error()))
+		return
+	}
+	req.PassengerID = passengerID
+
+	rides, err := h.service.ListRides(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rides)
+}
+
+func (h handler) events(w http.ResponseWriter, r *http.Request) {
+	rideID, err := uuid.FromString(r.PathValue("id"))
+	if err != nil {
+		writeError(w, appErrors.NewInvalidInputError("invalid ride ID format"))
+		return
+	}
+
+	passengerID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, appErrors.NewUnauthorizedError("invalid user context"))
+		return
+	}
+
+	events, err := h.service.RideEvents(r.Context(), rideID, passengerID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+// parseListRidesRequest reads ?status=&from=&to=&cursor=&limit=. from and to
+// accept RFC 3339 timestamps or dates; a date in to includes that whole day
+func parseListRidesRequest(query url.Values) (ListRidesRequest, error) {
+	req := ListRidesRequest{
+		Cursor: query.Get("cursor"),
+		Limit:  defaultRidePageSize,
+	}
+
+	if v := query.Get("status"); v != "" {
+		status, err := core.ParseRideStatus(v)
+		if err != nil {
+			return ListRidesRequest{}, fmt.Errorf("invalid status %q", v)
+		}
+		req.Status = &status
+	}
+
+	if v := query.Get("from"); v != "" {
+		from, _, err := parseTimeFilter(v)
+		if err != nil {
+			return ListRidesRequest{}, fmt.Errorf("invalid from: %w", err)
+		}
+		req.From = &from
+	}
+
+	if v := query.Get("to"); v != "" {
+		to, dateOnly, err := parseTimeFilter(v)
+		if err != nil {
+			return ListRidesRequest{}, fmt.Errorf("invalid to: %w", err)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		req.To = &to
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return ListRidesRequest{}, fmt.Errorf("invalid limit %q", v)
+		}
+		req.Limit = limit
+	}
+
+	return req, nil
+}
+
+func parseTimeFilter(v string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	if t, err = time.Parse(time.DateOnly, v); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, errors.New("expected RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	bytes, _ := json.Marshal(payload)
+	w.Write(bytes)
+}
+
+// writeError maps AppErrors to their status code and hides anything else behind a 500
+func writeError(w http.ResponseWriter, err error) {
+	var appErr *appErrors.AppError
+	if !errors.As(err, &appErr) {
+		slog.Error("Ride request failed", "error", err)
+		appErr = appErrors.NewInternalError("internal server error", err)
+	}
+
+	status, body := appErr.ToHTTPResponse("")
+	writeJSON(w, status, ErrorResponse{
+		Error:   body.Type,
+		Message: body.Message,
+	})
+}
+
+// stream carries the passenger socket's frames about the ride as server-sent
+// events, for clients behind proxies that block websocket upgrades
+func (h handler) stream(w http.ResponseWriter, r *http.Request) {
+	rideID, err := uuid.FromString(r.PathValue("id"))
+	if err != nil {
+		writeError(w, appErrors.NewInvalidInputError("invalid ride ID format"))
+		return
+	}
+
+	passengerID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, appErrors.NewUnauthorizedError("invalid user context"))
+		return
+	}
+
+	if _, err := h.service.GetRide(r.Context(), rideID, passengerID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.manager.ServeSSE(w, r, passengerID, rideFrames(rideID))
+}
+
+// rideFrames keeps the frames about rideID, and those without a ride_id that
+// are about the stream itself, e.g. resync
+func rideFrames(rideID uuid.UUID) func(frame []byte) bool {
+	id := rideID.String()
+	return func(frame []byte) bool {
+		var header struct {
+			RideID string `json:"ride_id"`
+		}
+		if err := json.Unmarshal(frame, &header); err != nil {
+			return false
+		}
+		return header.RideID == "" || header.RideID == id
+	}
+}
+
 func (h handler) websocket(w http.ResponseWriter, r *http.Request) {
-	h.manager.ServeWS(w, r)
+	h.manager.ServeWS(w, r, middleware.SocketAuth(*h.auth, core.UserRolePassenger))
 }
 
 func (h handler) signUp(w http.ResponseWriter, r *http.Request) {
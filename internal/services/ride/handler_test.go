@@ -10,6 +10,7 @@ import (
 
 	"ride-hail/internal/auth"
 	"ride-hail/internal/middleware"
+	"ride-hail/internal/shared/fare"
 	"ride-hail/pkg/uuid"
 )
 
@@ -377,7 +378,7 @@ func TestCreateRide_InvalidJSON(t *testing.T) {
 
 // TestFareCalculation tests the fare calculation logic
 func TestFareCalculation(t *testing.T) {
-	service := &RideService{}
+	service := NewRideService(nil, nil, RequestTimeouts{}, Matching{})
 
 	tests := []struct {
 		name        string
@@ -425,7 +426,10 @@ func TestFareCalculation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := service.calculateFare(tt.vehicleType, tt.distanceKm, tt.durationMin)
+			result, err := service.fares.CalculateFare(tt.vehicleType, tt.distanceKm, float64(tt.durationMin), noSurge)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			if result != tt.expected {
 				t.Errorf("Expected fare %.2f, got %.2f", tt.expected, result)
@@ -449,21 +453,21 @@ func TestRateTableValues(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.vehicleType, func(t *testing.T) {
-			rate, exists := Rates[tt.vehicleType]
-			if !exists {
+			rate, err := fare.NewCalculator().GetRate(tt.vehicleType)
+			if err != nil {
 				t.Errorf("Rate table missing for vehicle type: %s", tt.vehicleType)
 			}
 
-			if rate.Base != tt.expectedBase {
-				t.Errorf("Expected base fare %.2f, got %.2f", tt.expectedBase, rate.Base)
+			if rate.BaseFare != tt.expectedBase {
+				t.Errorf("Expected base fare %.2f, got %.2f", tt.expectedBase, rate.BaseFare)
 			}
 
-			if rate.PerKm != tt.expectedPerKm {
-				t.Errorf("Expected per-km rate %.2f, got %.2f", tt.expectedPerKm, rate.PerKm)
+			if rate.RatePerKm != tt.expectedPerKm {
+				t.Errorf("Expected per-km rate %.2f, got %.2f", tt.expectedPerKm, rate.RatePerKm)
 			}
 
-			if rate.PerMin != tt.expectedPerMin {
-				t.Errorf("Expected per-minute rate %.2f, got %.2f", tt.expectedPerMin, rate.PerMin)
+			if rate.RatePerMinute != tt.expectedPerMin {
+				t.Errorf("Expected per-minute rate %.2f, got %.2f", tt.expectedPerMin, rate.RatePerMinute)
 			}
 		})
 	}
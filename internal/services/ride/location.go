@@ -0,0 +1,154 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"ride-hail/internal/shared/core"
+	"ride-hail/pkg/geo"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// below this the reported speed is treated as stopped in traffic
+	minEtaSpeedKmh      = 5.0
+	fallbackEtaSpeedKmh = 30.0
+)
+
+// LocationHandler consumes location_updates_ride and forwards the matched
+// driver's position to the passenger's WebSocket
+type LocationHandler struct {
+	service *RideService
+	manager *server.Manager
+}
+
+func NewLocationHandler(service *RideService, manager *server.Manager) *LocationHandler {
+	return &LocationHandler{
+		service: service,
+		manager: manager,
+	}
+}
+
+// Handle is the mq.MessageHandler for the location_updates_ride queue
+func (h *LocationHandler) Handle(ctx context.Context, message mq.Message) error {
+	update, err := mq.DecodeAs[mq.LocationUpdateMessage](message)
+	if err != nil {
+		return fmt.Errorf("invalid location update: %w", err)
+	}
+	if update.EntityType != "driver" || update.Location == nil {
+		return nil
+	}
+
+	driverID, err := uuid.FromString(update.EntityID)
+	if err != nil {
+		return mq.Permanent(fmt.Errorf("invalid driver id %q: %w", update.EntityID, err))
+	}
+
+	ride, err := h.service.activeRide(ctx, driverID, update.RideID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// driver is not on a ride, nobody to notify
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	frame, err := h.service.driverLocationUpdate(ctx, ride, update)
+	if err != nil {
+		return err
+	}
+
+	pushToPassenger(ctx, h.manager, ride.PassengerID, frame)
+	return nil
+}
+
+// activeRide finds the ride a driver's update belongs to, preferring the ride id
+// the driver reported and falling back to their latest active ride
+func (s *RideService) activeRide(ctx context.Context, driverID uuid.UUID, rideID string) (sqlc.Ride, error) {
+	if rideID == "" {
+		return s.queries.GetActiveRideByDriver(ctx, driverID)
+	}
+
+	id, err := uuid.FromString(rideID)
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("invalid ride id %q: %w", rideID, err)
+	}
+	ride, err := s.queries.GetRideByID(ctx, id)
+	if err != nil {
+		return sqlc.Ride{}, err
+	}
+	if ride.DriverID != driverID {
+		slog.Warn("Location update for a ride assigned to another driver",
+			"ride_id", rideID,
+			"driver_id", driverID.String(),
+		)
+		return sqlc.Ride{}, pgx.ErrNoRows
+	}
+	if status, err := core.RideStatusFromDB(ride.Status); err != nil || !status.IsActive() {
+		return sqlc.Ride{}, pgx.ErrNoRows
+	}
+	return ride, nil
+}
+
+// driverLocationUpdate builds the passenger frame, measuring the ETA to pickup
+// until the ride starts and to the destination afterwards
+func (s *RideService) driverLocationUpdate(ctx context.Context, ride sqlc.Ride, update mq.LocationUpdateMessage) (DriverLocationUpdateMessage, error) {
+	status, _ := core.RideStatusFromDB(ride.Status)
+	toDestination := status == core.RideStatusInProgress
+
+	targetID := ride.PickupCoordinateID
+	if toDestination {
+		targetID = ride.DestinationCoordinateID
+	}
+	target, err := s.queries.GetCoordinateByID(ctx, targetID)
+	if err != nil {
+		return DriverLocationUpdateMessage{}, fmt.Errorf("failed to load ride coordinates: %w", err)
+	}
+
+	distanceKm, eta := estimateArrival(
+		update.Location.Latitude, update.Location.Longitude,
+		sqlc.FloatFromNumeric(target.Latitude), sqlc.FloatFromNumeric(target.Longitude),
+		update.Speed, update.Timestamp,
+	)
+
+	frame := DriverLocationUpdateMessage{
+		Type:   MessageTypeDriverLocationUpdate,
+		RideID: ride.ID.String(),
+		DriverLocation: WsLatLng{
+			Lat: update.Location.Latitude,
+			Lng: update.Location.Longitude,
+		},
+		EstimatedArrival: eta,
+	}
+	if toDestination {
+		frame.DistanceToDestinationKm = &distanceKm
+	} else {
+		frame.DistanceToPickupKm = &distanceKm
+	}
+	return frame, nil
+}
+
+// estimateArrival returns the straight-line distance in km, rounded to 10 m,
+// and the arrival time at the reported speed
+func estimateArrival(fromLat, fromLng, toLat, toLng, speedKmh float64, at time.Time) (float64, time.Time) {
+	if speedKmh < minEtaSpeedKmh {
+		speedKmh = fallbackEtaSpeedKmh
+	}
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+
+	distanceKm := geo.Distance(fromLat, fromLng, toLat, toLng)
+	travel := time.Duration(distanceKm / speedKmh * float64(time.Hour))
+
+	return math.Round(distanceKm*100) / 100, at.Add(travel).Truncate(time.Second)
+}
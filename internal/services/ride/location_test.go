@@ -0,0 +1,33 @@
+package ride
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateArrival(t *testing.T) {
+	at := time.Date(2024, 12, 16, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		speedKmh float64
+		wantETA  time.Time
+	}{
+		// 43.238949,76.889709 -> 43.238949,76.901998 is ~1.0 km
+		{name: "reported speed", speedKmh: 60, wantETA: at.Add(time.Minute)},
+		{name: "stopped falls back to city speed", speedKmh: 0, wantETA: at.Add(2 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distanceKm, eta := estimateArrival(43.238949, 76.889709, 43.238949, 76.901998, tt.speedKmh, at)
+
+			if distanceKm < 0.99 || distanceKm > 1.01 {
+				t.Errorf("Expected ~1 km, got %.2f", distanceKm)
+			}
+			if diff := eta.Sub(tt.wantETA); diff < -5*time.Second || diff > 5*time.Second {
+				t.Errorf("Expected ETA near %v, got %v", tt.wantETA, eta)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package ride
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"ride-hail/internal/shared/core"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/internal/shared/outbox"
+	"ride-hail/internal/shared/txn"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrRideNotAwaitingDriver = appErrors.NewConflictError("ride is no longer awaiting a driver")
+
+// MatchRide assigns the accepting driver to a ride that may still move to
+// MATCHED, records the DRIVER_MATCHED event and queues ride.status.MATCHED in
+// the outbox. Duplicate or stale acceptances fail with ErrRideNotAwaitingDriver,
+// whether the ride was seen in another status or changed before the update.
+// It joins the transaction ctx carries, if any
+func (s *RideService) MatchRide(ctx context.Context, resp mq.DriverResponseMessage) (sqlc.Ride, error) {
+	rideID, err := uuid.FromString(resp.RideID)
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("invalid ride_id %q: %w", resp.RideID, err)
+	}
+	driverID, err := uuid.FromString(resp.DriverID)
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("invalid driver_id %q: %w", resp.DriverID, err)
+	}
+
+	tx, err := txn.Begin(ctx, s.db)
+	if err != nil {
+		return sqlc.Ride{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+
+	qTx := s.queries.WithTx(tx)
+
+	current, err := qTx.GetRideByID(ctx, rideID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrRideNotAwaitingDriver
+		return sqlc.Ride{}, err
+	}
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("failed to load ride: %w", err)
+	}
+	status, err := core.RideStatusFromDB(current.Status)
+	if err != nil {
+		return sqlc.Ride{}, err
+	}
+	if !status.CanTransitionTo(core.RideStatusMatched) {
+		err = ErrRideNotAwaitingDriver
+		return sqlc.Ride{}, err
+	}
+
+	ride, err := qTx.UpdateRideMatched(ctx, sqlc.UpdateRideMatchedParams{
+		DriverID:       driverID,
+		ID:             rideID,
+		ExpectedStatus: status.String(),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrRideNotAwaitingDriver
+		return sqlc.Ride{}, err
+	}
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("failed to match ride: %w", err)
+	}
+
+	eventData, err := json.Marshal(map[string]interface{}{
+		"old_status":        status.String(),
+		"new_status":        core.RideStatusMatched.String(),
+		"driver_id":         resp.DriverID,
+		"location":          resp.DriverLocation,
+		"estimated_arrival": resp.EstimatedArrival,
+	})
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("failed to marshal ride event: %w", err)
+	}
+
+	err = qTx.CreateRideEvent(ctx, sqlc.CreateRideEventParams{
+		RideID:    rideID,
+		EventType: core.RideEventMatched.String(),
+		EventData: eventData,
+	})
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("failed to create ride event: %w", err)
+	}
+
+	err = outbox.RideEvents(qTx, rideID, eventProducer).PublishRideStatusWithCorrelation(ctx, core.RideStatusMatched.String(), resp.CorrelationID, rideMatchedMessage(ride, resp))
+	if err != nil {
+		return sqlc.Ride{}, fmt.Errorf("failed to queue ride matched event: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return sqlc.Ride{}, err
+	}
+
+	return ride, nil
+}
+
+// releaseDriver frees a driver whose acceptance lost the race for a ride, so
+// they are offered rides again instead of staying BUSY
+func (s *RideService) releaseDriver(ctx context.Context, resp mq.DriverResponseMessage) error {
+	rideID, err := uuid.FromString(resp.RideID)
+	if err != nil {
+		return err
+	}
+	driverID, err := uuid.FromString(resp.DriverID)
+	if err != nil {
+		return err
+	}
+
+	queries := txn.Queries(ctx, s.queries)
+	ride, err := queries.GetRideByID(ctx, rideID)
+	if err != nil {
+		return fmt.Errorf("failed to load ride: %w", err)
+	}
+	if ride.DriverID == driverID {
+		// redelivery of the acceptance that already won
+		return nil
+	}
+
+	return queries.UpdateDriverStatus(ctx, sqlc.UpdateDriverStatusParams{
+		Status: core.DriverStatusAvailable.String(),
+		ID:     driverID,
+	})
+}
+
+func rideMatchedMessage(ride sqlc.Ride, resp mq.DriverResponseMessage) mq.RideMatchedMessage {
+	message := mq.RideMatchedMessage{
+		EstimatedArrival: resp.EstimatedArrival,
+		MatchedAt:        time.Now().UTC(),
+		RideID:           ride.ID.String(),
+		RideNumber:       ride.RideNumber,
+		PassengerID:      ride.PassengerID.String(),
+		DriverID:         resp.DriverID,
+		DriverLocation:   resp.DriverLocation,
+		CorrelationID:    resp.CorrelationID,
+	}
+	if ride.MatchedAt != nil {
+		message.MatchedAt = *ride.MatchedAt
+	}
+	if ride.VehicleType != nil {
+		message.VehicleType = *ride.VehicleType
+	}
+	if resp.DriverInfo != nil {
+		message.DriverName = resp.DriverInfo.Name
+		message.DriverRating = resp.DriverInfo.Rating
+		if v := resp.DriverInfo.Vehicle; v != nil {
+			message.VehicleMake = v.Make
+			message.VehicleModel = v.Model
+			message.VehicleColor = v.Color
+			message.VehiclePlate = v.Plate
+		}
+	}
+	return message
+}
+
+func rideMatchedUpdate(ride sqlc.Ride, resp mq.DriverResponseMessage) RideStatusUpdateMessage {
+	update := RideStatusUpdateMessage{
+		Type:          MessageTypeRideStatusUpdate,
+		RideID:        ride.ID.String(),
+		RideNumber:    ride.RideNumber,
+		Status:        core.RideStatusMatched.String(),
+		DriverInfo:    &WsDriverInfo{DriverID: resp.DriverID},
+		CorrelationID: resp.CorrelationID,
+	}
+	if resp.DriverInfo != nil {
+		update.DriverInfo.Name = resp.DriverInfo.Name
+		update.DriverInfo.Rating = resp.DriverInfo.Rating
+		update.DriverInfo.Vehicle = resp.DriverInfo.Vehicle
+	}
+	return update
+}
+
+// DriverResponseHandler consumes driver_responses and moves accepted rides to MATCHED
+type DriverResponseHandler struct {
+	service *RideService
+	manager *server.Manager
+}
+
+func NewDriverResponseHandler(service *RideService, manager *server.Manager) *DriverResponseHandler {
+	return &DriverResponseHandler{
+		service: service,
+		manager: manager,
+	}
+}
+
+// Handle is the mq.MessageHandler for the driver_responses queue
+func (h *DriverResponseHandler) Handle(ctx context.Context, message mq.Message) error {
+	resp, err := mq.DecodeAs[mq.DriverResponseMessage](message)
+	if err != nil {
+		return fmt.Errorf("invalid driver response: %w", err)
+	}
+
+	if !resp.Accepted {
+		slog.InfoContext(ctx, "Driver declined ride",
+			"ride_id", resp.RideID,
+			"driver_id", resp.DriverID,
+			"reason", resp.Reason,
+			"correlation_id", message.CorrelationID,
+		)
+		return nil
+	}
+
+	ride, err := h.service.MatchRide(ctx, resp)
+	if errors.Is(err, ErrRideNotAwaitingDriver) {
+		slog.WarnContext(ctx, "Rejected acceptance for ride no longer awaiting a driver",
+			"ride_id", resp.RideID,
+			"driver_id", resp.DriverID,
+			"correlation_id", message.CorrelationID,
+		)
+		if relErr := h.service.releaseDriver(ctx, resp); relErr != nil {
+			slog.ErrorContext(ctx, "Failed to release driver after stale acceptance", "driver_id", resp.DriverID, "error", relErr)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Ride matched",
+		"ride_id", resp.RideID,
+		"driver_id", resp.DriverID,
+		"correlation_id", message.CorrelationID,
+	)
+
+	pushToPassenger(ctx, h.manager, ride.PassengerID, rideMatchedUpdate(ride, resp))
+	return nil
+}
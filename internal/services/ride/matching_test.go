@@ -0,0 +1,68 @@
+package ride
+
+import (
+	"testing"
+	"time"
+
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+)
+
+func TestRideMatchedMessages_CarryDriverInfo(t *testing.T) {
+	vehicleType := "ECONOMY"
+	matchedAt := time.Date(2024, 12, 16, 10, 32, 0, 0, time.UTC)
+	ride := sqlc.Ride{
+		ID:          uuid.New(),
+		RideNumber:  "RIDE_20241216_001",
+		PassengerID: uuid.New(),
+		VehicleType: &vehicleType,
+		MatchedAt:   &matchedAt,
+	}
+	resp := mq.DriverResponseMessage{
+		RideID:        ride.ID.String(),
+		DriverID:      uuid.New().String(),
+		CorrelationID: "req_123456",
+		Accepted:      true,
+		DriverInfo: &mq.DriverInfo{
+			Name:    "Aidar Nurlan",
+			Rating:  4.8,
+			Vehicle: &mq.VehicleInfo{Make: "Toyota", Model: "Camry", Color: "White", Plate: "KZ 123 ABC"},
+		},
+	}
+
+	update := rideMatchedUpdate(ride, resp)
+	if update.Type != MessageTypeRideStatusUpdate || update.Status != "MATCHED" {
+		t.Errorf("Expected ride_status_update with MATCHED, got %s/%s", update.Type, update.Status)
+	}
+	if update.DriverInfo == nil || update.DriverInfo.DriverID != resp.DriverID {
+		t.Fatal("Expected driver_info with the accepting driver")
+	}
+	if update.DriverInfo.Vehicle == nil || update.DriverInfo.Vehicle.Plate != "KZ 123 ABC" {
+		t.Error("Expected vehicle details in driver_info")
+	}
+
+	message := rideMatchedMessage(ride, resp)
+	if message.PassengerID != ride.PassengerID.String() {
+		t.Errorf("Expected passenger %s, got %s", ride.PassengerID.String(), message.PassengerID)
+	}
+	if !message.MatchedAt.Equal(matchedAt) {
+		t.Errorf("Expected matched_at from the ride row, got %v", message.MatchedAt)
+	}
+	if message.VehicleMake != "Toyota" || message.DriverName != "Aidar Nurlan" {
+		t.Errorf("Expected flattened driver info, got %q %q", message.VehicleMake, message.DriverName)
+	}
+}
+
+func TestRideMatchedUpdate_WithoutDriverInfo(t *testing.T) {
+	ride := sqlc.Ride{ID: uuid.New(), RideNumber: "RIDE_20241216_002"}
+	resp := mq.DriverResponseMessage{DriverID: uuid.New().String(), Accepted: true}
+
+	update := rideMatchedUpdate(ride, resp)
+	if update.DriverInfo == nil || update.DriverInfo.DriverID != resp.DriverID {
+		t.Error("Expected driver_id even when the profile is missing")
+	}
+	if update.DriverInfo.Vehicle != nil {
+		t.Error("Expected no vehicle when the profile is missing")
+	}
+}
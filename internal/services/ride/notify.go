@@ -0,0 +1,29 @@
+package ride
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"ride-hail/internal/shared/txn"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/uuid"
+)
+
+// pushToPassenger writes a frame to the passenger's socket once the change
+// being reported is committed; inside a guarded handler that is when the
+// guard's transaction commits. Delivery failures are only logged
+func pushToPassenger(ctx context.Context, manager *server.Manager, passengerID uuid.UUID, frame interface{}) {
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		slog.Error("Failed to marshal passenger frame", "passenger_id", passengerID.String(), "error", err)
+		return
+	}
+
+	txn.AfterCommit(ctx, func() {
+		select {
+		case manager.WriteChannel() <- server.ResponseWs{Payload: payload, ConsumerID: passengerID}:
+		case <-ctx.Done():
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package ride
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ride-hail/internal/shared/core"
+	"ride-hail/internal/shared/driverinfo"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultRidePageSize = 20
+	maxRidePageSize     = 100
+)
+
+var (
+	ErrRideNotFound     = appErrors.NewNotFoundError("ride")
+	ErrRideNotPassenger = appErrors.NewForbiddenError("ride does not belong to passenger")
+	ErrInvalidCursor    = appErrors.NewInvalidInputError("invalid cursor")
+)
+
+// GetRide returns the passenger's ride with its pickup, destination and, once
+// matched, the driver
+func (s *RideService) GetRide(ctx context.Context, rideID, passengerID uuid.UUID) (RideOutput, error) {
+	row, err := s.queries.GetRideDetails(ctx, rideID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RideOutput{}, ErrRideNotFound
+	}
+	if err != nil {
+		return RideOutput{}, fmt.Errorf("failed to load ride: %w", err)
+	}
+	if row.PassengerID != passengerID {
+		return RideOutput{}, ErrRideNotPassenger
+	}
+
+	status, err := core.RideStatusFromDB(row.Status)
+	if err != nil {
+		return RideOutput{}, err
+	}
+
+	out := RideOutput{
+		ID:                row.ID.String(),
+		RideNumber:        row.RideNumber,
+		Status:            status,
+		EstimatedFare:     sqlc.FloatFromNumeric(row.EstimatedFare),
+		FinalFare:         optionalFare(row.FinalFare),
+		EstimatedDuration: int(row.EstimatedDurationMinutes.Int32),
+		EstimatedDistance: sqlc.FloatFromNumeric(row.EstimatedDistanceKm),
+		MatchedAt:         row.MatchedAt,
+		ArrivedAt:         row.ArrivedAt,
+		StartedAt:         row.StartedAt,
+		CompletedAt:       row.CompletedAt,
+		CancelledAt:       row.CancelledAt,
+		PickupLat:         sqlc.FloatFromNumeric(row.PickupLatitude),
+		PickupLng:         sqlc.FloatFromNumeric(row.PickupLongitude),
+		PickupAddress:     row.PickupAddress,
+		DestLat:           sqlc.FloatFromNumeric(row.DestinationLatitude),
+		DestLng:           sqlc.FloatFromNumeric(row.DestinationLongitude),
+		DestAddress:       row.DestinationAddress,
+	}
+	if row.VehicleType != nil {
+		out.VehicleType = *row.VehicleType
+	}
+	if row.RequestedAt != nil {
+		out.RequestedAt = *row.RequestedAt
+	}
+	if row.CancellationReason != nil {
+		out.CancellationReason = *row.CancellationReason
+	}
+
+	if !row.DriverID.IsZero() {
+		profile, err := s.queries.GetDriverProfile(ctx, row.DriverID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return RideOutput{}, fmt.Errorf("failed to load driver: %w", err)
+		}
+		out.Driver = &WsDriverInfo{DriverID: row.DriverID.String()}
+		if err == nil {
+			info := driverinfo.FromProfile(profile)
+			out.Driver.Name = info.Name
+			out.Driver.Rating = info.Rating
+			out.Driver.Vehicle = info.Vehicle
+		}
+	}
+
+	return out, nil
+}
+
+// ListRides pages through the passenger's rides, newest first. NextCursor is
+// empty on the last page
+func (s *RideService) ListRides(ctx context.Context, req ListRidesRequest) (RideListResponse, error) {
+	if err := req.Validate(); err != nil {
+		return RideListResponse{}, appErrors.NewInvalidInputError(err.Error())
+	}
+
+	params := sqlc.ListPassengerRidesParams{
+		PassengerID:   req.PassengerID,
+		RequestedFrom: req.From,
+		RequestedTo:   req.To,
+		PageSize:      req.Limit + 1,
+	}
+	if req.Status != nil {
+		status := req.Status.String()
+		params.Status = &status
+	}
+	if req.Cursor != "" {
+		requestedAt, id, err := decodeRideCursor(req.Cursor)
+		if err != nil {
+			return RideListResponse{}, ErrInvalidCursor
+		}
+		params.CursorRequestedAt = &requestedAt
+		params.CursorID = id
+	}
+
+	rows, err := s.queries.ListPassengerRides(ctx, params)
+	if err != nil {
+		return RideListResponse{}, fmt.Errorf("failed to list rides: %w", err)
+	}
+
+	resp := RideListResponse{Rides: make([]RideSummary, 0, len(rows))}
+	if len(rows) > req.Limit {
+		rows = rows[:req.Limit]
+		last := rows[len(rows)-1]
+		if last.RequestedAt != nil {
+			resp.NextCursor = encodeRideCursor(*last.RequestedAt, last.ID)
+		}
+	}
+
+	for _, row := range rows {
+		summary := RideSummary{
+			ID:                 row.ID.String(),
+			RideNumber:         row.RideNumber,
+			EstimatedFare:      sqlc.FloatFromNumeric(row.EstimatedFare),
+			FinalFare:          optionalFare(row.FinalFare),
+			CompletedAt:        row.CompletedAt,
+			CancelledAt:        row.CancelledAt,
+			PickupAddress:      row.PickupAddress,
+			DestinationAddress: row.DestinationAddress,
+		}
+		if row.Status != nil {
+			summary.Status = *row.Status
+		}
+		if row.VehicleType != nil {
+			summary.VehicleType = *row.VehicleType
+		}
+		if !row.DriverID.IsZero() {
+			summary.DriverID = row.DriverID.String()
+		}
+		if row.RequestedAt != nil {
+			summary.RequestedAt = *row.RequestedAt
+		}
+		resp.Rides = append(resp.Rides, summary)
+	}
+
+	return resp, nil
+}
+
+// RideEvents returns the ride_events audit trail of the passenger's ride, oldest first
+func (s *RideService) RideEvents(ctx context.Context, rideID, passengerID uuid.UUID) (RideEventsResponse, error) {
+	ride, err := s.queries.GetRideByID(ctx, rideID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RideEventsResponse{}, ErrRideNotFound
+	}
+	if err != nil {
+		return RideEventsResponse{}, fmt.Errorf("failed to load ride: %w", err)
+	}
+	if ride.PassengerID != passengerID {
+		return RideEventsResponse{}, ErrRideNotPassenger
+	}
+
+	events, err := s.queries.ListRideEvents(ctx, rideID)
+	if err != nil {
+		return RideEventsResponse{}, fmt.Errorf("failed to list ride events: %w", err)
+	}
+
+	resp := RideEventsResponse{
+		RideID: rideID.String(),
+		Events: make([]RideEventResponse, 0, len(events)),
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, RideEventResponse{
+			ID:        event.ID.String(),
+			EventType: event.EventType,
+			CreatedAt: event.CreatedAt,
+			Data:      event.EventData,
+		})
+	}
+	return resp, nil
+}
+
+func optionalFare(n pgtype.Numeric) *float64 {
+	if !n.Valid {
+		return nil
+	}
+	fare := sqlc.FloatFromNumeric(n)
+	return &fare
+}
+
+// encodeRideCursor packs the position of the last ride on a page into an
+// opaque token for the next request
+func encodeRideCursor(requestedAt time.Time, id uuid.UUID) string {
+	raw := requestedAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeRideCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("malformed cursor")
+	}
+	requestedAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	rideID, err := uuid.FromString(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return requestedAt, rideID, nil
+}
@@ -0,0 +1,100 @@
+package ride
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"ride-hail/pkg/uuid"
+)
+
+func TestRideCursor_RoundTrip(t *testing.T) {
+	requestedAt := time.Date(2024, 12, 16, 10, 30, 0, 123456000, time.UTC)
+	id := uuid.New()
+
+	gotAt, gotID, err := decodeRideCursor(encodeRideCursor(requestedAt, id))
+	if err != nil {
+		t.Fatalf("Expected cursor to decode, got %v", err)
+	}
+	if !gotAt.Equal(requestedAt) || gotID != id {
+		t.Errorf("Expected %v/%s, got %v/%s", requestedAt, id, gotAt, gotID)
+	}
+
+	for _, cursor := range []string{"not base64!", "bm8tc2VwYXJhdG9y", encodeRideCursor(requestedAt, id)[:10]} {
+		if _, _, err := decodeRideCursor(cursor); err == nil {
+			t.Errorf("Expected cursor %q to be rejected", cursor)
+		}
+	}
+}
+
+func TestParseListRidesRequest(t *testing.T) {
+	req, err := parseListRidesRequest(url.Values{})
+	if err != nil {
+		t.Fatalf("Expected empty query to parse, got %v", err)
+	}
+	if req.Limit != defaultRidePageSize || req.Status != nil || req.From != nil || req.To != nil {
+		t.Errorf("Expected defaults, got %+v", req)
+	}
+
+	req, err = parseListRidesRequest(url.Values{
+		"status": {"COMPLETED"},
+		"from":   {"2024-12-01"},
+		"to":     {"2024-12-16"},
+		"limit":  {"50"},
+	})
+	if err != nil {
+		t.Fatalf("Expected filters to parse, got %v", err)
+	}
+	if req.Status == nil || req.Status.String() != "COMPLETED" {
+		t.Errorf("Expected COMPLETED status filter, got %v", req.Status)
+	}
+	if want := time.Date(2024, 12, 17, 0, 0, 0, 0, time.UTC); req.To == nil || !req.To.Equal(want) {
+		t.Errorf("Expected a date-only to to include the whole day, got %v", req.To)
+	}
+	if req.Limit != 50 {
+		t.Errorf("Expected limit 50, got %d", req.Limit)
+	}
+
+	req, err = parseListRidesRequest(url.Values{"to": {"2024-12-16T12:00:00Z"}})
+	if err != nil {
+		t.Fatalf("Expected RFC 3339 to parse, got %v", err)
+	}
+	if want := time.Date(2024, 12, 16, 12, 0, 0, 0, time.UTC); !req.To.Equal(want) {
+		t.Errorf("Expected timestamp to be used as is, got %v", req.To)
+	}
+
+	for _, query := range []url.Values{
+		{"status": {"DRIVING"}},
+		{"from": {"yesterday"}},
+		{"limit": {"ten"}},
+	} {
+		if _, err := parseListRidesRequest(query); err == nil {
+			t.Errorf("Expected %v to be rejected", query)
+		}
+	}
+}
+
+func TestListRidesRequest_Validate(t *testing.T) {
+	from := time.Date(2024, 12, 16, 0, 0, 0, 0, time.UTC)
+	to := from.Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		req     ListRidesRequest
+		wantErr bool
+	}{
+		{name: "valid", req: ListRidesRequest{Limit: 20}},
+		{name: "zero limit", req: ListRidesRequest{Limit: 0}, wantErr: true},
+		{name: "limit too large", req: ListRidesRequest{Limit: maxRidePageSize + 1}, wantErr: true},
+		{name: "from after to", req: ListRidesRequest{Limit: 20, From: &from, To: &to}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
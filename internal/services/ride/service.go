@@ -3,53 +3,54 @@ package ride
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"ride-hail/internal/shared/core"
+	appErrors "ride-hail/internal/shared/errors"
+	"ride-hail/internal/shared/fare"
+	"ride-hail/internal/shared/outbox"
 	"ride-hail/pkg/geo"
 	"ride-hail/pkg/mq"
 	"ride-hail/pkg/sqlc"
 	"ride-hail/pkg/uuid"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type RideEventPublisher = mq.RideEventPublisher
+const (
+	// eventProducer is the producer in the envelopes of the events published here
+	eventProducer = "ride-service"
+	// noSurge prices estimates at the base rates
+	noSurge = 1.0
+)
+
+// Matching is what the ride service asks of driver matching with each request
+type Matching struct {
+	RadiusKm     float64
+	OfferTimeout time.Duration
+}
 
 type RideService struct {
-	queries   *sqlc.Queries
-	db        *pgxpool.Pool
-	publisher *RideEventPublisher
+	queries  *sqlc.Queries
+	db       *pgxpool.Pool
+	timeouts RequestTimeouts
+	matching Matching
+	fares    *fare.Calculator
 }
 
-func NewRideService(db *pgxpool.Pool, queries *sqlc.Queries, publisher *RideEventPublisher) *RideService {
+func NewRideService(db *pgxpool.Pool, queries *sqlc.Queries, timeouts RequestTimeouts, matching Matching) *RideService {
 	return &RideService{
-		db:        db,
-		queries:   queries,
-		publisher: publisher,
+		db:       db,
+		queries:  queries,
+		timeouts: timeouts,
+		matching: matching,
+		fares:    fare.NewCalculator(),
 	}
 }
 
-type RideRate struct {
-	Base   float64
-	PerKm  float64
-	PerMin float64
-}
-
-var Rates = map[string]RideRate{
-	"ECONOMY": {500, 100, 50},
-	"PREMIUM": {800, 120, 60},
-	"XL":      {1000, 150, 75},
-}
-
-func (r *RideService) calculateFare(rideType string, km float64, minutes int) float64 {
-	rate := Rates[rideType]
-	return rate.Base +
-		(km * rate.PerKm) +
-		(float64(minutes) * rate.PerMin)
-}
-
 type CreateRideResponse struct {
 	RideID                   uuid.UUID `json:"ride_id"`
 	RideNumber               string    `json:"ride_number"`
@@ -63,7 +64,11 @@ func (s *RideService) CreateRide(ctx context.Context, req CreateRideRequest) (Cr
 	distanceKm := geo.Distance(req.PickupLat, req.PickupLng, req.DestLat, req.DestLng)
 	durationMin := int(distanceKm * 3)
 
-	fare := s.calculateFare(req.VehicleType, distanceKm, durationMin)
+	// the driver service prices the final fare with the same calculator
+	estimatedFare, err := s.fares.CalculateFare(req.VehicleType, distanceKm, float64(durationMin), noSurge)
+	if err != nil {
+		return CreateRideResponse{}, appErrors.NewInvalidInputError(err.Error())
+	}
 
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -94,7 +99,7 @@ func (s *RideService) CreateRide(ctx context.Context, req CreateRideRequest) (Cr
 		Longitude:       sqlc.NumericFromFloat(req.PickupLng),
 		DistanceKm:      sqlc.NumericFromFloat(distanceKm),
 		DurationMinutes: sqlc.Int4FromInt32(int32(durationMin)),
-		FareAmount:      sqlc.NumericFromFloat(fare),
+		FareAmount:      sqlc.NumericFromFloat(estimatedFare),
 	})
 	if err != nil {
 		return CreateRideResponse{}, err
@@ -115,7 +120,7 @@ func (s *RideService) CreateRide(ctx context.Context, req CreateRideRequest) (Cr
 		RideNumber:              ride_number,
 		PassengerID:             req.PassengerID,
 		VehicleType:             &req.VehicleType,
-		EstimatedFare:           sqlc.NumericFromFloat(fare),
+		EstimatedFare:           sqlc.NumericFromFloat(estimatedFare),
 		PickupCoordinateID:      pickup.ID,
 		DestinationCoordinateID: destination.ID,
 	})
@@ -132,87 +137,52 @@ func (s *RideService) CreateRide(ctx context.Context, req CreateRideRequest) (Cr
 		return CreateRideResponse{}, err
 	}
 
-	err = tx.Commit(ctx)
+	// swept by TimeoutSweeper if no driver accepts in time
+	err = qTx.CreateRideTimeout(ctx, sqlc.CreateRideTimeoutParams{
+		RideID:         ride.ID,
+		TimeoutSeconds: int(s.timeouts.For(req.VehicleType).Seconds()),
+	})
 	if err != nil {
-		return CreateRideResponse{}, err
+		return CreateRideResponse{}, fmt.Errorf("failed to schedule ride timeout: %w", err)
 	}
 
-	// Publish ride request event to RabbitMQ for driver matching
-	if s.publisher != nil {
-		rideRequestMsg := map[string]interface{}{
-			"ride_id":        ride.ID.String(),
-			"ride_number":    ride.RideNumber,
-			"passenger_id":   req.PassengerID.String(),
-			"vehicle_type":   req.VehicleType,
-			"pickup_lat":     req.PickupLat,
-			"pickup_lng":     req.PickupLng,
-			"pickup_addr":    req.PickupAddress,
-			"dest_lat":       req.DestLat,
-			"dest_lng":       req.DestLng,
-			"dest_addr":      req.DestAddress,
-			"estimated_fare": fare,
-			"requested_at":   time.Now().UTC(),
-		}
-		if pubErr := s.publisher.PublishRideRequest(ctx, req.VehicleType, rideRequestMsg); pubErr != nil {
-			// Log error but don't fail the request - ride is already created
-			fmt.Printf("Warning: failed to publish ride request event: %v\n", pubErr)
-		}
+	// ride request for driver matching, sent by the outbox relay once committed
+	rideRequestMsg := mq.RideRequestMessage{
+		RequestedAt: time.Now().UTC(),
+		RideID:      ride.ID.String(),
+		RideNumber:  ride.RideNumber,
+		PassengerID: req.PassengerID.String(),
+		VehicleType: req.VehicleType,
+		PickupLocation: mq.LocationCoordinates{
+			Latitude:  req.PickupLat,
+			Longitude: req.PickupLng,
+			Address:   req.PickupAddress,
+		},
+		DestinationLocation: mq.LocationCoordinates{
+			Latitude:  req.DestLat,
+			Longitude: req.DestLng,
+			Address:   req.DestAddress,
+		},
+		MaxDistanceKm:  s.matching.RadiusKm,
+		TimeoutSeconds: int(s.matching.OfferTimeout.Seconds()),
+		CorrelationID:  ride.ID.String(),
+		EstimatedFare:  estimatedFare,
+	}
+	err = outbox.RideEvents(qTx, ride.ID, eventProducer).PublishRideRequest(ctx, req.VehicleType, rideRequestMsg)
+	if err != nil {
+		return CreateRideResponse{}, err
 	}
 
-		// Start a 2-minute timeout to cancel the ride if still REQUESTED
-		// Runs asynchronously; best-effort cleanup and notification
-		go func(rideID uuid.UUID) {
-			// wait for 2 minutes
-			t := time.NewTimer(2 * time.Minute)
-			defer t.Stop()
-			select {
-			case <-t.C:
-				// after timeout, check ride status
-				ctx2 := context.Background()
-				r, err := s.queries.GetRideByID(ctx2, rideID)
-				if err != nil {
-					fmt.Printf("Warning: timeout check failed to get ride %s: %v\n", rideID.String(), err)
-					return
-				}
-				if r.Status != nil && *r.Status == "REQUESTED" {
-					reason := "NO_DRIVERS_AVAILABLE"
-					cancelledRide, cerr := s.queries.CancelRide(ctx2, sqlc.CancelRideParams{ID: rideID, CancellationReason: &reason})
-					if cerr != nil {
-						fmt.Printf("Warning: failed to cancel ride %s after timeout: %v\n", rideID.String(), cerr)
-						return
-					}
-					// record cancellation event
-					_ = s.queries.CreateRideEvent(ctx2, sqlc.CreateRideEventParams{
-						RideID:    rideID,
-						EventType: core.RideEventCancelled.String(),
-						EventData: json.RawMessage(fmt.Sprintf(`{"status":"CANCELLED","reason":"%s"}`, reason)),
-					})
-					// publish cancelled status
-					if s.publisher != nil {
-						cancelledMsg := map[string]interface{}{
-							"ride_id":      cancelledRide.ID.String(),
-							"ride_number":  cancelledRide.RideNumber,
-							"passenger_id": cancelledRide.PassengerID.String(),
-							"status":       "CANCELLED",
-							"reason":       reason,
-							"cancelled_at": time.Now().UTC(),
-						}
-						if pubErr := s.publisher.PublishRideStatus(ctx2, "CANCELLED", cancelledMsg); pubErr != nil {
-							fmt.Printf("Warning: failed to publish ride cancelled event after timeout: %v\n", pubErr)
-						}
-					}
-				}
-			case <-ctx.Done():
-				// request context cancelled; stop timer
-				return
-			}
-		}(ride.ID)
+	err = tx.Commit(ctx)
+	if err != nil {
+		return CreateRideResponse{}, err
+	}
 
 	return CreateRideResponse{
 		RideID:                   ride.ID,
 		RideNumber:               ride.RideNumber,
 		Status:                   *ride.Status,
-		EstimatedFare:            fare,
+		EstimatedFare:            estimatedFare,
 		EstimatedDurationMinutes: durationMin,
 		EstimatedDistanceKm:      distanceKm,
 	}, nil
@@ -224,26 +194,41 @@ func (s *RideService) generateRideNumber(date time.Time, counter int) string {
 	return fmt.Sprintf("RIDE_%s_%s", datePart, seq)
 }
 
+// Cancellation failures, told apart by the cancel handler with errors.As
+var (
+	ErrRideAlreadyCancelled = appErrors.NewInvalidInputError("ride is already cancelled")
+	ErrRideAlreadyCompleted = appErrors.NewInvalidInputError("cannot cancel completed ride")
+	ErrRideNotCancellable   = appErrors.NewInvalidInputError("cannot cancel ride in progress")
+	ErrRideStatusChanged    = appErrors.NewConflictError("ride status changed, please retry")
+)
+
 func (s *RideService) CancelRide(ctx context.Context, rideID uuid.UUID, passengerID uuid.UUID, reason string) (CancelRideResponse, error) {
 	// First, validate that the ride exists and belongs to the passenger
 	ride, err := s.queries.GetRideByID(ctx, rideID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CancelRideResponse{}, ErrRideNotFound
+	}
 	if err != nil {
-		return CancelRideResponse{}, fmt.Errorf("ride not found: %w", err)
+		return CancelRideResponse{}, fmt.Errorf("failed to load ride: %w", err)
 	}
 
 	// Check if the ride belongs to the passenger
 	if ride.PassengerID != passengerID {
-		return CancelRideResponse{}, fmt.Errorf("unauthorized: ride does not belong to passenger")
+		return CancelRideResponse{}, ErrRideNotPassenger
 	}
 
-	// Check if ride is already cancelled or completed
-	if ride.Status != nil {
-		if *ride.Status == "CANCELLED" {
-			return CancelRideResponse{}, fmt.Errorf("ride is already cancelled")
-		}
-		if *ride.Status == "COMPLETED" {
-			return CancelRideResponse{}, fmt.Errorf("cannot cancel completed ride")
-		}
+	// Check the ride can still be cancelled from its current status
+	status, err := core.RideStatusFromDB(ride.Status)
+	if err != nil {
+		return CancelRideResponse{}, err
+	}
+	switch {
+	case status == core.RideStatusCancelled:
+		return CancelRideResponse{}, ErrRideAlreadyCancelled
+	case status == core.RideStatusCompleted:
+		return CancelRideResponse{}, ErrRideAlreadyCompleted
+	case !status.CanTransitionTo(core.RideStatusCancelled):
+		return CancelRideResponse{}, ErrRideNotCancellable
 	}
 
 	// Begin transaction
@@ -261,11 +246,15 @@ func (s *RideService) CancelRide(ctx context.Context, rideID uuid.UUID, passenge
 
 	qTx := s.queries.WithTx(tx)
 
-	// Update ride status to CANCELLED
+	// Update ride status to CANCELLED, only if nobody moved it since we read it
 	cancelledRide, err := qTx.CancelRide(ctx, sqlc.CancelRideParams{
-		ID:                 rideID,
 		CancellationReason: &reason,
+		ID:                 rideID,
+		ExpectedStatus:     status.String(),
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CancelRideResponse{}, ErrRideStatusChanged
+	}
 	if err != nil {
 		return CancelRideResponse{}, fmt.Errorf("failed to cancel ride: %w", err)
 	}
@@ -280,27 +269,28 @@ func (s *RideService) CancelRide(ctx context.Context, rideID uuid.UUID, passenge
 		return CancelRideResponse{}, fmt.Errorf("failed to create ride event: %w", err)
 	}
 
-	// Commit transaction
-	err = tx.Commit(ctx)
+	// Ride cancelled event, sent by the outbox relay once committed
+	cancelledMsg := mq.RideCancelledMessage{
+		CancelledAt:    time.Now().UTC(),
+		RideID:         rideID.String(),
+		RideNumber:     cancelledRide.RideNumber,
+		PassengerID:    passengerID.String(),
+		PreviousStatus: *ride.Status,
+		CancelledBy:    core.UserRolePassenger.String(),
+		Reason:         reason,
+	}
+	if cancelledRide.CancelledAt != nil {
+		cancelledMsg.CancelledAt = *cancelledRide.CancelledAt
+	}
+	err = outbox.RideEvents(qTx, rideID, eventProducer).PublishRideStatusWithCorrelation(ctx, core.RideStatusCancelled.String(), rideID.String(), cancelledMsg)
 	if err != nil {
 		return CancelRideResponse{}, err
 	}
 
-	// Publish ride cancelled event to RabbitMQ
-	if s.publisher != nil {
-		cancelledMsg := map[string]interface{}{
-			"ride_id":         rideID.String(),
-			"ride_number":     cancelledRide.RideNumber,
-			"passenger_id":    passengerID.String(),
-			"status":          "CANCELLED",
-			"reason":          reason,
-			"cancelled_at":    time.Now().UTC(),
-			"previous_status": *ride.Status,
-		}
-		if pubErr := s.publisher.PublishRideStatus(ctx, "CANCELLED", cancelledMsg); pubErr != nil {
-			// Log error but don't fail the request - ride is already cancelled
-			fmt.Printf("Warning: failed to publish ride cancelled event: %v\n", pubErr)
-		}
+	// Commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return CancelRideResponse{}, err
 	}
 
 	var cancelledAt time.Time
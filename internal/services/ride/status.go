@@ -0,0 +1,134 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"ride-hail/internal/shared/core"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/uuid"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// passengerStatusMessages are the driver-side transitions forwarded to the
+// passenger. MATCHED and CANCELLED are pushed where the ride service makes them,
+// COMPLETED from ride.completed, which carries the final fare
+var passengerStatusMessages = map[core.RideStatus]string{
+	core.RideStatusEnRoute:    "Your driver is on the way",
+	core.RideStatusArrived:    "Your driver has arrived at the pickup location",
+	core.RideStatusInProgress: "Your ride has started",
+}
+
+// RideStatusHandler consumes ride_status and tells passengers about transitions
+// made by the driver service
+type RideStatusHandler struct {
+	service *RideService
+	manager *server.Manager
+}
+
+func NewRideStatusHandler(service *RideService, manager *server.Manager) *RideStatusHandler {
+	return &RideStatusHandler{
+		service: service,
+		manager: manager,
+	}
+}
+
+// Handle is the mq.MessageHandler for the ride_status queue
+func (h *RideStatusHandler) Handle(ctx context.Context, message mq.Message) error {
+	decoded, err := mq.DecodeEvent(message)
+	if err != nil {
+		return fmt.Errorf("invalid ride status message: %w", err)
+	}
+
+	// ride_status also carries ride.matched and ride.cancelled, which the
+	// passenger hears about where the ride service handles them
+	var update RideStatusUpdateMessage
+	var passenger string
+	switch event := decoded.(type) {
+	case mq.RideStatusMessage:
+		var ok bool
+		if update, ok = passengerStatusUpdate(event); !ok {
+			return nil
+		}
+		passenger = event.PassengerID
+	case mq.RideCompletedMessage:
+		update = rideCompletedUpdate(event, message.CorrelationID)
+		passenger = event.PassengerID
+	default:
+		return nil
+	}
+
+	passengerID, err := uuid.FromString(passenger)
+	if err != nil {
+		rideID, err := uuid.FromString(update.RideID)
+		if err != nil {
+			return mq.Permanent(fmt.Errorf("invalid ride_id %q: %w", update.RideID, err))
+		}
+		ride, err := h.service.queries.GetRideByID(ctx, rideID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.WarnContext(ctx, "Ride status for unknown ride", "ride_id", update.RideID)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load ride: %w", err)
+		}
+		passengerID = ride.PassengerID
+		update.RideNumber = ride.RideNumber
+	}
+
+	slog.InfoContext(ctx, "Ride status changed",
+		"ride_id", update.RideID,
+		"status", update.Status,
+		"correlation_id", message.CorrelationID,
+	)
+
+	pushToPassenger(ctx, h.manager, passengerID, update)
+	return nil
+}
+
+// rideCompletedUpdate builds the passenger's COMPLETED frame with the final fare
+func rideCompletedUpdate(event mq.RideCompletedMessage, correlationID string) RideStatusUpdateMessage {
+	update := RideStatusUpdateMessage{
+		Type:          MessageTypeRideStatusUpdate,
+		RideID:        event.RideID,
+		RideNumber:    event.RideNumber,
+		Status:        core.RideStatusCompleted.String(),
+		Message:       "Your ride is complete",
+		FinalFare:     &event.FinalFare,
+		CorrelationID: correlationID,
+	}
+	if event.DriverID != "" {
+		update.DriverInfo = &WsDriverInfo{DriverID: event.DriverID}
+	}
+	return update
+}
+
+// passengerStatusUpdate builds the passenger frame for event, or reports false
+// when the status is not one the passenger is told about here
+func passengerStatusUpdate(event mq.RideStatusMessage) (RideStatusUpdateMessage, bool) {
+	status, err := core.ParseRideStatus(event.NewStatus)
+	if err != nil {
+		return RideStatusUpdateMessage{}, false
+	}
+	text, ok := passengerStatusMessages[status]
+	if !ok {
+		return RideStatusUpdateMessage{}, false
+	}
+
+	update := RideStatusUpdateMessage{
+		Type:          MessageTypeRideStatusUpdate,
+		RideID:        event.RideID,
+		RideNumber:    event.RideNumber,
+		Status:        status.String(),
+		Message:       text,
+		CorrelationID: event.CorrelationID,
+	}
+	if event.DriverID != "" {
+		update.DriverInfo = &WsDriverInfo{DriverID: event.DriverID}
+	}
+	return update, true
+}
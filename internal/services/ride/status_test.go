@@ -0,0 +1,62 @@
+package ride
+
+import (
+	"testing"
+
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/uuid"
+)
+
+func TestPassengerStatusUpdate(t *testing.T) {
+	event := mq.RideStatusMessage{
+		RideID:        uuid.New().String(),
+		RideNumber:    "RIDE_20241216_001",
+		PassengerID:   uuid.New().String(),
+		DriverID:      uuid.New().String(),
+		OldStatus:     "EN_ROUTE",
+		NewStatus:     "ARRIVED",
+		CorrelationID: "req_123456",
+	}
+
+	update, ok := passengerStatusUpdate(event)
+	if !ok {
+		t.Fatal("Expected ARRIVED to be forwarded to the passenger")
+	}
+	if update.Type != MessageTypeRideStatusUpdate || update.Status != "ARRIVED" {
+		t.Errorf("Expected ride_status_update with ARRIVED, got %s/%s", update.Type, update.Status)
+	}
+	if update.Message == "" {
+		t.Error("Expected a message telling the passenger to walk out")
+	}
+	if update.DriverInfo == nil || update.DriverInfo.DriverID != event.DriverID {
+		t.Error("Expected driver_id in driver_info")
+	}
+
+	for _, status := range []string{"MATCHED", "CANCELLED", "", "UNKNOWN"} {
+		event.NewStatus = status
+		if _, ok := passengerStatusUpdate(event); ok {
+			t.Errorf("Expected %q not to be forwarded", status)
+		}
+	}
+}
+
+func TestRideCompletedUpdate(t *testing.T) {
+	event := mq.RideCompletedMessage{
+		RideID:      uuid.New().String(),
+		RideNumber:  "RIDE_20241216_001",
+		PassengerID: uuid.New().String(),
+		DriverID:    uuid.New().String(),
+		FinalFare:   1520,
+	}
+
+	update := rideCompletedUpdate(event, "req_123456")
+	if update.Type != MessageTypeRideStatusUpdate || update.Status != "COMPLETED" {
+		t.Errorf("Expected ride_status_update with COMPLETED, got %s/%s", update.Type, update.Status)
+	}
+	if update.FinalFare == nil || *update.FinalFare != 1520 {
+		t.Errorf("Expected final_fare 1520, got %v", update.FinalFare)
+	}
+	if update.RideID != event.RideID || update.CorrelationID != "req_123456" {
+		t.Errorf("Unexpected ride %s or correlation %s", update.RideID, update.CorrelationID)
+	}
+}
@@ -0,0 +1,178 @@
+package ride
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"ride-hail/internal/shared/core"
+	"ride-hail/internal/shared/outbox"
+	"ride-hail/pkg/conc"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/server"
+	"ride-hail/pkg/sqlc"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultRequestTimeout = 2 * time.Minute
+	timeoutSweepBatch     = 100
+	noDriversReason       = "NO_DRIVERS_AVAILABLE"
+	// cancelledBySystem marks cancellations nobody asked for
+	cancelledBySystem = "SYSTEM"
+)
+
+// RequestTimeouts is how long a ride may wait in REQUESTED before it is
+// cancelled, by vehicle type
+type RequestTimeouts map[string]time.Duration
+
+func (t RequestTimeouts) For(vehicleType string) time.Duration {
+	if d, ok := t[vehicleType]; ok && d > 0 {
+		return d
+	}
+	return defaultRequestTimeout
+}
+
+// ExpireRides cancels up to limit rides whose request timeout is due and that
+// are still REQUESTED, queueing ride.status.CANCELLED for each. Each timeout is
+// claimed and marked processed in the same transaction as the cancellation, so
+// a ride is cancelled exactly once even with several sweepers running
+func (s *RideService) ExpireRides(ctx context.Context, limit int) ([]sqlc.Ride, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			tx.Commit(ctx)
+		}
+	}()
+	qTx := s.queries.WithTx(tx)
+
+	due, err := qTx.ClaimDueRideTimeouts(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim ride timeouts: %w", err)
+	}
+
+	reason := noDriversReason
+	eventData, err := json.Marshal(map[string]interface{}{
+		"old_status": core.RideStatusRequested.String(),
+		"new_status": core.RideStatusCancelled.String(),
+		"reason":     reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cancelled []sqlc.Ride
+	for _, rideID := range due {
+		ride, cancelErr := qTx.CancelRide(ctx, sqlc.CancelRideParams{
+			CancellationReason: &reason,
+			ID:                 rideID,
+			ExpectedStatus:     core.RideStatusRequested.String(),
+		})
+		switch {
+		case errors.Is(cancelErr, pgx.ErrNoRows):
+			// matched or cancelled by the passenger before the deadline
+		case cancelErr != nil:
+			err = fmt.Errorf("failed to cancel ride %s: %w", rideID.String(), cancelErr)
+			return nil, err
+		default:
+			err = qTx.CreateRideEvent(ctx, sqlc.CreateRideEventParams{
+				RideID:    rideID,
+				EventType: core.RideEventCancelled.String(),
+				EventData: eventData,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create ride event: %w", err)
+			}
+			err = outbox.RideEvents(qTx, rideID, eventProducer).PublishRideStatusWithCorrelation(ctx, core.RideStatusCancelled.String(), rideID.String(), rideTimedOutMessage(ride))
+			if err != nil {
+				return nil, err
+			}
+			cancelled = append(cancelled, ride)
+		}
+
+		err = qTx.MarkRideTimeoutProcessed(ctx, rideID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark ride timeout processed: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cancelled, nil
+}
+
+// TimeoutSweeper periodically cancels rides nobody accepted in time and tells
+// their passengers
+type TimeoutSweeper struct {
+	service  *RideService
+	manager  *server.Manager
+	ticker   *conc.Ticker
+	interval time.Duration
+}
+
+func NewTimeoutSweeper(service *RideService, manager *server.Manager, interval time.Duration) *TimeoutSweeper {
+	return &TimeoutSweeper{
+		service:  service,
+		manager:  manager,
+		ticker:   conc.NewTicker(),
+		interval: interval,
+	}
+}
+
+// Run sweeps every interval until ctx is done
+func (s *TimeoutSweeper) Run(ctx context.Context) {
+	s.ticker.Start(ctx, s.interval, func() {
+		s.sweep(ctx)
+	})
+}
+
+func (s *TimeoutSweeper) sweep(ctx context.Context) {
+	cancelled, err := s.service.ExpireRides(ctx, timeoutSweepBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to expire timed out rides", "error", err)
+		}
+		return
+	}
+
+	for _, ride := range cancelled {
+		slog.Info("Cancelled ride with no driver", "ride_id", ride.ID.String(), "ride_number", ride.RideNumber)
+		pushToPassenger(ctx, s.manager, ride.PassengerID, RideStatusUpdateMessage{
+			Type:          MessageTypeRideStatusUpdate,
+			RideID:        ride.ID.String(),
+			RideNumber:    ride.RideNumber,
+			Status:        core.RideStatusCancelled.String(),
+			Message:       "No drivers are available right now, please try again",
+			CorrelationID: ride.ID.String(),
+		})
+	}
+}
+
+// rideTimedOutMessage is the ride.status.CANCELLED event for a ride nobody accepted
+func rideTimedOutMessage(ride sqlc.Ride) mq.RideCancelledMessage {
+	cancelledAt := time.Now().UTC()
+	if ride.CancelledAt != nil {
+		cancelledAt = *ride.CancelledAt
+	}
+	return mq.RideCancelledMessage{
+		CancelledAt:    cancelledAt,
+		RideID:         ride.ID.String(),
+		RideNumber:     ride.RideNumber,
+		PassengerID:    ride.PassengerID.String(),
+		PreviousStatus: core.RideStatusRequested.String(),
+		CancelledBy:    cancelledBySystem,
+		Reason:         noDriversReason,
+	}
+}
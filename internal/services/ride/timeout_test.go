@@ -0,0 +1,34 @@
+package ride
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestTimeouts_For(t *testing.T) {
+	timeouts := RequestTimeouts{
+		"ECONOMY": 90 * time.Second,
+		"PREMIUM": 3 * time.Minute,
+		"XL":      0,
+	}
+
+	tests := []struct {
+		vehicleType string
+		want        time.Duration
+	}{
+		{vehicleType: "ECONOMY", want: 90 * time.Second},
+		{vehicleType: "PREMIUM", want: 3 * time.Minute},
+		{vehicleType: "XL", want: defaultRequestTimeout},
+		{vehicleType: "BIKE", want: defaultRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		if got := timeouts.For(tt.vehicleType); got != tt.want {
+			t.Errorf("Expected %s timeout %v, got %v", tt.vehicleType, tt.want, got)
+		}
+	}
+
+	if got := RequestTimeouts(nil).For("ECONOMY"); got != defaultRequestTimeout {
+		t.Errorf("Expected default timeout without configuration, got %v", got)
+	}
+}
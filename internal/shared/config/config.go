@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 
 	"ride-hail/pkg/utils"
@@ -16,6 +17,11 @@ type Config struct {
 	Env       string
 	Ports     Ports
 	WebSocket WebSocketConfig
+	Driver    DriverConfig
+	Ride      RideConfig
+	Matching  MatchingConfig
+	Outbox    OutboxConfig
+	Messages  MessagesConfig
 }
 
 // DatabaseConfig holds database connection parameters
@@ -29,15 +35,67 @@ type DatabaseConfig struct {
 
 // RabbitMQConfig holds RabbitMQ connection parameters
 type RabbitMQConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	ManagementPort string
 }
 
 // WebSocketConfig holds WebSocket server configuration
 type WebSocketConfig struct {
-	Port int
+	Port                int
+	OutboundBuffer      int    // frames a socket may fall behind by
+	SlowConsumerPolicy  string // "drop_oldest" or "disconnect"
+	ReplayFrames        int    // frames kept per user for reconnects
+	ReplayWindowSeconds int
+}
+
+var slowConsumerPolicies = []string{"drop_oldest", "disconnect"}
+
+// DriverConfig holds driver service tuning
+type DriverConfig struct {
+	ArrivalRadiusMeters int // distance from pickup that counts as arrived, for arriving and starting
+	ArrivalUpdates      int // consecutive in-radius location updates before auto-arrival
+}
+
+// RideConfig holds ride service tuning
+type RideConfig struct {
+	RequestTimeouts     map[string]int // seconds a ride may stay REQUESTED, by vehicle type
+	TimeoutSweepSeconds int
+}
+
+// MatchingConfig holds the driver matching parameters. The ride service sends
+// them with each ride request; the driver service falls back to them
+type MatchingConfig struct {
+	RadiusMeters        int // how far from the pickup drivers are offered the ride
+	OfferTimeoutSeconds int // how long a driver has to answer an offer
+}
+
+// OutboxConfig holds outbox relay tuning
+type OutboxConfig struct {
+	RelayIntervalMillis int
+	BatchSize           int // messages published per relay pass
+	MaxAttempts         int // failed publishes before a message is parked as dead
+}
+
+// MessagesConfig holds consumer idempotency tuning
+type MessagesConfig struct {
+	ProcessedTTLHours      int // how long processed message IDs are remembered
+	CleanupIntervalSeconds int
+}
+
+var vehicleTypes = []string{"ECONOMY", "PREMIUM", "XL"}
+
+func defaultRideConfig() RideConfig {
+	cfg := RideConfig{
+		RequestTimeouts:     make(map[string]int, len(vehicleTypes)),
+		TimeoutSweepSeconds: 5,
+	}
+	for _, vehicleType := range vehicleTypes {
+		cfg.RequestTimeouts[vehicleType] = 120
+	}
+	return cfg
 }
 
 // Ports holds service port configurations
@@ -94,11 +152,65 @@ func LoadConfigFromYAML(path string) (*Config, error) {
 		cfg.RabbitMQ.Port = getStringFromMap(mq, "port", "5672")
 		cfg.RabbitMQ.User = getStringFromMap(mq, "user", "guest")
 		cfg.RabbitMQ.Password = getStringFromMap(mq, "password", "guest")
+		cfg.RabbitMQ.ManagementPort = getStringFromMap(mq, "management_port", "15672")
 	}
 
 	// Parse WebSocket config
+	cfg.WebSocket.OutboundBuffer = 64
+	cfg.WebSocket.SlowConsumerPolicy = "drop_oldest"
+	cfg.WebSocket.ReplayFrames = 100
+	cfg.WebSocket.ReplayWindowSeconds = 120
 	if ws, ok := data["websocket"].(map[string]interface{}); ok {
 		cfg.WebSocket.Port = getIntFromMap(ws, "port", 8080)
+		cfg.WebSocket.OutboundBuffer = getIntFromMap(ws, "outbound_buffer", 64)
+		cfg.WebSocket.SlowConsumerPolicy = getStringFromMap(ws, "slow_consumer_policy", "drop_oldest")
+		cfg.WebSocket.ReplayFrames = getIntFromMap(ws, "replay_frames", 100)
+		cfg.WebSocket.ReplayWindowSeconds = getIntFromMap(ws, "replay_window_seconds", 120)
+	}
+
+	// Parse driver config
+	cfg.Driver.ArrivalRadiusMeters = 100
+	cfg.Driver.ArrivalUpdates = 2
+	if driver, ok := data["driver"].(map[string]interface{}); ok {
+		cfg.Driver.ArrivalRadiusMeters = getIntFromMap(driver, "arrival_radius_meters", 100)
+		cfg.Driver.ArrivalUpdates = getIntFromMap(driver, "arrival_updates", 2)
+	}
+
+	// Parse ride config
+	cfg.Ride = defaultRideConfig()
+	if ride, ok := data["ride"].(map[string]interface{}); ok {
+		cfg.Ride.TimeoutSweepSeconds = getIntFromMap(ride, "timeout_sweep_seconds", 5)
+		if timeouts, ok := ride["request_timeout_seconds"].(map[string]interface{}); ok {
+			for _, vehicleType := range vehicleTypes {
+				cfg.Ride.RequestTimeouts[vehicleType] = getIntFromMap(timeouts, vehicleType, 120)
+			}
+		}
+	}
+
+	// Parse matching config
+	cfg.Matching.RadiusMeters = 5000
+	cfg.Matching.OfferTimeoutSeconds = 30
+	if matching, ok := data["matching"].(map[string]interface{}); ok {
+		cfg.Matching.RadiusMeters = getIntFromMap(matching, "radius_meters", 5000)
+		cfg.Matching.OfferTimeoutSeconds = getIntFromMap(matching, "offer_timeout_seconds", 30)
+	}
+
+	// Parse outbox config
+	cfg.Outbox.RelayIntervalMillis = 500
+	cfg.Outbox.BatchSize = 100
+	cfg.Outbox.MaxAttempts = 10
+	if outbox, ok := data["outbox"].(map[string]interface{}); ok {
+		cfg.Outbox.RelayIntervalMillis = getIntFromMap(outbox, "relay_interval_ms", 500)
+		cfg.Outbox.BatchSize = getIntFromMap(outbox, "batch_size", 100)
+		cfg.Outbox.MaxAttempts = getIntFromMap(outbox, "max_attempts", 10)
+	}
+
+	// Parse messages config
+	cfg.Messages.ProcessedTTLHours = 24
+	cfg.Messages.CleanupIntervalSeconds = 300
+	if messages, ok := data["messages"].(map[string]interface{}); ok {
+		cfg.Messages.ProcessedTTLHours = getIntFromMap(messages, "processed_ttl_hours", 24)
+		cfg.Messages.CleanupIntervalSeconds = getIntFromMap(messages, "cleanup_interval_seconds", 300)
 	}
 
 	// Parse services config
@@ -123,6 +235,21 @@ func LoadConfigFromEnv() (*Config, error) {
 		return nil, fmt.Errorf("invalid WS_PORT: %w", err)
 	}
 
+	wsBuffer, err := strconv.Atoi(utils.GetEnv("WS_OUTBOUND_BUFFER", "64"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WS_OUTBOUND_BUFFER: %w", err)
+	}
+
+	wsReplayFrames, err := strconv.Atoi(utils.GetEnv("WS_REPLAY_FRAMES", "100"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WS_REPLAY_FRAMES: %w", err)
+	}
+
+	wsReplayWindow, err := strconv.Atoi(utils.GetEnv("WS_REPLAY_WINDOW_SECONDS", "120"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WS_REPLAY_WINDOW_SECONDS: %w", err)
+	}
+
 	ridePort, err := strconv.Atoi(utils.GetEnv("RIDE_SERVICE_PORT", "3000"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid RIDE_SERVICE_PORT: %w", err)
@@ -138,6 +265,65 @@ func LoadConfigFromEnv() (*Config, error) {
 		return nil, fmt.Errorf("invalid ADMIN_SERVICE_PORT: %w", err)
 	}
 
+	arrivalRadius, err := strconv.Atoi(utils.GetEnv("DRIVER_ARRIVAL_RADIUS_METERS", "100"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DRIVER_ARRIVAL_RADIUS_METERS: %w", err)
+	}
+
+	arrivalUpdates, err := strconv.Atoi(utils.GetEnv("DRIVER_ARRIVAL_UPDATES", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DRIVER_ARRIVAL_UPDATES: %w", err)
+	}
+
+	rideCfg := defaultRideConfig()
+	rideCfg.TimeoutSweepSeconds, err = strconv.Atoi(utils.GetEnv("RIDE_TIMEOUT_SWEEP_SECONDS", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RIDE_TIMEOUT_SWEEP_SECONDS: %w", err)
+	}
+	defaultTimeout := utils.GetEnv("RIDE_REQUEST_TIMEOUT_SECONDS", "120")
+	for _, vehicleType := range vehicleTypes {
+		key := "RIDE_REQUEST_TIMEOUT_" + vehicleType + "_SECONDS"
+		rideCfg.RequestTimeouts[vehicleType], err = strconv.Atoi(utils.GetEnv(key, defaultTimeout))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	matchRadius, err := strconv.Atoi(utils.GetEnv("MATCHING_RADIUS_METERS", "5000"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MATCHING_RADIUS_METERS: %w", err)
+	}
+
+	offerTimeout, err := strconv.Atoi(utils.GetEnv("MATCHING_OFFER_TIMEOUT_SECONDS", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MATCHING_OFFER_TIMEOUT_SECONDS: %w", err)
+	}
+
+	relayInterval, err := strconv.Atoi(utils.GetEnv("OUTBOX_RELAY_INTERVAL_MS", "500"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOX_RELAY_INTERVAL_MS: %w", err)
+	}
+
+	outboxBatch, err := strconv.Atoi(utils.GetEnv("OUTBOX_BATCH_SIZE", "100"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOX_BATCH_SIZE: %w", err)
+	}
+
+	outboxAttempts, err := strconv.Atoi(utils.GetEnv("OUTBOX_MAX_ATTEMPTS", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOX_MAX_ATTEMPTS: %w", err)
+	}
+
+	processedTTL, err := strconv.Atoi(utils.GetEnv("MESSAGES_PROCESSED_TTL_HOURS", "24"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MESSAGES_PROCESSED_TTL_HOURS: %w", err)
+	}
+
+	cleanupInterval, err := strconv.Atoi(utils.GetEnv("MESSAGES_CLEANUP_INTERVAL_SECONDS", "300"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MESSAGES_CLEANUP_INTERVAL_SECONDS: %w", err)
+	}
+
 	return &Config{
 		Database: DatabaseConfig{
 			Host:     utils.GetEnv("DB_HOST", "localhost"),
@@ -151,9 +337,33 @@ func LoadConfigFromEnv() (*Config, error) {
 			Port:     utils.GetEnv("RABBITMQ_PORT", "5672"),
 			User:     utils.GetEnv("RABBITMQ_USER", "guest"),
 			Password: utils.GetEnv("RABBITMQ_PASSWORD", "guest"),
+
+			ManagementPort: utils.GetEnv("RABBITMQ_MANAGEMENT_PORT", "15672"),
 		},
 		WebSocket: WebSocketConfig{
-			Port: wsPort,
+			Port:                wsPort,
+			OutboundBuffer:      wsBuffer,
+			SlowConsumerPolicy:  utils.GetEnv("WS_SLOW_CONSUMER_POLICY", "drop_oldest"),
+			ReplayFrames:        wsReplayFrames,
+			ReplayWindowSeconds: wsReplayWindow,
+		},
+		Driver: DriverConfig{
+			ArrivalRadiusMeters: arrivalRadius,
+			ArrivalUpdates:      arrivalUpdates,
+		},
+		Ride: rideCfg,
+		Matching: MatchingConfig{
+			RadiusMeters:        matchRadius,
+			OfferTimeoutSeconds: offerTimeout,
+		},
+		Outbox: OutboxConfig{
+			RelayIntervalMillis: relayInterval,
+			BatchSize:           outboxBatch,
+			MaxAttempts:         outboxAttempts,
+		},
+		Messages: MessagesConfig{
+			ProcessedTTLHours:      processedTTL,
+			CleanupIntervalSeconds: cleanupInterval,
 		},
 		Ports: Ports{
 			RideService:           ridePort,
@@ -203,6 +413,53 @@ func (c *Config) Validate() error {
 	if c.WebSocket.Port < 1 || c.WebSocket.Port > 65535 {
 		return fmt.Errorf("websocket port must be between 1 and 65535")
 	}
+	if c.WebSocket.OutboundBuffer < 1 {
+		return fmt.Errorf("websocket outbound buffer must be at least 1")
+	}
+	if !slices.Contains(slowConsumerPolicies, c.WebSocket.SlowConsumerPolicy) {
+		return fmt.Errorf("websocket slow consumer policy must be one of %v", slowConsumerPolicies)
+	}
+	if c.WebSocket.ReplayFrames < 0 {
+		return fmt.Errorf("websocket replay frames must not be negative")
+	}
+	if c.WebSocket.ReplayWindowSeconds < 1 {
+		return fmt.Errorf("websocket replay window must be positive")
+	}
+	if c.Driver.ArrivalRadiusMeters < 1 {
+		return fmt.Errorf("driver arrival radius must be positive")
+	}
+	if c.Driver.ArrivalUpdates < 1 {
+		return fmt.Errorf("driver arrival updates must be at least 1")
+	}
+	for vehicleType, seconds := range c.Ride.RequestTimeouts {
+		if seconds < 1 {
+			return fmt.Errorf("ride request timeout for %s must be positive", vehicleType)
+		}
+	}
+	if c.Ride.TimeoutSweepSeconds < 1 {
+		return fmt.Errorf("ride timeout sweep interval must be positive")
+	}
+	if c.Matching.RadiusMeters < 1 {
+		return fmt.Errorf("matching radius must be positive")
+	}
+	if c.Matching.OfferTimeoutSeconds < 1 {
+		return fmt.Errorf("matching offer timeout must be positive")
+	}
+	if c.Outbox.RelayIntervalMillis < 1 {
+		return fmt.Errorf("outbox relay interval must be positive")
+	}
+	if c.Outbox.BatchSize < 1 {
+		return fmt.Errorf("outbox batch size must be at least 1")
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		return fmt.Errorf("outbox max attempts must be at least 1")
+	}
+	if c.Messages.ProcessedTTLHours < 1 {
+		return fmt.Errorf("processed message TTL must be positive")
+	}
+	if c.Messages.CleanupIntervalSeconds < 1 {
+		return fmt.Errorf("processed message cleanup interval must be positive")
+	}
 	if c.Ports.RideService < 1 || c.Ports.RideService > 65535 {
 		return fmt.Errorf("ride service port must be between 1 and 65535")
 	}
@@ -16,9 +16,9 @@ func (rs RideStatus) String() string {
 	return []string{
 		"REQUESTED",
 		"MATCHED",
-		"ENROUTE",
+		"EN_ROUTE",
 		"ARRIVED",
-		"INPROGRESS",
+		"IN_PROGRESS",
 		"COMPLETED",
 		"CANCELLED",
 	}[rs]
@@ -41,8 +41,8 @@ const (
 func (ret RideEventType) String() string {
 	return []string{
 		"RIDE_REQUESTED",
-		"RIDE_MATCHED",
-		"RIDE_ARRIVED",
+		"DRIVER_MATCHED",
+		"DRIVER_ARRIVED",
 		"RIDE_STARTED",
 		"RIDE_COMPLETED",
 		"RIDE_CANCELLED",
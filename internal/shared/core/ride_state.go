@@ -0,0 +1,70 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownRideStatus = errors.New("unknown ride status")
+
+// rideTransitions lists the statuses each ride status may legally move to.
+// COMPLETED and CANCELLED are terminal. Every status update checks it with
+// CanTransitionTo, then compares-and-sets on the status it saw; the queries
+// stamp the timestamp column of the new status
+var rideTransitions = map[RideStatus][]RideStatus{
+	RideStatusRequested:  {RideStatusMatched, RideStatusCancelled},
+	RideStatusMatched:    {RideStatusEnRoute, RideStatusArrived, RideStatusInProgress, RideStatusCancelled},
+	RideStatusEnRoute:    {RideStatusArrived, RideStatusInProgress, RideStatusCancelled},
+	RideStatusArrived:    {RideStatusInProgress, RideStatusCancelled},
+	RideStatusInProgress: {RideStatusCompleted},
+}
+
+// RideStatuses returns every ride status in lifecycle order
+func RideStatuses() []RideStatus {
+	return []RideStatus{
+		RideStatusRequested,
+		RideStatusMatched,
+		RideStatusEnRoute,
+		RideStatusArrived,
+		RideStatusInProgress,
+		RideStatusCompleted,
+		RideStatusCancelled,
+	}
+}
+
+// ParseRideStatus is the inverse of RideStatus.String and accepts the values of the ride_status table
+func ParseRideStatus(s string) (RideStatus, error) {
+	for _, status := range RideStatuses() {
+		if status.String() == s {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownRideStatus, s)
+}
+
+// RideStatusFromDB parses the nullable rides.status column
+func RideStatusFromDB(s *string) (RideStatus, error) {
+	if s == nil {
+		return 0, fmt.Errorf("%w: NULL", ErrUnknownRideStatus)
+	}
+	return ParseRideStatus(*s)
+}
+
+func (rs RideStatus) CanTransitionTo(next RideStatus) bool {
+	for _, allowed := range rideTransitions[rs] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether a driver is attached to a ride in this status
+func (rs RideStatus) IsActive() bool {
+	switch rs {
+	case RideStatusMatched, RideStatusEnRoute, RideStatusArrived, RideStatusInProgress:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// values of the ride_status table in migrations/001_ride.up.sql
+var dbRideStatuses = []string{
+	"REQUESTED",
+	"MATCHED",
+	"EN_ROUTE",
+	"ARRIVED",
+	"IN_PROGRESS",
+	"COMPLETED",
+	"CANCELLED",
+}
+
+func TestParseRideStatus_RoundTripsWithDB(t *testing.T) {
+	for _, value := range dbRideStatuses {
+		status, err := ParseRideStatus(value)
+		if err != nil {
+			t.Errorf("Expected %q to parse, got %v", value, err)
+			continue
+		}
+		if status.String() != value {
+			t.Errorf("Expected %q to format back, got %q", value, status.String())
+		}
+	}
+
+	if len(RideStatuses()) != len(dbRideStatuses) {
+		t.Errorf("Expected %d statuses, got %d", len(dbRideStatuses), len(RideStatuses()))
+	}
+}
+
+func TestParseRideStatus_Unknown(t *testing.T) {
+	for _, value := range []string{"", "INPROGRESS", "matched"} {
+		if _, err := ParseRideStatus(value); !errors.Is(err, ErrUnknownRideStatus) {
+			t.Errorf("Expected %q to be rejected, got %v", value, err)
+		}
+	}
+
+	if _, err := RideStatusFromDB(nil); !errors.Is(err, ErrUnknownRideStatus) {
+		t.Errorf("Expected NULL status to be rejected, got %v", err)
+	}
+}
+
+func TestRideStatus_Transitions(t *testing.T) {
+	tests := []struct {
+		from RideStatus
+		to   RideStatus
+		want bool
+	}{
+		{RideStatusRequested, RideStatusMatched, true},
+		{RideStatusRequested, RideStatusCancelled, true},
+		{RideStatusRequested, RideStatusInProgress, false},
+		{RideStatusMatched, RideStatusEnRoute, true},
+		{RideStatusMatched, RideStatusArrived, true},
+		{RideStatusEnRoute, RideStatusArrived, true},
+		{RideStatusArrived, RideStatusInProgress, true},
+		{RideStatusArrived, RideStatusMatched, false},
+		{RideStatusInProgress, RideStatusCompleted, true},
+		{RideStatusInProgress, RideStatusCancelled, false},
+		{RideStatusCompleted, RideStatusCancelled, false},
+		{RideStatusCancelled, RideStatusMatched, false},
+		{RideStatusMatched, RideStatusMatched, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from.String()+"->"+tt.to.String(), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRideStatus_TerminalAndActive(t *testing.T) {
+	for _, status := range RideStatuses() {
+		terminal := status == RideStatusCompleted || status == RideStatusCancelled
+		for _, next := range RideStatuses() {
+			if terminal && status.CanTransitionTo(next) {
+				t.Errorf("Expected %s to be terminal, it moves to %s", status, next)
+			}
+		}
+		if status.IsActive() && (terminal || status == RideStatusRequested) {
+			t.Errorf("Expected %s not to be active", status)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package driverinfo
+
+import (
+	"encoding/json"
+	"errors"
+
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+)
+
+// FromProfile flattens a driver's profile row into the driver_info shared
+// with passengers, preferring the name in users.attrs over the email
+func FromProfile(profile sqlc.GetDriverProfileRow) *mq.DriverInfo {
+	info := &mq.DriverInfo{
+		Name:   profile.Email,
+		Rating: sqlc.FloatFromNumeric(profile.Rating),
+	}
+
+	var userAttrs struct {
+		Name string `json:"name"`
+	}
+	if decodeAttrs(profile.Attrs, &userAttrs) == nil && userAttrs.Name != "" {
+		info.Name = userAttrs.Name
+	}
+
+	var vehicleAttrs struct {
+		Make  string `json:"vehicle_make"`
+		Model string `json:"vehicle_model"`
+		Color string `json:"vehicle_color"`
+		Plate string `json:"vehicle_plate"`
+	}
+	if decodeAttrs(profile.VehicleAttrs, &vehicleAttrs) == nil {
+		info.Vehicle = &mq.VehicleInfo{
+			Make:  vehicleAttrs.Make,
+			Model: vehicleAttrs.Model,
+			Color: vehicleAttrs.Color,
+			Plate: vehicleAttrs.Plate,
+		}
+	}
+
+	return info
+}
+
+// decodeAttrs re-decodes a jsonb column scanned into any into a typed struct
+func decodeAttrs(attrs any, target interface{}) error {
+	if attrs == nil {
+		return errors.New("attrs are empty")
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -1,26 +1,26 @@
-package ride
+package fare
 
 import (
 	"fmt"
 	"math"
 )
 
-// FareCalculator calculates ride fares based on vehicle type, distance, and duration
-type FareCalculator struct {
-	rates map[string]FareRate
+// Calculator calculates ride fares based on vehicle type, distance, and duration
+type Calculator struct {
+	rates map[string]Rate
 }
 
-// FareRate defines pricing structure for a vehicle type
-type FareRate struct {
+// Rate defines pricing structure for a vehicle type
+type Rate struct {
 	BaseFare      float64 // Base fare in tenge (₸)
 	RatePerKm     float64 // Rate per kilometer
 	RatePerMinute float64 // Rate per minute
 }
 
-// NewFareCalculator creates a new fare calculator with predefined rates
-func NewFareCalculator() *FareCalculator {
-	return &FareCalculator{
-		rates: map[string]FareRate{
+// NewCalculator creates a new fare calculator with predefined rates
+func NewCalculator() *Calculator {
+	return &Calculator{
+		rates: map[string]Rate{
 			"ECONOMY": {
 				BaseFare:      500.0,
 				RatePerKm:     100.0,
@@ -42,7 +42,7 @@ func NewFareCalculator() *FareCalculator {
 
 // CalculateFare computes the fare for a ride
 // Formula: base_fare + (distance_km * rate_per_km) + (duration_minutes * rate_per_minute)
-func (fc *FareCalculator) CalculateFare(vehicleType string, distanceKm float64, durationMinutes float64, surgeMultiplier float64) (float64, error) {
+func (fc *Calculator) CalculateFare(vehicleType string, distanceKm float64, durationMinutes float64, surgeMultiplier float64) (float64, error) {
 	rate, exists := fc.rates[vehicleType]
 	if !exists {
 		return 0, fmt.Errorf("invalid vehicle type: %s", vehicleType)
@@ -65,7 +65,7 @@ func (fc *FareCalculator) CalculateFare(vehicleType string, distanceKm float64,
 
 // EstimateFare estimates fare without duration (for initial ride request)
 // Uses average speed estimation: 30 km/h in city traffic
-func (fc *FareCalculator) EstimateFare(vehicleType string, distanceKm float64, surgeMultiplier float64) (float64, error) {
+func (fc *Calculator) EstimateFare(vehicleType string, distanceKm float64, surgeMultiplier float64) (float64, error) {
 	const avgSpeedKmH = 30.0
 	estimatedDurationMinutes := (distanceKm / avgSpeedKmH) * 60.0
 
@@ -73,15 +73,15 @@ func (fc *FareCalculator) EstimateFare(vehicleType string, distanceKm float64, s
 }
 
 // GetRates returns the fare rates for all vehicle types
-func (fc *FareCalculator) GetRates() map[string]FareRate {
+func (fc *Calculator) GetRates() map[string]Rate {
 	return fc.rates
 }
 
 // GetRate returns the fare rate for a specific vehicle type
-func (fc *FareCalculator) GetRate(vehicleType string) (FareRate, error) {
+func (fc *Calculator) GetRate(vehicleType string) (Rate, error) {
 	rate, exists := fc.rates[vehicleType]
 	if !exists {
-		return FareRate{}, fmt.Errorf("invalid vehicle type: %s", vehicleType)
+		return Rate{}, fmt.Errorf("invalid vehicle type: %s", vehicleType)
 	}
 	return rate, nil
 }
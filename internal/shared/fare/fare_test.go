@@ -1,14 +1,14 @@
-package ride
+package fare
 
 import (
 	"testing"
 )
 
-func TestNewFareCalculator(t *testing.T) {
-	fc := NewFareCalculator()
+func TestNewCalculator(t *testing.T) {
+	fc := NewCalculator()
 
 	if fc == nil {
-		t.Fatal("NewFareCalculator() returned nil")
+		t.Fatal("NewCalculator() returned nil")
 	}
 
 	rates := fc.GetRates()
@@ -63,7 +63,7 @@ func TestNewFareCalculator(t *testing.T) {
 }
 
 func TestCalculateFare_Economy(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 10 km, 20 minutes, no surge
 	// Expected: 500 + (10 * 100) + (20 * 50) = 500 + 1000 + 1000 = 2500
@@ -77,7 +77,7 @@ func TestCalculateFare_Economy(t *testing.T) {
 }
 
 func TestCalculateFare_Premium(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 5 km, 15 minutes, no surge
 	// Expected: 800 + (5 * 120) + (15 * 60) = 800 + 600 + 900 = 2300
@@ -91,7 +91,7 @@ func TestCalculateFare_Premium(t *testing.T) {
 }
 
 func TestCalculateFare_XL(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 8 km, 10 minutes, no surge
 	// Expected: 1000 + (8 * 150) + (10 * 75) = 1000 + 1200 + 750 = 2950
@@ -105,7 +105,7 @@ func TestCalculateFare_XL(t *testing.T) {
 }
 
 func TestCalculateFare_WithSurge(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 10 km, 20 minutes, 1.5x surge
 	// Expected: (500 + 1000 + 1000) * 1.5 = 2500 * 1.5 = 3750
@@ -119,7 +119,7 @@ func TestCalculateFare_WithSurge(t *testing.T) {
 }
 
 func TestCalculateFare_RoundingToNearest10(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	tests := []struct {
 		name     string
@@ -164,7 +164,7 @@ func TestCalculateFare_RoundingToNearest10(t *testing.T) {
 }
 
 func TestCalculateFare_InvalidVehicleType(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	_, err := fc.CalculateFare("INVALID", 10.0, 20.0, 1.0)
 	if err == nil {
@@ -173,7 +173,7 @@ func TestCalculateFare_InvalidVehicleType(t *testing.T) {
 }
 
 func TestCalculateFare_SurgeMinimum(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test with surge < 1.0, should default to 1.0
 	fare1, _ := fc.CalculateFare("ECONOMY", 10.0, 20.0, 0.5)
@@ -185,7 +185,7 @@ func TestCalculateFare_SurgeMinimum(t *testing.T) {
 }
 
 func TestEstimateFare(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 10 km distance
 	// Estimated duration: (10 / 30) * 60 = 20 minutes
@@ -200,7 +200,7 @@ func TestEstimateFare(t *testing.T) {
 }
 
 func TestEstimateFare_WithSurge(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 10 km distance, 1.5x surge
 	// Estimated duration: 20 minutes
@@ -215,7 +215,7 @@ func TestEstimateFare_WithSurge(t *testing.T) {
 }
 
 func TestGetRate_InvalidType(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	_, err := fc.GetRate("INVALID")
 	if err == nil {
@@ -224,7 +224,7 @@ func TestGetRate_InvalidType(t *testing.T) {
 }
 
 func TestCalculateFare_ZeroDistance(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 0 km, 5 minutes - should still charge base fare + time
 	// Expected: 500 + 0 + (5 * 50) = 750
@@ -238,7 +238,7 @@ func TestCalculateFare_ZeroDistance(t *testing.T) {
 }
 
 func TestCalculateFare_LongDistance(t *testing.T) {
-	fc := NewFareCalculator()
+	fc := NewCalculator()
 
 	// Test: 100 km, 120 minutes (2 hours)
 	// Expected: 500 + (100 * 100) + (120 * 50) = 500 + 10000 + 6000 = 16500
@@ -0,0 +1,52 @@
+package idempotency
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"ride-hail/pkg/conc"
+)
+
+type cleanerStore interface {
+	DeleteProcessedMessagesBefore(ctx context.Context, processedAt time.Time) (int64, error)
+}
+
+// Cleaner periodically forgets processed messages older than ttl. A message
+// redelivered after that is processed again, so ttl must outlast the retry
+// delays and any dead letter replay window
+type Cleaner struct {
+	store    cleanerStore
+	ticker   *conc.Ticker
+	ttl      time.Duration
+	interval time.Duration
+}
+
+func NewCleaner(store cleanerStore, ttl, interval time.Duration) *Cleaner {
+	return &Cleaner{
+		store:    store,
+		ticker:   conc.NewTicker(),
+		ttl:      ttl,
+		interval: interval,
+	}
+}
+
+// Run cleans every interval until ctx is done
+func (c *Cleaner) Run(ctx context.Context) {
+	c.ticker.Start(ctx, c.interval, func() {
+		c.clean(ctx)
+	})
+}
+
+func (c *Cleaner) clean(ctx context.Context) {
+	deleted, err := c.store.DeleteProcessedMessagesBefore(ctx, time.Now().Add(-c.ttl))
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to clean processed messages", "error", err)
+		}
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Cleaned processed messages", "deleted", deleted, "ttl", c.ttl)
+	}
+}
@@ -0,0 +1,85 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"ride-hail/internal/shared/txn"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+)
+
+// Guard skips messages a consumer has already processed. It records the
+// message ID in a transaction it hands to the handler through the context, so
+// the ID commits together with the handler's changes or not at all. Handlers
+// must start their transactions with txn.Begin to join it, and leave side
+// effects such as socket pushes to txn.AfterCommit
+type Guard struct {
+	db       txn.Beginner
+	queries  *sqlc.Queries
+	consumer string
+}
+
+// NewGuard deduplicates the messages of consumer, usually its queue name
+func NewGuard(db txn.Beginner, queries *sqlc.Queries, consumer string) *Guard {
+	return &Guard{
+		db:       db,
+		queries:  queries,
+		consumer: consumer,
+	}
+}
+
+// Wrap is the idempotency middleware for next. Messages without an ID are
+// passed through unguarded
+func (g *Guard) Wrap(next mq.MessageHandler) mq.MessageHandler {
+	return func(ctx context.Context, message mq.Message) (err error) {
+		if message.MessageID == "" {
+			slog.Debug("Message has no ID, skipping idempotency check", "consumer", g.consumer, "correlation_id", message.CorrelationID)
+			return next(ctx, message)
+		}
+
+		tx, err := g.db.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin idempotency transaction: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback(ctx)
+			} else {
+				tx.Commit(ctx)
+			}
+		}()
+
+		// a concurrent delivery of the same message waits here until this
+		// transaction ends
+		inserted, err := g.queries.WithTx(tx).MarkMessageProcessed(ctx, sqlc.MarkMessageProcessedParams{
+			Consumer:  g.consumer,
+			MessageID: message.MessageID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record processed message: %w", err)
+		}
+		if inserted == 0 {
+			slog.Info("Skipping already processed message",
+				"consumer", g.consumer,
+				"message_id", message.MessageID,
+				"correlation_id", message.CorrelationID,
+			)
+			return nil
+		}
+
+		handlerCtx, afterCommit := txn.WithAfterCommit(txn.WithTx(ctx, tx))
+		err = next(handlerCtx, message)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to commit processed message: %w", err)
+		}
+		afterCommit()
+		return nil
+	}
+}
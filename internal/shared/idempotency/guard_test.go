@@ -0,0 +1,187 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"ride-hail/internal/shared/txn"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB keeps the processed_messages rows of committed transactions
+type fakeDB struct {
+	processed []string
+	commits   int
+	rollbacks int
+}
+
+func (d *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: d}, nil
+}
+
+// fakeTx runs MarkMessageProcessed; any other use of pgx.Tx panics
+type fakeTx struct {
+	pgx.Tx
+	db      *fakeDB
+	pending []string
+	done    bool
+}
+
+func (t *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	key := args[0].(string) + "/" + args[1].(string)
+	if slices.Contains(t.db.processed, key) || slices.Contains(t.pending, key) {
+		return pgconn.NewCommandTag("INSERT 0 0"), nil
+	}
+	t.pending = append(t.pending, key)
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	t.db.processed = append(t.db.processed, t.pending...)
+	t.db.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	t.db.rollbacks++
+	return nil
+}
+
+func newTestGuard(db *fakeDB) *Guard {
+	return NewGuard(db, sqlc.New(nil), mq.DriverResponsesQueue)
+}
+
+func TestGuard_SkipsProcessedMessages(t *testing.T) {
+	db := &fakeDB{}
+	handled := 0
+	handler := newTestGuard(db).Wrap(func(ctx context.Context, message mq.Message) error {
+		handled++
+		return nil
+	})
+
+	for range 2 {
+		if err := handler(context.Background(), mq.Message{MessageID: "m1"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := handler(context.Background(), mq.Message{MessageID: "m2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if handled != 2 {
+		t.Errorf("Expected m1 and m2 handled once each, got %d calls", handled)
+	}
+	if db.rollbacks != 0 {
+		t.Errorf("Expected no rollbacks, got %d", db.rollbacks)
+	}
+}
+
+func TestGuard_RollsBackWhenHandlerFails(t *testing.T) {
+	db := &fakeDB{}
+	failing := errors.New("database unavailable")
+	attempts := 0
+	handler := newTestGuard(db).Wrap(func(ctx context.Context, message mq.Message) error {
+		attempts++
+		if attempts == 1 {
+			return failing
+		}
+		return nil
+	})
+
+	if err := handler(context.Background(), mq.Message{MessageID: "m1"}); !errors.Is(err, failing) {
+		t.Fatalf("Expected the handler error, got %v", err)
+	}
+	if db.rollbacks != 1 || len(db.processed) != 0 {
+		t.Fatalf("Expected the failed attempt rolled back unrecorded, got %d rollbacks and %v", db.rollbacks, db.processed)
+	}
+
+	// the retry is processed, and a replay after it is not
+	for range 2 {
+		if err := handler(context.Background(), mq.Message{MessageID: "m1"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestGuard_HandsTransactionToHandler(t *testing.T) {
+	db := &fakeDB{}
+	handler := newTestGuard(db).Wrap(func(ctx context.Context, message mq.Message) error {
+		tx, ok := txn.From(ctx)
+		if !ok {
+			t.Fatal("Expected the guard's transaction in the handler context")
+		}
+		if tx.(*fakeTx).done {
+			t.Error("Expected the transaction to be open while the handler runs")
+		}
+		return nil
+	})
+
+	if err := handler(context.Background(), mq.Message{MessageID: "m1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if db.commits != 1 {
+		t.Errorf("Expected one commit, got %d", db.commits)
+	}
+}
+
+func TestGuard_PassesThroughMessagesWithoutID(t *testing.T) {
+	db := &fakeDB{}
+	handled := 0
+	handler := newTestGuard(db).Wrap(func(ctx context.Context, message mq.Message) error {
+		if _, ok := txn.From(ctx); ok {
+			t.Error("Expected no transaction for a message without an ID")
+		}
+		handled++
+		return nil
+	})
+
+	for range 2 {
+		if err := handler(context.Background(), mq.Message{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if handled != 2 || db.commits != 0 {
+		t.Errorf("Expected both messages handled without a transaction, got %d calls and %d commits", handled, db.commits)
+	}
+}
+
+func TestGuard_RunsAfterCommitHooksOnlyOnCommit(t *testing.T) {
+	db := &fakeDB{}
+	failing := errors.New("database unavailable")
+	var pushed []int
+	handler := newTestGuard(db).Wrap(func(ctx context.Context, message mq.Message) error {
+		txn.AfterCommit(ctx, func() { pushed = append(pushed, db.commits) })
+		if message.MessageID == "m1" {
+			return failing
+		}
+		return nil
+	})
+
+	if err := handler(context.Background(), mq.Message{MessageID: "m1"}); !errors.Is(err, failing) {
+		t.Fatalf("Expected the handler error, got %v", err)
+	}
+	if err := handler(context.Background(), mq.Message{MessageID: "m2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !slices.Equal(pushed, []int{1}) {
+		t.Errorf("Expected one hook run after the commit, got runs at commits %v", pushed)
+	}
+}
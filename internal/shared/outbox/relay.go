@@ -0,0 +1,221 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"ride-hail/pkg/conc"
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultMaxAttempts = 10
+	// claimLease is how long a relay owns the rows it claimed; rows it did not
+	// get to, e.g. because it died mid-batch, are claimed again afterwards
+	claimLease = 5 * time.Minute
+	// failed rows wait retryBaseDelay, doubling per attempt up to retryMaxDelay
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// Relay publishes pending outbox messages to RabbitMQ and marks them sent. It
+// claims a batch under a lock shared by all instances and publishes it after
+// the claim commits, so a ride's messages reach the broker in the order they
+// were written without a transaction held open across publishes. A message
+// that keeps failing is parked as dead after maxAttempts
+type Relay struct {
+	db          *pgxpool.Pool
+	queries     *sqlc.Queries
+	publisher   mq.MessageIDPublisher
+	ticker      *conc.Ticker
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	backlog     atomic.Int64
+}
+
+func NewRelay(db *pgxpool.Pool, queries *sqlc.Queries, publisher mq.MessageIDPublisher, interval time.Duration, batchSize, maxAttempts int) *Relay {
+	if batchSize < 1 {
+		batchSize = defaultBatchSize
+	}
+	if maxAttempts < 1 {
+		maxAttempts = defaultMaxAttempts
+	}
+	return &Relay{
+		db:          db,
+		queries:     queries,
+		publisher:   publisher,
+		ticker:      conc.NewTicker(),
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Run flushes the outbox every interval until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	r.ticker.Start(ctx, r.interval, func() {
+		r.flush(ctx)
+	})
+}
+
+// Backlog is the number of unsent, not dead messages left after the last flush
+func (r *Relay) Backlog() int64 {
+	return r.backlog.Load()
+}
+
+func (r *Relay) flush(ctx context.Context) {
+	messages, err := r.claim(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to claim outbox messages", "error", err)
+		}
+		return
+	}
+
+	sent, err := publishClaimed(ctx, r.queries, r.publisher, messages, r.maxAttempts)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to relay outbox", "error", err)
+		}
+		return
+	}
+
+	backlog, err := r.queries.GetOutboxBacklog(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to count outbox backlog", "error", err)
+		}
+		return
+	}
+
+	previous := r.backlog.Swap(backlog.Pending)
+	if sent > 0 || backlog.Pending != previous {
+		slog.Info("Outbox relayed", "sent", sent, "backlog", backlog.Pending, "dead", backlog.Dead)
+	}
+}
+
+// claim leases the next batch in a short transaction holding the relay lock.
+// It claims nothing when another instance holds the lock
+func (r *Relay) claim(ctx context.Context) ([]sqlc.Outbox, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	qTx := r.queries.WithTx(tx)
+
+	locked, err := qTx.TryLockOutboxRelay(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take outbox relay lock: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	messages, err := qTx.ClaimPendingOutbox(ctx, sqlc.ClaimPendingOutboxParams{
+		LeaseSeconds: claimLease.Seconds(),
+		BatchSize:    r.batchSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending outbox messages: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	// update ... returning does not keep the subquery's order
+	slices.SortFunc(messages, func(a, b sqlc.Outbox) int { return cmp.Compare(a.ID, b.ID) })
+	return messages, nil
+}
+
+type relayStore interface {
+	MarkOutboxSent(ctx context.Context, id int64) error
+	MarkOutboxFailed(ctx context.Context, arg sqlc.MarkOutboxFailedParams) error
+	ReleaseOutbox(ctx context.Context, ids []int64) error
+}
+
+// messageID is the message ID of outbox row id. A row published again, e.g.
+// after its mark failed or its lease ran out, keeps the ID, so the consumers'
+// idempotency guards skip the copy
+func messageID(id int64) string {
+	return fmt.Sprintf("outbox-%d", id)
+}
+
+// publishClaimed sends claimed messages in id order. Once a ride's message
+// fails, its later messages are released untried so they never overtake it;
+// the failed one backs off, or is parked as dead after maxAttempts
+func publishClaimed(ctx context.Context, store relayStore, publisher mq.MessageIDPublisher, messages []sqlc.Outbox, maxAttempts int) (int, error) {
+	sent := 0
+	blocked := make(map[uuid.UUID]bool)
+	var released []int64
+	for _, message := range messages {
+		if blocked[message.AggregateID] {
+			released = append(released, message.ID)
+			continue
+		}
+
+		pubErr := publisher.PublishWithMessageID(ctx, message.Exchange, message.RoutingKey, message.CorrelationID, messageID(message.ID), json.RawMessage(message.Payload))
+		if pubErr != nil {
+			blocked[message.AggregateID] = true
+			attempts := message.Attempts + 1
+			dead := attempts >= maxAttempts
+			reason := pubErr.Error()
+			err := store.MarkOutboxFailed(ctx, sqlc.MarkOutboxFailedParams{
+				LastError:      &reason,
+				BackoffSeconds: retryDelay(attempts).Seconds(),
+				Dead:           dead,
+				ID:             message.ID,
+			})
+			if err != nil {
+				return sent, fmt.Errorf("failed to mark outbox message %d failed: %w", message.ID, err)
+			}
+			log := slog.Warn
+			if dead {
+				log = slog.Error
+			}
+			log("Failed to publish outbox message",
+				"outbox_id", message.ID,
+				"ride_id", message.AggregateID.String(),
+				"routing_key", message.RoutingKey,
+				"attempts", attempts,
+				"dead", dead,
+				"error", pubErr,
+			)
+			continue
+		}
+
+		err := store.MarkOutboxSent(ctx, message.ID)
+		if err != nil {
+			return sent, fmt.Errorf("failed to mark outbox message %d sent: %w", message.ID, err)
+		}
+		sent++
+	}
+
+	if len(released) > 0 {
+		if err := store.ReleaseOutbox(ctx, released); err != nil {
+			return sent, fmt.Errorf("failed to release outbox messages: %w", err)
+		}
+	}
+	return sent, nil
+}
+
+// retryDelay is the backoff before a message's next attempt
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
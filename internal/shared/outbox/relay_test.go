@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+)
+
+type fakeStore struct {
+	sent     []int64
+	failed   []sqlc.MarkOutboxFailedParams
+	released []int64
+}
+
+func (s *fakeStore) MarkOutboxSent(ctx context.Context, id int64) error {
+	s.sent = append(s.sent, id)
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxFailed(ctx context.Context, arg sqlc.MarkOutboxFailedParams) error {
+	s.failed = append(s.failed, arg)
+	return nil
+}
+
+func (s *fakeStore) ReleaseOutbox(ctx context.Context, ids []int64) error {
+	s.released = append(s.released, ids...)
+	return nil
+}
+
+type fakePublisher struct {
+	fail       map[string]bool // routing keys that fail
+	published  []string
+	bodies     []string
+	messageIDs []string
+}
+
+func (p *fakePublisher) PublishWithMessageID(ctx context.Context, exchange, routingKey, correlationID, messageID string, message interface{}) error {
+	if p.fail[routingKey] {
+		return errors.New("broker unavailable")
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	p.published = append(p.published, routingKey)
+	p.bodies = append(p.bodies, string(body))
+	p.messageIDs = append(p.messageIDs, messageID)
+	return nil
+}
+
+func TestPublishClaimed_PreservesRideOrderAfterFailure(t *testing.T) {
+	rideA, rideB := uuid.New(), uuid.New()
+	messages := []sqlc.Outbox{
+		{ID: 1, AggregateID: rideA, RoutingKey: "ride.request.ECONOMY", Payload: []byte(`{"n":1}`)},
+		{ID: 2, AggregateID: rideB, RoutingKey: "ride.request.XL", Payload: []byte(`{"n":2}`)},
+		{ID: 3, AggregateID: rideA, RoutingKey: "ride.status.CANCELLED", Payload: []byte(`{"n":3}`)},
+		{ID: 4, AggregateID: rideB, RoutingKey: "ride.status.MATCHED", Payload: []byte(`{"n":4}`)},
+	}
+	store := &fakeStore{}
+	publisher := &fakePublisher{fail: map[string]bool{"ride.request.ECONOMY": true}}
+
+	sent, err := publishClaimed(context.Background(), store, publisher, messages, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sent != 2 {
+		t.Errorf("Expected 2 messages sent, got %d", sent)
+	}
+	if len(store.failed) != 1 || store.failed[0].ID != 1 || store.failed[0].Dead {
+		t.Errorf("Expected only message 1 marked failed and retried, got %+v", store.failed)
+	}
+	if len(store.sent) != 2 || store.sent[0] != 2 || store.sent[1] != 4 {
+		t.Errorf("Expected messages 2 and 4 marked sent, got %v", store.sent)
+	}
+	if len(store.released) != 1 || store.released[0] != 3 {
+		t.Errorf("Expected the cancellation to be released untried, got %v", store.released)
+	}
+	for _, key := range publisher.published {
+		if key == "ride.status.CANCELLED" {
+			t.Error("Expected the cancellation to wait for the failed ride request")
+		}
+	}
+}
+
+func TestPublishClaimed_ParksMessageAfterMaxAttempts(t *testing.T) {
+	messages := []sqlc.Outbox{
+		{ID: 1, AggregateID: uuid.New(), RoutingKey: "ride.status.MATCHED", Attempts: 2, Payload: []byte(`{}`)},
+	}
+	store := &fakeStore{}
+	publisher := &fakePublisher{fail: map[string]bool{"ride.status.MATCHED": true}}
+
+	if _, err := publishClaimed(context.Background(), store, publisher, messages, 3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(store.failed) != 1 || !store.failed[0].Dead {
+		t.Errorf("Expected the third failure to park the message as dead, got %+v", store.failed)
+	}
+}
+
+func TestRetryDelay_DoublesUpToMax(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, retryMaxDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("Expected %v after %d attempts, got %v", tt.want, tt.attempts, got)
+		}
+	}
+}
+
+func TestPublishClaimed_SendsPayloadUnchanged(t *testing.T) {
+	messages := []sqlc.Outbox{
+		{ID: 7, AggregateID: uuid.New(), RoutingKey: "ride.status.MATCHED", Payload: []byte(`{"ride_id":"abc"}`)},
+	}
+	publisher := &fakePublisher{}
+
+	if _, err := publishClaimed(context.Background(), &fakeStore{}, publisher, messages, 10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(publisher.bodies) != 1 || publisher.bodies[0] != `{"ride_id":"abc"}` {
+		t.Errorf("Expected payload to be published as stored, got %v", publisher.bodies)
+	}
+}
+
+func TestPublishClaimed_KeepsMessageIDWhenPublishedAgain(t *testing.T) {
+	messages := []sqlc.Outbox{
+		{ID: 7, AggregateID: uuid.New(), RoutingKey: "ride.status.MATCHED", Payload: []byte(`{}`)},
+		{ID: 8, AggregateID: uuid.New(), RoutingKey: "ride.status.MATCHED", Payload: []byte(`{}`)},
+	}
+	publisher := &fakePublisher{}
+
+	// the second claim stands in for a relay whose lease ran out before it marked the rows sent
+	for range 2 {
+		if _, err := publishClaimed(context.Background(), &fakeStore{}, publisher, messages, 10); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	want := []string{"outbox-7", "outbox-8", "outbox-7", "outbox-8"}
+	if !slices.Equal(publisher.messageIDs, want) {
+		t.Errorf("Expected message IDs %v, got %v", want, publisher.messageIDs)
+	}
+}
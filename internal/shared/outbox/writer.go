@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/sqlc"
+	"ride-hail/pkg/uuid"
+)
+
+// Writer is an mq.Publisher that stores messages in the outbox instead of
+// sending them. Build it on transaction-bound queries so the event commits or
+// rolls back together with the change it describes
+type Writer struct {
+	queries     *sqlc.Queries
+	aggregateID uuid.UUID
+}
+
+// NewWriter stores messages for the ride aggregateID; the relay publishes one
+// ride's messages in the order they were written
+func NewWriter(queries *sqlc.Queries, aggregateID uuid.UUID) *Writer {
+	return &Writer{
+		queries:     queries,
+		aggregateID: aggregateID,
+	}
+}
+
+func (w *Writer) Publish(ctx context.Context, exchange, routingKey string, message interface{}) error {
+	return w.PublishWithCorrelationID(ctx, exchange, routingKey, uuid.New().String(), message)
+}
+
+func (w *Writer) PublishWithCorrelationID(ctx context.Context, exchange, routingKey, correlationID string, message interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	err = w.queries.CreateOutboxMessage(ctx, sqlc.CreateOutboxMessageParams{
+		AggregateID:   w.aggregateID,
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		CorrelationID: correlationID,
+		Payload:       payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+	return nil
+}
+
+// RideEvents routes the ride's events, published by producer, through the outbox
+func RideEvents(queries *sqlc.Queries, rideID uuid.UUID, producer string) *mq.RideEventPublisher {
+	return mq.NewRideEventPublisherFor(NewWriter(queries, rideID), producer)
+}
@@ -0,0 +1,69 @@
+package txn
+
+import (
+	"context"
+
+	"ride-hail/pkg/sqlc"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type txKey struct{}
+
+type afterCommitKey struct{}
+
+// Beginner starts transactions; *pgxpool.Pool and pgx.Tx are both one
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// WithTx returns a context carrying tx
+func WithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// From returns the transaction ctx carries, if any
+func From(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// Begin starts a transaction on db, or a savepoint in the transaction ctx
+// carries so the caller's work commits or rolls back with it
+func Begin(ctx context.Context, db Beginner) (pgx.Tx, error) {
+	if tx, ok := From(ctx); ok {
+		return tx.Begin(ctx)
+	}
+	return db.Begin(ctx)
+}
+
+// Queries binds queries to the transaction ctx carries, if any
+func Queries(ctx context.Context, queries *sqlc.Queries) *sqlc.Queries {
+	if tx, ok := From(ctx); ok {
+		return queries.WithTx(tx)
+	}
+	return queries
+}
+
+// WithAfterCommit returns a context collecting the functions given to
+// AfterCommit, and run to call them once the caller's transaction committed
+func WithAfterCommit(ctx context.Context) (context.Context, func()) {
+	hooks := &[]func(){}
+	run := func() {
+		for _, fn := range *hooks {
+			fn()
+		}
+	}
+	return context.WithValue(ctx, afterCommitKey{}, hooks), run
+}
+
+// AfterCommit defers fn until the transaction of WithAfterCommit commits, or
+// calls it now when ctx has none. A rolled back transaction never calls fn
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*[]func())
+	if !ok {
+		fn()
+		return
+	}
+	*hooks = append(*hooks, fn)
+}
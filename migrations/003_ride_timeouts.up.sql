@@ -0,0 +1,14 @@
+begin;
+
+-- Deadline for a ride to leave REQUESTED; swept by the ride service
+create table ride_timeouts (
+    ride_id uuid primary key references rides(id),
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    processed_at timestamptz
+);
+
+-- Index for the sweeper's due-timeout scan
+create index idx_ride_timeouts_due on ride_timeouts(expires_at) where processed_at is null;
+
+commit;
@@ -0,0 +1,21 @@
+begin;
+
+-- Events written in the same transaction as the state change they describe and
+-- published to RabbitMQ by the outbox relay
+create table outbox (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    aggregate_id uuid not null, -- ride the event belongs to; its rows are sent in id order
+    exchange text not null,
+    routing_key text not null,
+    correlation_id text not null,
+    payload jsonb not null,
+    attempts integer not null default 0,
+    last_error text,
+    sent_at timestamptz
+);
+
+-- Index for the relay's pending scan
+create index idx_outbox_pending on outbox(id) where sent_at is null;
+
+commit;
@@ -0,0 +1,15 @@
+begin;
+
+-- Messages a consumer has handled, recorded in the same transaction as the
+-- handler's changes so a redelivered or replayed message is skipped
+create table processed_messages (
+    consumer text not null, -- queue the message was consumed from
+    message_id text not null,
+    processed_at timestamptz not null default now(),
+    primary key (consumer, message_id)
+);
+
+-- Index for the TTL cleanup
+create index idx_processed_messages_processed_at on processed_messages(processed_at);
+
+commit;
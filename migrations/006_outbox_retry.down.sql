@@ -0,0 +1,12 @@
+begin;
+
+drop index if exists idx_outbox_pending_aggregate;
+drop index if exists idx_outbox_pending;
+create index idx_outbox_pending on outbox(id) where sent_at is null;
+
+alter table outbox
+    drop column if exists dead_at,
+    drop column if exists claimed_until,
+    drop column if exists next_attempt_at;
+
+commit;
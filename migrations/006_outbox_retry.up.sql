@@ -0,0 +1,16 @@
+begin;
+
+-- Retry bookkeeping for the outbox relay. A relay leases the rows it publishes
+-- until claimed_until; a failed row waits until next_attempt_at and is parked
+-- as dead once it runs out of attempts
+alter table outbox
+    add column next_attempt_at timestamptz not null default now(),
+    add column claimed_until timestamptz,
+    add column dead_at timestamptz;
+
+-- Indexes for the relay's pending scan and its per-ride ordering check
+drop index if exists idx_outbox_pending;
+create index idx_outbox_pending on outbox(id) where sent_at is null and dead_at is null;
+create index idx_outbox_pending_aggregate on outbox(aggregate_id, id) where sent_at is null and dead_at is null;
+
+commit;
@@ -0,0 +1,31 @@
+package mq
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Broker is the message bus services publish to and consume from. *Client
+// implements it on RabbitMQ and *MemoryBroker in process. Deliveries are
+// acked and nacked through their Acknowledger
+type Broker interface {
+	// Send publishes a mandatory message; an unroutable one fails with a *ReturnedError
+	Send(ctx context.Context, exchange, routingKey string, optinions amqp.Publishing) error
+	Consume(queue, consumer string, autoAck bool) (<-chan amqp.Delivery, error)
+	SetQos(prefetchCount int) error
+	// NotifyReconnect signals after the broker connection or the consumer
+	// channel was re-established and is closed once the broker gives up or is closed
+	NotifyReconnect() <-chan struct{}
+
+	CreateExchange(name, kind string, durable, autoDelete bool) error
+	CreateQueueWithArgs(name string, durable, autoDelete bool, args amqp.Table) error
+	CreateBindingWithArgs(name, binding, exchange string, args amqp.Table) error
+
+	Close() error
+}
+
+var (
+	_ Broker = (*Client)(nil)
+	_ Broker = (*MemoryBroker)(nil)
+)
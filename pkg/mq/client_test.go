@@ -0,0 +1,454 @@
+package mq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQP 0-9-1 frame types and the class and method ids fakeServer speaks
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+
+	classConnection = 10
+	classChannel    = 20
+	classBasic      = 60
+	classConfirm    = 85
+)
+
+type methodID struct{ class, method uint16 }
+
+var (
+	connectionStart   = methodID{classConnection, 10}
+	connectionStartOk = methodID{classConnection, 11}
+	connectionTune    = methodID{classConnection, 30}
+	connectionTuneOk  = methodID{classConnection, 31}
+	connectionOpen    = methodID{classConnection, 40}
+	connectionOpenOk  = methodID{classConnection, 41}
+	connectionClose   = methodID{classConnection, 50}
+	connectionCloseOk = methodID{classConnection, 51}
+	channelOpen       = methodID{classChannel, 10}
+	channelOpenOk     = methodID{classChannel, 11}
+	channelClose      = methodID{classChannel, 40}
+	channelCloseOk    = methodID{classChannel, 41}
+	basicQos          = methodID{classBasic, 10}
+	basicQosOk        = methodID{classBasic, 11}
+	basicConsume      = methodID{classBasic, 20}
+	basicConsumeOk    = methodID{classBasic, 21}
+	basicCancel       = methodID{classBasic, 30}
+	basicCancelOk     = methodID{classBasic, 31}
+	basicPublish      = methodID{classBasic, 40}
+	basicDeliver      = methodID{classBasic, 60}
+	basicAck          = methodID{classBasic, 80}
+	confirmSelect     = methodID{classConfirm, 10}
+	confirmSelectOk   = methodID{classConfirm, 11}
+)
+
+// fakeServer is a dockerless stand-in for RabbitMQ that speaks just enough
+// AMQP for a Client: the handshake, channels, QoS, consume, acks and confirmed
+// publishes. kill drops every connection the way a broker restart does
+type fakeServer struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	conns       []*fakeConn
+	accepted    int
+	consumes    int
+	acked       int
+	published   int
+	consumer    *fakeConn // connection and channel of the latest consume
+	consumerCh  uint16
+	consumerTag string
+	nextTag     uint64
+}
+
+type fakeConn struct {
+	server  *fakeServer
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	// per channel: whether it is in confirm mode and how many publishes it took
+	confirming map[uint16]bool
+	published  map[uint16]uint64
+	pending    map[uint16]uint64 // body bytes still expected for a publish
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeServer{listener: listener}
+	go s.accept()
+	t.Cleanup(func() {
+		listener.Close()
+		s.kill()
+	})
+	return s
+}
+
+func (s *fakeServer) config() Config {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return Config{Host: "127.0.0.1", Port: port, UserName: "guest", Password: "guest"}
+}
+
+func (s *fakeServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeConn{
+			server:     s,
+			conn:       conn,
+			confirming: make(map[uint16]bool),
+			published:  make(map[uint16]uint64),
+			pending:    make(map[uint16]uint64),
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.accepted++
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// kill drops every open connection without a connection.close
+func (s *fakeServer) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.conn.Close()
+	}
+	s.conns = nil
+	s.consumer = nil
+}
+
+// closeConsumerChannel closes the consuming channel from the broker side, as
+// RabbitMQ does on a channel error, and leaves the connection up
+func (s *fakeServer) closeConsumerChannel() {
+	s.mu.Lock()
+	c, ch := s.consumer, s.consumerCh
+	s.consumer = nil
+	s.mu.Unlock()
+	c.send(ch, channelClose, func(w *argWriter) {
+		w.short(406)
+		w.shortstr("PRECONDITION_FAILED - unknown delivery tag")
+		w.short(classBasic)
+		w.short(80)
+	})
+}
+
+// deliver pushes body to the latest consumer
+func (s *fakeServer) deliver(t *testing.T, body string) {
+	t.Helper()
+	s.mu.Lock()
+	c, ch, tag := s.consumer, s.consumerCh, s.consumerTag
+	s.nextTag++
+	deliveryTag := s.nextTag
+	s.mu.Unlock()
+	if c == nil {
+		t.Fatal("No consumer to deliver to")
+	}
+
+	c.send(ch, basicDeliver, func(w *argWriter) {
+		w.shortstr(tag)
+		w.longlong(deliveryTag)
+		w.octet(0) // redelivered
+		w.shortstr("")
+		w.shortstr("test")
+	})
+	c.sendContent(ch, []byte(body))
+}
+
+func (s *fakeServer) counts() (accepted, consumes, acked, published int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted, s.consumes, s.acked, s.published
+}
+
+func (s *fakeServer) hasConsumer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consumer != nil
+}
+
+func (c *fakeConn) serve() {
+	defer c.conn.Close()
+	r := bufio.NewReader(c.conn)
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, []byte("AMQP\x00\x00\x09\x01")) {
+		return
+	}
+	c.send(0, connectionStart, func(w *argWriter) {
+		w.octet(0)
+		w.octet(9)
+		w.table()
+		w.longstr("PLAIN")
+		w.longstr("en_US")
+	})
+
+	for {
+		kind, channel, payload, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		switch kind {
+		case frameMethod:
+			if !c.handleMethod(channel, payload) {
+				return
+			}
+		case frameHeader:
+			c.pending[channel] = binary.BigEndian.Uint64(payload[4:12])
+			c.completePublish(channel, 0)
+		case frameBody:
+			c.completePublish(channel, uint64(len(payload)))
+		case frameHeartbeat:
+		}
+	}
+}
+
+// handleMethod answers one client method; it returns false once the
+// connection is closed
+func (c *fakeConn) handleMethod(channel uint16, payload []byte) bool {
+	id := methodID{binary.BigEndian.Uint16(payload[0:2]), binary.BigEndian.Uint16(payload[2:4])}
+	args := &argReader{data: payload[4:]}
+
+	switch id {
+	case connectionStartOk:
+		c.send(0, connectionTune, func(w *argWriter) {
+			w.short(2047)
+			w.long(131072)
+			w.short(0) // no heartbeats
+		})
+	case connectionTuneOk:
+	case connectionOpen:
+		c.send(0, connectionOpenOk, func(w *argWriter) { w.shortstr("") })
+	case connectionClose:
+		c.send(0, connectionCloseOk, nil)
+		return false
+	case channelOpen:
+		c.send(channel, channelOpenOk, func(w *argWriter) { w.longstr("") })
+	case channelClose:
+		c.send(channel, channelCloseOk, nil)
+	case channelCloseOk:
+	case confirmSelect:
+		c.confirming[channel] = true
+		c.send(channel, confirmSelectOk, nil)
+	case basicQos:
+		c.send(channel, basicQosOk, nil)
+	case basicConsume:
+		args.short() // reserved
+		args.shortstr()
+		tag := args.shortstr()
+		c.server.mu.Lock()
+		c.server.consumes++
+		c.server.consumer, c.server.consumerCh, c.server.consumerTag = c, channel, tag
+		c.server.mu.Unlock()
+		c.send(channel, basicConsumeOk, func(w *argWriter) { w.shortstr(tag) })
+	case basicCancel:
+		tag := args.shortstr()
+		c.send(channel, basicCancelOk, func(w *argWriter) { w.shortstr(tag) })
+	case basicPublish:
+		// the content header and body follow
+	case basicAck:
+		c.server.mu.Lock()
+		c.server.acked++
+		c.server.mu.Unlock()
+	}
+	return true
+}
+
+// completePublish counts body bytes and confirms the publish once all arrived
+func (c *fakeConn) completePublish(channel uint16, received uint64) {
+	c.pending[channel] -= min(received, c.pending[channel])
+	if c.pending[channel] > 0 {
+		return
+	}
+	c.server.mu.Lock()
+	c.server.published++
+	c.server.mu.Unlock()
+	if c.confirming[channel] {
+		c.published[channel]++
+		tag := c.published[channel]
+		c.send(channel, basicAck, func(w *argWriter) {
+			w.longlong(tag)
+			w.octet(0) // multiple
+		})
+	}
+}
+
+func (c *fakeConn) send(channel uint16, id methodID, args func(w *argWriter)) {
+	w := &argWriter{}
+	w.short(id.class)
+	w.short(id.method)
+	if args != nil {
+		args(w)
+	}
+	c.writeFrame(frameMethod, channel, w.buf.Bytes())
+}
+
+func (c *fakeConn) sendContent(channel uint16, body []byte) {
+	w := &argWriter{}
+	w.short(classBasic)
+	w.short(0) // weight
+	w.longlong(uint64(len(body)))
+	w.short(0) // no properties
+	c.writeFrame(frameHeader, channel, w.buf.Bytes())
+	c.writeFrame(frameBody, channel, body)
+}
+
+func (c *fakeConn) writeFrame(kind byte, channel uint16, payload []byte) {
+	frame := make([]byte, 0, len(payload)+8)
+	frame = append(frame, kind)
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = append(frame, frameEnd)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, _ = c.conn.Write(frame)
+}
+
+func readFrame(r *bufio.Reader) (kind byte, channel uint16, payload []byte, err error) {
+	header := make([]byte, 7)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	payload = make([]byte, binary.BigEndian.Uint32(header[3:7])+1)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+type argWriter struct{ buf bytes.Buffer }
+
+func (w *argWriter) octet(v byte)      { w.buf.WriteByte(v) }
+func (w *argWriter) short(v uint16)    { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+func (w *argWriter) long(v uint32)     { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+func (w *argWriter) longlong(v uint64) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+func (w *argWriter) table()            { w.long(0) }
+
+func (w *argWriter) shortstr(v string) {
+	w.octet(byte(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *argWriter) longstr(v string) {
+	w.long(uint32(len(v)))
+	w.buf.WriteString(v)
+}
+
+type argReader struct{ data []byte }
+
+func (r *argReader) short() uint16 {
+	v := binary.BigEndian.Uint16(r.data)
+	r.data = r.data[2:]
+	return v
+}
+
+func (r *argReader) shortstr() string {
+	n := int(r.data[0])
+	v := string(r.data[1 : 1+n])
+	r.data = r.data[1+n:]
+	return v
+}
+
+func startTestConsumer(t *testing.T, client Broker, handled *recorder) *MessageConsumer {
+	t.Helper()
+	consumer := NewConsumer(client, ConsumerConfig{
+		Handler:     handled.handle,
+		Queue:       "ride_status",
+		ConsumerTag: "ride-status",
+		Workers:     1,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+	return consumer
+}
+
+func TestClient_ResubscribesAfterConnectionDrop(t *testing.T) {
+	server := newFakeServer(t)
+	client, err := NewClientWithReconnect(server.config())
+	if err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	defer client.Close()
+
+	handled := &recorder{}
+	consumer := startTestConsumer(t, client, handled)
+	waitFor(t, "the consumer", server.hasConsumer)
+	server.deliver(t, "before")
+	waitFor(t, "the first delivery", func() bool { return handled.count() == 1 })
+
+	server.kill()
+	waitFor(t, "the consumer on a new connection", server.hasConsumer)
+	server.deliver(t, "after")
+	waitFor(t, "the delivery after reconnect", func() bool { return handled.count() == 2 })
+
+	accepted, consumes, _, _ := server.counts()
+	if accepted != 2 || consumes != 2 {
+		t.Errorf("Expected one reconnect and one resubscribe, got %d connections and %d consumes", accepted, consumes)
+	}
+	waitFor(t, "both acks", func() bool {
+		_, _, acked, _ := server.counts()
+		return acked == 2
+	})
+	if state := consumer.Status().State; state != ConsumerStateRunning {
+		t.Errorf("Expected running after reconnect, got %s", state)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Send(ctx, "", "ride_status", amqp.Publishing{Body: []byte("{}")}); err != nil {
+		t.Errorf("Expected publishes to use the new connection, got %v", err)
+	}
+	if _, _, _, published := server.counts(); published != 1 {
+		t.Errorf("Expected the publish to reach the broker, got %d", published)
+	}
+}
+
+func TestClient_ReopensChannelClosedByBroker(t *testing.T) {
+	server := newFakeServer(t)
+	client, err := NewClientWithReconnect(server.config())
+	if err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	defer client.Close()
+
+	handled := &recorder{}
+	startTestConsumer(t, client, handled)
+	waitFor(t, "the consumer", server.hasConsumer)
+
+	server.closeConsumerChannel()
+	waitFor(t, "the consumer on a reopened channel", server.hasConsumer)
+	server.deliver(t, "after")
+	waitFor(t, "the delivery after the channel closed", func() bool { return handled.count() == 1 })
+
+	accepted, consumes, _, _ := server.counts()
+	if accepted != 1 || consumes != 2 {
+		t.Errorf("Expected a resubscribe on the same connection, got %d connections and %d consumes", accepted, consumes)
+	}
+	if !client.IsConnected() {
+		t.Error("Expected the connection to stay up")
+	}
+}
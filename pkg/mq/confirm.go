@@ -0,0 +1,202 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// confirmTimeout is how long Send waits for the broker to confirm a message
+const confirmTimeout = 5 * time.Second
+
+var (
+	// ErrPublishNacked means the broker refused responsibility for the message
+	ErrPublishNacked = errors.New("broker nacked message")
+	// ErrConfirmTimeout means no confirm arrived in time; the broker may or may
+	// not have accepted the message
+	ErrConfirmTimeout = errors.New("timed out waiting for broker confirm")
+	// ErrUnroutable matches every *ReturnedError
+	ErrUnroutable = errors.New("message unroutable")
+	// ErrPublishChannelClosed means the channel closed before the message was confirmed
+	ErrPublishChannelClosed = errors.New("publish channel closed before confirm")
+)
+
+// ReturnedError reports a mandatory message the broker could not route to any queue
+type ReturnedError struct {
+	Exchange   string
+	RoutingKey string
+	ReplyCode  uint16
+	ReplyText  string
+}
+
+func (e *ReturnedError) Error() string {
+	return fmt.Sprintf("no queue bound for %s on exchange %q (%d %s)", e.RoutingKey, e.Exchange, e.ReplyCode, e.ReplyText)
+}
+
+func (e *ReturnedError) Is(target error) bool {
+	return target == ErrUnroutable
+}
+
+type pendingConfirm struct {
+	messageID string
+	result    chan error
+}
+
+// confirmTracker pairs broker confirms and returns with the publishes waiting
+// for them. The broker sends a message's return before its ack and listen reads
+// both on one goroutine, so a return is always recorded before its confirm
+type confirmTracker struct {
+	mu       sync.Mutex
+	pending  map[uint64]pendingConfirm
+	returned map[string]*ReturnedError
+}
+
+func newConfirmTracker() *confirmTracker {
+	return &confirmTracker{
+		pending:  make(map[uint64]pendingConfirm),
+		returned: make(map[string]*ReturnedError),
+	}
+}
+
+// track registers the publish with delivery tag; the returned channel yields
+// nil once the broker accepted it
+func (t *confirmTracker) track(tag uint64, messageID string) <-chan error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make(chan error, 1)
+	t.pending[tag] = pendingConfirm{messageID: messageID, result: result}
+	return result
+}
+
+// forget drops a publish that never reached the broker
+func (t *confirmTracker) forget(tag uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, tag)
+}
+
+func (t *confirmTracker) returnedMessage(ret amqp.Return) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.returned[ret.MessageId] = &ReturnedError{
+		Exchange:   ret.Exchange,
+		RoutingKey: ret.RoutingKey,
+		ReplyCode:  ret.ReplyCode,
+		ReplyText:  ret.ReplyText,
+	}
+}
+
+func (t *confirmTracker) confirm(confirmation amqp.Confirmation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pending[confirmation.DeliveryTag]
+	if !ok {
+		return
+	}
+	delete(t.pending, confirmation.DeliveryTag)
+
+	returned, wasReturned := t.returned[p.messageID]
+	delete(t.returned, p.messageID)
+
+	switch {
+	case !confirmation.Ack:
+		p.result <- ErrPublishNacked
+	case wasReturned:
+		p.result <- returned
+	default:
+		p.result <- nil
+	}
+}
+
+// fail resolves every outstanding publish with err
+func (t *confirmTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for tag, p := range t.pending {
+		p.result <- err
+		delete(t.pending, tag)
+	}
+	t.returned = make(map[string]*ReturnedError)
+}
+
+// listen runs until the channel closes
+func (t *confirmTracker) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			t.returnedMessage(ret)
+		case confirmation, ok := <-confirms:
+			if !ok {
+				t.fail(ErrPublishChannelClosed)
+				return
+			}
+			t.confirm(confirmation)
+		}
+	}
+}
+
+// confirmChannel is the channel every publish goes through, in confirm mode
+// with returns of mandatory messages tracked
+type confirmChannel struct {
+	mu      sync.Mutex // keeps sequence numbers in step with delivery tags
+	ch      *amqp.Channel
+	tracker *confirmTracker
+}
+
+func newConfirmChannel(conn *amqp.Connection) (*confirmChannel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	tracker := newConfirmTracker()
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	go tracker.listen(confirms, returns)
+
+	return &confirmChannel{ch: ch, tracker: tracker}, nil
+}
+
+// publish sends msg as mandatory and returns the channel its confirm arrives on
+func (c *confirmChannel) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (<-chan error, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tag := c.ch.GetNextPublishSeqNo()
+	result := c.tracker.track(tag, msg.MessageId)
+	if err := c.ch.PublishWithContext(ctx, exchange, routingKey, true, false, msg); err != nil {
+		c.tracker.forget(tag)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *confirmChannel) Close() error {
+	return c.ch.Close()
+}
+
+// awaitConfirm waits for the broker's verdict on one publish
+func awaitConfirm(ctx context.Context, result <-chan error, routingKey string) error {
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w for %s", ErrConfirmTimeout, routingKey)
+		}
+		return ctx.Err()
+	}
+}
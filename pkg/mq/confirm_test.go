@@ -0,0 +1,96 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestConfirmTracker_Ack(t *testing.T) {
+	tracker := newConfirmTracker()
+	result := tracker.track(1, "m1")
+
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 1, Ack: true})
+
+	if err := <-result; err != nil {
+		t.Errorf("Expected ack to resolve with nil, got %v", err)
+	}
+}
+
+func TestConfirmTracker_Nack(t *testing.T) {
+	tracker := newConfirmTracker()
+	result := tracker.track(1, "m1")
+
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 1, Ack: false})
+
+	if err := <-result; !errors.Is(err, ErrPublishNacked) {
+		t.Errorf("Expected ErrPublishNacked, got %v", err)
+	}
+}
+
+func TestConfirmTracker_ReturnedBeforeAck(t *testing.T) {
+	tracker := newConfirmTracker()
+	returnedResult := tracker.track(1, "m1")
+	okResult := tracker.track(2, "m2")
+
+	tracker.returnedMessage(amqp.Return{
+		ReplyCode:  312,
+		ReplyText:  "NO_ROUTE",
+		Exchange:   "ride_topic",
+		RoutingKey: "ride.request.XL",
+		MessageId:  "m1",
+	})
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 1, Ack: true})
+	tracker.confirm(amqp.Confirmation{DeliveryTag: 2, Ack: true})
+
+	err := <-returnedResult
+	if !errors.Is(err, ErrUnroutable) {
+		t.Fatalf("Expected ErrUnroutable, got %v", err)
+	}
+	var returned *ReturnedError
+	if !errors.As(err, &returned) || returned.RoutingKey != "ride.request.XL" {
+		t.Errorf("Expected a ReturnedError for ride.request.XL, got %v", err)
+	}
+	if err := <-okResult; err != nil {
+		t.Errorf("Expected the routed message to succeed, got %v", err)
+	}
+}
+
+func TestConfirmTracker_ListenFailsPendingOnClose(t *testing.T) {
+	tracker := newConfirmTracker()
+	result := tracker.track(1, "m1")
+
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return)
+	done := make(chan struct{})
+	go func() {
+		tracker.listen(confirms, returns)
+		close(done)
+	}()
+
+	close(returns)
+	close(confirms)
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrPublishChannelClosed) {
+			t.Errorf("Expected ErrPublishChannelClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected pending publish to fail when the channel closes")
+	}
+	<-done
+}
+
+func TestAwaitConfirm_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := awaitConfirm(ctx, make(chan error), "ride.request.ECONOMY")
+	if !errors.Is(err, ErrConfirmTimeout) {
+		t.Errorf("Expected ErrConfirmTimeout, got %v", err)
+	}
+}
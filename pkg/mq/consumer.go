@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -16,9 +17,11 @@ type MessageHandler func(ctx context.Context, message Message) error
 type Message struct {
 	CorrelationID string
 	MessageID     string
+	Queue         string
 	Timestamp     time.Time
 	Body          []byte
 	Delivery      amqp.Delivery
+	Event         Event // set once decoded, e.g. by ValidateEvents
 }
 
 func (m *Message) ParseJSON(target interface{}) error {
@@ -28,17 +31,50 @@ func (m *Message) ParseJSON(target interface{}) error {
 type Consumer interface {
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
+	Status() ConsumerStatus
+}
+
+type ConsumerState string
+
+const (
+	ConsumerStateStarting     ConsumerState = "starting"
+	ConsumerStateRunning      ConsumerState = "running"
+	ConsumerStateReconnecting ConsumerState = "reconnecting"
+	ConsumerStateFailed       ConsumerState = "failed"
+	ConsumerStateStopped      ConsumerState = "stopped"
+)
+
+// ConsumerStatus is a consumer's state as reported by ConsumerGroup.Status
+type ConsumerStatus struct {
+	Queue       string
+	ConsumerTag string
+	State       ConsumerState
+}
+
+const (
+	resubscribeBaseDelay = 1 * time.Second
+	resubscribeMaxDelay  = 30 * time.Second
+)
+
+// consumerClient is the part of Broker a MessageConsumer uses
+type consumerClient interface {
+	SetQos(prefetchCount int) error
+	Consume(queue, consumer string, autoAck bool) (<-chan amqp.Delivery, error)
+	Send(ctx context.Context, exchange, routingKey string, optinions amqp.Publishing) error
+	NotifyReconnect() <-chan struct{}
 }
 
 type MessageConsumer struct {
-	client        *Client
+	client        consumerClient
 	handler       MessageHandler
+	state         atomic.Value // ConsumerState
 	stopChan      chan struct{}
 	queue         string
 	consumerTag   string
 	wg            sync.WaitGroup
 	prefetchCount int
-	maxRetries    int
+	retry         RetryPolicy
+	deadLetters   string
 	workers       int
 	once          sync.Once
 }
@@ -47,41 +83,66 @@ type ConsumerConfig struct {
 	Handler       MessageHandler
 	Queue         string
 	ConsumerTag   string
-	PrefetchCount int // Number of messages to prefetch (default: 10)
-	MaxRetries    int // Maximum number of retry attempts (default: 3)
-	Workers       int // Number of concurrent workers (default: 5)
+	PrefetchCount int         // Number of messages to prefetch (default: 10)
+	Retry         RetryPolicy // retries through <queue>.retry.<n>, see DeclareRetryQueues
+	DeadLetters   string      // exchange failed messages are published to (default: DeadLetterExchange)
+	Workers       int         // Number of concurrent workers (default: 5)
 }
 
-func NewConsumer(client *Client, config ConsumerConfig) *MessageConsumer {
+func NewConsumer(client Broker, config ConsumerConfig) *MessageConsumer {
+	return newConsumer(client, config)
+}
+
+func newConsumer(client consumerClient, config ConsumerConfig) *MessageConsumer {
 	if config.PrefetchCount == 0 {
 		config.PrefetchCount = 10
 	}
-	if config.MaxRetries == 0 {
-		config.MaxRetries = 3
-	}
 	if config.Workers == 0 {
 		config.Workers = 5
 	}
+	if config.DeadLetters == "" {
+		config.DeadLetters = DeadLetterExchange
+	}
 
-	return &MessageConsumer{
+	c := &MessageConsumer{
 		client:        client,
 		queue:         config.Queue,
 		consumerTag:   config.ConsumerTag,
 		handler:       config.Handler,
 		prefetchCount: config.PrefetchCount,
-		maxRetries:    config.MaxRetries,
+		retry:         config.Retry.withDefaults(),
+		deadLetters:   config.DeadLetters,
 		workers:       config.Workers,
 		stopChan:      make(chan struct{}),
 	}
+	c.state.Store(ConsumerStateStarting)
+	return c
 }
 
-func (c *MessageConsumer) Start(ctx context.Context) error {
-	if err := c.client.SetQos(c.prefetchCount); err != nil {
-		return fmt.Errorf("failed to set QoS: %w", err)
+func (c *MessageConsumer) Status() ConsumerStatus {
+	return ConsumerStatus{
+		Queue:       c.queue,
+		ConsumerTag: c.consumerTag,
+		State:       c.state.Load().(ConsumerState),
 	}
-	deliveries, err := c.client.Consume(c.queue, c.consumerTag, false)
+}
+
+func (c *MessageConsumer) setState(state ConsumerState) {
+	if previous := c.state.Swap(state); previous != state {
+		slog.Info("Consumer state changed", "queue", c.queue, "from", previous, "to", state)
+	}
+}
+
+// Start subscribes and keeps the consumer subscribed: when the delivery
+// channel closes, e.g. because the connection dropped, it re-declares QoS and
+// consumes again once the client has reconnected
+func (c *MessageConsumer) Start(ctx context.Context) error {
+	reconnected := c.client.NotifyReconnect()
+
+	deliveries, err := c.subscribe()
 	if err != nil {
-		return fmt.Errorf("failed to start consuming: %w", err)
+		c.setState(ConsumerStateFailed)
+		return err
 	}
 
 	slog.Info("Consumer started",
@@ -91,18 +152,102 @@ func (c *MessageConsumer) Start(ctx context.Context) error {
 		"workers", c.workers,
 	)
 
-	for i := 0; i < c.workers; i++ {
-		c.wg.Add(1)
-		go c.worker(ctx, i, deliveries)
-	}
+	c.wg.Add(1)
+	go c.supervise(ctx, deliveries, reconnected)
 
 	return nil
 }
 
-// processes messages from the delivery channel
-func (c *MessageConsumer) worker(ctx context.Context, workerID int, deliveries <-chan amqp.Delivery) {
+func (c *MessageConsumer) subscribe() (<-chan amqp.Delivery, error) {
+	if err := c.client.SetQos(c.prefetchCount); err != nil {
+		return nil, fmt.Errorf("failed to set QoS: %w", err)
+	}
+	deliveries, err := c.client.Consume(c.queue, c.consumerTag, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start consuming: %w", err)
+	}
+	c.setState(ConsumerStateRunning)
+	return deliveries, nil
+}
+
+// supervise runs the workers on deliveries and resubscribes each time the
+// delivery channel closes, until the consumer is stopped
+func (c *MessageConsumer) supervise(ctx context.Context, deliveries <-chan amqp.Delivery, reconnected <-chan struct{}) {
 	defer c.wg.Done()
 
+	for {
+		var workers sync.WaitGroup
+		for i := 0; i < c.workers; i++ {
+			workers.Add(1)
+			go func(workerID int) {
+				defer workers.Done()
+				c.worker(ctx, workerID, deliveries)
+			}(i)
+		}
+		workers.Wait()
+
+		if c.stopped(ctx) {
+			c.setState(ConsumerStateStopped)
+			return
+		}
+
+		c.setState(ConsumerStateReconnecting)
+		var ok bool
+		deliveries, ok = c.resubscribe(ctx, reconnected)
+		if !ok {
+			return
+		}
+		slog.Info("Consumer resubscribed", "queue", c.queue, "consumer_tag", c.consumerTag)
+	}
+}
+
+// resubscribe consumes again after a reconnect, or after a backoff for a
+// channel that closed on its own. It gives up when the client stops reconnecting
+func (c *MessageConsumer) resubscribe(ctx context.Context, reconnected <-chan struct{}) (<-chan amqp.Delivery, bool) {
+	delay := resubscribeBaseDelay
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.setState(ConsumerStateStopped)
+			return nil, false
+		case <-c.stopChan:
+			timer.Stop()
+			c.setState(ConsumerStateStopped)
+			return nil, false
+		case _, ok := <-reconnected:
+			timer.Stop()
+			if !ok {
+				slog.Error("Consumer gave up, client is no longer reconnecting", "queue", c.queue)
+				c.setState(ConsumerStateFailed)
+				return nil, false
+			}
+		case <-timer.C:
+		}
+
+		deliveries, err := c.subscribe()
+		if err == nil {
+			return deliveries, true
+		}
+		slog.Warn("Consumer resubscribe failed", "queue", c.queue, "retry_in", delay, "error", err)
+		delay = min(delay*2, resubscribeMaxDelay)
+	}
+}
+
+func (c *MessageConsumer) stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-c.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// processes messages from the delivery channel
+func (c *MessageConsumer) worker(ctx context.Context, workerID int, deliveries <-chan amqp.Delivery) {
 	slog.Debug("Consumer worker started", "worker_id", workerID, "queue", c.queue)
 
 	for {
@@ -128,6 +273,7 @@ func (c *MessageConsumer) processMessage(ctx context.Context, workerID int, deli
 	message := Message{
 		CorrelationID: delivery.CorrelationId,
 		MessageID:     delivery.MessageId,
+		Queue:         c.queue,
 		Timestamp:     delivery.Timestamp,
 		Body:          delivery.Body,
 		Delivery:      delivery,
@@ -137,7 +283,7 @@ func (c *MessageConsumer) processMessage(ctx context.Context, workerID int, deli
 	retryCount := 0
 
 	if delivery.Headers != nil {
-		if val, ok := delivery.Headers["x-retry-count"]; ok {
+		if val, ok := delivery.Headers[headerRetryCount]; ok {
 			if count, ok := val.(int32); ok {
 				retryCount = int(count)
 			}
@@ -159,77 +305,67 @@ func (c *MessageConsumer) processMessage(ctx context.Context, workerID int, deli
 	if err != nil {
 		slog.Error("Message processing failed", append(logAttrs, "error", err)...)
 
-		if retryCount < c.maxRetries {
-			// retry by republishing with incremented retry count
-			if republishErr := c.republishWithRetry(ctx, delivery, retryCount+1); republishErr != nil {
-				slog.Error("Failed to republish message for retry", "error", republishErr)
-				// fallback: nack without requeue
-				if nackErr := c.client.Nack(delivery.DeliveryTag, false, false); nackErr != nil {
-					slog.Error("Failed to nack message", "error", nackErr)
-				}
-			} else {
-				// ack the original message
-				if ackErr := c.client.Ack(delivery.DeliveryTag, false); ackErr != nil {
-					slog.Error("Failed to ack message after republish", "error", ackErr)
-				} else {
-					slog.Info("Message republished for retry",
-						"correlation_id", message.CorrelationID,
-						"retry_count", retryCount+1,
-						"max_retries", c.maxRetries,
-					)
-				}
-			}
-		} else {
-			// max retries exceeded, send to dead letter queue
-			if nackErr := c.client.Nack(delivery.DeliveryTag, false, false); nackErr != nil {
-				slog.Error("Failed to nack message (send to DLQ)", "error", nackErr)
-			} else {
-				slog.Warn("Message sent to dead letter queue (max retries exceeded)",
-					"correlation_id", message.CorrelationID,
-					"retry_count", retryCount,
-				)
-			}
+		switch {
+		case !c.retry.retryable(err):
+			c.deadLetter(ctx, delivery, "non-retryable error", err, logAttrs)
+		case retryCount >= c.retry.retries():
+			c.deadLetter(ctx, delivery, "max retries exceeded", err, logAttrs)
+		default:
+			c.scheduleRetry(ctx, delivery, retryCount+1, err, logAttrs)
 		}
 	} else {
 		slog.Debug("Message processed successfully", logAttrs...)
 
-		if ackErr := c.client.Ack(delivery.DeliveryTag, false); ackErr != nil {
+		if ackErr := delivery.Ack(false); ackErr != nil {
 			slog.Error("Failed to ack message", "error", ackErr)
 		}
 	}
 }
 
-// republishWithRetry republishes a failed message with an incremented retry count
-func (c *MessageConsumer) republishWithRetry(ctx context.Context, delivery amqp.Delivery, newRetryCount int) error {
-	headers := amqp.Table{}
-	if delivery.Headers != nil {
-		for k, v := range delivery.Headers {
-			headers[k] = v
-		}
+// scheduleRetry parks the message in its <queue>.retry.<n> queue with its
+// original routing key and acks it here, so no worker waits out the backoff
+func (c *MessageConsumer) scheduleRetry(ctx context.Context, delivery amqp.Delivery, retry int, handlerErr error, logAttrs []interface{}) {
+	publishing := retryPublishing(delivery, c.queue, retry, handlerErr)
+	if err := c.client.Send(ctx, RetryExchange, delivery.RoutingKey, publishing); err != nil {
+		// e.g. the retry queue was never declared
+		slog.Error("Failed to schedule retry", append(logAttrs, "retry_queue", RetryQueueName(c.queue, retry), "error", err)...)
+		c.deadLetter(ctx, delivery, "retry could not be scheduled", handlerErr, logAttrs)
+		return
 	}
 
-	headers["x-retry-count"] = int32(newRetryCount)
-
-	// add delay before retry
-	delayMs := int32(100 * (1 << uint(newRetryCount-1)))
-	if delayMs > 5000 {
-		delayMs = 5000
+	if ackErr := delivery.Ack(false); ackErr != nil {
+		slog.Error("Failed to ack message after scheduling retry", "error", ackErr)
+		return
 	}
+	slog.Info("Message scheduled for retry", append(logAttrs,
+		"retry", retry,
+		"max_retries", c.retry.retries(),
+		"delay", c.retry.Delay(retry),
+	)...)
+}
 
-	publishing := amqp.Publishing{
-		Headers:       headers,
-		ContentType:   delivery.ContentType,
-		CorrelationId: delivery.CorrelationId,
-		MessageId:     delivery.MessageId,
-		Timestamp:     delivery.Timestamp,
-		DeliveryMode:  delivery.DeliveryMode,
-		Body:          delivery.Body,
+// deadLetter publishes the message to the dead letter exchange with reason and
+// the handler error in its headers, then acks it. If that publish fails it
+// rejects the message instead, which dead-letters it without them
+func (c *MessageConsumer) deadLetter(ctx context.Context, delivery amqp.Delivery, reason string, handlerErr error, logAttrs []interface{}) {
+	logAttrs = append(logAttrs, "reason", reason, "error", handlerErr)
+
+	publishing := deadLetterPublishing(delivery, c.queue, reason, handlerErr)
+	if err := c.client.Send(ctx, c.deadLetters, delivery.RoutingKey, publishing); err != nil {
+		slog.Error("Failed to publish dead letter, rejecting instead", append(logAttrs, "publish_error", err)...)
+		if nackErr := delivery.Nack(false, false); nackErr != nil {
+			slog.Error("Failed to nack message (send to DLQ)", "error", nackErr)
+			return
+		}
+		slog.Warn("Message sent to dead letter queue", logAttrs...)
+		return
 	}
 
-	time.Sleep(time.Duration(delayMs) * time.Millisecond)
-
-	// republish to the same queue via default exchange
-	return c.client.Send(ctx, "", c.queue, publishing)
+	if ackErr := delivery.Ack(false); ackErr != nil {
+		slog.Error("Failed to ack message after dead-lettering", "error", ackErr)
+		return
+	}
+	slog.Warn("Message sent to dead letter queue", logAttrs...)
 }
 
 func (c *MessageConsumer) Stop(ctx context.Context) error {
@@ -286,6 +422,15 @@ func (g *ConsumerGroup) StartAll(ctx context.Context) error {
 	return nil
 }
 
+// Status reports every consumer's state, in the order they were added
+func (g *ConsumerGroup) Status() []ConsumerStatus {
+	statuses := make([]ConsumerStatus, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		statuses = append(statuses, consumer.Status())
+	}
+	return statuses
+}
+
 func (g *ConsumerGroup) StopAll(ctx context.Context) error {
 	slog.Info("Stopping consumer group", "count", len(g.consumers))
 
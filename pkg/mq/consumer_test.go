@@ -0,0 +1,274 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker stands in for Client: each Consume opens a new delivery channel
+// and kill closes it the way a dropped connection does
+type fakeBroker struct {
+	mu        sync.Mutex
+	current   chan amqp.Delivery
+	consumes  int
+	qos       int
+	acked     int
+	nacked    int
+	sent      []sentMessage
+	nextTag   uint64
+	reconnect chan struct{}
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{reconnect: make(chan struct{}, 1)}
+}
+
+func (b *fakeBroker) SetQos(prefetchCount int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.qos++
+	return nil
+}
+
+func (b *fakeBroker) Consume(queue, consumer string, autoAck bool) (<-chan amqp.Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consumes++
+	b.current = make(chan amqp.Delivery, 16)
+	return b.current, nil
+}
+
+func (b *fakeBroker) Send(ctx context.Context, exchange, routingKey string, optinions amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sent = append(b.sent, sentMessage{exchange: exchange, routingKey: routingKey, publishing: optinions})
+	return nil
+}
+
+func (b *fakeBroker) NotifyReconnect() <-chan struct{} {
+	return b.reconnect
+}
+
+func (b *fakeBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acked++
+	return nil
+}
+
+func (b *fakeBroker) Nack(tag uint64, multiple, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nacked++
+	return nil
+}
+
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error { return nil }
+
+func (b *fakeBroker) deliver(body string) {
+	b.mu.Lock()
+	b.nextTag++
+	delivery := amqp.Delivery{Acknowledger: b, DeliveryTag: b.nextTag, Body: []byte(body)}
+	current := b.current
+	b.mu.Unlock()
+	current <- delivery
+}
+
+func (b *fakeBroker) kill() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	close(b.current)
+}
+
+func (b *fakeBroker) counts() (consumes, qos, acked int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.consumes, b.qos, b.acked
+}
+
+type sentMessage struct {
+	exchange   string
+	routingKey string
+	publishing amqp.Publishing
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (r *recorder) handle(ctx context.Context, message Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, string(message.Body))
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMessageConsumer_ResubscribesAfterReconnect(t *testing.T) {
+	broker := newFakeBroker()
+	handled := &recorder{}
+	consumer := newConsumer(broker, ConsumerConfig{
+		Handler:     handled.handle,
+		Queue:       "ride_status",
+		ConsumerTag: "ride-status",
+		Workers:     2,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+	if state := consumer.Status().State; state != ConsumerStateRunning {
+		t.Fatalf("Expected running after start, got %s", state)
+	}
+
+	broker.deliver("a")
+	broker.deliver("b")
+	waitFor(t, "first deliveries", func() bool { return handled.count() == 2 })
+
+	broker.kill()
+	waitFor(t, "reconnecting state", func() bool { return consumer.Status().State == ConsumerStateReconnecting })
+
+	broker.reconnect <- struct{}{}
+	waitFor(t, "resubscribe", func() bool { return consumer.Status().State == ConsumerStateRunning })
+
+	broker.deliver("c")
+	waitFor(t, "delivery after reconnect", func() bool { return handled.count() == 3 })
+
+	consumes, qos, acked := broker.counts()
+	if consumes != 2 || qos != 2 {
+		t.Errorf("Expected QoS and consume to be re-declared once, got %d consumes and %d qos", consumes, qos)
+	}
+	if acked != 3 {
+		t.Errorf("Expected 3 acks, got %d", acked)
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+	defer stopCancel()
+	if err := consumer.Stop(stopCtx); err != nil {
+		t.Fatalf("Unexpected stop error: %v", err)
+	}
+	if state := consumer.Status().State; state != ConsumerStateStopped {
+		t.Errorf("Expected stopped after Stop, got %s", state)
+	}
+}
+
+func TestMessageConsumer_FailsWhenClientGivesUp(t *testing.T) {
+	broker := newFakeBroker()
+	consumer := newConsumer(broker, ConsumerConfig{
+		Handler: (&recorder{}).handle,
+		Queue:   "driver_matching",
+		Workers: 1,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+
+	broker.kill()
+	close(broker.reconnect)
+	waitFor(t, "failed state", func() bool { return consumer.Status().State == ConsumerStateFailed })
+}
+
+func TestConsumerGroup_Status(t *testing.T) {
+	group := NewConsumerGroup()
+	group.Add(newConsumer(newFakeBroker(), ConsumerConfig{Queue: "ride_status", ConsumerTag: "ride-status"}))
+	group.Add(newConsumer(newFakeBroker(), ConsumerConfig{Queue: "driver_responses", ConsumerTag: "ride-driver-responses"}))
+
+	statuses := group.Status()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 statuses, got %d", len(statuses))
+	}
+	if statuses[1].Queue != "driver_responses" || statuses[1].State != ConsumerStateStarting {
+		t.Errorf("Unexpected status %+v", statuses[1])
+	}
+}
+
+func TestMessageConsumer_ProcessMessageRetries(t *testing.T) {
+	failing := errors.New("database unavailable")
+
+	tests := []struct {
+		name       string
+		handlerErr error
+		retryCount int32
+		wantRetry  bool
+		wantReason string
+	}{
+		{name: "transient error is retried", handlerErr: failing, retryCount: 0, wantRetry: true},
+		{name: "last retry", handlerErr: failing, retryCount: 2, wantRetry: true},
+		{name: "retries exhausted", handlerErr: failing, retryCount: 3, wantReason: "max retries exceeded"},
+		{name: "permanent error", handlerErr: Permanent(failing), retryCount: 0, wantReason: "non-retryable error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeBroker()
+			consumer := newConsumer(broker, ConsumerConfig{
+				Handler: func(ctx context.Context, message Message) error { return tt.handlerErr },
+				Queue:   "driver_matching",
+			})
+
+			consumer.processMessage(context.Background(), 0, amqp.Delivery{
+				Acknowledger: broker,
+				RoutingKey:   "ride.request.XL",
+				MessageId:    "m1",
+				Headers:      amqp.Table{headerRetryCount: tt.retryCount},
+			})
+
+			if !tt.wantRetry {
+				if len(broker.sent) != 1 || broker.acked != 1 || broker.nacked != 0 {
+					t.Fatalf("Expected the message to be dead-lettered and acked, got %d sends, %d acks and %d nacks", len(broker.sent), broker.acked, broker.nacked)
+				}
+				sent := broker.sent[0]
+				if sent.exchange != DeadLetterExchange || sent.routingKey != "ride.request.XL" {
+					t.Errorf("Expected dead letter via %s with the original routing key, got %s %s", DeadLetterExchange, sent.exchange, sent.routingKey)
+				}
+				letter := parseDeadLetter(amqp.Delivery{Headers: sent.publishing.Headers})
+				if letter.Queue != "driver_matching" || letter.Reason != tt.wantReason || letter.LastError != failing.Error() {
+					t.Errorf("Unexpected dead letter %+v", letter)
+				}
+				return
+			}
+
+			if len(broker.sent) != 1 || broker.acked != 1 {
+				t.Fatalf("Expected one retry and an ack, got %d retries and %d acks", len(broker.sent), broker.acked)
+			}
+			sent := broker.sent[0]
+			retry := int(tt.retryCount) + 1
+			if sent.exchange != RetryExchange || sent.routingKey != "ride.request.XL" {
+				t.Errorf("Expected retry via %s with the original routing key, got %s %s", RetryExchange, sent.exchange, sent.routingKey)
+			}
+			if got := sent.publishing.Headers[headerRetryQueue]; got != RetryQueueName("driver_matching", retry) {
+				t.Errorf("Expected retry queue header %s, got %v", RetryQueueName("driver_matching", retry), got)
+			}
+			if got := sent.publishing.Headers[headerRetryCount]; got != int32(retry) {
+				t.Errorf("Expected retry count %d, got %v", retry, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterQueueName is the queue bound to the dlx exchange with "#"
+const DeadLetterQueueName = "dead_letters"
+
+// Death is one x-death entry: the broker adds or updates one each time the
+// message is dead-lettered from a queue
+type Death struct {
+	Queue       string    `json:"queue"`
+	Reason      string    `json:"reason"` // rejected, expired, maxlen or delivery_limit
+	Exchange    string    `json:"exchange"`
+	RoutingKeys []string  `json:"routing_keys"`
+	Count       int64     `json:"count"`
+	Time        time.Time `json:"time"`
+}
+
+// DeadLetter is a message sitting in the dead letter queue
+type DeadLetter struct {
+	MessageID     string
+	CorrelationID string
+	Exchange      string // exchange the message was first published to
+	RoutingKey    string
+	Queue         string // queue the message was last dead-lettered from
+	Reason        string
+	LastError     string // last handler error
+	Retries       int
+	Deaths        []Death // most recent first
+	Timestamp     time.Time
+	ContentType   string
+	Body          []byte
+}
+
+// DeadLetterFilter selects dead letters; empty fields match everything
+type DeadLetterFilter struct {
+	MessageIDs    []string
+	Queue         string
+	RoutingKey    string
+	CorrelationID string
+	Limit         int // 0 means no limit
+}
+
+// IsEmpty reports whether the filter selects every message in the queue
+func (f DeadLetterFilter) IsEmpty() bool {
+	return len(f.MessageIDs) == 0 && f.Queue == "" && f.RoutingKey == "" && f.CorrelationID == "" && f.Limit == 0
+}
+
+func (f DeadLetterFilter) Match(d DeadLetter) bool {
+	if len(f.MessageIDs) > 0 && !slices.Contains(f.MessageIDs, d.MessageID) {
+		return false
+	}
+	if f.Queue != "" && f.Queue != d.Queue {
+		return false
+	}
+	if f.RoutingKey != "" && f.RoutingKey != d.RoutingKey {
+		return false
+	}
+	return f.CorrelationID == "" || f.CorrelationID == d.CorrelationID
+}
+
+// DeadLetterQueue inspects, replays and purges dead-lettered messages. It
+// browses the queue with basic.get on a channel of its own and leaves every
+// message it does not act on unacked until the channel closes, which puts them
+// back where they were
+type DeadLetterQueue struct {
+	client *Client
+	queue  string
+}
+
+func NewDeadLetterQueue(client *Client) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		client: client,
+		queue:  DeadLetterQueueName,
+	}
+}
+
+// List returns the dead letters matching filter, oldest first
+func (q *DeadLetterQueue) List(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	_, err := q.scan(ctx, filter, func(letter DeadLetter, delivery amqp.Delivery) error {
+		letters = append(letters, letter)
+		return nil
+	})
+	return letters, err
+}
+
+// Replay hands the matching dead letters back to the queue they were
+// dead-lettered from, with a fresh retry budget, and removes them from the
+// queue. No other queue bound to their routing key sees them again. On a
+// failed publish Replay stops and the message stays dead-lettered
+func (q *DeadLetterQueue) Replay(ctx context.Context, filter DeadLetterFilter) (int, error) {
+	return q.scan(ctx, filter, func(letter DeadLetter, delivery amqp.Delivery) error {
+		if err := replay(ctx, q.client, letter, delivery); err != nil {
+			return fmt.Errorf("failed to replay message %s: %w", letter.MessageID, err)
+		}
+		return delivery.Ack(false)
+	})
+}
+
+// replay sends letter to letter.Queue through retry_return, which keeps its
+// routing key, or through the default exchange when the queue has no retry
+// queues and so no retry_return binding
+func replay(ctx context.Context, client Broker, letter DeadLetter, delivery amqp.Delivery) error {
+	if letter.Queue == "" {
+		return errors.New("no queue to replay to")
+	}
+
+	publishing := replayPublishing(delivery)
+	publishing.Headers[headerOriginalExchange] = letter.Exchange
+	publishing.Headers[headerRetryOrigin] = letter.Queue
+
+	err := client.Send(ctx, RetryReturnExchange, letter.RoutingKey, publishing)
+	var returned *ReturnedError
+	if !errors.As(err, &returned) {
+		return err
+	}
+	delete(publishing.Headers, headerRetryOrigin)
+	return client.Send(ctx, "", letter.Queue, publishing)
+}
+
+// Purge deletes the matching dead letters
+func (q *DeadLetterQueue) Purge(ctx context.Context, filter DeadLetterFilter) (int, error) {
+	if filter.IsEmpty() {
+		ch, err := q.client.channel(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close()
+		return ch.QueuePurge(q.queue, false)
+	}
+
+	return q.scan(ctx, filter, func(letter DeadLetter, delivery amqp.Delivery) error {
+		return delivery.Ack(false)
+	})
+}
+
+// scan calls fn for each message matching filter, up to its limit. Only the
+// messages in the queue when the scan starts are looked at
+func (q *DeadLetterQueue) scan(ctx context.Context, filter DeadLetterFilter, fn func(DeadLetter, amqp.Delivery) error) (int, error) {
+	ch, err := q.client.channel(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// unacked messages go back to the queue
+	defer ch.Close()
+
+	state, err := ch.QueueDeclarePassive(q.queue, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect %s: %w", q.queue, err)
+	}
+
+	matched := 0
+	for i := 0; i < state.Messages; i++ {
+		if filter.Limit > 0 && matched >= filter.Limit {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return matched, err
+		}
+
+		delivery, ok, err := ch.Get(q.queue, false)
+		if err != nil {
+			return matched, fmt.Errorf("failed to get message from %s: %w", q.queue, err)
+		}
+		if !ok {
+			break
+		}
+
+		letter := parseDeadLetter(delivery)
+		if !filter.Match(letter) {
+			continue
+		}
+		if err := fn(letter, delivery); err != nil {
+			return matched, err
+		}
+		matched++
+	}
+
+	return matched, nil
+}
+
+func parseDeadLetter(delivery amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID:     delivery.MessageId,
+		CorrelationID: delivery.CorrelationId,
+		Exchange:      delivery.Exchange,
+		RoutingKey:    delivery.RoutingKey,
+		Timestamp:     delivery.Timestamp,
+		ContentType:   delivery.ContentType,
+		Body:          delivery.Body,
+		Deaths:        parseDeaths(delivery.Headers["x-death"]),
+	}
+
+	if len(letter.Deaths) > 0 {
+		letter.Queue = letter.Deaths[0].Queue
+		letter.Reason = letter.Deaths[0].Reason
+		letter.Exchange = letter.Deaths[len(letter.Deaths)-1].Exchange
+	}
+	if exchange, ok := delivery.Headers[headerOriginalExchange].(string); ok {
+		letter.Exchange = exchange
+	}
+	// set when the consumer published the message here itself rather than rejecting it
+	if queue, ok := delivery.Headers[headerFailedQueue].(string); ok {
+		letter.Queue = queue
+	}
+	if reason, ok := delivery.Headers[headerDeadLetterReason].(string); ok {
+		letter.Reason = reason
+	}
+	if lastError, ok := delivery.Headers[headerLastError].(string); ok {
+		letter.LastError = lastError
+	}
+	if retries, ok := delivery.Headers[headerRetryCount].(int32); ok {
+		letter.Retries = int(retries)
+	}
+
+	return letter
+}
+
+func parseDeaths(header interface{}) []Death {
+	entries, ok := header.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	deaths := make([]Death, 0, len(entries))
+	for _, entry := range entries {
+		table, ok := entry.(amqp.Table)
+		if !ok {
+			continue
+		}
+		death := Death{}
+		death.Queue, _ = table["queue"].(string)
+		death.Reason, _ = table["reason"].(string)
+		death.Exchange, _ = table["exchange"].(string)
+		death.Count, _ = table["count"].(int64)
+		death.Time, _ = table["time"].(time.Time)
+		if keys, ok := table["routing-keys"].([]interface{}); ok {
+			for _, key := range keys {
+				if s, ok := key.(string); ok {
+					death.RoutingKeys = append(death.RoutingKeys, s)
+				}
+			}
+		}
+		deaths = append(deaths, death)
+	}
+	return deaths
+}
+
+// replayPublishing copies a dead letter without the headers the broker and
+// the retry queues added, so it starts over as a new delivery
+func replayPublishing(delivery amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		if strings.HasPrefix(k, "x-death") || strings.HasPrefix(k, "x-first-death") || strings.HasPrefix(k, "x-last-death") {
+			continue
+		}
+		switch k {
+		case headerRetryCount, headerRetryQueue, headerRetryOrigin, headerOriginalExchange, headerLastError,
+			headerFailedQueue, headerDeadLetterReason:
+			continue
+		}
+		headers[k] = v
+	}
+
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		MessageId:     delivery.MessageId,
+		Timestamp:     delivery.Timestamp,
+		DeliveryMode:  delivery.DeliveryMode,
+		Body:          delivery.Body,
+	}
+}
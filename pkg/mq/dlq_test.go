@@ -0,0 +1,160 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// retriedDelivery is a driver_matching message that failed its retries and
+// was rejected into dead_letters
+func retriedDelivery() amqp.Delivery {
+	diedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return amqp.Delivery{
+		Exchange:      "dlx",
+		RoutingKey:    "ride.request.XL",
+		MessageId:     "m1",
+		CorrelationId: "ride-1",
+		Body:          []byte(`{"ride_id":"ride-1"}`),
+		Headers: amqp.Table{
+			headerRetryCount:       int32(3),
+			headerRetryOrigin:      "driver_matching",
+			headerOriginalExchange: "ride_topic",
+			headerLastError:        "database unavailable",
+			"x-first-death-queue":  "driver_matching.retry.1",
+			"x-death": []interface{}{
+				amqp.Table{
+					"queue":        "driver_matching",
+					"reason":       "rejected",
+					"exchange":     RetryReturnExchange,
+					"count":        int64(1),
+					"time":         diedAt,
+					"routing-keys": []interface{}{"ride.request.XL"},
+				},
+				amqp.Table{
+					"queue":        "driver_matching.retry.1",
+					"reason":       "expired",
+					"exchange":     RetryExchange,
+					"count":        int64(1),
+					"time":         diedAt.Add(-time.Minute),
+					"routing-keys": []interface{}{"ride.request.XL"},
+				},
+			},
+		},
+	}
+}
+
+func TestParseDeadLetter(t *testing.T) {
+	letter := parseDeadLetter(retriedDelivery())
+
+	if letter.Queue != "driver_matching" || letter.Reason != "rejected" {
+		t.Errorf("Expected to be dead-lettered from driver_matching as rejected, got %s %s", letter.Queue, letter.Reason)
+	}
+	if letter.Exchange != "ride_topic" || letter.RoutingKey != "ride.request.XL" {
+		t.Errorf("Expected origin ride_topic ride.request.XL, got %s %s", letter.Exchange, letter.RoutingKey)
+	}
+	if letter.LastError != "database unavailable" || letter.Retries != 3 {
+		t.Errorf("Unexpected last error %q after %d retries", letter.LastError, letter.Retries)
+	}
+	if len(letter.Deaths) != 2 || letter.Deaths[1].Reason != "expired" || letter.Deaths[0].RoutingKeys[0] != "ride.request.XL" {
+		t.Errorf("Unexpected deaths %+v", letter.Deaths)
+	}
+}
+
+func TestParseDeadLetter_NotRetried(t *testing.T) {
+	letter := parseDeadLetter(amqp.Delivery{
+		Exchange:   "dlx",
+		RoutingKey: "driver.response.ride-2",
+		Headers: amqp.Table{
+			"x-death": []interface{}{
+				amqp.Table{"queue": "driver_responses", "reason": "rejected", "exchange": "driver_topic", "count": int64(1)},
+			},
+		},
+	})
+
+	if letter.Exchange != "driver_topic" || letter.Queue != "driver_responses" {
+		t.Errorf("Expected origin from x-death, got exchange %s queue %s", letter.Exchange, letter.Queue)
+	}
+	if letter.LastError != "" || letter.Retries != 0 {
+		t.Errorf("Expected no retry information, got %q and %d", letter.LastError, letter.Retries)
+	}
+}
+
+func TestDeadLetterFilter_Match(t *testing.T) {
+	letter := parseDeadLetter(retriedDelivery())
+
+	tests := []struct {
+		name   string
+		filter DeadLetterFilter
+		want   bool
+	}{
+		{name: "empty", filter: DeadLetterFilter{}, want: true},
+		{name: "selected", filter: DeadLetterFilter{MessageIDs: []string{"m0", "m1"}}, want: true},
+		{name: "not selected", filter: DeadLetterFilter{MessageIDs: []string{"m2"}}, want: false},
+		{name: "queue", filter: DeadLetterFilter{Queue: "driver_matching"}, want: true},
+		{name: "other queue", filter: DeadLetterFilter{Queue: "ride_status"}, want: false},
+		{name: "routing key and correlation", filter: DeadLetterFilter{RoutingKey: "ride.request.XL", CorrelationID: "ride-1"}, want: true},
+		{name: "other correlation", filter: DeadLetterFilter{CorrelationID: "ride-2"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(letter); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReplayPublishing_StripsDeathAndRetryHeaders(t *testing.T) {
+	delivery := retriedDelivery()
+	delivery.Headers["x-trace"] = "abc"
+
+	publishing := replayPublishing(delivery)
+
+	if len(publishing.Headers) != 1 || publishing.Headers["x-trace"] != "abc" {
+		t.Errorf("Expected only application headers to survive, got %v", publishing.Headers)
+	}
+	if publishing.MessageId != "m1" || publishing.CorrelationId != "ride-1" || string(publishing.Body) != `{"ride_id":"ride-1"}` {
+		t.Errorf("Expected the message to be replayed unchanged, got %+v", publishing)
+	}
+}
+
+func TestReplay_ReturnsToTheFailedQueueOnly(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+
+	// driver_matching has retry queues, ride_requests does not; both are bound to ride.request.*
+	failed := retriedDelivery()
+	notRetried := retriedDelivery()
+	notRetried.Headers = amqp.Table{headerFailedQueue: "ride_requests", headerOriginalExchange: "ride_topic"}
+
+	for _, delivery := range []amqp.Delivery{failed, notRetried} {
+		letter := parseDeadLetter(delivery)
+		if err := replay(context.Background(), b, letter, delivery); err != nil {
+			t.Fatalf("Unexpected replay error for %s: %v", letter.Queue, err)
+		}
+	}
+
+	if b.QueueLen("driver_matching") != 1 || b.QueueLen("ride_requests") != 1 {
+		t.Errorf("Expected each queue to get its own letter back, got driver_matching %d and ride_requests %d",
+			b.QueueLen("driver_matching"), b.QueueLen("ride_requests"))
+	}
+}
+
+func TestReplay_RequiresAQueue(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+
+	delivery := amqp.Delivery{RoutingKey: "ride.request.XL", Headers: amqp.Table{}}
+	if err := replay(context.Background(), b, parseDeadLetter(delivery), delivery); err == nil {
+		t.Error("Expected a letter without a queue not to be replayed")
+	}
+	if b.QueueLen("driver_matching") != 0 || b.QueueLen("ride_requests") != 0 {
+		t.Error("Expected nothing to be published")
+	}
+}
@@ -0,0 +1,219 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event types carried in Envelope.Type
+const (
+	EventRideRequested       = "ride.requested"
+	EventRideStatusChanged   = "ride.status_changed"
+	EventRideMatched         = "ride.matched"
+	EventRideCancelled       = "ride.cancelled"
+	EventRideCompleted       = "ride.completed"
+	EventDriverResponded     = "driver.responded"
+	EventDriverStatusChanged = "driver.status_changed"
+	EventLocationUpdated     = "location.updated"
+	EventSocketFrame         = "socket.frame"
+	EventSocketPresence      = "socket.presence"
+	EventSocketRequest       = "socket.request"
+)
+
+var (
+	ErrUnregisteredEvent  = errors.New("event is not registered")
+	ErrInvalidEnvelope    = errors.New("invalid event envelope")
+	ErrUnknownEventType   = errors.New("unknown event type")
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+	ErrUnexpectedEvent    = errors.New("unexpected event type")
+)
+
+// Event is a payload that can be published. Its type and version must be
+// registered; bump the version on any incompatible payload change and register
+// an Upgrader from the previous one
+type Event interface {
+	EventType() string
+	EventVersion() int
+}
+
+// Envelope is the body of every message on the bus
+type Envelope struct {
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Producer      string          `json:"producer"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Upgrader rewrites a payload of one version into the next version
+type Upgrader func(payload json.RawMessage) (json.RawMessage, error)
+
+type eventSchema struct {
+	version  int
+	decode   func(payload json.RawMessage) (Event, error)
+	upgrades map[int]Upgrader // keyed by the version upgraded from
+}
+
+// Registry knows the current version of every event type and how to bring
+// older versions up to it
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*eventSchema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*eventSchema)}
+}
+
+// DefaultRegistry has every ride-hail event registered at its current version
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	Register[RideRequestMessage](r)
+	Register[RideStatusMessage](r)
+	Register[RideMatchedMessage](r)
+	Register[RideCancelledMessage](r)
+	Register[RideCompletedMessage](r)
+	Register[DriverResponseMessage](r)
+	Register[DriverStatusMessage](r)
+	Register[LocationUpdateMessage](r)
+	Register[SocketFrameMessage](r)
+	Register[SocketPresenceMessage](r)
+	Register[SocketRequestMessage](r)
+	return r
+}
+
+// events is the registry the event publishers and DecodeEvent use
+var events = DefaultRegistry()
+
+// Register makes T the current version of its event type in r
+func Register[T Event](r *Registry) {
+	var zero T
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schema, ok := r.schemas[zero.EventType()]
+	if !ok {
+		schema = &eventSchema{upgrades: make(map[int]Upgrader)}
+		r.schemas[zero.EventType()] = schema
+	}
+	schema.version = zero.EventVersion()
+	schema.decode = func(payload json.RawMessage) (Event, error) {
+		var event T
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	}
+}
+
+// RegisterUpgrade lets consumers read version from of eventType by rewriting
+// it into version from+1
+func (r *Registry) RegisterUpgrade(eventType string, from int, upgrade Upgrader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schema, ok := r.schemas[eventType]
+	if !ok {
+		schema = &eventSchema{upgrades: make(map[int]Upgrader)}
+		r.schemas[eventType] = schema
+	}
+	schema.upgrades[from] = upgrade
+}
+
+// Wrap puts event in an envelope, refusing types or versions r does not have
+// registered as current
+func (r *Registry) Wrap(event Event, producer, correlationID string) (Envelope, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[event.EventType()]
+	r.mu.RUnlock()
+	if !ok || schema.decode == nil || schema.version != event.EventVersion() {
+		return Envelope{}, fmt.Errorf("%w: %s v%d", ErrUnregisteredEvent, event.EventType(), event.EventVersion())
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal %s payload: %w", event.EventType(), err)
+	}
+	return Envelope{
+		Type:          event.EventType(),
+		Version:       event.EventVersion(),
+		OccurredAt:    time.Now().UTC(),
+		Producer:      producer,
+		CorrelationID: correlationID,
+		Payload:       payload,
+	}, nil
+}
+
+// Decode reads an envelope and returns its payload at the current version of
+// its type. Older versions are upgraded one version at a time; newer versions,
+// unknown types and malformed bodies are permanent errors, so the consumer
+// dead-letters the message with the reason instead of retrying it
+func (r *Registry) Decode(body []byte) (Envelope, Event, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return envelope, nil, Permanent(fmt.Errorf("%w: %v", ErrInvalidEnvelope, err))
+	}
+	if envelope.Type == "" || envelope.Version < 1 {
+		return envelope, nil, Permanent(fmt.Errorf("%w: missing type or version", ErrInvalidEnvelope))
+	}
+
+	r.mu.RLock()
+	schema, ok := r.schemas[envelope.Type]
+	r.mu.RUnlock()
+	if !ok || schema.decode == nil {
+		return envelope, nil, Permanent(fmt.Errorf("%w: %s", ErrUnknownEventType, envelope.Type))
+	}
+	if envelope.Version > schema.version {
+		return envelope, nil, Permanent(fmt.Errorf("%w: %s v%d, this consumer reads up to v%d",
+			ErrUnsupportedVersion, envelope.Type, envelope.Version, schema.version))
+	}
+
+	payload := envelope.Payload
+	for version := envelope.Version; version < schema.version; version++ {
+		upgrade, ok := schema.upgrades[version]
+		if !ok {
+			return envelope, nil, Permanent(fmt.Errorf("%w: %s v%d, no upgrade to v%d",
+				ErrUnsupportedVersion, envelope.Type, version, version+1))
+		}
+		upgraded, err := upgrade(payload)
+		if err != nil {
+			return envelope, nil, Permanent(fmt.Errorf("failed to upgrade %s v%d: %w", envelope.Type, version, err))
+		}
+		payload = upgraded
+	}
+
+	event, err := schema.decode(payload)
+	if err != nil {
+		return envelope, nil, Permanent(fmt.Errorf("invalid %s v%d payload: %w", envelope.Type, envelope.Version, err))
+	}
+	return envelope, event, nil
+}
+
+// DecodeEvent decodes message with the default registry, unless a middleware
+// already did; switch on the returned event's type to handle queues that
+// carry several
+func DecodeEvent(message Message) (Event, error) {
+	if message.Event != nil {
+		return message.Event, nil
+	}
+	_, event, err := events.Decode(message.Body)
+	return event, err
+}
+
+// DecodeAs decodes message as a T, the only event its queue carries
+func DecodeAs[T Event](message Message) (T, error) {
+	var zero T
+	event, err := DecodeEvent(message)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := event.(T)
+	if !ok {
+		return zero, Permanent(fmt.Errorf("%w: got %s, want %s", ErrUnexpectedEvent, event.EventType(), zero.EventType()))
+	}
+	return typed, nil
+}
@@ -0,0 +1,169 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type fareQuoteV1 struct {
+	Fare float64 `json:"fare"`
+}
+
+func (fareQuoteV1) EventType() string { return "fare.quoted" }
+func (fareQuoteV1) EventVersion() int { return 1 }
+
+type fareQuoteV2 struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+func (fareQuoteV2) EventType() string { return "fare.quoted" }
+func (fareQuoteV2) EventVersion() int { return 2 }
+
+func envelopeBody(t *testing.T, envelope Envelope) []byte {
+	t.Helper()
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("Failed to marshal envelope: %v", err)
+	}
+	return body
+}
+
+func TestRegistry_WrapAndDecode(t *testing.T) {
+	registry := DefaultRegistry()
+
+	envelope, err := registry.Wrap(RideRequestMessage{RideID: "ride-1", PickupLocation: LocationCoordinates{Latitude: 43.2}}, "ride-service", "corr-1")
+	if err != nil {
+		t.Fatalf("Unexpected wrap error: %v", err)
+	}
+	if envelope.Type != EventRideRequested || envelope.Version != 1 || envelope.Producer != "ride-service" || envelope.CorrelationID != "corr-1" {
+		t.Errorf("Unexpected envelope %+v", envelope)
+	}
+	if envelope.OccurredAt.IsZero() {
+		t.Error("Expected occurred_at to be set")
+	}
+
+	_, event, err := registry.Decode(envelopeBody(t, envelope))
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	request, ok := event.(RideRequestMessage)
+	if !ok || request.RideID != "ride-1" || request.PickupLocation.Latitude != 43.2 {
+		t.Errorf("Unexpected event %#v", event)
+	}
+}
+
+func TestRegistry_WrapRefusesUnregisteredEvents(t *testing.T) {
+	registry := NewRegistry()
+	Register[fareQuoteV2](registry)
+
+	if _, err := registry.Wrap(RideRequestMessage{}, "ride-service", ""); !errors.Is(err, ErrUnregisteredEvent) {
+		t.Errorf("Expected ErrUnregisteredEvent for an unregistered type, got %v", err)
+	}
+	if _, err := registry.Wrap(fareQuoteV1{}, "ride-service", ""); !errors.Is(err, ErrUnregisteredEvent) {
+		t.Errorf("Expected ErrUnregisteredEvent for an old version, got %v", err)
+	}
+}
+
+func TestRegistry_DecodeUpgradesOlderVersions(t *testing.T) {
+	registry := NewRegistry()
+	Register[fareQuoteV2](registry)
+	registry.RegisterUpgrade("fare.quoted", 1, func(payload json.RawMessage) (json.RawMessage, error) {
+		var v1 fareQuoteV1
+		if err := json.Unmarshal(payload, &v1); err != nil {
+			return nil, err
+		}
+		return json.Marshal(fareQuoteV2{Amount: v1.Fare, Currency: "KZT"})
+	})
+
+	body := envelopeBody(t, Envelope{Type: "fare.quoted", Version: 1, Payload: json.RawMessage(`{"fare":1500}`)})
+	_, event, err := registry.Decode(body)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if quote, ok := event.(fareQuoteV2); !ok || quote.Amount != 1500 || quote.Currency != "KZT" {
+		t.Errorf("Expected the v1 payload upgraded to v2, got %#v", event)
+	}
+}
+
+func TestRegistry_DecodeRejects(t *testing.T) {
+	registry := NewRegistry()
+	Register[fareQuoteV2](registry)
+
+	tests := []struct {
+		name string
+		body []byte
+		want error
+	}{
+		{name: "not an envelope", body: []byte("not json"), want: ErrInvalidEnvelope},
+		{name: "bare payload", body: []byte(`{"fare":1500}`), want: ErrInvalidEnvelope},
+		{name: "unknown type", body: envelopeBody(t, Envelope{Type: "fare.disputed", Version: 1}), want: ErrUnknownEventType},
+		{name: "newer version", body: envelopeBody(t, Envelope{Type: "fare.quoted", Version: 3}), want: ErrUnsupportedVersion},
+		{name: "no upgrade path", body: envelopeBody(t, Envelope{Type: "fare.quoted", Version: 1}), want: ErrUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := registry.Decode(tt.body)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if !errors.Is(err, ErrPermanent) {
+				t.Errorf("Expected a permanent error so the message is not retried, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeAs_UnexpectedEvent(t *testing.T) {
+	envelope, err := events.Wrap(DriverStatusMessage{DriverID: "driver-1"}, "driver-location-service", "")
+	if err != nil {
+		t.Fatalf("Unexpected wrap error: %v", err)
+	}
+
+	_, err = DecodeAs[RideRequestMessage](Message{Body: envelopeBody(t, envelope)})
+	if !errors.Is(err, ErrUnexpectedEvent) || !errors.Is(err, ErrPermanent) {
+		t.Errorf("Expected a permanent ErrUnexpectedEvent, got %v", err)
+	}
+}
+
+func TestMemoryBroker_UnsupportedVersionIsDeadLettered(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+
+	consumer := NewConsumer(b, ConsumerConfig{
+		Queue: DriverMatchingQueue,
+		Handler: func(ctx context.Context, message Message) error {
+			_, err := DecodeAs[RideRequestMessage](message)
+			return err
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+
+	body := envelopeBody(t, Envelope{Type: EventRideRequested, Version: 2, Producer: "ride-service", Payload: json.RawMessage(`{}`)})
+	if err := b.Send(ctx, RideTopicExchange, "ride.request.XL", amqp.Publishing{MessageId: "m1", Body: body}); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+
+	letters, err := b.Consume(DeadLetterQueueName, "dlq", true)
+	if err != nil {
+		t.Fatalf("Unexpected consume error: %v", err)
+	}
+	letter := parseDeadLetter(receive(t, letters))
+	if letter.MessageID != "m1" || letter.Queue != DriverMatchingQueue || letter.Exchange != RideTopicExchange || letter.Reason != "non-retryable error" {
+		t.Errorf("Unexpected dead letter %+v", letter)
+	}
+	if !strings.Contains(letter.LastError, "unsupported event version: ride.requested v2") {
+		t.Errorf("Expected the version in the dead letter's error, got %q", letter.LastError)
+	}
+}
@@ -0,0 +1,503 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"ride-hail/pkg/uuid"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MemoryBroker is an in-process Broker that routes like RabbitMQ: direct,
+// topic (with * and # wildcards), fanout and headers exchanges, the default
+// exchange, dead letter exchanges and per-queue message TTLs. Messages live
+// in memory only, and consumers of one queue compete for its messages
+type MemoryBroker struct {
+	mu        sync.Mutex
+	exchanges map[string]*memoryExchange
+	queues    map[string]*memoryQueue
+	unacked   map[uint64]unackedMessage
+	nextTag   uint64
+	nextID    uint64
+	closed    bool
+	done      chan struct{}
+}
+
+type memoryExchange struct {
+	kind     string
+	bindings []memoryBinding
+}
+
+type memoryBinding struct {
+	queue string
+	key   string
+	args  amqp.Table
+}
+
+type memoryQueue struct {
+	name  string
+	args  amqp.Table
+	ready []memoryMessage
+	wait  chan struct{} // closed and replaced whenever a message is queued
+}
+
+type memoryMessage struct {
+	id          uint64
+	exchange    string
+	routingKey  string
+	publishing  amqp.Publishing
+	redelivered bool
+}
+
+type unackedMessage struct {
+	queue   *memoryQueue
+	message memoryMessage
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		exchanges: make(map[string]*memoryExchange),
+		queues:    make(map[string]*memoryQueue),
+		unacked:   make(map[uint64]unackedMessage),
+		done:      make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) CreateExchange(name, kind string, durable, autoDelete bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return &amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("exchange %q already declared as %s", name, ex.kind)}
+		}
+		return nil
+	}
+	switch kind {
+	case amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout, amqp.ExchangeHeaders:
+	default:
+		return &amqp.Error{Code: amqp.CommandInvalid, Reason: fmt.Sprintf("unknown exchange type %s", kind)}
+	}
+	b.exchanges[name] = &memoryExchange{kind: kind}
+	return nil
+}
+
+func (b *MemoryBroker) CreateQueueWithArgs(name string, durable, autoDelete bool, args amqp.Table) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if q, ok := b.queues[name]; ok {
+		if !argsEqual(q.args, args) {
+			return &amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("inequivalent arguments for queue %q: %s, want %s", name, formatArgs(args), formatArgs(q.args))}
+		}
+		return nil
+	}
+	b.queues[name] = &memoryQueue{name: name, args: args, wait: make(chan struct{})}
+	return nil
+}
+
+func (b *MemoryBroker) CreateBindingWithArgs(name, binding, exchange string, args amqp.Table) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("no exchange %q", exchange)}
+	}
+	if _, ok := b.queues[name]; !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("no queue %q", name)}
+	}
+	for _, existing := range ex.bindings {
+		if existing.queue == name && existing.key == binding && argsEqual(existing.args, args) {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, memoryBinding{queue: name, key: binding, args: args})
+	return nil
+}
+
+// Send routes the message to every matching queue. Like Client.Send it fails
+// with a *ReturnedError when no queue matches
+func (b *MemoryBroker) Send(ctx context.Context, exchange, routingKey string, optinions amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if optinions.MessageId == "" {
+		optinions.MessageId = uuid.New().String()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return amqp.ErrClosed
+	}
+
+	routed, err := b.route(exchange, routingKey, optinions)
+	if err != nil {
+		return err
+	}
+	if routed == 0 {
+		return &ReturnedError{Exchange: exchange, RoutingKey: routingKey, ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Consume(queue, consumer string, autoAck bool) (<-chan amqp.Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil, &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("no queue %q", queue)}
+	}
+	out := make(chan amqp.Delivery)
+	go b.deliver(q, out, consumer, autoAck)
+	return out, nil
+}
+
+// SetQos is a no-op: a consumer takes its next message when it is ready for it
+func (b *MemoryBroker) SetQos(prefetchCount int) error {
+	return nil
+}
+
+// NotifyReconnect never signals; it is closed when the broker is
+func (b *MemoryBroker) NotifyReconnect() <-chan struct{} {
+	return b.done
+}
+
+func (b *MemoryBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.takeUnacked(tag, multiple)
+	return err
+}
+
+func (b *MemoryBroker) Nack(tag uint64, multiple, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	messages, err := b.takeUnacked(tag, multiple)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		if requeue {
+			m.message.redelivered = true
+			m.queue.ready = append([]memoryMessage{m.message}, m.queue.ready...)
+			m.queue.wake()
+			continue
+		}
+		b.deadLetter(m.queue, m.message, "rejected")
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+// QueueLen is the number of messages in queue waiting for a consumer
+func (b *MemoryBroker) QueueLen(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if q, ok := b.queues[queue]; ok {
+		return len(q.ready)
+	}
+	return 0
+}
+
+// Close stops every consumer; unacked messages are dropped
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	return nil
+}
+
+// deliver hands the messages of q to one consumer until the broker closes
+func (b *MemoryBroker) deliver(q *memoryQueue, out chan<- amqp.Delivery, consumerTag string, autoAck bool) {
+	defer close(out)
+
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return
+		}
+		if len(q.ready) == 0 {
+			wait := q.wait
+			b.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-b.done:
+				return
+			}
+		}
+
+		message := q.ready[0]
+		q.ready = q.ready[1:]
+		b.nextTag++
+		delivery := message.delivery(b, b.nextTag, consumerTag)
+		if !autoAck {
+			b.unacked[b.nextTag] = unackedMessage{queue: q, message: message}
+		}
+		b.mu.Unlock()
+
+		select {
+		case out <- delivery:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// route copies the message into every queue bound to exchange that matches,
+// once per queue. Callers hold b.mu
+func (b *MemoryBroker) route(exchange, routingKey string, publishing amqp.Publishing) (int, error) {
+	if exchange == "" {
+		q, ok := b.queues[routingKey]
+		if !ok {
+			return 0, nil
+		}
+		b.enqueue(q, exchange, routingKey, publishing)
+		return 1, nil
+	}
+
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return 0, &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("no exchange %q", exchange)}
+	}
+
+	routed := make(map[string]bool)
+	for _, binding := range ex.bindings {
+		if routed[binding.queue] || !binding.matches(ex.kind, routingKey, publishing.Headers) {
+			continue
+		}
+		routed[binding.queue] = true
+		b.enqueue(b.queues[binding.queue], exchange, routingKey, publishing)
+	}
+	return len(routed), nil
+}
+
+func (b *MemoryBroker) enqueue(q *memoryQueue, exchange, routingKey string, publishing amqp.Publishing) {
+	b.nextID++
+	message := memoryMessage{
+		id:         b.nextID,
+		exchange:   exchange,
+		routingKey: routingKey,
+		publishing: publishing,
+	}
+	q.ready = append(q.ready, message)
+	q.wake()
+
+	if ttl, ok := tableInt(q.args, "x-message-ttl"); ok {
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			b.expire(q, message.id)
+		})
+	}
+}
+
+// expire dead-letters message id if it is still waiting in q
+func (b *MemoryBroker) expire(q *memoryQueue, id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	for i, message := range q.ready {
+		if message.id == id {
+			q.ready = append(q.ready[:i], q.ready[i+1:]...)
+			b.deadLetter(q, message, "expired")
+			return
+		}
+	}
+}
+
+// deadLetter republishes message to the dead letter exchange of q with an
+// x-death entry, or drops it if q has none. Callers hold b.mu
+func (b *MemoryBroker) deadLetter(q *memoryQueue, message memoryMessage, reason string) {
+	dlx, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	routingKey := message.routingKey
+	if key, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		routingKey = key
+	}
+
+	publishing := message.publishing
+	publishing.Headers = withDeath(message.publishing.Headers, q.name, reason, message.exchange, message.routingKey)
+	// like RabbitMQ, a dead letter nobody is bound for is dropped
+	b.route(dlx, routingKey, publishing)
+}
+
+// takeUnacked removes and returns the unacked message with tag, or with every
+// tag up to it when multiple is set. Callers hold b.mu
+func (b *MemoryBroker) takeUnacked(tag uint64, multiple bool) ([]unackedMessage, error) {
+	if !multiple {
+		m, ok := b.unacked[tag]
+		if !ok {
+			return nil, &amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("unknown delivery tag %d", tag)}
+		}
+		delete(b.unacked, tag)
+		return []unackedMessage{m}, nil
+	}
+
+	var taken []unackedMessage
+	for t := uint64(1); t <= tag; t++ {
+		if m, ok := b.unacked[t]; ok {
+			taken = append(taken, m)
+			delete(b.unacked, t)
+		}
+	}
+	return taken, nil
+}
+
+func (q *memoryQueue) wake() {
+	close(q.wait)
+	q.wait = make(chan struct{})
+}
+
+func (m memoryMessage) delivery(acknowledger amqp.Acknowledger, tag uint64, consumerTag string) amqp.Delivery {
+	p := m.publishing
+	return amqp.Delivery{
+		Acknowledger:  acknowledger,
+		Headers:       p.Headers,
+		ContentType:   p.ContentType,
+		DeliveryMode:  p.DeliveryMode,
+		CorrelationId: p.CorrelationId,
+		MessageId:     p.MessageId,
+		Timestamp:     p.Timestamp,
+		ConsumerTag:   consumerTag,
+		DeliveryTag:   tag,
+		Redelivered:   m.redelivered,
+		Exchange:      m.exchange,
+		RoutingKey:    m.routingKey,
+		Body:          p.Body,
+	}
+}
+
+func (b memoryBinding) matches(kind, routingKey string, headers amqp.Table) bool {
+	switch kind {
+	case amqp.ExchangeDirect:
+		return b.key == routingKey
+	case amqp.ExchangeTopic:
+		return topicMatches(b.key, routingKey)
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeHeaders:
+		return headersMatch(b.args, headers)
+	}
+	return false
+}
+
+// topicMatches reports whether routingKey matches a topic binding pattern,
+// where * stands for exactly one word and # for zero or more
+func topicMatches(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			for skip := 0; skip <= len(words); skip++ {
+				if matchWords(pattern[1:], words[skip:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(words) == 0 {
+				return false
+			}
+		default:
+			if len(words) == 0 || words[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, words = pattern[1:], words[1:]
+	}
+	return len(words) == 0
+}
+
+// headersMatch applies a headers exchange binding; as in RabbitMQ, binding
+// arguments starting with x- take no part in the match
+func headersMatch(args, headers amqp.Table) bool {
+	matchAny := args["x-match"] == "any"
+	for k, v := range args {
+		if strings.HasPrefix(k, "x-") {
+			continue
+		}
+		got, ok := headers[k]
+		matched := ok && reflect.DeepEqual(got, v)
+		if matchAny && matched {
+			return true
+		}
+		if !matchAny && !matched {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+// withDeath copies headers with the x-death entry for queue and reason added,
+// or its count raised and moved to the front as RabbitMQ does
+func withDeath(headers amqp.Table, queue, reason, exchange, routingKey string) amqp.Table {
+	copied := amqp.Table{}
+	for k, v := range headers {
+		copied[k] = v
+	}
+
+	deaths, _ := copied["x-death"].([]interface{})
+	entry := amqp.Table{
+		"queue":        queue,
+		"reason":       reason,
+		"exchange":     exchange,
+		"routing-keys": []interface{}{routingKey},
+		"count":        int64(1),
+		"time":         time.Now().UTC().Truncate(time.Second),
+	}
+	rest := make([]interface{}, 0, len(deaths))
+	for _, d := range deaths {
+		existing, ok := d.(amqp.Table)
+		if ok && existing["queue"] == queue && existing["reason"] == reason {
+			count, _ := existing["count"].(int64)
+			entry["count"] = count + 1
+			continue
+		}
+		rest = append(rest, d)
+	}
+	copied["x-death"] = append([]interface{}{entry}, rest...)
+
+	if _, ok := copied["x-first-death-queue"]; !ok {
+		copied["x-first-death-queue"] = queue
+		copied["x-first-death-reason"] = reason
+		copied["x-first-death-exchange"] = exchange
+	}
+	return copied
+}
+
+func tableInt(table amqp.Table, key string) (int64, bool) {
+	switch v := table[key].(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
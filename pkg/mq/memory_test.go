@@ -0,0 +1,247 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// declareRideTopology declares the ride-hail topology on b
+func declareRideTopology(t *testing.T, b *MemoryBroker) {
+	t.Helper()
+	if err := DefaultTopology().Apply(b); err != nil {
+		t.Fatalf("Failed to declare topology: %v", err)
+	}
+}
+
+func receive(t *testing.T, deliveries <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a delivery")
+		return amqp.Delivery{}
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"ride.request.*", "ride.request.XL", true},
+		{"ride.request.*", "ride.request", false},
+		{"ride.request.*", "ride.request.XL.extra", false},
+		{"ride.*.XL", "ride.request.XL", true},
+		{"#", "driver.status.abc", true},
+		{"#", "", true},
+		{"ride.#", "ride", true},
+		{"ride.#", "ride.status.MATCHED", true},
+		{"ride.#.MATCHED", "ride.status.MATCHED", true},
+		{"ride.#.MATCHED", "ride.status.CANCELLED", false},
+		{"driver.response.*", "ride.request.XL", false},
+	}
+
+	for _, tt := range tests {
+		if got := topicMatches(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryBroker_Routing(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+	ctx := context.Background()
+
+	if err := b.Send(ctx, "ride_topic", "ride.request.ECONOMY", amqp.Publishing{Body: []byte("request")}); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if b.QueueLen("ride_requests") != 1 || b.QueueLen("driver_matching") != 1 || b.QueueLen("ride_status") != 0 {
+		t.Errorf("Expected the request in ride_requests and driver_matching only")
+	}
+
+	if err := b.Send(ctx, "location_fanout", "ignored", amqp.Publishing{Body: []byte("location")}); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if b.QueueLen("location_updates_ride") != 1 || b.QueueLen("location_updates_admin") != 1 {
+		t.Errorf("Expected the location update in both fanout queues")
+	}
+
+	err := b.Send(ctx, "driver_topic", "driver.location.abc", amqp.Publishing{})
+	if !errors.Is(err, ErrUnroutable) {
+		t.Errorf("Expected ErrUnroutable for a key nothing is bound to, got %v", err)
+	}
+	var amqpErr *amqp.Error
+	if err := b.Send(ctx, "missing", "key", amqp.Publishing{}); !errors.As(err, &amqpErr) || amqpErr.Code != amqp.NotFound {
+		t.Errorf("Expected NOT_FOUND for an undeclared exchange, got %v", err)
+	}
+}
+
+func TestMessagePublisher_PublishWithMessageID(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+	ctx := context.Background()
+
+	publisher := NewPublisher(b)
+	for range 2 {
+		if err := publisher.PublishWithMessageID(ctx, "ride_topic", "ride.status.MATCHED", "ride-1", "outbox-7", map[string]string{}); err != nil {
+			t.Fatalf("Unexpected publish error: %v", err)
+		}
+	}
+
+	deliveries, err := b.Consume("ride_status", "test", true)
+	if err != nil {
+		t.Fatalf("Unexpected consume error: %v", err)
+	}
+	for range 2 {
+		if d := receive(t, deliveries); d.MessageId != "outbox-7" || d.CorrelationId != "ride-1" {
+			t.Errorf("Expected message outbox-7 of ride-1, got %s of %s", d.MessageId, d.CorrelationId)
+		}
+	}
+}
+
+func TestMemoryBroker_NackDeadLetters(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+
+	deliveries, err := b.Consume("ride_status", "test", false)
+	if err != nil {
+		t.Fatalf("Unexpected consume error: %v", err)
+	}
+	if err := b.Send(context.Background(), "ride_topic", "ride.status.MATCHED", amqp.Publishing{MessageId: "m1"}); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+
+	first := receive(t, deliveries)
+	if err := first.Nack(false, true); err != nil {
+		t.Fatalf("Unexpected nack error: %v", err)
+	}
+	again := receive(t, deliveries)
+	if !again.Redelivered || again.MessageId != "m1" {
+		t.Errorf("Expected m1 to be redelivered, got %+v", again)
+	}
+	if err := again.Nack(false, false); err != nil {
+		t.Fatalf("Unexpected nack error: %v", err)
+	}
+
+	letters, err := b.Consume(DeadLetterQueueName, "dlq", true)
+	if err != nil {
+		t.Fatalf("Unexpected consume error: %v", err)
+	}
+	letter := parseDeadLetter(receive(t, letters))
+	if letter.Queue != "ride_status" || letter.Reason != "rejected" || letter.Exchange != "ride_topic" || letter.RoutingKey != "ride.status.MATCHED" {
+		t.Errorf("Unexpected dead letter %+v", letter)
+	}
+	if err := again.Ack(false); err == nil {
+		t.Error("Expected acking a settled delivery to fail")
+	}
+}
+
+func TestMemoryBroker_RetryReturnsToFailedQueueOnly(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+
+	// ride_requests has no retry queues in the default topology
+	policy := RetryPolicy{MaxRetries: 2, InitialDelay: 10 * time.Millisecond}
+	if err := DeclareRetryQueues(b, "ride_requests", policy); err != nil {
+		t.Fatalf("Failed to declare retry queues: %v", err)
+	}
+
+	var attempts atomic.Int32
+	consumer := NewConsumer(b, ConsumerConfig{
+		Queue: "ride_requests",
+		Retry: policy,
+		Handler: func(ctx context.Context, message Message) error {
+			if attempts.Add(1) < 3 {
+				return errors.New("no drivers loaded yet")
+			}
+			return nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+
+	if err := b.Send(ctx, "ride_topic", "ride.request.XL", amqp.Publishing{Body: []byte("{}")}); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+
+	waitFor(t, "the third attempt", func() bool { return attempts.Load() == 3 })
+	if b.QueueLen("driver_matching") != 1 {
+		t.Errorf("Expected driver_matching to get the request once, got %d", b.QueueLen("driver_matching"))
+	}
+	if b.QueueLen(DeadLetterQueueName) != 0 {
+		t.Errorf("Expected nothing dead-lettered")
+	}
+}
+
+func TestMemoryBroker_RideMatchFlow(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	declareRideTopology(t, b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rides := NewRideEventPublisher(b, "ride-service")
+	drivers := NewDriverEventPublisher(b, "driver-location-service")
+
+	// the driver service accepts every request it sees
+	matcher := NewConsumer(b, ConsumerConfig{
+		Queue: "driver_matching",
+		Handler: func(ctx context.Context, message Message) error {
+			request, err := DecodeAs[RideRequestMessage](message)
+			if err != nil {
+				return err
+			}
+			return drivers.PublishDriverResponseWithCorrelation(ctx, request.RideID, message.CorrelationID, DriverResponseMessage{
+				RideID:   request.RideID,
+				DriverID: "driver-1",
+				Accepted: true,
+			})
+		},
+	})
+	responses := make(chan DriverResponseMessage, 1)
+	matched := NewConsumer(b, ConsumerConfig{
+		Queue: "driver_responses",
+		Handler: func(ctx context.Context, message Message) error {
+			response, err := DecodeAs[DriverResponseMessage](message)
+			if err != nil {
+				return err
+			}
+			responses <- response
+			return nil
+		},
+	})
+	for _, c := range []*MessageConsumer{matcher, matched} {
+		if err := c.Start(ctx); err != nil {
+			t.Fatalf("Unexpected start error: %v", err)
+		}
+	}
+
+	err := rides.PublishRideRequest(ctx, "ECONOMY", RideRequestMessage{RideID: "ride-1", VehicleType: "ECONOMY"})
+	if err != nil {
+		t.Fatalf("Unexpected publish error: %v", err)
+	}
+
+	select {
+	case response := <-responses:
+		if response.RideID != "ride-1" || !response.Accepted {
+			t.Errorf("Unexpected driver response %+v", response)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the driver response")
+	}
+}
@@ -0,0 +1,121 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueueMetrics counts the handler outcomes of one queue
+type QueueMetrics struct {
+	Queue         string
+	Handled       int64
+	Failed        int64 // includes panics and timeouts
+	Panics        int64
+	Timeouts      int64
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// AverageDuration is the mean handler duration
+func (m QueueMetrics) AverageDuration() time.Duration {
+	total := m.Handled + m.Failed
+	if total == 0 {
+		return 0
+	}
+	return m.TotalDuration / time.Duration(total)
+}
+
+// Metrics collects QueueMetrics for every queue whose handler it records
+type Metrics struct {
+	mu     sync.Mutex
+	queues map[string]*QueueMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{queues: make(map[string]*QueueMetrics)}
+}
+
+// Record is the middleware counting each message's outcome and duration
+func (m *Metrics) Record(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, message Message) error {
+		start := time.Now()
+		err := next(ctx, message)
+		m.observe(message.Queue, time.Since(start), err)
+		return err
+	}
+}
+
+func (m *Metrics) observe(queue string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.queues[queue]
+	if !ok {
+		q = &QueueMetrics{Queue: queue}
+		m.queues[queue] = q
+	}
+	switch {
+	case err == nil:
+		q.Handled++
+	case errors.Is(err, ErrHandlerPanic):
+		q.Failed++
+		q.Panics++
+	case errors.Is(err, ErrHandlerTimeout):
+		q.Failed++
+		q.Timeouts++
+	default:
+		q.Failed++
+	}
+	q.TotalDuration += duration
+	q.MaxDuration = max(q.MaxDuration, duration)
+}
+
+// Snapshot returns the metrics of every queue, sorted by queue
+func (m *Metrics) Snapshot() []QueueMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make([]QueueMetrics, 0, len(m.queues))
+	for _, q := range m.queues {
+		snapshot = append(snapshot, *q)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Queue < snapshot[j].Queue })
+	return snapshot
+}
+
+// Report logs the metrics of queues that saw messages every interval until
+// ctx is done
+func (m *Metrics) Report(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reported := make(map[string]int64)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, q := range m.Snapshot() {
+			total := q.Handled + q.Failed
+			if total == reported[q.Queue] {
+				continue
+			}
+			reported[q.Queue] = total
+			slog.Info("Consumer metrics",
+				"queue", q.Queue,
+				"handled", q.Handled,
+				"failed", q.Failed,
+				"panics", q.Panics,
+				"timeouts", q.Timeouts,
+				"avg_duration_ms", q.AverageDuration().Milliseconds(),
+				"max_duration_ms", q.MaxDuration.Milliseconds(),
+			)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"ride-hail/pkg/logger"
+)
+
+var (
+	ErrHandlerPanic   = errors.New("message handler panicked")
+	ErrHandlerTimeout = errors.New("message handler timed out")
+)
+
+// Middleware wraps a MessageHandler, the way internal/middleware wraps HTTP handlers
+type Middleware func(next MessageHandler) MessageHandler
+
+// Chain composes middlewares; the first one runs outermost
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// StandardMiddleware is the stack every consumer runs with: correlation IDs in
+// the logs, metrics, panic recovery, a per-message timeout and event validation
+func StandardMiddleware(metrics *Metrics, timeout time.Duration) Middleware {
+	return Chain(CorrelationID, metrics.Record, Recovery, Timeout(timeout), ValidateEvents)
+}
+
+// CorrelationID makes the message's correlation ID the request ID of every log
+// written with the handler's context
+func CorrelationID(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, message Message) error {
+		id := message.CorrelationID
+		if id == "" {
+			id = message.MessageID
+		}
+		ctx = logger.WithRequestID(ctx, id)
+		ctx = logger.WithAction(ctx, "consume "+message.Queue)
+		return next(ctx, message)
+	}
+}
+
+// Recovery turns a handler panic into a permanent error, so the message is
+// dead-lettered with the panic as its last error and the worker keeps running
+func Recovery(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, message Message) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(ctx, "Message handler panicked",
+					"queue", message.Queue,
+					"message_id", message.MessageID,
+					"panic", r,
+					"stack", string(debug.Stack()),
+				)
+				err = Permanent(fmt.Errorf("%w: %v", ErrHandlerPanic, r))
+			}
+		}()
+		return next(ctx, message)
+	}
+}
+
+// Timeout cancels the handler's context after d. Handlers must watch the
+// context; a timed out message is retried like any other failure
+func Timeout(d time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, message Message) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			err := next(ctx, message)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %w", ErrHandlerTimeout, d, err)
+			}
+			return err
+		}
+	}
+}
+
+// ValidateEvents decodes the message and validates events that implement
+// Validator. Invalid messages fail permanently; valid ones reach next with
+// message.Event set, so the handler does not decode them again
+func ValidateEvents(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, message Message) error {
+		event, err := DecodeEvent(message)
+		if err != nil {
+			return err
+		}
+		if v, ok := event.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				problems := strings.ReplaceAll(err.Error(), "\n", "; ")
+				return Permanent(fmt.Errorf("%w: %s v%d: %s", ErrInvalidEvent, event.EventType(), event.EventVersion(), problems))
+			}
+		}
+		message.Event = event
+		return next(ctx, message)
+	}
+}
@@ -0,0 +1,187 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"ride-hail/pkg/logger"
+)
+
+func eventMessage(t *testing.T, queue string, event Event) Message {
+	t.Helper()
+	envelope, err := events.Wrap(event, "test", "corr-1")
+	if err != nil {
+		t.Fatalf("Unexpected wrap error: %v", err)
+	}
+	return Message{Queue: queue, CorrelationID: "corr-1", MessageID: "m1", Body: envelopeBody(t, envelope)}
+}
+
+func TestChain_RunsFirstMiddlewareOutermost(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, message Message) error {
+				calls = append(calls, name)
+				return next(ctx, message)
+			}
+		}
+	}
+
+	handler := Chain(trace("a"), trace("b"), trace("c"))(func(ctx context.Context, message Message) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	if err := handler(context.Background(), Message{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(calls, ",") != "a,b,c,handler" {
+		t.Errorf("Unexpected call order %v", calls)
+	}
+}
+
+func TestRecovery_TurnsPanicIntoPermanentError(t *testing.T) {
+	handler := Recovery(func(ctx context.Context, message Message) error {
+		var driver *DriverInfo
+		_ = driver.Name // nil dereference
+		return nil
+	})
+
+	err := handler(context.Background(), Message{Queue: DriverResponsesQueue})
+	if !errors.Is(err, ErrHandlerPanic) || !errors.Is(err, ErrPermanent) {
+		t.Errorf("Expected a permanent ErrHandlerPanic, got %v", err)
+	}
+}
+
+func TestTimeout_CancelsSlowHandlers(t *testing.T) {
+	handler := Timeout(10 * time.Millisecond)(func(ctx context.Context, message Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := handler(context.Background(), Message{})
+	if !errors.Is(err, ErrHandlerTimeout) {
+		t.Errorf("Expected ErrHandlerTimeout, got %v", err)
+	}
+	if errors.Is(err, ErrPermanent) {
+		t.Error("Expected a timed out message to be retried")
+	}
+}
+
+func TestValidateEvents(t *testing.T) {
+	var handled Message
+	handler := ValidateEvents(func(ctx context.Context, message Message) error {
+		handled = message
+		return nil
+	})
+
+	valid := RideRequestMessage{
+		RideID:              "ride-1",
+		VehicleType:         "ECONOMY",
+		PickupLocation:      LocationCoordinates{Latitude: 43.238949, Longitude: 76.889709},
+		DestinationLocation: LocationCoordinates{Latitude: 43.222015, Longitude: 76.851511},
+	}
+	if err := handler(context.Background(), eventMessage(t, DriverMatchingQueue, valid)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if request, ok := handled.Event.(RideRequestMessage); !ok || request.RideID != "ride-1" {
+		t.Errorf("Expected the decoded event on the message, got %#v", handled.Event)
+	}
+
+	invalid := valid
+	invalid.RideID = ""
+	invalid.PickupLocation.Latitude = 143
+	err := handler(context.Background(), eventMessage(t, DriverMatchingQueue, invalid))
+	if !errors.Is(err, ErrInvalidEvent) || !errors.Is(err, ErrPermanent) {
+		t.Fatalf("Expected a permanent ErrInvalidEvent, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ride_id is required; pickup_location") {
+		t.Errorf("Expected every problem in the error, got %q", err)
+	}
+
+	err = handler(context.Background(), Message{Body: []byte(`{"ride_id":"ride-1"}`)})
+	if !errors.Is(err, ErrInvalidEnvelope) {
+		t.Errorf("Expected ErrInvalidEnvelope for a bare payload, got %v", err)
+	}
+}
+
+func TestCorrelationID_TagsHandlerLogs(t *testing.T) {
+	var out bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logger.NewHandlerMiddleware(slog.NewJSONHandler(&out, nil))))
+	defer slog.SetDefault(previous)
+
+	handler := CorrelationID(func(ctx context.Context, message Message) error {
+		slog.InfoContext(ctx, "Handling message")
+		return nil
+	})
+	if err := handler(context.Background(), Message{Queue: RideStatusQueue, CorrelationID: "ride-42"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to decode log record %q: %v", out.String(), err)
+	}
+	if record["request_id"] != "ride-42" || record["action"] != "consume ride_status" {
+		t.Errorf("Expected the correlation ID and queue in the log, got %v", record)
+	}
+}
+
+func TestMetrics_Record(t *testing.T) {
+	metrics := NewMetrics()
+	outcomes := []error{nil, nil, errors.New("database unavailable"), Permanent(ErrHandlerPanic), ErrHandlerTimeout}
+	for _, outcome := range outcomes {
+		handler := metrics.Record(func(ctx context.Context, message Message) error { return outcome })
+		handler(context.Background(), Message{Queue: RideStatusQueue})
+	}
+	metrics.Record(func(ctx context.Context, message Message) error { return nil })(context.Background(), Message{Queue: DriverResponsesQueue})
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Queue != DriverResponsesQueue {
+		t.Fatalf("Expected metrics for two queues sorted by name, got %+v", snapshot)
+	}
+	status := snapshot[1]
+	if status.Handled != 2 || status.Failed != 3 || status.Panics != 1 || status.Timeouts != 1 {
+		t.Errorf("Unexpected ride_status metrics %+v", status)
+	}
+}
+
+func TestMessageConsumer_StandardMiddlewareSurvivesPanics(t *testing.T) {
+	broker := newFakeBroker()
+	handled := &recorder{}
+	consumer := newConsumer(broker, ConsumerConfig{
+		Queue:   RideStatusQueue,
+		Workers: 1,
+		Handler: StandardMiddleware(NewMetrics(), time.Second)(func(ctx context.Context, message Message) error {
+			if _, ok := message.Event.(RideCancelledMessage); ok {
+				panic("unhandled event")
+			}
+			return handled.handle(ctx, message)
+		}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := consumer.Start(ctx); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+
+	broker.deliver(string(eventMessage(t, RideStatusQueue, RideCancelledMessage{RideID: "ride-1"}).Body))
+	broker.deliver(string(eventMessage(t, RideStatusQueue, RideStatusMessage{RideID: "ride-1", NewStatus: "EN_ROUTE"}).Body))
+	waitFor(t, "the message after the panic", func() bool { return handled.count() == 1 })
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.sent) != 1 || broker.sent[0].exchange != DeadLetterExchange {
+		t.Fatalf("Expected the panicking message dead-lettered, got %+v", broker.sent)
+	}
+	if lastError := broker.sent[0].publishing.Headers[headerLastError]; !strings.Contains(lastError.(string), "unhandled event") {
+		t.Errorf("Expected the panic as the last error, got %v", lastError)
+	}
+}
@@ -11,13 +11,15 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 
 	"ride-hail/pkg/utils"
+	"ride-hail/pkg/uuid"
 )
 
 type Config struct {
-	Port     string
-	Host     string
-	UserName string
-	Password string
+	Port           string
+	Host           string
+	UserName       string
+	Password       string
+	ManagementPort string // port of the management plugin's HTTP API
 }
 
 func LoadMqConfig() (Config, error) {
@@ -26,6 +28,8 @@ func LoadMqConfig() (Config, error) {
 		Host:     utils.GetEnv("RABBITMQ_HOST", "localhost"),
 		UserName: utils.GetEnv("RABBITMQ_USER", "guest"),
 		Password: utils.GetEnv("RABBITMQ_PASSWORD", "guest"),
+
+		ManagementPort: utils.GetEnv("RABBITMQ_MANAGEMENT_PORT", "15672"),
 	}, nil
 }
 
@@ -34,19 +38,29 @@ func (c Config) Url() string {
 }
 
 type Client struct {
+	// stateMutex guards conn, ch and pub, which reconnect replaces
+	stateMutex      sync.RWMutex
 	conn            *amqp.Connection
 	ch              *amqp.Channel
+	pub             *confirmChannel
 	connectionReady chan struct{}
-	closeChan       chan *amqp.Error
 	config          Config
 	closeMutex      sync.RWMutex
 	reconnectMutex  sync.Mutex
 	isReconnecting  bool
 	closed          bool
+
+	listenersMutex     sync.Mutex
+	reconnectListeners []chan struct{}
+	listenersClosed    bool
 }
 
 func Connect(config Config) (*amqp.Connection, error) {
-	return amqp.Dial(config.Url())
+	return amqp.DialConfig(config.Url(), amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+		Dial:      amqp.DefaultDial(5 * time.Second),
+	})
 }
 
 func NewClient(conn *amqp.Connection) (*Client, error) {
@@ -54,16 +68,20 @@ func NewClient(conn *amqp.Connection) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	pub, err := newConfirmChannel(conn)
+	if err != nil {
+		return nil, err
+	}
 	client := &Client{
 		conn:            conn,
 		ch:              ch,
+		pub:             pub,
 		connectionReady: make(chan struct{}, 1),
-		closeChan:       make(chan *amqp.Error, 1),
 	}
 	// Signal that connection is ready
 	client.connectionReady <- struct{}{}
 	// Start monitoring connection
-	go client.monitorConnection()
+	client.monitor(conn, ch, pub)
 	return client, nil
 }
 
@@ -77,39 +95,111 @@ func NewClientWithReconnect(config Config) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	pub, err := newConfirmChannel(conn)
+	if err != nil {
+		return nil, err
+	}
 	client := &Client{
 		conn:            conn,
 		ch:              ch,
+		pub:             pub,
 		config:          config,
 		connectionReady: make(chan struct{}, 1),
-		closeChan:       make(chan *amqp.Error, 1),
 	}
 	// Signal that connection is ready
 	client.connectionReady <- struct{}{}
 	// Start monitoring connection
-	go client.monitorConnection()
+	client.monitor(conn, ch, pub)
 	return client, nil
 }
 
-// monitorConnection watches for connection failures and triggers reconnection
-func (c *Client) monitorConnection() {
-	c.closeChan = c.conn.NotifyClose(make(chan *amqp.Error, 1))
+// monitor watches a connection and its channels. Each connection gets its own
+// monitor; reconnect starts the next. The close notifications are registered
+// here so a close that happens before the goroutines run is not missed
+func (c *Client) monitor(conn *amqp.Connection, ch *amqp.Channel, pub *confirmChannel) {
+	go c.monitorConnection(conn.NotifyClose(make(chan *amqp.Error, 1)))
+	go c.monitorChannel(conn, ch.NotifyClose(make(chan *amqp.Error, 1)), c.reopenChannel)
+	go c.monitorChannel(conn, pub.ch.NotifyClose(make(chan *amqp.Error, 1)), c.reopenPublishChannel)
+}
+
+// monitorConnection triggers reconnection when the connection fails
+func (c *Client) monitorConnection(closed <-chan *amqp.Error) {
+	err, ok := <-closed
+	if !ok || c.isClosed() {
+		return
+	}
+	slog.Warn("RabbitMQ connection lost", "error", err)
+	c.reconnect()
+}
+
+// monitorChannel reopens a channel the broker closed on a live connection,
+// e.g. after a failed declare or a publish to a missing exchange. A channel
+// that goes down with its connection is left to monitorConnection
+func (c *Client) monitorChannel(conn *amqp.Connection, closed <-chan *amqp.Error, reopen func(*amqp.Connection) error) {
+	err, ok := <-closed
+	if !ok || c.isClosed() || conn.IsClosed() {
+		return
+	}
+	slog.Warn("RabbitMQ channel closed by broker, reopening", "error", err)
+
+	delay := 1 * time.Second
 	for {
-		err, ok := <-c.closeChan
-		if !ok {
-			return
-		}
-		c.closeMutex.RLock()
-		if c.closed {
-			c.closeMutex.RUnlock()
+		err := reopen(conn)
+		if err == nil || c.isClosed() || conn.IsClosed() {
 			return
 		}
-		c.closeMutex.RUnlock()
-		slog.Warn("RabbitMQ connection lost", "error", err)
-		c.reconnect()
+		slog.Warn("Failed to reopen RabbitMQ channel, retrying", "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay = min(delay*2, 30*time.Second)
 	}
 }
 
+// reopenChannel replaces the consumer channel and tells consumers to
+// subscribe again, as after a reconnect
+func (c *Client) reopenChannel(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.stateMutex.Lock()
+	if c.conn != conn {
+		// reconnected in the meantime, with channels of its own
+		c.stateMutex.Unlock()
+		return ch.Close()
+	}
+	c.ch = ch
+	c.stateMutex.Unlock()
+
+	go c.monitorChannel(conn, closed, c.reopenChannel)
+	slog.Info("Reopened RabbitMQ channel")
+	c.notifyReconnected()
+	return nil
+}
+
+// reopenPublishChannel replaces the publish channel; publishes that were
+// waiting on the old one already failed with ErrPublishChannelClosed
+func (c *Client) reopenPublishChannel(conn *amqp.Connection) error {
+	pub, err := newConfirmChannel(conn)
+	if err != nil {
+		return err
+	}
+	closed := pub.ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.stateMutex.Lock()
+	if c.conn != conn {
+		c.stateMutex.Unlock()
+		return pub.Close()
+	}
+	c.pub = pub
+	c.stateMutex.Unlock()
+
+	go c.monitorChannel(conn, closed, c.reopenPublishChannel)
+	slog.Info("Reopened RabbitMQ publish channel")
+	return nil
+}
+
 // reconnect attempts to reconnect with exponential backoff
 func (c *Client) reconnect() {
 	c.reconnectMutex.Lock()
@@ -150,9 +240,20 @@ func (c *Client) reconnect() {
 			time.Sleep(delay)
 			continue
 		}
+		pub, err := newConfirmChannel(conn)
+		if err != nil {
+			conn.Close()
+			delay := time.Duration(math.Min(float64(baseDelay)*math.Pow(2, float64(attempt-1)), float64(maxDelay)))
+			slog.Warn("Failed to create publish channel, retrying", "attempt", attempt, "delay", delay, "error", err)
+			time.Sleep(delay)
+			continue
+		}
 		// Update client state
+		c.stateMutex.Lock()
 		c.conn = conn
 		c.ch = ch
+		c.pub = pub
+		c.stateMutex.Unlock()
 		// Signal reconnection success
 		select {
 		case c.connectionReady <- struct{}{}:
@@ -160,10 +261,53 @@ func (c *Client) reconnect() {
 		}
 		slog.Info("Successfully reconnected to RabbitMQ")
 		// Restart connection monitoring
-		go c.monitorConnection()
+		c.monitor(conn, ch, pub)
+		c.notifyReconnected()
 		return
 	}
 	slog.Error("Failed to reconnect to RabbitMQ after maximum retries")
+	c.closeReconnectListeners()
+}
+
+// NotifyReconnect returns a channel that receives after every successful
+// reconnect or reopen of the consumer channel, so consumers can subscribe
+// again on the new channel. It is closed once the client gives up
+// reconnecting or is closed
+func (c *Client) NotifyReconnect() <-chan struct{} {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+
+	listener := make(chan struct{}, 1)
+	if c.listenersClosed {
+		close(listener)
+		return listener
+	}
+	c.reconnectListeners = append(c.reconnectListeners, listener)
+	return listener
+}
+
+func (c *Client) notifyReconnected() {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+	for _, listener := range c.reconnectListeners {
+		select {
+		case listener <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Client) closeReconnectListeners() {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+	if c.listenersClosed {
+		return
+	}
+	c.listenersClosed = true
+	for _, listener := range c.reconnectListeners {
+		close(listener)
+	}
+	c.reconnectListeners = nil
 }
 
 // waitForConnection waits until connection is ready
@@ -181,39 +325,94 @@ func (c *Client) Close() error {
 	c.closeMutex.Lock()
 	c.closed = true
 	c.closeMutex.Unlock()
-	if err := c.ch.Close(); err != nil {
+	c.closeReconnectListeners()
+	conn, ch, pub := c.state()
+	if err := pub.Close(); err != nil {
+		return err
+	}
+	if err := ch.Close(); err != nil {
 		return err
 	}
-	return c.conn.Close()
+	return conn.Close()
+}
+
+func (c *Client) isClosed() bool {
+	c.closeMutex.RLock()
+	defer c.closeMutex.RUnlock()
+	return c.closed
+}
+
+// state returns the current connection and channels, which reconnect may
+// replace at any time
+func (c *Client) state() (*amqp.Connection, *amqp.Channel, *confirmChannel) {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.conn, c.ch, c.pub
+}
+
+// channelNow is the current consumer and topology channel
+func (c *Client) channelNow() *amqp.Channel {
+	_, ch, _ := c.state()
+	return ch
 }
 
 func (c *Client) CreateQueue(name string, durable, autoDelete bool) error {
-	_, err := c.ch.QueueDeclare(name, durable, autoDelete, false, false, nil)
+	_, err := c.channelNow().QueueDeclare(name, durable, autoDelete, false, false, nil)
 	return err
 }
 
 func (c *Client) CreateQueueWithArgs(name string, durable, autoDelete bool, args amqp.Table) error {
-	_, err := c.ch.QueueDeclare(name, durable, autoDelete, false, false, args)
+	_, err := c.channelNow().QueueDeclare(name, durable, autoDelete, false, false, args)
 	return err
 }
 
 func (c *Client) CreateBinding(name, binding, exchange string) error {
-	return c.ch.QueueBind(name, binding, exchange, false, nil)
+	return c.channelNow().QueueBind(name, binding, exchange, false, nil)
+}
+
+func (c *Client) CreateBindingWithArgs(name, binding, exchange string, args amqp.Table) error {
+	return c.channelNow().QueueBind(name, binding, exchange, false, args)
 }
 
+// Send publishes a mandatory message and waits for the broker to confirm it.
+// An unroutable message fails with a *ReturnedError, a refused one with
+// ErrPublishNacked, and a missing confirm with ErrConfirmTimeout
 func (c *Client) Send(ctx context.Context, exchange, routingKey string, optinions amqp.Publishing) error {
 	if err := c.waitForConnection(ctx); err != nil {
 		return fmt.Errorf("connection not ready: %w", err)
 	}
-	return c.ch.PublishWithContext(ctx, exchange, routingKey, true, false, optinions)
+	if optinions.MessageId == "" {
+		// returns are matched to their publish by message id
+		optinions.MessageId = uuid.New().String()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+
+	_, _, pub := c.state()
+	result, err := pub.publish(ctx, exchange, routingKey, optinions)
+	if err != nil {
+		return err
+	}
+	return awaitConfirm(ctx, result, routingKey)
+}
+
+// channel opens a channel of its own for work that must not share the
+// consumer channel's delivery tags, such as browsing a queue with basic.get
+func (c *Client) channel(ctx context.Context) (*amqp.Channel, error) {
+	if err := c.waitForConnection(ctx); err != nil {
+		return nil, fmt.Errorf("connection not ready: %w", err)
+	}
+	conn, _, _ := c.state()
+	return conn.Channel()
 }
 
 func (c *Client) Consume(queue, consumer string, autoAck bool) (<-chan amqp.Delivery, error) {
-	return c.ch.Consume(queue, consumer, autoAck, false, false, false, nil)
+	return c.channelNow().Consume(queue, consumer, autoAck, false, false, false, nil)
 }
 
 func (c *Client) CreateExchange(name, kind string, durable, autoDelete bool) error {
-	return c.ch.ExchangeDeclare(
+	return c.channelNow().ExchangeDeclare(
 		name,
 		kind,
 		durable,
@@ -225,27 +424,28 @@ func (c *Client) CreateExchange(name, kind string, durable, autoDelete bool) err
 }
 
 func (c *Client) SetQos(prefetchCount int) error {
-	return c.ch.Qos(prefetchCount, 0, false)
+	return c.channelNow().Qos(prefetchCount, 0, false)
 }
 
 // Ack acknowledges a message
 func (c *Client) Ack(tag uint64, multiple bool) error {
-	return c.ch.Ack(tag, multiple)
+	return c.channelNow().Ack(tag, multiple)
 }
 
 // Nack negatively acknowledges a message
 func (c *Client) Nack(tag uint64, multiple, requeue bool) error {
-	return c.ch.Nack(tag, multiple, requeue)
+	return c.channelNow().Nack(tag, multiple, requeue)
 }
 
 // Reject rejects a message
 func (c *Client) Reject(tag uint64, requeue bool) error {
-	return c.ch.Reject(tag, requeue)
+	return c.channelNow().Reject(tag, requeue)
 }
 
 // IsConnected returns whether the client is connected
 func (c *Client) IsConnected() bool {
 	c.closeMutex.RLock()
 	defer c.closeMutex.RUnlock()
-	return !c.closed && c.conn != nil && !c.conn.IsClosed()
+	conn, _, _ := c.state()
+	return !c.closed && conn != nil && !conn.IsClosed()
 }
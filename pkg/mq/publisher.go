@@ -17,11 +17,17 @@ type Publisher interface {
 	PublishWithCorrelationID(ctx context.Context, exchange, routingKey, correlationID string, message interface{}) error
 }
 
+// MessageIDPublisher publishes under a message ID the caller chooses, so a
+// message sent again keeps the ID consumers deduplicate it by
+type MessageIDPublisher interface {
+	PublishWithMessageID(ctx context.Context, exchange, routingKey, correlationID, messageID string, message interface{}) error
+}
+
 type MessagePublisher struct {
-	client *Client
+	client Broker
 }
 
-func NewPublisher(client *Client) *MessagePublisher {
+func NewPublisher(client Broker) *MessagePublisher {
 	return &MessagePublisher{
 		client: client,
 	}
@@ -33,8 +39,15 @@ func (p *MessagePublisher) Publish(ctx context.Context, exchange, routingKey str
 	return p.PublishWithCorrelationID(ctx, exchange, routingKey, correlationID, message)
 }
 
-// publishes a message with a specific correlation ID
+// publishes a message with a specific correlation ID and returns once the
+// broker confirmed it; see Client.Send for the errors
 func (p *MessagePublisher) PublishWithCorrelationID(ctx context.Context, exchange, routingKey, correlationID string, message interface{}) error {
+	return p.PublishWithMessageID(ctx, exchange, routingKey, correlationID, uuid.New().String(), message)
+}
+
+// PublishWithMessageID is PublishWithCorrelationID with messageID as the
+// message ID, e.g. one derived from the row the message is stored in
+func (p *MessagePublisher) PublishWithMessageID(ctx context.Context, exchange, routingKey, correlationID, messageID string, message interface{}) error {
 	body, err := json.Marshal(message)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
@@ -43,7 +56,7 @@ func (p *MessagePublisher) PublishWithCorrelationID(ctx context.Context, exchang
 	publishing := amqp.Publishing{
 		ContentType:   "application/json",
 		CorrelationId: correlationID,
-		MessageId:     uuid.New().String(),
+		MessageId:     messageID,
 		Timestamp:     time.Now(),
 		DeliveryMode:  amqp.Persistent, // Persist messages to disk
 		Body:          body,
@@ -69,32 +82,57 @@ func (p *MessagePublisher) PublishWithCorrelationID(ctx context.Context, exchang
 	return nil
 }
 
+// eventPublisher wraps events in envelopes before handing them to publisher
+type eventPublisher struct {
+	publisher Publisher
+	registry  *Registry
+	producer  string
+}
+
+func (p eventPublisher) publish(ctx context.Context, exchange, routingKey, correlationID string, event Event) error {
+	if correlationID == "" {
+		correlationID = uuid.New().String()
+	}
+	envelope, err := p.registry.Wrap(event, p.producer, correlationID)
+	if err != nil {
+		return err
+	}
+	return p.publisher.PublishWithCorrelationID(ctx, exchange, routingKey, correlationID, envelope)
+}
+
 // publishes ride-related events
 type RideEventPublisher struct {
-	publisher *MessagePublisher
-	exchange  string
+	events   eventPublisher
+	exchange string
+}
+
+func NewRideEventPublisher(client Broker, producer string) *RideEventPublisher {
+	return NewRideEventPublisherFor(NewPublisher(client), producer)
 }
 
-func NewRideEventPublisher(client *Client) *RideEventPublisher {
+// NewRideEventPublisherFor routes ride events through publisher, e.g. an outbox
+// writer that stores them until a relay sends them to the broker
+func NewRideEventPublisherFor(publisher Publisher, producer string) *RideEventPublisher {
 	return &RideEventPublisher{
-		publisher: NewPublisher(client),
-		exchange:  "ride_topic",
+		events:   eventPublisher{publisher: publisher, registry: events, producer: producer},
+		exchange: RideTopicExchange,
 	}
 }
 
-func (p *RideEventPublisher) PublishRideRequest(ctx context.Context, rideType string, message interface{}) error {
+func (p *RideEventPublisher) PublishRideRequest(ctx context.Context, rideType string, message RideRequestMessage) error {
 	routingKey := fmt.Sprintf("ride.request.%s", rideType)
-	return p.publisher.Publish(ctx, p.exchange, routingKey, message)
+	return p.events.publish(ctx, p.exchange, routingKey, message.CorrelationID, message)
 }
 
-func (p *RideEventPublisher) PublishRideStatus(ctx context.Context, status string, message interface{}) error {
-	routingKey := fmt.Sprintf("ride.status.%s", status)
-	return p.publisher.Publish(ctx, p.exchange, routingKey, message)
+// PublishRideStatus publishes event, e.g. a RideStatusMessage or
+// RideCancelledMessage, as ride.status.{status}
+func (p *RideEventPublisher) PublishRideStatus(ctx context.Context, status string, event Event) error {
+	return p.PublishRideStatusWithCorrelation(ctx, status, "", event)
 }
 
-func (p *RideEventPublisher) PublishRideStatusWithCorrelation(ctx context.Context, status, correlationID string, message interface{}) error {
+func (p *RideEventPublisher) PublishRideStatusWithCorrelation(ctx context.Context, status, correlationID string, event Event) error {
 	routingKey := fmt.Sprintf("ride.status.%s", status)
-	return p.publisher.PublishWithCorrelationID(ctx, p.exchange, routingKey, correlationID, message)
+	return p.events.publish(ctx, p.exchange, routingKey, correlationID, event)
 }
 
 // PublishRideStatusUpdate publishes a ride status update with ride and driver information
@@ -122,50 +160,95 @@ func (p *RideEventPublisher) PublishRideStatusUpdateWithCorrelation(ctx context.
 
 // publishes driver-related events
 type DriverEventPublisher struct {
-	publisher *MessagePublisher
-	exchange  string
+	events   eventPublisher
+	exchange string
 }
 
-func NewDriverEventPublisher(client *Client) *DriverEventPublisher {
+func NewDriverEventPublisher(client Broker, producer string) *DriverEventPublisher {
 	return &DriverEventPublisher{
-		publisher: NewPublisher(client),
-		exchange:  "driver_topic",
+		events:   eventPublisher{publisher: NewPublisher(client), registry: events, producer: producer},
+		exchange: DriverTopicExchange,
 	}
 }
 
-func (p *DriverEventPublisher) PublishDriverResponse(ctx context.Context, rideID string, message interface{}) error {
+func (p *DriverEventPublisher) PublishDriverResponse(ctx context.Context, rideID string, message DriverResponseMessage) error {
+	return p.PublishDriverResponseWithCorrelation(ctx, rideID, "", message)
+}
+
+func (p *DriverEventPublisher) PublishDriverResponseWithCorrelation(ctx context.Context, rideID, correlationID string, message DriverResponseMessage) error {
 	routingKey := fmt.Sprintf("driver.response.%s", rideID)
-	return p.publisher.Publish(ctx, p.exchange, routingKey, message)
+	return p.events.publish(ctx, p.exchange, routingKey, correlationID, message)
 }
 
-func (p *DriverEventPublisher) PublishDriverStatus(ctx context.Context, driverID string, message interface{}) error {
-	routingKey := fmt.Sprintf("driver.status.%s", driverID)
-	return p.publisher.Publish(ctx, p.exchange, routingKey, message)
+func (p *DriverEventPublisher) PublishDriverStatus(ctx context.Context, driverID string, message DriverStatusMessage) error {
+	return p.PublishDriverStatusWithCorrelation(ctx, driverID, "", message)
 }
 
-func (p *DriverEventPublisher) PublishDriverStatusWithCorrelation(ctx context.Context, driverID, correlationID string, message interface{}) error {
+func (p *DriverEventPublisher) PublishDriverStatusWithCorrelation(ctx context.Context, driverID, correlationID string, message DriverStatusMessage) error {
 	routingKey := fmt.Sprintf("driver.status.%s", driverID)
-	return p.publisher.PublishWithCorrelationID(ctx, p.exchange, routingKey, correlationID, message)
+	return p.events.publish(ctx, p.exchange, routingKey, correlationID, message)
 }
 
 // publishes location update events
 type LocationEventPublisher struct {
-	publisher *MessagePublisher
-	exchange  string
+	events   eventPublisher
+	exchange string
 }
 
-func NewLocationEventPublisher(client *Client) *LocationEventPublisher {
+func NewLocationEventPublisher(client Broker, producer string) *LocationEventPublisher {
 	return &LocationEventPublisher{
-		publisher: NewPublisher(client),
-		exchange:  "location_fanout",
+		events:   eventPublisher{publisher: NewPublisher(client), registry: events, producer: producer},
+		exchange: LocationFanoutExchange,
 	}
 }
 
 // publishes a location update (fanout exchange doesn't use routing keys)
-func (p *LocationEventPublisher) PublishLocationUpdate(ctx context.Context, message interface{}) error {
-	return p.publisher.Publish(ctx, p.exchange, "", message)
+func (p *LocationEventPublisher) PublishLocationUpdate(ctx context.Context, message LocationUpdateMessage) error {
+	return p.PublishLocationUpdateWithCorrelation(ctx, "", message)
+}
+
+func (p *LocationEventPublisher) PublishLocationUpdateWithCorrelation(ctx context.Context, correlationID string, message LocationUpdateMessage) error {
+	return p.events.publish(ctx, p.exchange, "", correlationID, message)
+}
+
+// SocketRoutingKey is the routing key the replicas of service relay websocket
+// frames and presence with
+func SocketRoutingKey(service string) string {
+	return "socket." + service
+}
+
+// socketQueuePrefix starts the names of the replicas' relay queues. They come
+// and go with the replicas, so no Topology declares them
+const socketQueuePrefix = "ws."
+
+// SocketQueueName is the relay queue of replica instanceID of service
+func SocketQueueName(service, instanceID string) string {
+	return socketQueuePrefix + service + "." + instanceID
+}
+
+// publishes websocket frames and presence to every replica of a service
+type SocketEventPublisher struct {
+	events     eventPublisher
+	exchange   string
+	routingKey string
+}
+
+func NewSocketEventPublisher(client Broker, service string) *SocketEventPublisher {
+	return &SocketEventPublisher{
+		events:     eventPublisher{publisher: NewPublisher(client), registry: events, producer: service},
+		exchange:   SocketTopicExchange,
+		routingKey: SocketRoutingKey(service),
+	}
+}
+
+func (p *SocketEventPublisher) PublishFrame(ctx context.Context, message SocketFrameMessage) error {
+	return p.events.publish(ctx, p.exchange, p.routingKey, "", message)
+}
+
+func (p *SocketEventPublisher) PublishRequest(ctx context.Context, message SocketRequestMessage) error {
+	return p.events.publish(ctx, p.exchange, p.routingKey, "", message)
 }
 
-func (p *LocationEventPublisher) PublishLocationUpdateWithCorrelation(ctx context.Context, correlationID string, message interface{}) error {
-	return p.publisher.PublishWithCorrelationID(ctx, p.exchange, "", correlationID, message)
+func (p *SocketEventPublisher) PublishPresence(ctx context.Context, message SocketPresenceMessage) error {
+	return p.events.publish(ctx, p.exchange, p.routingKey, "", message)
 }
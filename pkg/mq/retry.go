@@ -0,0 +1,172 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// RetryExchange routes a failed message into its <queue>.retry.<n> queue
+	RetryExchange = "retry"
+	// RetryReturnExchange receives expired retries and routes each back to the
+	// queue it failed on, so other queues bound to its routing key never see it again
+	RetryReturnExchange = "retry_return"
+
+	headerRetryCount = "x-retry-count"
+	// headers exchanges ignore binding arguments starting with x-, so the two
+	// headers retries are routed on must not have the prefix
+	headerRetryQueue       = "retry-queue"
+	headerRetryOrigin      = "retry-origin"
+	headerOriginalExchange = "x-original-exchange"
+	headerLastError        = "x-last-error"
+	headerDeadLetterReason = "x-dead-letter-reason"
+	headerFailedQueue      = "x-failed-queue"
+)
+
+// NoRetries as RetryPolicy.MaxRetries dead-letters a message on its first failure
+const NoRetries = -1
+
+// ErrPermanent marks handler errors that retrying cannot fix, such as a
+// malformed payload; the message goes straight to the dead letter queue
+var ErrPermanent = errors.New("permanent failure")
+
+type permanentError struct {
+	err error
+}
+
+// Permanent wraps err so the consumer dead-letters the message without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string        { return e.err.Error() }
+func (e *permanentError) Unwrap() error        { return e.err }
+func (e *permanentError) Is(target error) bool { return target == ErrPermanent }
+
+// RetryPolicy controls how a consumer retries failed messages. The delay of
+// each retry is the TTL of its <queue>.retry.<n> queue, so DeclareRetryQueues
+// must be given the same policy as the consumer
+type RetryPolicy struct {
+	MaxRetries   int           // retries before dead-lettering (default: 3, none with NoRetries)
+	InitialDelay time.Duration // delay before the first retry (default: 1s)
+	MaxDelay     time.Duration // cap on the delay (default: 30s)
+	Multiplier   float64       // growth of the delay per retry (default: 2)
+	// NonRetryable reports errors that go straight to the dead letter queue.
+	// Errors wrapped with Permanent are never retried
+	NonRetryable func(error) bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{}.withDefaults()
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxRetries == 0 {
+		p.MaxRetries = 3
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = time.Second
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 30 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+// retries is the number of retries before dead-lettering
+func (p RetryPolicy) retries() int {
+	return max(p.MaxRetries, 0)
+}
+
+// Delay is how long the message waits before retry number retry, from 1
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	p = p.withDefaults()
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(retry-1))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, ErrPermanent) {
+		return false
+	}
+	return p.NonRetryable == nil || !p.NonRetryable(err)
+}
+
+// RetryQueueName is the queue holding messages from queue waiting for retry number retry
+func RetryQueueName(queue string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, retry)
+}
+
+// DeclareRetryQueues declares the retry exchanges and one TTL'd
+// <queue>.retry.<n> queue per retry of policy. A changed delay needs the old
+// retry queue deleted first, as RabbitMQ refuses to redeclare a queue's TTL
+func DeclareRetryQueues(client Broker, queue string, policy RetryPolicy) error {
+	return Topology{}.WithRetries(queue, policy).Apply(client)
+}
+
+// retryPublishing copies delivery for retry number retry of a message that
+// failed on queue with handlerErr
+func retryPublishing(delivery amqp.Delivery, queue string, retry int, handlerErr error) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	if _, ok := headers[headerOriginalExchange]; !ok {
+		// retries come back through retry_return, so remember where the message was first published
+		headers[headerOriginalExchange] = delivery.Exchange
+	}
+	headers[headerRetryCount] = int32(retry)
+	headers[headerRetryQueue] = RetryQueueName(queue, retry)
+	headers[headerRetryOrigin] = queue
+	headers[headerLastError] = handlerErr.Error()
+
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		MessageId:     delivery.MessageId,
+		Timestamp:     delivery.Timestamp,
+		DeliveryMode:  delivery.DeliveryMode,
+		Body:          delivery.Body,
+	}
+}
+
+// deadLetterPublishing copies delivery for the dead letter exchange, recording
+// why it failed on queue
+func deadLetterPublishing(delivery amqp.Delivery, queue, reason string, handlerErr error) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	if _, ok := headers[headerOriginalExchange]; !ok {
+		headers[headerOriginalExchange] = delivery.Exchange
+	}
+	headers[headerFailedQueue] = queue
+	headers[headerDeadLetterReason] = reason
+	if handlerErr != nil {
+		headers[headerLastError] = handlerErr.Error()
+	}
+
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		MessageId:     delivery.MessageId,
+		Timestamp:     delivery.Timestamp,
+		DeliveryMode:  delivery.DeliveryMode,
+		Body:          delivery.Body,
+	}
+}
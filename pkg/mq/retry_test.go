@@ -0,0 +1,109 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{retry: 1, want: time.Second},
+		{retry: 2, want: 2 * time.Second},
+		{retry: 3, want: 4 * time.Second},
+		{retry: 4, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.retry); got != tt.want {
+			t.Errorf("Expected retry %d delay %v, got %v", tt.retry, tt.want, got)
+		}
+	}
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	errBadInput := errors.New("bad input")
+	policy := RetryPolicy{NonRetryable: func(err error) bool { return errors.Is(err, errBadInput) }}
+
+	if !policy.retryable(errors.New("timeout")) {
+		t.Error("Expected a plain error to be retryable")
+	}
+	if policy.retryable(fmt.Errorf("handler: %w", errBadInput)) {
+		t.Error("Expected an error matched by NonRetryable not to be retried")
+	}
+	if policy.retryable(fmt.Errorf("handler: %w", Permanent(errors.New("malformed")))) {
+		t.Error("Expected a Permanent error not to be retried")
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	if policy.MaxRetries != 3 {
+		t.Errorf("Expected 3 retries by default, got %d", policy.MaxRetries)
+	}
+	if policy.Delay(1) != time.Second {
+		t.Errorf("Expected a 1s first retry by default, got %v", policy.Delay(1))
+	}
+}
+
+func TestRetryPublishing_MatchesOnlyItsRetryBindings(t *testing.T) {
+	// RabbitMQ leaves binding arguments starting with x- out of the match
+	for _, header := range []string{headerRetryQueue, headerRetryOrigin} {
+		if strings.HasPrefix(header, "x-") {
+			t.Fatalf("Expected retry routing header %s not to start with x-", header)
+		}
+	}
+
+	topology := Topology{}.WithRetries("driver_matching", DefaultRetryPolicy()).WithRetries("ride_status", DefaultRetryPolicy())
+	for retry := 1; retry <= 3; retry++ {
+		headers := retryPublishing(amqp.Delivery{}, "driver_matching", retry, errors.New("timeout")).Headers
+
+		var matched []string
+		for _, binding := range topology.Bindings {
+			if headersMatch(binding.Args, headers) {
+				matched = append(matched, binding.Exchange+" -> "+binding.Queue)
+			}
+		}
+		want := []string{
+			RetryReturnExchange + " -> driver_matching",
+			RetryExchange + " -> " + RetryQueueName("driver_matching", retry),
+		}
+		if !slices.Equal(matched, want) {
+			t.Errorf("Expected retry %d to match %v, got %v", retry, want, matched)
+		}
+	}
+}
+
+func TestRetryPolicy_NoRetries(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: NoRetries}.withDefaults()
+	if policy.retries() != 0 {
+		t.Errorf("Expected no retries, got %d", policy.retries())
+	}
+	queues := Topology{}.WithRetries("driver_matching", policy).Queues
+	if len(queues) != 0 {
+		t.Errorf("Expected no retry queues, got %v", queues)
+	}
+
+	broker := newFakeBroker()
+	consumer := newConsumer(broker, ConsumerConfig{
+		Handler: func(ctx context.Context, message Message) error { return errors.New("timeout") },
+		Queue:   "driver_matching",
+		Retry:   policy,
+	})
+	consumer.processMessage(context.Background(), 0, amqp.Delivery{Acknowledger: broker, MessageId: "m1"})
+
+	if len(broker.sent) != 1 || broker.sent[0].exchange != DeadLetterExchange {
+		t.Fatalf("Expected the first failure to be dead-lettered, got %+v", broker.sent)
+	}
+}
@@ -0,0 +1,210 @@
+package mq
+
+import (
+	"fmt"
+	"log/slog"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	RideTopicExchange      = "ride_topic"
+	DriverTopicExchange    = "driver_topic"
+	LocationFanoutExchange = "location_fanout"
+	SocketTopicExchange    = "ws_topic"
+	DeadLetterExchange     = "dlx"
+
+	RideRequestsQueue         = "ride_requests"
+	RideStatusQueue           = "ride_status"
+	DriverMatchingQueue       = "driver_matching"
+	DriverResponsesQueue      = "driver_responses"
+	DriverStatusQueue         = "driver_status"
+	LocationUpdatesRideQueue  = "location_updates_ride"
+	LocationUpdatesAdminQueue = "location_updates_admin"
+)
+
+type ExchangeSpec struct {
+	Name       string
+	Kind       string
+	Durable    bool
+	AutoDelete bool
+}
+
+type QueueSpec struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Args       amqp.Table
+}
+
+type BindingSpec struct {
+	Queue    string
+	Key      string
+	Exchange string
+	Args     amqp.Table
+}
+
+func (b BindingSpec) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", b.Exchange, b.Queue, b.Key)
+}
+
+// Topology is the set of exchanges, queues and bindings the services expect
+// on the broker
+type Topology struct {
+	Exchanges []ExchangeSpec
+	Queues    []QueueSpec
+	Bindings  []BindingSpec
+}
+
+// DefaultTopology is the ride-hail topology. Every consumed queue gets the
+// retry queues of DefaultRetryPolicy, the policy the consumers run with
+func DefaultTopology() Topology {
+	dlxArgs := amqp.Table{"x-dead-letter-exchange": DeadLetterExchange}
+
+	t := Topology{
+		Exchanges: []ExchangeSpec{
+			{Name: RideTopicExchange, Kind: amqp.ExchangeTopic, Durable: true},
+			{Name: DriverTopicExchange, Kind: amqp.ExchangeTopic, Durable: true},
+			{Name: LocationFanoutExchange, Kind: amqp.ExchangeFanout, Durable: true},
+			{Name: SocketTopicExchange, Kind: amqp.ExchangeTopic, Durable: true},
+			{Name: DeadLetterExchange, Kind: amqp.ExchangeTopic, Durable: true},
+		},
+		Queues: []QueueSpec{
+			{Name: RideRequestsQueue, Durable: true, Args: dlxArgs},
+			{Name: RideStatusQueue, Durable: true, Args: dlxArgs},
+			{Name: DriverMatchingQueue, Durable: true, Args: dlxArgs},
+			{Name: DriverResponsesQueue, Durable: true, Args: dlxArgs},
+			{Name: DriverStatusQueue, Durable: true, Args: dlxArgs},
+			{Name: LocationUpdatesRideQueue, Durable: true, Args: dlxArgs},
+			{Name: LocationUpdatesAdminQueue, Durable: true, Args: dlxArgs},
+			{Name: DeadLetterQueueName, Durable: true},
+		},
+		Bindings: []BindingSpec{
+			{Queue: RideRequestsQueue, Key: "ride.request.*", Exchange: RideTopicExchange},
+			{Queue: RideStatusQueue, Key: "ride.status.*", Exchange: RideTopicExchange},
+			{Queue: DriverMatchingQueue, Key: "ride.request.*", Exchange: RideTopicExchange},
+			{Queue: DriverResponsesQueue, Key: "driver.response.*", Exchange: DriverTopicExchange},
+			{Queue: DriverStatusQueue, Key: "driver.status.*", Exchange: DriverTopicExchange},
+			{Queue: LocationUpdatesRideQueue, Key: "", Exchange: LocationFanoutExchange},
+			{Queue: LocationUpdatesAdminQueue, Key: "", Exchange: LocationFanoutExchange},
+			{Queue: DeadLetterQueueName, Key: "#", Exchange: DeadLetterExchange},
+		},
+	}
+
+	for _, queue := range []string{RideStatusQueue, DriverMatchingQueue, DriverResponsesQueue, LocationUpdatesRideQueue} {
+		t = t.WithRetries(queue, DefaultRetryPolicy())
+	}
+	return t
+}
+
+// WithRetries adds the retry exchanges and the <queue>.retry.<n> queues of
+// policy. Each retry queue holds messages for the delay of its retry and then
+// dead-letters them to retry_return, which routes them back to queue only
+func (t Topology) WithRetries(queue string, policy RetryPolicy) Topology {
+	policy = policy.withDefaults()
+
+	retry := Topology{
+		Exchanges: []ExchangeSpec{
+			{Name: RetryExchange, Kind: amqp.ExchangeHeaders, Durable: true},
+			{Name: RetryReturnExchange, Kind: amqp.ExchangeHeaders, Durable: true},
+		},
+		Bindings: []BindingSpec{
+			{Queue: queue, Exchange: RetryReturnExchange, Args: amqp.Table{"x-match": "all", headerRetryOrigin: queue}},
+		},
+	}
+	for n := 1; n <= policy.retries(); n++ {
+		name := RetryQueueName(queue, n)
+		retry.Queues = append(retry.Queues, QueueSpec{
+			Name:    name,
+			Durable: true,
+			Args: amqp.Table{
+				"x-message-ttl":          policy.Delay(n).Milliseconds(),
+				"x-dead-letter-exchange": RetryReturnExchange,
+			},
+		})
+		retry.Bindings = append(retry.Bindings, BindingSpec{
+			Queue:    name,
+			Exchange: RetryExchange,
+			Args:     amqp.Table{"x-match": "all", headerRetryQueue: name},
+		})
+	}
+
+	return t.merge(retry)
+}
+
+// merge appends the parts of other t does not declare yet
+func (t Topology) merge(other Topology) Topology {
+	merged := Topology{
+		Exchanges: append([]ExchangeSpec(nil), t.Exchanges...),
+		Queues:    append([]QueueSpec(nil), t.Queues...),
+		Bindings:  append([]BindingSpec(nil), t.Bindings...),
+	}
+	for _, ex := range other.Exchanges {
+		if _, ok := merged.exchange(ex.Name); !ok {
+			merged.Exchanges = append(merged.Exchanges, ex)
+		}
+	}
+	for _, q := range other.Queues {
+		if _, ok := merged.queue(q.Name); !ok {
+			merged.Queues = append(merged.Queues, q)
+		}
+	}
+	for _, b := range other.Bindings {
+		if !merged.hasBinding(b) {
+			merged.Bindings = append(merged.Bindings, b)
+		}
+	}
+	return merged
+}
+
+// Apply declares the topology on broker. Declaring is idempotent, but the
+// broker refuses to redeclare an exchange or queue with different settings;
+// Diff shows which
+func (t Topology) Apply(broker Broker) error {
+	for _, ex := range t.Exchanges {
+		if err := broker.CreateExchange(ex.Name, ex.Kind, ex.Durable, ex.AutoDelete); err != nil {
+			return fmt.Errorf("failed to create %s exchange: %w", ex.Name, err)
+		}
+		slog.Debug("Declared exchange", "name", ex.Name, "type", ex.Kind)
+	}
+	for _, q := range t.Queues {
+		if err := broker.CreateQueueWithArgs(q.Name, q.Durable, q.AutoDelete, q.Args); err != nil {
+			return fmt.Errorf("failed to create %s queue: %w", q.Name, err)
+		}
+		slog.Debug("Declared queue", "name", q.Name)
+	}
+	for _, b := range t.Bindings {
+		if err := broker.CreateBindingWithArgs(b.Queue, b.Key, b.Exchange, b.Args); err != nil {
+			return fmt.Errorf("failed to bind %s: %w", b.Queue, err)
+		}
+		slog.Debug("Declared binding", "queue", b.Queue, "exchange", b.Exchange, "key", b.Key)
+	}
+	return nil
+}
+
+func (t Topology) exchange(name string) (ExchangeSpec, bool) {
+	for _, ex := range t.Exchanges {
+		if ex.Name == name {
+			return ex, true
+		}
+	}
+	return ExchangeSpec{}, false
+}
+
+func (t Topology) queue(name string) (QueueSpec, bool) {
+	for _, q := range t.Queues {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return QueueSpec{}, false
+}
+
+func (t Topology) hasBinding(binding BindingSpec) bool {
+	for _, b := range t.Bindings {
+		if b.Queue == binding.Queue && b.Exchange == binding.Exchange && b.Key == binding.Key && argsEqual(b.Args, binding.Args) {
+			return true
+		}
+	}
+	return false
+}
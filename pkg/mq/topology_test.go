@@ -0,0 +1,175 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDefaultTopology_ApplyIsIdempotent(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := DefaultTopology().Apply(b); err != nil {
+			t.Fatalf("Apply %d failed: %v", i+1, err)
+		}
+	}
+
+	if err := b.Send(context.Background(), RideTopicExchange, "ride.request.ECONOMY", amqp.Publishing{}); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if b.QueueLen(RideRequestsQueue) != 1 || b.QueueLen(DriverMatchingQueue) != 1 {
+		t.Errorf("Expected one copy per bound queue after applying twice")
+	}
+}
+
+func TestMemoryBroker_RefusesChangedQueueArguments(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+	if err := DefaultTopology().Apply(b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err := DeclareRetryQueues(b, DriverMatchingQueue, RetryPolicy{InitialDelay: 5 * time.Second})
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		t.Errorf("Expected PRECONDITION_FAILED for a changed retry delay, got %v", err)
+	}
+}
+
+func TestDefaultTopology_DeclaresRetryQueuesOnce(t *testing.T) {
+	topology := DefaultTopology()
+
+	exchanges := 0
+	for _, ex := range topology.Exchanges {
+		if ex.Name == RetryExchange {
+			exchanges++
+		}
+	}
+	if exchanges != 1 {
+		t.Errorf("Expected the retry exchange once, got %d", exchanges)
+	}
+	if _, ok := topology.queue(RetryQueueName(DriverMatchingQueue, DefaultRetryPolicy().MaxRetries)); !ok {
+		t.Errorf("Expected the last driver_matching retry queue to be declared")
+	}
+}
+
+// liveTopology is DefaultTopology as the management API reports it: numbers
+// as floats, empty argument tables, the default exchange bindings and the
+// relay queue of a replica
+func liveTopology() Topology {
+	live := DefaultTopology()
+	for i, q := range live.Queues {
+		args := amqp.Table{}
+		for k, v := range q.Args {
+			if n, ok := v.(int64); ok {
+				v = float64(n)
+			}
+			args[k] = v
+		}
+		live.Queues[i].Args = args
+	}
+	live.Exchanges = append(live.Exchanges, ExchangeSpec{Name: "amq.topic", Kind: amqp.ExchangeTopic, Durable: true})
+	live.Bindings = append(live.Bindings, BindingSpec{Queue: RideStatusQueue, Key: RideStatusQueue, Exchange: ""})
+
+	// a running ride service replica
+	relay := SocketQueueName("ride-service", "7f3c")
+	live.Queues = append(live.Queues, QueueSpec{Name: relay, Args: amqp.Table{"x-expires": float64(60000)}})
+	live.Bindings = append(live.Bindings, BindingSpec{Queue: relay, Key: SocketRoutingKey("ride-service"), Exchange: SocketTopicExchange})
+	return live
+}
+
+func TestTopology_DiffMatchingBroker(t *testing.T) {
+	if drifts := DefaultTopology().Diff(liveTopology()); len(drifts) != 0 {
+		t.Errorf("Expected no drift, got %v", drifts)
+	}
+}
+
+func TestTopology_DiffReportsDrift(t *testing.T) {
+	live := liveTopology()
+	live.Exchanges[0].Kind = amqp.ExchangeDirect
+	live.Queues = live.Queues[1:]
+	for i, q := range live.Queues {
+		if q.Name == RetryQueueName(RideStatusQueue, 1) {
+			live.Queues[i].Args["x-message-ttl"] = float64(5000)
+		}
+	}
+	live.Queues = append(live.Queues, QueueSpec{Name: "ride_requests_old", Durable: true})
+	live.Bindings = append(live.Bindings, BindingSpec{Queue: RideStatusQueue, Key: "ride.#", Exchange: RideTopicExchange})
+	live.Bindings = append(live.Bindings, BindingSpec{Queue: SocketQueueName("ride-service", "7f3c"), Key: "ride.#", Exchange: RideTopicExchange})
+
+	got := make(map[string]bool)
+	for _, drift := range DefaultTopology().Diff(live) {
+		got[drift.String()] = true
+	}
+
+	want := []string{
+		"exchange ride_topic: type is direct, want topic",
+		"queue ride_requests: missing",
+		"queue ride_status.retry.1: arguments are {x-dead-letter-exchange=retry_return x-message-ttl=5000}, want {x-dead-letter-exchange=retry_return x-message-ttl=1000}",
+		"queue ride_requests_old: unexpected",
+		"binding ride_topic -> ride_status (ride.#): unexpected",
+		"binding ride_topic -> ws.ride-service.7f3c (ride.#): unexpected",
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("Expected drift %q, got %v", w, got)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d drifts, got %d: %v", len(want), len(got), got)
+	}
+}
+
+func TestManagementClient_State(t *testing.T) {
+	responses := map[string]interface{}{
+		"/api/exchanges/%2F": []map[string]interface{}{
+			{"name": "ride_topic", "type": "topic", "durable": true, "auto_delete": false},
+		},
+		"/api/queues/%2F": []map[string]interface{}{
+			{"name": "ride_status", "durable": true, "auto_delete": false, "arguments": map[string]interface{}{"x-dead-letter-exchange": "dlx"}},
+		},
+		"/api/bindings/%2F": []map[string]interface{}{
+			{"source": "ride_topic", "destination": "ride_status", "destination_type": "queue", "routing_key": "ride.status.*", "arguments": map[string]interface{}{}},
+			{"source": "ride_topic", "destination": "audit", "destination_type": "exchange", "routing_key": "#", "arguments": map[string]interface{}{}},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "guest" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		response, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	host, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	management := NewManagementClient(Config{Host: host, ManagementPort: port, UserName: "guest", Password: "secret"})
+
+	state, err := management.State(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(state.Exchanges) != 1 || state.Exchanges[0].Kind != amqp.ExchangeTopic {
+		t.Errorf("Unexpected exchanges %+v", state.Exchanges)
+	}
+	if len(state.Queues) != 1 || state.Queues[0].Args["x-dead-letter-exchange"] != "dlx" {
+		t.Errorf("Unexpected queues %+v", state.Queues)
+	}
+	if len(state.Bindings) != 1 || state.Bindings[0].String() != "ride_topic -> ride_status (ride.status.*)" {
+		t.Errorf("Expected only the queue binding, got %+v", state.Bindings)
+	}
+}
@@ -1,6 +1,9 @@
 package mq
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type RideRequestMessage struct {
 	RequestedAt         time.Time           `json:"requested_at"`
@@ -16,6 +19,9 @@ type RideRequestMessage struct {
 	EstimatedFare       float64             `json:"estimated_fare"`
 }
 
+func (RideRequestMessage) EventType() string { return EventRideRequested }
+func (RideRequestMessage) EventVersion() int { return 1 }
+
 type RideStatusMessage struct {
 	UpdatedAt     time.Time              `json:"updated_at"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
@@ -28,6 +34,9 @@ type RideStatusMessage struct {
 	CorrelationID string                 `json:"correlation_id,omitempty"`
 }
 
+func (RideStatusMessage) EventType() string { return EventRideStatusChanged }
+func (RideStatusMessage) EventVersion() int { return 1 }
+
 type DriverResponseMessage struct {
 	RespondedAt             time.Time            `json:"responded_at"`
 	RideID                  string               `json:"ride_id"`
@@ -41,6 +50,8 @@ type DriverResponseMessage struct {
 	Accepted                bool                 `json:"accepted"`
 }
 
+func (DriverResponseMessage) EventType() string { return EventDriverResponded }
+func (DriverResponseMessage) EventVersion() int { return 1 }
 
 type DriverStatusMessage struct {
 	UpdatedAt time.Time              `json:"updated_at"`
@@ -50,6 +61,9 @@ type DriverStatusMessage struct {
 	NewStatus string                 `json:"new_status"`
 }
 
+func (DriverStatusMessage) EventType() string { return EventDriverStatusChanged }
+func (DriverStatusMessage) EventVersion() int { return 1 }
+
 type LocationUpdateMessage struct {
 	Timestamp  time.Time            `json:"timestamp"`
 	EntityID   string               `json:"entity_id"`
@@ -61,6 +75,9 @@ type LocationUpdateMessage struct {
 	Heading    float64              `json:"heading_degrees,omitempty"`
 }
 
+func (LocationUpdateMessage) EventType() string { return EventLocationUpdated }
+func (LocationUpdateMessage) EventVersion() int { return 1 }
+
 type RideMatchedMessage struct {
 	EstimatedArrival time.Time            `json:"estimated_arrival"`
 	MatchedAt        time.Time            `json:"matched_at"`
@@ -79,6 +96,9 @@ type RideMatchedMessage struct {
 	CorrelationID    string               `json:"correlation_id,omitempty"`
 }
 
+func (RideMatchedMessage) EventType() string { return EventRideMatched }
+func (RideMatchedMessage) EventVersion() int { return 1 }
+
 type RideCompletedMessage struct {
 	StartTime     time.Time `json:"start_time"`
 	EndTime       time.Time `json:"end_time"`
@@ -93,23 +113,73 @@ type RideCompletedMessage struct {
 	FinalFare     float64   `json:"final_fare"`
 }
 
+func (RideCompletedMessage) EventType() string { return EventRideCompleted }
+func (RideCompletedMessage) EventVersion() int { return 1 }
+
 type RideCancelledMessage struct {
 	CancelledAt     time.Time `json:"cancelled_at"`
 	RideID          string    `json:"ride_id"`
 	RideNumber      string    `json:"ride_number"`
 	PassengerID     string    `json:"passenger_id"`
 	DriverID        string    `json:"driver_id,omitempty"`
+	PreviousStatus  string    `json:"previous_status,omitempty"`
 	CancelledBy     string    `json:"cancelled_by"`
 	Reason          string    `json:"reason"`
 	CancellationFee float64   `json:"cancellation_fee,omitempty"`
 }
 
+func (RideCancelledMessage) EventType() string { return EventRideCancelled }
+func (RideCancelledMessage) EventVersion() int { return 1 }
+
+// SocketFrameMessage carries a websocket frame to the replica its user is
+// connected to
+type SocketFrameMessage struct {
+	Origin  string          `json:"origin"` // instance that published the frame
+	UserID  string          `json:"user_id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (SocketFrameMessage) EventType() string { return EventSocketFrame }
+func (SocketFrameMessage) EventVersion() int { return 1 }
+
+// SocketPresenceMessage lists every user connected to a replica. Replicas send
+// it when their sockets change and periodically, and send Leaving on shutdown
+type SocketPresenceMessage struct {
+	Origin  string   `json:"origin"`
+	Users   []string `json:"users"`
+	Leaving bool     `json:"leaving,omitempty"`
+}
+
+func (SocketPresenceMessage) EventType() string { return EventSocketPresence }
+func (SocketPresenceMessage) EventVersion() int { return 1 }
+
+// SocketRequestMessage carries a frame a user sent on one replica to the
+// replica Target, which handles it as if the user's socket were its own
+type SocketRequestMessage struct {
+	Origin  string          `json:"origin"`
+	Target  string          `json:"target"`
+	UserID  string          `json:"user_id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (SocketRequestMessage) EventType() string { return EventSocketRequest }
+func (SocketRequestMessage) EventVersion() int { return 1 }
+
 type LocationCoordinates struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	Address   string  `json:"address,omitempty"`
 }
 
 type DriverInfo struct {
-	Name         string  `json:"name"`
-	Rating       float64 `json:"rating"`
+	Vehicle *VehicleInfo `json:"vehicle,omitempty"`
+	Name    string       `json:"name"`
+	Rating  float64      `json:"rating"`
+}
+
+type VehicleInfo struct {
+	Make  string `json:"make"`
+	Model string `json:"model"`
+	Color string `json:"color"`
+	Plate string `json:"plate"`
 }
@@ -0,0 +1,63 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidEvent marks events whose payload failed validation
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Validator is an Event that can check its own payload
+type Validator interface {
+	Validate() error
+}
+
+func (m RideRequestMessage) Validate() error {
+	return errors.Join(
+		required("ride_id", m.RideID),
+		required("vehicle_type", m.VehicleType),
+		m.PickupLocation.validate("pickup_location"),
+		m.DestinationLocation.validate("destination_location"),
+	)
+}
+
+func (m RideStatusMessage) Validate() error {
+	return errors.Join(
+		required("ride_id", m.RideID),
+		required("new_status", m.NewStatus),
+	)
+}
+
+func (m DriverResponseMessage) Validate() error {
+	err := errors.Join(
+		required("ride_id", m.RideID),
+		required("driver_id", m.DriverID),
+	)
+	if m.DriverLocation != nil {
+		err = errors.Join(err, m.DriverLocation.validate("driver_location"))
+	}
+	return err
+}
+
+func (m LocationUpdateMessage) Validate() error {
+	err := required("entity_id", m.EntityID)
+	if m.Location == nil {
+		return errors.Join(err, errors.New("location is required"))
+	}
+	return errors.Join(err, m.Location.validate("location"))
+}
+
+func (c LocationCoordinates) validate(field string) error {
+	if c.Latitude < -90 || c.Latitude > 90 || c.Longitude < -180 || c.Longitude > 180 {
+		return fmt.Errorf("%s (%g, %g) is out of range", field, c.Latitude, c.Longitude)
+	}
+	return nil
+}
+
+func required(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	return nil
+}
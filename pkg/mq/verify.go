@@ -0,0 +1,237 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Drift is one difference between a Topology and the live broker
+type Drift struct {
+	Kind    string // exchange, queue or binding
+	Name    string
+	Problem string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Name, d.Problem)
+}
+
+// Diff reports what live lacks, declares differently or declares beyond t.
+// The default exchange, amq.* exchanges, server-named queues and the relay
+// queues of websocket replicas with their ws_topic bindings are ignored
+func (t Topology) Diff(live Topology) []Drift {
+	var drifts []Drift
+
+	for _, want := range t.Exchanges {
+		got, ok := live.exchange(want.Name)
+		switch {
+		case !ok:
+			drifts = append(drifts, Drift{Kind: "exchange", Name: want.Name, Problem: "missing"})
+		case got.Kind != want.Kind:
+			drifts = append(drifts, Drift{Kind: "exchange", Name: want.Name, Problem: fmt.Sprintf("type is %s, want %s", got.Kind, want.Kind)})
+		case got.Durable != want.Durable || got.AutoDelete != want.AutoDelete:
+			drifts = append(drifts, Drift{Kind: "exchange", Name: want.Name, Problem: flagsProblem(got.Durable, got.AutoDelete, want.Durable, want.AutoDelete)})
+		}
+	}
+	for _, got := range live.Exchanges {
+		if _, ok := t.exchange(got.Name); !ok && got.Name != "" && !strings.HasPrefix(got.Name, "amq.") {
+			drifts = append(drifts, Drift{Kind: "exchange", Name: got.Name, Problem: "unexpected"})
+		}
+	}
+
+	for _, want := range t.Queues {
+		got, ok := live.queue(want.Name)
+		switch {
+		case !ok:
+			drifts = append(drifts, Drift{Kind: "queue", Name: want.Name, Problem: "missing"})
+		case got.Durable != want.Durable || got.AutoDelete != want.AutoDelete:
+			drifts = append(drifts, Drift{Kind: "queue", Name: want.Name, Problem: flagsProblem(got.Durable, got.AutoDelete, want.Durable, want.AutoDelete)})
+		case !argsEqual(got.Args, want.Args):
+			drifts = append(drifts, Drift{Kind: "queue", Name: want.Name, Problem: fmt.Sprintf("arguments are %s, want %s", formatArgs(got.Args), formatArgs(want.Args))})
+		}
+	}
+	for _, got := range live.Queues {
+		if _, ok := t.queue(got.Name); !ok && !strings.HasPrefix(got.Name, "amq.") && !strings.HasPrefix(got.Name, socketQueuePrefix) {
+			drifts = append(drifts, Drift{Kind: "queue", Name: got.Name, Problem: "unexpected"})
+		}
+	}
+
+	for _, want := range t.Bindings {
+		if !live.hasBinding(want) {
+			drifts = append(drifts, Drift{Kind: "binding", Name: bindingName(want), Problem: "missing"})
+		}
+	}
+	for _, got := range live.Bindings {
+		if got.Exchange != "" && !t.hasBinding(got) && !isSocketBinding(got) {
+			drifts = append(drifts, Drift{Kind: "binding", Name: bindingName(got), Problem: "unexpected"})
+		}
+	}
+
+	return drifts
+}
+
+// isSocketBinding reports whether b binds a replica's relay queue to ws_topic
+func isSocketBinding(b BindingSpec) bool {
+	return b.Exchange == SocketTopicExchange && strings.HasPrefix(b.Queue, socketQueuePrefix)
+}
+
+func bindingName(b BindingSpec) string {
+	if len(b.Args) > 0 {
+		return b.String() + " " + formatArgs(b.Args)
+	}
+	return b.String()
+}
+
+func flagsProblem(durable, autoDelete, wantDurable, wantAutoDelete bool) string {
+	return fmt.Sprintf("durable=%t auto_delete=%t, want durable=%t auto_delete=%t", durable, autoDelete, wantDurable, wantAutoDelete)
+}
+
+// argsEqual compares declaration arguments; numbers compare by value, as the
+// management API reports every number as a float
+func argsEqual(a, b amqp.Table) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		other, ok := b[k]
+		if !ok || normalizeArg(v) != normalizeArg(other) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeArg(v interface{}) string {
+	switch n := v.(type) {
+	case int:
+		return fmt.Sprint(float64(n))
+	case int32:
+		return fmt.Sprint(float64(n))
+	case int64:
+		return fmt.Sprint(float64(n))
+	case float32:
+		return fmt.Sprint(float64(n))
+	}
+	return fmt.Sprint(v)
+}
+
+func formatArgs(args amqp.Table) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+normalizeArg(args[k]))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// ManagementClient reads the declared topology of the "/" vhost from the
+// RabbitMQ management plugin; AMQP itself cannot list bindings
+type ManagementClient struct {
+	baseURL  string
+	user     string
+	password string
+	http     *http.Client
+}
+
+func NewManagementClient(config Config) *ManagementClient {
+	return &ManagementClient{
+		baseURL:  fmt.Sprintf("http://%s:%s/api", config.Host, config.ManagementPort),
+		user:     config.UserName,
+		password: config.Password,
+		http:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// State fetches the exchanges, queues and queue bindings the broker has declared
+func (m *ManagementClient) State(ctx context.Context) (Topology, error) {
+	var state Topology
+
+	var exchanges []struct {
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		Durable    bool   `json:"durable"`
+		AutoDelete bool   `json:"auto_delete"`
+	}
+	if err := m.get(ctx, "exchanges", &exchanges); err != nil {
+		return state, err
+	}
+	for _, ex := range exchanges {
+		state.Exchanges = append(state.Exchanges, ExchangeSpec{Name: ex.Name, Kind: ex.Type, Durable: ex.Durable, AutoDelete: ex.AutoDelete})
+	}
+
+	var queues []struct {
+		Name       string     `json:"name"`
+		Durable    bool       `json:"durable"`
+		AutoDelete bool       `json:"auto_delete"`
+		Arguments  amqp.Table `json:"arguments"`
+	}
+	if err := m.get(ctx, "queues", &queues); err != nil {
+		return state, err
+	}
+	for _, q := range queues {
+		state.Queues = append(state.Queues, QueueSpec{Name: q.Name, Durable: q.Durable, AutoDelete: q.AutoDelete, Args: q.Arguments})
+	}
+
+	var bindings []struct {
+		Source          string     `json:"source"`
+		Destination     string     `json:"destination"`
+		DestinationType string     `json:"destination_type"`
+		RoutingKey      string     `json:"routing_key"`
+		Arguments       amqp.Table `json:"arguments"`
+	}
+	if err := m.get(ctx, "bindings", &bindings); err != nil {
+		return state, err
+	}
+	for _, b := range bindings {
+		if b.DestinationType != "queue" {
+			continue
+		}
+		state.Bindings = append(state.Bindings, BindingSpec{Queue: b.Destination, Key: b.RoutingKey, Exchange: b.Source, Args: b.Arguments})
+	}
+
+	return state, nil
+}
+
+func (m *ManagementClient) get(ctx context.Context, resource string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+"/"+resource+"/"+url.PathEscape("/"), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.user, m.password)
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to list %s: management API returned %s", resource, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", resource, err)
+	}
+	return nil
+}
+
+// Verify compares t with the live broker
+func (t Topology) Verify(ctx context.Context, management *ManagementClient) ([]Drift, error) {
+	live, err := management.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.Diff(live), nil
+}
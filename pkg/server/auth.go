@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ride-hail/pkg/uuid"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrBadAuthFrame = errors.New("expected an auth frame")
+	ErrAuthTimeout  = errors.New("auth frame not received in time")
+)
+
+// Close codes for sockets that fail the auth handshake, from the 4000-4999
+// range left to applications
+const (
+	CloseBadAuthFrame = 4400
+	CloseUnauthorized = 4401
+	CloseForbidden    = 4403
+	CloseAuthTimeout  = 4408
+)
+
+// authFrameLimit leaves room for a JWT; later frames get the Manager's limit
+const authFrameLimit = 4096
+
+// authTimeout is how long a socket has to send its auth frame
+var authTimeout = 5 * time.Second
+
+// Authenticate checks the bearer token of the socket opened by r and returns
+// the user the socket belongs to. Errors wrapping ErrForbidden close the socket
+// with CloseForbidden, any other error with CloseUnauthorized
+type Authenticate func(r *http.Request, token string) (uuid.UUID, error)
+
+type authFrame struct {
+	LastSeq *uint64 `json:"last_seq,omitempty"` // resume after this frame, see Manager
+	Type    string  `json:"type"`
+	Token   string  `json:"token"`
+	Stream  string  `json:"stream,omitempty"` // the stream last_seq belongs to
+}
+
+// authenticated is the outcome of a successful auth frame
+type authenticated struct {
+	cursor *Cursor
+	userID uuid.UUID
+}
+
+func bearerToken(value string) (string, error) {
+	token, ok := strings.CutPrefix(value, "Bearer ")
+	if !ok || token == "" {
+		return "", fmt.Errorf("%w: expected a Bearer token", ErrUnauthorized)
+	}
+	return token, nil
+}
+
+// authenticateHeader checks a token sent in the Authorization header, so
+// clients that can set headers skip the auth frame
+func authenticateHeader(r *http.Request, header string, authenticate Authenticate) (uuid.UUID, error) {
+	token, err := bearerToken(header)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return authenticate(r, token)
+}
+
+// authenticateFrame waits up to authTimeout for the socket's first frame,
+// which must be {"type":"auth","token":"Bearer {jwt}"} and may add last_seq
+// and stream
+func authenticateFrame(conn *websocket.Conn, r *http.Request, authenticate Authenticate) (authenticated, error) {
+	conn.SetReadLimit(authFrameLimit)
+	if err := conn.SetReadDeadline(time.Now().Add(authTimeout)); err != nil {
+		return authenticated{}, err
+	}
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return authenticated{}, ErrAuthTimeout
+		}
+		return authenticated{}, err
+	}
+
+	var frame authFrame
+	if err := json.Unmarshal(data, &frame); err != nil || frame.Type != "auth" {
+		return authenticated{}, ErrBadAuthFrame
+	}
+	token, err := bearerToken(frame.Token)
+	if err != nil {
+		return authenticated{}, err
+	}
+	userID, err := authenticate(r, token)
+	if err != nil {
+		return authenticated{}, err
+	}
+	result := authenticated{userID: userID}
+	if frame.LastSeq != nil {
+		result.cursor = &Cursor{Stream: frame.Stream, Seq: *frame.LastSeq}
+	}
+	return result, nil
+}
+
+// authStatus is the HTTP status for an auth error found before the upgrade
+func authStatus(err error) int {
+	if errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// authCloseCode is the close code for an auth error found after the upgrade
+func authCloseCode(err error) int {
+	switch {
+	case errors.Is(err, ErrForbidden):
+		return CloseForbidden
+	case errors.Is(err, ErrBadAuthFrame):
+		return CloseBadAuthFrame
+	case errors.Is(err, ErrAuthTimeout):
+		return CloseAuthTimeout
+	default:
+		return CloseUnauthorized
+	}
+}
+
+// closeWithError sends a close frame carrying code and err, then closes conn
+func closeWithError(conn *websocket.Conn, code int, err error) {
+	reason := err.Error()
+	if len(reason) > 123 {
+		// control frames carry at most 125 bytes, two of them the code
+		reason = reason[:123]
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	_ = conn.Close()
+}
@@ -12,36 +12,68 @@ import (
 
 type ClientList map[*Client]bool
 
+// Client is one socket of a user, or a Subscription when conn is nil
 type Client struct {
 	conn      *websocket.Conn
 	manager   *Manager
 	inbound   chan []byte
 	outbound  chan []byte
+	replay    [][]byte // written before outbound, see Manager.addClient
 	closeOnce sync.Once
 	id        uuid.UUID
 }
 
+const writeWait = 10 * time.Second
+
 var (
 	pongWait     = 10 * time.Second
 	pingInterval = (pongWait * 9) / 10
 )
 
-func NewClient(id uuid.UUID, conn *websocket.Conn, manager *Manager) *Client {
+func NewClient(id uuid.UUID, conn *websocket.Conn, manager *Manager, buffer int) *Client {
 	return &Client{
 		id:       id,
 		conn:     conn,
 		manager:  manager,
 		inbound:  make(chan []byte),
-		outbound: make(chan []byte),
+		outbound: make(chan []byte, buffer),
+	}
+}
+
+// enqueue queues frame for the writer. When the buffer is full, DropOldest
+// makes room by discarding the oldest frame; under Disconnect enqueue reports
+// false and the caller disconnects the client. The manager is the only sender
+func (c *Client) enqueue(frame []byte, policy SlowConsumerPolicy) bool {
+	select {
+	case c.outbound <- frame:
+		return true
+	default:
+	}
+	if policy == Disconnect {
+		return false
+	}
+
+	select {
+	case <-c.outbound:
+		slog.Warn("Client outbound buffer full, dropped oldest frame", "client_id", c.id.String())
+	default:
+	}
+	select {
+	case c.outbound <- frame:
+		return true
+	default:
+		return false
 	}
 }
 
 func (c *Client) readMessages() {
 	defer func() {
+		// only the reader sends on inbound, so only it closes it
+		close(c.inbound)
 		c.close()
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(c.manager.readLimit.Load())
 	if err := c.conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 		return
 	}
@@ -68,11 +100,19 @@ func (c *Client) writeMessages() {
 		c.close()
 	}()
 
+	for _, frame := range c.replay {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return
+		}
+	}
+	c.replay = nil
+
 	for {
 		select {
 		case event, ok := <-c.outbound:
 
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte("conn shutting down"))
@@ -91,11 +131,22 @@ func (c *Client) writeMessages() {
 	}
 }
 
+// disconnect sends a close frame with code and closes the client
+func (c *Client) disconnect(code int, reason string) {
+	if c.conn != nil {
+		_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+	c.close()
+}
+
+// close removes the client before closing outbound, so the manager never
+// sends on a closed channel
 func (c *Client) close() {
 	c.closeOnce.Do(func() {
+		c.manager.removeClient(c)
 		close(c.outbound)
-		close(c.inbound)
-		_ = c.conn.Close()
-		c.manager.removeClient(c.id)
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
 	})
 }
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"ride-hail/pkg/mq"
+	"ride-hail/pkg/uuid"
+)
+
+const (
+	// presenceInterval is how often a replica republishes its presence
+	presenceInterval = 10 * time.Second
+	// presenceTTL forgets replicas that stopped publishing, e.g. after a crash
+	presenceTTL = 3 * presenceInterval
+	// relayQueueExpiry lets the broker drop the queue of a replica that is gone
+	relayQueueExpiry    = time.Minute
+	relayPublishTimeout = 5 * time.Second
+	// relayBuffer is how many frames may wait for the broker before route drops them
+	relayBuffer = 256
+)
+
+// BrokerRelay connects the Managers of every replica of a service over the
+// message bus. Each replica consumes a queue of its own bound to
+// mq.SocketTopicExchange, so any replica can push to sockets another one holds
+type BrokerRelay struct {
+	broker    mq.Broker
+	publisher *mq.SocketEventPublisher
+	service   string
+}
+
+func NewBrokerRelay(broker mq.Broker, service string) *BrokerRelay {
+	return &BrokerRelay{
+		broker:    broker,
+		publisher: mq.NewSocketEventPublisher(broker, service),
+		service:   service,
+	}
+}
+
+// subscribe declares the queue of the replica instanceID and consumes it with
+// handler. The queue outlives short reconnects but not the replica
+func (r *BrokerRelay) subscribe(ctx context.Context, instanceID string, handler mq.MessageHandler) (*mq.MessageConsumer, error) {
+	queue := mq.SocketQueueName(r.service, instanceID)
+	args := amqp.Table{"x-expires": relayQueueExpiry.Milliseconds()}
+	if err := r.broker.CreateQueueWithArgs(queue, false, false, args); err != nil {
+		return nil, fmt.Errorf("failed to create relay queue: %w", err)
+	}
+	if err := r.broker.CreateBindingWithArgs(queue, mq.SocketRoutingKey(r.service), mq.SocketTopicExchange, nil); err != nil {
+		return nil, fmt.Errorf("failed to bind relay queue: %w", err)
+	}
+
+	// one worker keeps each user's frames in order
+	consumer := mq.NewConsumer(r.broker, mq.ConsumerConfig{
+		Handler:       handler,
+		Queue:         queue,
+		ConsumerTag:   queue,
+		PrefetchCount: 50,
+		Workers:       1,
+	})
+	if err := consumer.Start(ctx); err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+var (
+	// ErrForwarded tells the Router a handler forwarded its frame, so it sends no reply
+	ErrForwarded = errors.New("frame forwarded to another replica")
+	// ErrRelayUnavailable means Forward could not queue a frame: the relay is
+	// not running or is behind
+	ErrRelayUnavailable = errors.New("websocket relay unavailable")
+)
+
+type replicaPresence struct {
+	users  map[uuid.UUID]struct{}
+	seenAt time.Time
+}
+
+// RunRelay shares m's sockets with the other replicas behind relay until ctx
+// is done: frames for users connected to another replica are forwarded there,
+// and Connected answers for every replica
+func (m *Manager) RunRelay(ctx context.Context, relay *BrokerRelay) error {
+	consumer, err := relay.subscribe(ctx, m.instanceID, m.handleRelayed)
+	if err != nil {
+		return err
+	}
+	frames := make(chan mq.Event, relayBuffer)
+	m.mu.Lock()
+	m.relayFrames = frames
+	m.mu.Unlock()
+	slog.Info("WebSocket relay started", "service", relay.service, "instance_id", m.instanceID)
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		m.publishFrames(ctx, relay, frames)
+	}()
+
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	m.publishPresence(ctx, relay, false)
+	for {
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			m.relayFrames = nil
+			m.mu.Unlock()
+			<-published
+
+			stopCtx, cancel := context.WithTimeout(context.Background(), relayPublishTimeout)
+			defer cancel()
+			m.publishPresence(stopCtx, relay, true)
+			return consumer.Stop(stopCtx)
+		case <-ticker.C:
+		case <-m.presenceChanged:
+		}
+		m.publishPresence(ctx, relay, false)
+	}
+}
+
+// publishFrames publishes the frames route and Forward queued until ctx is
+// done, one at a time so each user's frames keep their order
+func (m *Manager) publishFrames(ctx context.Context, relay *BrokerRelay, frames <-chan mq.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame := <-frames:
+			publishCtx, cancel := context.WithTimeout(ctx, relayPublishTimeout)
+			err := relay.publish(publishCtx, frame)
+			cancel()
+			if err != nil {
+				slog.Warn("Failed to relay websocket frame", "event_type", frame.EventType(), "error", err)
+			}
+		}
+	}
+}
+
+func (r *BrokerRelay) publish(ctx context.Context, event mq.Event) error {
+	switch e := event.(type) {
+	case mq.SocketFrameMessage:
+		return r.publisher.PublishFrame(ctx, e)
+	case mq.SocketRequestMessage:
+		return r.publisher.PublishRequest(ctx, e)
+	default:
+		return fmt.Errorf("%w: %s", mq.ErrUnexpectedEvent, event.EventType())
+	}
+}
+
+// Forward hands request to the replica instanceID, whose Router handles it as
+// if the user's socket were its own. A handler that forwards its frame returns
+// ErrForwarded, leaving the reply to that replica
+func (m *Manager) Forward(instanceID string, request Request) error {
+	m.mu.Lock()
+	frames := m.relayFrames
+	m.mu.Unlock()
+	if frames == nil {
+		return ErrRelayUnavailable
+	}
+
+	message := mq.SocketRequestMessage{
+		Origin:  m.instanceID,
+		Target:  instanceID,
+		UserID:  request.UserID.String(),
+		Payload: request.Payload,
+	}
+	select {
+	case frames <- message:
+		return nil
+	default:
+		return ErrRelayUnavailable
+	}
+}
+
+// InstanceID names this replica on the relay, e.g. to Forward frames back to it
+func (m *Manager) InstanceID() string {
+	return m.instanceID
+}
+
+func (m *Manager) publishPresence(ctx context.Context, relay *BrokerRelay, leaving bool) {
+	presence := mq.SocketPresenceMessage{Origin: m.instanceID, Leaving: leaving}
+	if !leaving {
+		m.mu.Lock()
+		for userID := range m.clients {
+			presence.Users = append(presence.Users, userID.String())
+		}
+		m.mu.Unlock()
+	}
+
+	if err := relay.publisher.PublishPresence(ctx, presence); err != nil {
+		slog.Warn("Failed to publish websocket presence", "instance_id", m.instanceID, "error", err)
+	}
+}
+
+// notifyPresence asks RunRelay to publish the sockets, which changed
+func (m *Manager) notifyPresence() {
+	select {
+	case m.presenceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// handleRelayed is the mq.MessageHandler of the replica's relay queue. The
+// queue also gets the replica's own messages, which it skips, and requests
+// forwarded to other replicas
+func (m *Manager) handleRelayed(ctx context.Context, message mq.Message) error {
+	event, err := mq.DecodeEvent(message)
+	if err != nil {
+		return err
+	}
+
+	switch e := event.(type) {
+	case mq.SocketFrameMessage:
+		if e.Origin == m.instanceID {
+			return nil
+		}
+		userID, err := uuid.FromString(e.UserID)
+		if err != nil {
+			return mq.Permanent(fmt.Errorf("invalid user_id %q: %w", e.UserID, err))
+		}
+		m.deliver(userID, e.Payload)
+	case mq.SocketRequestMessage:
+		if e.Target != m.instanceID {
+			return nil
+		}
+		userID, err := uuid.FromString(e.UserID)
+		if err != nil {
+			return mq.Permanent(fmt.Errorf("invalid user_id %q: %w", e.UserID, err))
+		}
+		select {
+		case m.read <- RequestWs{Payload: e.Payload, ProducerID: userID}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case mq.SocketPresenceMessage:
+		if e.Origin != m.instanceID {
+			m.updatePresence(e, time.Now())
+		}
+	default:
+		return mq.Permanent(fmt.Errorf("%w: %s", mq.ErrUnexpectedEvent, event.EventType()))
+	}
+	return nil
+}
+
+// updatePresence records the sockets of another replica. A replica seen for
+// the first time gets this one's presence back, so it need not wait for the
+// next interval to route frames here
+func (m *Manager) updatePresence(presence mq.SocketPresenceMessage, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if presence.Leaving {
+		delete(m.remote, presence.Origin)
+		return
+	}
+
+	users := make(map[uuid.UUID]struct{}, len(presence.Users))
+	for _, user := range presence.Users {
+		userID, err := uuid.FromString(user)
+		if err != nil {
+			slog.Warn("Skipping invalid user in websocket presence", "instance_id", presence.Origin, "user_id", user)
+			continue
+		}
+		users[userID] = struct{}{}
+	}
+
+	if _, known := m.remote[presence.Origin]; !known {
+		m.notifyPresence()
+	}
+	m.remote[presence.Origin] = &replicaPresence{users: users, seenAt: now}
+
+	for origin, replica := range m.remote {
+		if now.Sub(replica.seenAt) > presenceTTL {
+			delete(m.remote, origin)
+		}
+	}
+}
+
+// remotelyConnected reports whether a replica that published recently has a
+// socket of userID; the caller holds m.mu
+func (m *Manager) remotelyConnected(userID uuid.UUID, now time.Time) bool {
+	for _, replica := range m.remote {
+		if now.Sub(replica.seenAt) > presenceTTL {
+			continue
+		}
+		if _, ok := replica.users[userID]; ok {
+			return true
+		}
+	}
+	return false
+}
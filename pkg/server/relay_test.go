@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ride-hail/pkg/mq"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newReplica starts a manager relaying through broker and serving sockets
+func newReplica(t *testing.T, broker mq.Broker) (*Manager, string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := NewManager(DefaultManagerConfig())
+	manager.StartWrite(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- manager.RunRelay(ctx, NewBrokerRelay(broker, "test-service")) }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.ServeWS(w, r, testAuth)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Unexpected relay error: %v", err)
+		}
+		manager.Shutdown()
+	})
+	return manager, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func newTestBroker(t *testing.T) *mq.MemoryBroker {
+	t.Helper()
+	broker := mq.NewMemoryBroker()
+	if err := mq.DefaultTopology().Apply(broker); err != nil {
+		t.Fatalf("Unexpected topology error: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func expectFrame(t *testing.T, conn *websocket.Conn, payload string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Expected %s, got %v", payload, err)
+	}
+	if string(data) != payload {
+		t.Errorf("Expected %s, got %s", payload, data)
+	}
+}
+
+func TestManager_WritesToEverySocketOfUser(t *testing.T) {
+	manager, url := newTestServer(t)
+	manager.StartWrite(context.Background())
+	header := http.Header{"Authorization": {"Bearer valid"}}
+	first, second := dial(t, url, header), dial(t, url, header)
+	waitFor(t, "both sockets", func() bool { return manager.Connections(testUserID) == 2 })
+
+	manager.WriteChannel() <- ResponseWs{Payload: []byte(`{"type":"ride_status_update"}`), ConsumerID: testUserID}
+	expectFrame(t, first, `{"seq":1,"stream":"replica-1","type":"ride_status_update"}`)
+	expectFrame(t, second, `{"seq":1,"stream":"replica-1","type":"ride_status_update"}`)
+
+	first.Close()
+	waitFor(t, "the closed socket to leave", func() bool { return manager.Connections(testUserID) == 1 })
+	if !manager.Connected(testUserID) {
+		t.Error("Expected the user to stay connected through the second socket")
+	}
+}
+
+func TestManager_RelaysFramesToOtherReplicas(t *testing.T) {
+	broker := newTestBroker(t)
+	sender, _ := newReplica(t, broker)
+	holder, url := newReplica(t, broker)
+
+	conn := dial(t, url, http.Header{"Authorization": {"Bearer valid"}})
+	waitFor(t, "presence from the other replica", func() bool { return sender.Connected(testUserID) })
+	if sender.Connections(testUserID) != 0 || holder.Connections(testUserID) != 1 {
+		t.Fatalf("Expected the socket on the holder only")
+	}
+	if sender.Connected(otherID) {
+		t.Error("Expected an unconnected user to be reported as such")
+	}
+
+	sender.WriteChannel() <- ResponseWs{Payload: []byte(`{"type":"ride_offer"}`), ConsumerID: testUserID}
+	expectFrame(t, conn, `{"seq":1,"stream":"`+holder.instanceID+`","type":"ride_offer"}`)
+
+	conn.Close()
+	waitFor(t, "the disconnect to reach the other replica", func() bool { return !sender.Connected(testUserID) })
+}
+
+func TestManager_RouteDropsFramesWhenRelayIsBehind(t *testing.T) {
+	manager := NewManager(DefaultManagerConfig())
+	manager.relayFrames = make(chan mq.Event, 1)
+	manager.updatePresence(mq.SocketPresenceMessage{Origin: "other", Users: []string{testUserID.String()}}, time.Now())
+
+	routed := make(chan struct{})
+	go func() {
+		defer close(routed)
+		for range 3 {
+			manager.route(ResponseWs{Payload: []byte(`{"type":"ride_offer"}`), ConsumerID: testUserID})
+		}
+	}()
+	select {
+	case <-routed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected route not to wait for the broker")
+	}
+	if len(manager.relayFrames) != 1 {
+		t.Errorf("Expected the first frame queued and the rest dropped, got %d queued", len(manager.relayFrames))
+	}
+}
+
+func TestManager_ForwardsRequestsToReplica(t *testing.T) {
+	broker := newTestBroker(t)
+	offering, _ := newReplica(t, broker)
+	holder, url := newReplica(t, broker)
+
+	// the answer belongs to the offering replica, wherever the socket is
+	handled := make(chan string, 1)
+	newRouter := func(m *Manager) *Router {
+		router := NewRouter()
+		Handle(router, "answer", func(ctx context.Context, request Request, message testMessage) (any, error) {
+			if m != offering {
+				if err := m.Forward(offering.InstanceID(), request); err != nil {
+					return nil, err
+				}
+				return nil, ErrForwarded
+			}
+			handled <- message.RideID
+			return nil, nil
+		})
+		return router
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go newRouter(offering).Run(ctx, offering)
+	go newRouter(holder).Run(ctx, holder)
+
+	conn := dial(t, url, http.Header{"Authorization": {"Bearer valid"}})
+	waitFor(t, "presence from the holder", func() bool { return offering.Connected(testUserID) })
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"answer","request_id":"r1","ride_id":"ride-1","accepted":false}`)); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	select {
+	case rideID := <-handled:
+		if rideID != "ride-1" {
+			t.Errorf("Expected ride-1 to be handled, got %s", rideID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the offering replica to handle the frame")
+	}
+
+	// the ack comes back through the relay, numbered in the holder's stream
+	expectFrame(t, conn, `{"seq":1,"stream":"`+holder.instanceID+`","type":"ack","for":"answer","request_id":"r1"}`)
+}
+
+func TestManager_ForwardWithoutRelay(t *testing.T) {
+	manager := NewManager(DefaultManagerConfig())
+	if err := manager.Forward("other", Request{UserID: testUserID}); !errors.Is(err, ErrRelayUnavailable) {
+		t.Errorf("Expected ErrRelayUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime/debug"
+	"sync"
+
+	"ride-hail/pkg/uuid"
+)
+
+const (
+	MessageTypeAck   = "ack"
+	MessageTypeError = "error"
+	MessageTypePing  = "ping"
+	MessageTypePong  = "pong"
+)
+
+// Error codes the Router answers with itself; handlers add their own
+const (
+	ErrorCodeInvalidMessage  = "INVALID_MESSAGE"
+	ErrorCodeUnsupportedType = "UNSUPPORTED_TYPE"
+	ErrorCodeMessageTooLarge = "MESSAGE_TOO_LARGE"
+	ErrorCodeTooManyMessages = "TOO_MANY_MESSAGES"
+	ErrorCodeInternal        = "INTERNAL_ERROR"
+)
+
+// DefaultReadLimit is the size limit of a message type registered without
+// WithReadLimit
+const DefaultReadLimit = 512
+
+// Request is an inbound frame routed to a handler
+type Request struct {
+	Payload   []byte
+	Type      string
+	RequestID string // set by the client to correlate the ack or error
+	UserID    uuid.UUID
+}
+
+// Error is a handler error sent back as an error frame. Fields are added to
+// the frame, e.g. the ride_id the error is about
+type Error struct {
+	Fields  map[string]string
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// AckMessage answers a handled frame that carried a request_id, or whose
+// handler returned data
+type AckMessage struct {
+	Data      any    `json:"data,omitempty"`
+	Type      string `json:"type"`
+	For       string `json:"for"` // the type of the acknowledged frame
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PongMessage answers a ping frame, for clients that cannot send websocket
+// pings, e.g. browsers
+type PongMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// HandlerFunc handles a decoded and validated message of type T. The returned
+// data, if any, is sent back in the ack
+type HandlerFunc[T any] func(ctx context.Context, request Request, message T) (any, error)
+
+type route struct {
+	handle    func(ctx context.Context, request Request) (any, error)
+	readLimit int64
+}
+
+type RouteOption func(*route)
+
+// WithReadLimit sets the largest frame accepted for the message type, in bytes
+func WithReadLimit(limit int64) RouteOption {
+	return func(r *route) {
+		r.readLimit = limit
+	}
+}
+
+// Router dispatches the inbound frames of a Manager to handlers registered by
+// message type with Handle. Every frame gets at most one reply, written to the
+// socket it came from, or by the replica a handler forwarded it to
+type Router struct {
+	routes map[string]route
+}
+
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]route)}
+}
+
+// Handle registers handler for frames of messageType. Frames are checked
+// against the JSON shape of T before they are decoded: fields without
+// omitempty are required, types must match and unknown fields are rejected.
+// If *T has a Validate() error method, it runs next
+func Handle[T any](r *Router, messageType string, handler HandlerFunc[T], options ...RouteOption) {
+	schema := schemaOf(reflect.TypeFor[T]())
+	rt := route{
+		readLimit: DefaultReadLimit,
+		handle: func(ctx context.Context, request Request) (any, error) {
+			if err := schema.validate(request.Payload); err != nil {
+				return nil, &Error{Code: ErrorCodeInvalidMessage, Message: err.Error()}
+			}
+
+			var message T
+			if err := json.Unmarshal(request.Payload, &message); err != nil {
+				return nil, &Error{Code: ErrorCodeInvalidMessage, Message: fmt.Sprintf("invalid %s payload", messageType)}
+			}
+			if v, ok := any(&message).(interface{ Validate() error }); ok {
+				if err := v.Validate(); err != nil {
+					return nil, &Error{Code: ErrorCodeInvalidMessage, Message: err.Error()}
+				}
+			}
+			return handler(ctx, request, message)
+		},
+	}
+	for _, option := range options {
+		option(&rt)
+	}
+	r.routes[messageType] = rt
+}
+
+// readLimit is the largest frame any route accepts, the limit of the sockets
+func (r *Router) readLimit() int64 {
+	limit := int64(DefaultReadLimit)
+	for _, rt := range r.routes {
+		limit = max(limit, rt.readLimit)
+	}
+	return limit
+}
+
+// maxPendingFrames is how many frames of one user may wait for their handler;
+// further frames are answered with a TOO_MANY_MESSAGES error
+const maxPendingFrames = 32
+
+// Run dispatches m's inbound frames until ctx is done or m shuts down. Each
+// user's frames are handled in order by a worker of their own, so a slow
+// handler only holds up the user it is serving. Run returns once the workers
+// have finished the frames they hold
+func (r *Router) Run(ctx context.Context, m *Manager) {
+	m.readLimit.Store(r.readLimit())
+	queues := newUserQueues()
+	var workers sync.WaitGroup
+	defer workers.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request, ok := <-m.ReadChannel():
+			if !ok {
+				return
+			}
+			start, queued := queues.push(request)
+			if !queued {
+				r.reply(m, request, errorFrame("", &Error{
+					Code:    ErrorCodeTooManyMessages,
+					Message: "too many messages awaiting processing",
+				}))
+				continue
+			}
+			if start {
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					r.work(ctx, m, queues, request.ProducerID)
+				}()
+			}
+		}
+	}
+}
+
+// work serves userID's frames until their queue runs dry
+func (r *Router) work(ctx context.Context, m *Manager, queues *userQueues, userID uuid.UUID) {
+	for {
+		request, ok := queues.next(userID)
+		if !ok {
+			return
+		}
+		if reply := r.serve(ctx, request.ProducerID, request.Payload); reply != nil {
+			r.reply(m, request, reply)
+		}
+	}
+}
+
+func (r *Router) reply(m *Manager, request RequestWs, reply any) {
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		slog.Error("Failed to marshal websocket reply", "client_id", request.ProducerID.String(), "error", err)
+		return
+	}
+	m.reply(request, payload)
+}
+
+// userQueues holds the frames waiting for each user's worker. A user has a
+// worker exactly while they have an entry
+type userQueues struct {
+	pending map[uuid.UUID][]RequestWs
+	mu      sync.Mutex
+}
+
+func newUserQueues() *userQueues {
+	return &userQueues{pending: make(map[uuid.UUID][]RequestWs)}
+}
+
+// push queues request for its user, reporting whether a worker must be
+// started for them and false for queued when the user has too many frames waiting
+func (q *userQueues) push(request RequestWs) (start, queued bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	frames, running := q.pending[request.ProducerID]
+	if len(frames) >= maxPendingFrames {
+		return false, false
+	}
+	q.pending[request.ProducerID] = append(frames, request)
+	return !running, true
+}
+
+// next pops userID's oldest frame. When none is left the entry is removed and
+// the worker must stop
+func (q *userQueues) next(userID uuid.UUID) (RequestWs, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	frames := q.pending[userID]
+	if len(frames) == 0 {
+		delete(q.pending, userID)
+		return RequestWs{}, false
+	}
+	request := frames[0]
+	frames[0] = RequestWs{}
+	q.pending[userID] = frames[1:]
+	return request, true
+}
+
+// serve routes one frame and returns the reply to send, if any
+func (r *Router) serve(ctx context.Context, userID uuid.UUID, payload []byte) any {
+	var envelope struct {
+		Type      string `json:"type"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil || envelope.Type == "" {
+		return errorFrame("", &Error{
+			Code:    ErrorCodeInvalidMessage,
+			Message: "message must be a JSON object with a type field",
+		})
+	}
+	if envelope.Type == MessageTypePing {
+		return PongMessage{Type: MessageTypePong, RequestID: envelope.RequestID}
+	}
+
+	rt, ok := r.routes[envelope.Type]
+	if !ok {
+		return errorFrame(envelope.RequestID, &Error{
+			Code:    ErrorCodeUnsupportedType,
+			Message: "unsupported message type: " + envelope.Type,
+		})
+	}
+	if int64(len(payload)) > rt.readLimit {
+		return errorFrame(envelope.RequestID, &Error{
+			Code:    ErrorCodeMessageTooLarge,
+			Message: fmt.Sprintf("%s messages are limited to %d bytes", envelope.Type, rt.readLimit),
+		})
+	}
+
+	request := Request{
+		Payload:   payload,
+		Type:      envelope.Type,
+		RequestID: envelope.RequestID,
+		UserID:    userID,
+	}
+	data, err := handleSafely(ctx, rt, request)
+	if errors.Is(err, ErrForwarded) {
+		return nil
+	}
+	if err != nil {
+		var handlerErr *Error
+		if !errors.As(err, &handlerErr) {
+			slog.Error("WebSocket handler failed", "client_id", userID.String(), "type", request.Type, "error", err)
+			handlerErr = &Error{Code: ErrorCodeInternal, Message: "failed to process " + request.Type}
+		}
+		return errorFrame(request.RequestID, handlerErr)
+	}
+
+	if data == nil && request.RequestID == "" {
+		return nil
+	}
+	return AckMessage{Data: data, Type: MessageTypeAck, For: request.Type, RequestID: request.RequestID}
+}
+
+// handleSafely turns a handler panic into an error, so one bad frame does not
+// stop the router
+func handleSafely(ctx context.Context, rt route, request Request) (data any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("WebSocket handler panicked", "type", request.Type, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return rt.handle(ctx, request)
+}
+
+func errorFrame(requestID string, err *Error) map[string]any {
+	frame := make(map[string]any, len(err.Fields)+4)
+	for key, value := range err.Fields {
+		frame[key] = value
+	}
+	frame["type"] = MessageTypeError
+	frame["code"] = err.Code
+	frame["message"] = err.Message
+	if requestID != "" {
+		frame["request_id"] = requestID
+	}
+	return frame
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ride-hail/pkg/uuid"
+)
+
+type testLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type testMessage struct {
+	Location *testLocation `json:"location,omitempty"`
+	Type     string        `json:"type"`
+	RideID   string        `json:"ride_id"`
+	Reason   string        `json:"reason,omitempty"`
+	Accepted bool          `json:"accepted"`
+}
+
+func (m *testMessage) Validate() error {
+	if m.Accepted && m.Location == nil {
+		return errors.New("location is required when accepting")
+	}
+	return nil
+}
+
+func newTestRouter() *Router {
+	router := NewRouter()
+	Handle(router, "answer", func(ctx context.Context, request Request, message testMessage) (any, error) {
+		switch message.Reason {
+		case "taken":
+			return nil, &Error{Code: "OFFER_EXPIRED", Message: "offer expired", Fields: map[string]string{"ride_id": message.RideID}}
+		case "broken":
+			return nil, errors.New("database unavailable")
+		case "panic":
+			var location *testLocation
+			return location.Latitude, nil
+		case "echo":
+			return map[string]string{"user_id": request.UserID.String()}, nil
+		}
+		return nil, nil
+	}, WithReadLimit(2048))
+	return router
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s := schemaOf(reflect.TypeFor[testMessage]())
+
+	if err := s.validate([]byte(`{"type":"answer","request_id":"r1","ride_id":"ride-1","accepted":false}`)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err := s.validate([]byte(`{"type":"answer","accepted":"yes","location":{"latitude":"43.2"},"speed":3}`))
+	want := "unknown field speed; location.latitude must be a number; location.longitude is required; ride_id is required; accepted must be a boolean"
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected %q, got %v", want, err)
+	}
+
+	if err := s.validate([]byte(`[1,2]`)); err == nil || err.Error() != "message must be an object" {
+		t.Errorf("Expected a non-object to be rejected, got %v", err)
+	}
+}
+
+func TestRouter_Replies(t *testing.T) {
+	router := newTestRouter()
+	tests := []struct {
+		name    string
+		payload string
+		reply   string
+	}{
+		{"ping", `{"type":"ping","request_id":"r1"}`, `{"type":"pong","request_id":"r1"}`},
+		{"not json", `hello`, `{"code":"INVALID_MESSAGE","message":"message must be a JSON object with a type field","type":"error"}`},
+		{"unknown type", `{"type":"dance","request_id":"r2"}`, `{"code":"UNSUPPORTED_TYPE","message":"unsupported message type: dance","request_id":"r2","type":"error"}`},
+		{"invalid", `{"type":"answer","request_id":"r3","ride_id":"ride-1","accepted":true}`, `{"code":"INVALID_MESSAGE","message":"location is required when accepting","request_id":"r3","type":"error"}`},
+		{"handler error", `{"type":"answer","ride_id":"ride-1","accepted":false,"reason":"taken"}`, `{"code":"OFFER_EXPIRED","message":"offer expired","ride_id":"ride-1","type":"error"}`},
+		{"failure", `{"type":"answer","ride_id":"ride-1","accepted":false,"reason":"broken"}`, `{"code":"INTERNAL_ERROR","message":"failed to process answer","type":"error"}`},
+		{"panic", `{"type":"answer","ride_id":"ride-1","accepted":false,"reason":"panic"}`, `{"code":"INTERNAL_ERROR","message":"failed to process answer","type":"error"}`},
+		{"no reply", `{"type":"answer","ride_id":"ride-1","accepted":false}`, `null`},
+		{"ack", `{"type":"answer","request_id":"r4","ride_id":"ride-1","accepted":false}`, `{"type":"ack","for":"answer","request_id":"r4"}`},
+		{"ack with data", `{"type":"answer","ride_id":"ride-1","accepted":false,"reason":"echo"}`, `{"data":{"user_id":"` + testUserID.String() + `"},"type":"ack","for":"answer"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := json.Marshal(router.serve(context.Background(), testUserID, []byte(tt.payload)))
+			if err != nil {
+				t.Fatalf("Unexpected marshal error: %v", err)
+			}
+			if string(reply) != tt.reply {
+				t.Errorf("Expected %s, got %s", tt.reply, reply)
+			}
+		})
+	}
+}
+
+func TestRouter_EnforcesReadLimitPerType(t *testing.T) {
+	router := newTestRouter()
+	Handle(router, "note", func(ctx context.Context, request Request, message struct{ Text string }) (any, error) {
+		return nil, nil
+	})
+	if limit := router.readLimit(); limit != 2048 {
+		t.Errorf("Expected the sockets to accept the largest route limit, got %d", limit)
+	}
+
+	text := strings.Repeat("a", 600)
+	reply, _ := json.Marshal(router.serve(context.Background(), testUserID, []byte(`{"type":"note","Text":"`+text+`"}`)))
+	if want := `{"code":"MESSAGE_TOO_LARGE","message":"note messages are limited to 512 bytes","type":"error"}`; string(reply) != want {
+		t.Errorf("Expected %s, got %s", want, reply)
+	}
+
+	answer := `{"type":"answer","request_id":"r1","ride_id":"ride-1","accepted":false,"reason":"` + text + `"}`
+	reply, _ = json.Marshal(router.serve(context.Background(), testUserID, []byte(answer)))
+	if want := `{"type":"ack","for":"answer","request_id":"r1"}`; string(reply) != want {
+		t.Errorf("Expected %s, got %s", want, reply)
+	}
+}
+
+func TestRouter_RepliesOnlyToTheSendingSocket(t *testing.T) {
+	manager, url := newTestServer(t)
+	manager.StartWrite(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go newTestRouter().Run(ctx, manager)
+	waitFor(t, "the router's read limit", func() bool { return manager.readLimit.Load() == 2048 })
+
+	header := http.Header{"Authorization": {"Bearer valid"}}
+	sender, other := dial(t, url, header), dial(t, url, header)
+	waitFor(t, "both sockets", func() bool { return manager.Connections(testUserID) == 2 })
+
+	// larger than DefaultReadLimit, within the route's
+	answer := `{"type":"answer","request_id":"r1","ride_id":"ride-1","accepted":false,"reason":"` + strings.Repeat("a", 600) + `"}`
+	if err := sender.WriteMessage(websocket.TextMessage, []byte(answer)); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	expectFrame(t, sender, `{"type":"ack","for":"answer","request_id":"r1"}`)
+
+	other.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("Expected no reply on the other socket, got %s", data)
+	}
+}
+
+func TestRouter_SlowUserDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 4)
+	router := NewRouter()
+	Handle(router, "answer", func(ctx context.Context, request Request, message testMessage) (any, error) {
+		if request.UserID == testUserID {
+			<-release
+		}
+		handled <- request.UserID.String() + ":" + message.RideID
+		return nil, nil
+	})
+
+	manager := NewManager(DefaultManagerConfig())
+	t.Cleanup(manager.Shutdown)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		router.Run(ctx, manager)
+		close(done)
+	}()
+
+	send := func(userID uuid.UUID, rideID string) {
+		manager.read <- RequestWs{ProducerID: userID, Payload: []byte(`{"type":"answer","ride_id":"` + rideID + `","accepted":false}`)}
+	}
+	send(testUserID, "ride-1")
+	send(testUserID, "ride-2")
+	send(otherID, "ride-3")
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Errorf("Expected %s to be handled, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected %s to be handled", want)
+		}
+	}
+	expect(otherID.String() + ":ride-3")
+
+	close(release)
+	expect(testUserID.String() + ":ride-1")
+	expect(testUserID.String() + ":ride-2")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Run to return once its workers finished")
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+type jsonKind string
+
+const (
+	kindAny    jsonKind = "any"
+	kindString jsonKind = "string"
+	kindNumber jsonKind = "number"
+	kindBool   jsonKind = "boolean"
+	kindObject jsonKind = "object"
+	kindArray  jsonKind = "array"
+)
+
+// envelopeFields may appear on any frame whether or not its type declares them
+var envelopeFields = []string{"type", "request_id"}
+
+var (
+	textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+	jsonUnmarshaler = reflect.TypeFor[json.Unmarshaler]()
+)
+
+// schema is the JSON shape of a struct: its fields in order, their kinds and
+// whether they are required. A nil schema accepts any object, e.g. for maps
+type schema struct {
+	fields []schemaField
+}
+
+type schemaField struct {
+	object   *schema // fields of a struct valued field
+	name     string
+	kind     jsonKind
+	required bool
+}
+
+func schemaOf(t reflect.Type) *schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	s := &schema{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			if embedded := schemaOf(f.Type); embedded != nil {
+				s.fields = append(s.fields, embedded.fields...)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := schemaField{
+			name:     name,
+			required: f.Type.Kind() != reflect.Pointer && !slices.Contains(strings.Split(opts, ","), "omitempty"),
+		}
+		field.kind, field.object = kindOf(f.Type)
+		s.fields = append(s.fields, field)
+	}
+	return s
+}
+
+func kindOf(t reflect.Type) (jsonKind, *schema) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch ptr := reflect.PointerTo(t); {
+	case ptr.Implements(jsonUnmarshaler):
+		return kindAny, nil
+	case ptr.Implements(textUnmarshaler):
+		return kindString, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return kindString, nil
+	case reflect.Bool:
+		return kindBool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return kindNumber, nil
+	case reflect.Struct:
+		return kindObject, schemaOf(t)
+	case reflect.Map:
+		return kindObject, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return kindString, nil // base64
+		}
+		return kindArray, nil
+	case reflect.Array:
+		return kindArray, nil
+	default:
+		return kindAny, nil
+	}
+}
+
+// validate reports every problem of data against s, joined by "; "
+func (s *schema) validate(data []byte) error {
+	var problems []string
+	s.check(data, "", &problems)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (s *schema) check(data []byte, path string, problems *[]string) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		*problems = append(*problems, describe(path, "must be an object"))
+		return
+	}
+	if s == nil {
+		return
+	}
+
+	var unknown []string
+	for name := range object {
+		known := slices.ContainsFunc(s.fields, func(f schemaField) bool { return f.name == name })
+		if !known && (path != "" || !slices.Contains(envelopeFields, name)) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		*problems = append(*problems, "unknown field "+path+name)
+	}
+
+	for _, f := range s.fields {
+		value, ok := object[f.name]
+		if !ok || bytes.Equal(value, []byte("null")) {
+			if f.required {
+				*problems = append(*problems, path+f.name+" is required")
+			}
+			continue
+		}
+		if !f.kind.matches(value) {
+			*problems = append(*problems, fmt.Sprintf("%s%s must be %s", path, f.name, article(f.kind)))
+			continue
+		}
+		if f.object != nil {
+			f.object.check(value, path+f.name+".", problems)
+		}
+	}
+}
+
+func (k jsonKind) matches(value json.RawMessage) bool {
+	if k == kindAny {
+		return true
+	}
+	switch value[0] {
+	case '"':
+		return k == kindString
+	case '{':
+		return k == kindObject
+	case '[':
+		return k == kindArray
+	case 't', 'f':
+		return k == kindBool
+	default:
+		return k == kindNumber
+	}
+}
+
+func article(k jsonKind) string {
+	if k == kindArray || k == kindObject {
+		return "an " + string(k)
+	}
+	return "a " + string(k)
+}
+
+func describe(path, problem string) string {
+	if path == "" {
+		return "message " + problem
+	}
+	return strings.TrimSuffix(path, ".") + " " + problem
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ride-hail/pkg/uuid"
+)
+
+// sseHeartbeat keeps idle streams from being cut by proxies
+var sseHeartbeat = 15 * time.Second
+
+// Subscription receives the frames of a user like one of the user's sockets
+// does, sequenced and replayed the same way, for transports other than
+// websockets. It counts as a socket of the user until closed
+type Subscription struct {
+	client *Client
+}
+
+// Subscribe opens a Subscription for userID. With cursor, Replay returns the
+// frames after it, or a resync frame if some are gone
+func (m *Manager) Subscribe(userID uuid.UUID, cursor *Cursor) *Subscription {
+	client := NewClient(userID, nil, m, m.config.OutboundBuffer)
+	m.addClient(client, cursor)
+	return &Subscription{client: client}
+}
+
+// Replay is the frames missed since the cursor given to Subscribe, to be sent
+// before any from Frames
+func (s *Subscription) Replay() [][]byte {
+	return s.client.replay
+}
+
+// Frames is closed when the manager drops the subscription, on shutdown or
+// when it falls behind under the Disconnect policy
+func (s *Subscription) Frames() <-chan []byte {
+	return s.client.outbound
+}
+
+func (s *Subscription) Close() {
+	s.client.close()
+}
+
+// ServeSSE streams the frames of userID that keep accepts as server-sent
+// events until the client goes away or the manager stops. The data of each
+// event is the frame the user's sockets get and its id is the frame's
+// <stream>:<seq>, so a Last-Event-ID header resumes the stream like last_seq
+// and stream resume a socket
+func (m *Manager) ServeSSE(w http.ResponseWriter, r *http.Request, userID uuid.UUID, keep func(frame []byte) bool) {
+	cursor, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// stops nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		slog.Error("Response writer cannot stream server-sent events", "client_id", userID.String(), "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	done := m.ctx.Done()
+	m.mu.Unlock()
+
+	subscription := m.Subscribe(userID, cursor)
+	defer subscription.Close()
+	slog.Info("Event stream established", "client_id", userID.String())
+
+	send := func(event []byte) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := w.Write(event); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	for _, frame := range subscription.Replay() {
+		if keep(frame) && !send(sseEvent(frame)) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-done:
+			return
+		case <-heartbeat.C:
+			if !send([]byte(": heartbeat\n\n")) {
+				return
+			}
+		case frame, ok := <-subscription.Frames():
+			if !ok {
+				return
+			}
+			if keep(frame) && !send(sseEvent(frame)) {
+				return
+			}
+		}
+	}
+}
+
+// sseEvent formats frame as an event with the frame's stream and seq as id
+func sseEvent(frame []byte) []byte {
+	var header struct {
+		Seq    *uint64 `json:"seq"`
+		Stream string  `json:"stream"`
+	}
+	_ = json.Unmarshal(frame, &header)
+
+	var event bytes.Buffer
+	if header.Seq != nil {
+		event.WriteString("id: " + header.Stream + ":" + strconv.FormatUint(*header.Seq, 10) + "\n")
+	}
+	for line := range bytes.SplitSeq(frame, []byte("\n")) {
+		event.WriteString("data: ")
+		event.Write(line)
+		event.WriteByte('\n')
+	}
+	event.WriteByte('\n')
+	return event.Bytes()
+}
+
+// lastEventID reads the Last-Event-ID header, falling back to ?last_seq and
+// ?stream for clients that cannot set headers
+func lastEventID(r *http.Request) (*Cursor, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		return queryCursor(r)
+	}
+	stream, seq, ok := strings.Cut(value, ":")
+	lastSeq, err := strconv.ParseUint(seq, 10, 64)
+	if !ok || err != nil {
+		return nil, errors.New("Last-Event-ID must be <stream>:<seq>")
+	}
+	return &Cursor{Stream: stream, Seq: lastSeq}, nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSSEServer streams testUserID's frames, except those marked "hidden"
+func newSSEServer(t *testing.T) (*Manager, string) {
+	t.Helper()
+	manager := NewManager(DefaultManagerConfig())
+	manager.instanceID = testStream
+	manager.StartWrite(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.ServeSSE(w, r, testUserID, func(frame []byte) bool {
+			return !bytes.Contains(frame, []byte("hidden"))
+		})
+	}))
+	t.Cleanup(func() {
+		manager.Shutdown()
+		srv.Close()
+	})
+	return manager, srv.URL
+}
+
+func openStream(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected request error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// expectEvent reads the next event, up to its blank line
+func expectEvent(t *testing.T, stream *bufio.Reader, event string) {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected %q, got %q and %v", event, strings.Join(lines, ""), err)
+		}
+		if line == "\n" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if got := strings.Join(lines, ""); got != event {
+		t.Errorf("Expected %q, got %q", event, got)
+	}
+}
+
+func TestServeSSE_StreamsFramesWithSeqAsID(t *testing.T) {
+	manager, url := newSSEServer(t)
+	stream := openStream(t, url, "")
+	waitFor(t, "the stream", func() bool { return manager.Connections(testUserID) == 1 })
+
+	manager.WriteChannel() <- ResponseWs{Payload: []byte(`{"type":"ride_status_update","ride_id":"hidden"}`), ConsumerID: testUserID}
+	manager.WriteChannel() <- ResponseWs{Payload: []byte(`{"type":"ride_status_update"}`), ConsumerID: testUserID}
+	expectEvent(t, stream, "id: replica-1:2\ndata: {\"seq\":2,\"stream\":\"replica-1\",\"type\":\"ride_status_update\"}\n")
+}
+
+func TestServeSSE_ResumesAfterLastEventID(t *testing.T) {
+	manager, url := newSSEServer(t)
+	for _, status := range []string{"MATCHED", "EN_ROUTE", "ARRIVED"} {
+		manager.WriteChannel() <- ResponseWs{Payload: []byte(`{"status":"` + status + `"}`), ConsumerID: testUserID}
+	}
+	waitFor(t, "the frames to be logged", func() bool {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		return manager.stream(testUserID).seq == 3
+	})
+
+	stream := openStream(t, url, "replica-1:1")
+	expectEvent(t, stream, "id: replica-1:2\ndata: {\"seq\":2,\"stream\":\"replica-1\",\"status\":\"EN_ROUTE\"}\n")
+	expectEvent(t, stream, "id: replica-1:3\ndata: {\"seq\":3,\"stream\":\"replica-1\",\"status\":\"ARRIVED\"}\n")
+
+	// an id another replica numbered says nothing about this replica's log
+	stream = openStream(t, url, "replica-2:3")
+	expectEvent(t, stream, "id: replica-1:3\ndata: {\"type\":\"resync\",\"last_seq\":3,\"seq\":3,\"stream\":\"replica-1\"}\n")
+}
+
+func TestServeSSE_SendsHeartbeats(t *testing.T) {
+	previous := sseHeartbeat
+	sseHeartbeat = 20 * time.Millisecond
+	defer func() { sseHeartbeat = previous }()
+
+	_, url := newSSEServer(t)
+	expectEvent(t, openStream(t, url, ""), ": heartbeat\n")
+}
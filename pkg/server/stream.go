@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// SlowConsumerPolicy is what a Manager does with a socket whose outbound
+// buffer is full
+type SlowConsumerPolicy string
+
+const (
+	// DropOldest discards the oldest queued frame; the client sees a gap in
+	// seq and can reconnect with last_seq and stream to get it back
+	DropOldest SlowConsumerPolicy = "drop_oldest"
+	// Disconnect closes the socket with CloseTryAgainLater
+	Disconnect SlowConsumerPolicy = "disconnect"
+)
+
+// ManagerConfig tunes a Manager's outbound buffering and replay log
+type ManagerConfig struct {
+	OutboundBuffer int // frames a socket may fall behind by
+	SlowConsumer   SlowConsumerPolicy
+	ReplayFrames   int           // frames kept per user for reconnects
+	ReplayWindow   time.Duration // how long they are kept
+}
+
+func DefaultManagerConfig() ManagerConfig {
+	return ManagerConfig{
+		OutboundBuffer: 64,
+		SlowConsumer:   DropOldest,
+		ReplayFrames:   100,
+		ReplayWindow:   2 * time.Minute,
+	}
+}
+
+// ResyncMessage is sent instead of a replay when the log no longer has every
+// frame after last_seq, e.g. after the replica restarted, or when last_seq was
+// numbered by another replica; the client should reload its state over HTTP
+// and resume from seq and stream
+type ResyncMessage struct {
+	Type    string `json:"type"`
+	LastSeq uint64 `json:"last_seq"`
+	Seq     uint64 `json:"seq"`
+	Stream  string `json:"stream"`
+}
+
+const MessageTypeResync = "resync"
+
+// Cursor is where a client resumes: the seq of the last frame it got and the
+// stream that numbered it. Each replica numbers the frames of its sockets
+// itself, so a seq means nothing to another replica
+type Cursor struct {
+	Stream string
+	Seq    uint64
+}
+
+type sequencedFrame struct {
+	seq     uint64
+	payload []byte
+	at      time.Time
+}
+
+// stream numbers the frames written for one user on this replica and keeps
+// the recent ones, so a client reconnecting with last_seq gets what it missed.
+// Frames carry the stream's id next to their seq
+type stream struct {
+	id     string
+	seq    uint64
+	frames []sequencedFrame // oldest first
+}
+
+// append numbers payload and logs it, dropping frames past the config's limits
+func (s *stream) append(payload []byte, now time.Time, config ManagerConfig) []byte {
+	s.seq++
+	framed := withSeq(payload, s.id, s.seq)
+
+	s.frames = append(s.frames, sequencedFrame{seq: s.seq, payload: framed, at: now})
+	s.prune(now, config)
+	return framed
+}
+
+func (s *stream) prune(now time.Time, config ManagerConfig) {
+	drop := max(len(s.frames)-config.ReplayFrames, 0)
+	for drop < len(s.frames) && now.Sub(s.frames[drop].at) > config.ReplayWindow {
+		drop++
+	}
+	s.frames = s.frames[drop:]
+}
+
+// since returns the frames after cursor, or false if some are gone or cursor
+// belongs to another stream
+func (s *stream) since(cursor Cursor) ([][]byte, bool) {
+	if cursor.Stream != s.id || cursor.Seq > s.seq {
+		return nil, false
+	}
+	if cursor.Seq == s.seq {
+		return nil, true
+	}
+	if len(s.frames) == 0 || s.frames[0].seq > cursor.Seq+1 {
+		return nil, false
+	}
+
+	var frames [][]byte
+	for _, frame := range s.frames {
+		if frame.seq > cursor.Seq {
+			frames = append(frames, frame.payload)
+		}
+	}
+	return frames, true
+}
+
+// withSeq adds "seq" and "stream" to a JSON object frame; other frames are
+// left as they are
+func withSeq(payload []byte, streamID string, seq uint64) []byte {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) < 2 || trimmed[0] != '{' || !json.Valid(trimmed) {
+		return payload
+	}
+	quoted, _ := json.Marshal(streamID)
+
+	rest := bytes.TrimSpace(trimmed[1:])
+	framed := make([]byte, 0, len(trimmed)+len(quoted)+32)
+	framed = append(framed, `{"seq":`...)
+	framed = strconv.AppendUint(framed, seq, 10)
+	framed = append(framed, `,"stream":`...)
+	framed = append(framed, quoted...)
+	if rest[0] != '}' {
+		framed = append(framed, ',')
+	}
+	return append(framed, rest...)
+}
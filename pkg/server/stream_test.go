@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWithSeq(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`{"type":"ride_status_update"}`, `{"seq":7,"stream":"replica-1","type":"ride_status_update"}`},
+		{` { "type": "ping" } `, `{"seq":7,"stream":"replica-1","type": "ping" }`},
+		{`{}`, `{"seq":7,"stream":"replica-1"}`},
+		{`["not","an","object"]`, `["not","an","object"]`},
+		{`{"broken":`, `{"broken":`},
+	}
+	for _, tt := range tests {
+		if got := string(withSeq([]byte(tt.payload), testStream, 7)); got != tt.want {
+			t.Errorf("withSeq(%s) = %s, want %s", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestStream_Since(t *testing.T) {
+	config := ManagerConfig{ReplayFrames: 3, ReplayWindow: time.Minute}
+	now := time.Now()
+	s := &stream{id: testStream}
+	for i := 1; i <= 5; i++ {
+		s.append([]byte(fmt.Sprintf(`{"n":%d}`, i)), now, config)
+	}
+
+	frames, ok := s.since(Cursor{Stream: testStream, Seq: 3})
+	if !ok || len(frames) != 2 || string(frames[0]) != `{"seq":4,"stream":"replica-1","n":4}` {
+		t.Errorf("Expected frames 4 and 5, got %q (%v)", frames, ok)
+	}
+	if frames, ok := s.since(Cursor{Stream: testStream, Seq: 5}); !ok || len(frames) != 0 {
+		t.Errorf("Expected nothing to replay for the latest seq, got %q (%v)", frames, ok)
+	}
+	if _, ok := s.since(Cursor{Stream: testStream, Seq: 1}); ok {
+		t.Error("Expected frame 2 to be gone, only 3 frames are kept")
+	}
+	if _, ok := s.since(Cursor{Stream: testStream, Seq: 9}); ok {
+		t.Error("Expected a last_seq ahead of the stream to need a resync")
+	}
+	for _, other := range []string{"replica-2", ""} {
+		if _, ok := s.since(Cursor{Stream: other, Seq: 5}); ok {
+			t.Errorf("Expected a last_seq of stream %q to need a resync", other)
+		}
+	}
+
+	s.prune(now.Add(2*time.Minute), config)
+	if _, ok := s.since(Cursor{Stream: testStream, Seq: 4}); ok {
+		t.Error("Expected frames past the replay window to be gone")
+	}
+}
+
+func TestClient_Enqueue(t *testing.T) {
+	client := &Client{outbound: make(chan []byte, 2)}
+	for _, frame := range []string{"1", "2", "3"} {
+		if !client.enqueue([]byte(frame), DropOldest) {
+			t.Fatalf("Expected DropOldest to make room for %s", frame)
+		}
+	}
+	if first := <-client.outbound; string(first) != "2" {
+		t.Errorf("Expected the oldest frame dropped, got %s first", first)
+	}
+
+	client = &Client{outbound: make(chan []byte, 1)}
+	client.enqueue([]byte("1"), Disconnect)
+	if client.enqueue([]byte("2"), Disconnect) {
+		t.Error("Expected Disconnect to refuse a frame for a full buffer")
+	}
+}
+
+func TestManager_ReplaysMissedFramesOnReconnect(t *testing.T) {
+	manager, url := newTestServer(t)
+	manager.StartWrite(context.Background())
+	write := func(n int) {
+		manager.WriteChannel() <- ResponseWs{Payload: []byte(fmt.Sprintf(`{"n":%d}`, n)), ConsumerID: testUserID}
+	}
+	header := http.Header{"Authorization": {"Bearer valid"}}
+
+	conn := dial(t, url, header)
+	waitFor(t, "the socket", func() bool { return manager.Connections(testUserID) == 1 })
+	write(1)
+	expectFrame(t, conn, `{"seq":1,"stream":"replica-1","n":1}`)
+	conn.Close()
+	waitFor(t, "the disconnect", func() bool { return manager.Connections(testUserID) == 0 })
+
+	// written while the user is offline
+	write(2)
+	write(3)
+	waitFor(t, "the offline frames to be logged", func() bool {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		return manager.streams[testUserID].seq == 3
+	})
+
+	conn = dial(t, url+"?last_seq=1&stream=replica-1", header)
+	expectFrame(t, conn, `{"seq":2,"stream":"replica-1","n":2}`)
+	expectFrame(t, conn, `{"seq":3,"stream":"replica-1","n":3}`)
+	write(4)
+	expectFrame(t, conn, `{"seq":4,"stream":"replica-1","n":4}`)
+
+	// the auth frame can carry last_seq and stream too
+	conn = dial(t, url, nil)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"auth","token":"Bearer valid","last_seq":3,"stream":"replica-1"}`)); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	expectFrame(t, conn, `{"seq":4,"stream":"replica-1","n":4}`)
+}
+
+func TestManager_AsksForResyncWhenReplayIsIncomplete(t *testing.T) {
+	_, url := newTestServer(t)
+	conn := dial(t, url+"?last_seq=42&stream=replica-1", http.Header{"Authorization": {"Bearer valid"}})
+	expectFrame(t, conn, `{"type":"resync","last_seq":42,"seq":0,"stream":"replica-1"}`)
+}
+
+func TestManager_AsksForResyncForAnotherReplicasSeq(t *testing.T) {
+	manager, url := newTestServer(t)
+	manager.StartWrite(context.Background())
+	manager.WriteChannel() <- ResponseWs{Payload: []byte(`{"n":1}`), ConsumerID: testUserID}
+	waitFor(t, "the frame to be logged", func() bool {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		return manager.stream(testUserID).seq == 1
+	})
+
+	// seq 1 of another replica is not this replica's frame 1, and without a
+	// stream there is no telling whose it is
+	header := http.Header{"Authorization": {"Bearer valid"}}
+	for _, query := range []string{"?last_seq=1&stream=replica-2", "?last_seq=1"} {
+		conn := dial(t, url+query, header)
+		expectFrame(t, conn, `{"type":"resync","last_seq":1,"seq":1,"stream":"replica-1"}`)
+	}
+}
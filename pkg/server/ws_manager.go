@@ -2,13 +2,18 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 
-	"ride-hail/internal/middleware"
+	"ride-hail/pkg/mq"
 	"ride-hail/pkg/uuid"
 )
 
@@ -18,59 +23,170 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
+// Manager holds the websockets of one replica. A user may have several open,
+// e.g. one per device, and each gets every frame written for the user. With
+// RunRelay, frames also reach the user's sockets on other replicas. Frames
+// carry a per-user "seq" and the "stream" of the replica that numbered it, and
+// a client reconnecting with both gets the frames it missed replayed first.
+// On another replica it gets a resync instead
 type Manager struct {
-	ctx          context.Context
-	clients      map[uuid.UUID]*Client
-	read         chan RequestWs
-	write        chan ResponseWs
-	cancel       context.CancelFunc
-	wg           sync.WaitGroup
-	shutdownOnce sync.Once
-	mu           sync.Mutex
+	ctx             context.Context
+	clients         map[uuid.UUID]map[*Client]struct{}
+	streams         map[uuid.UUID]*stream
+	remote          map[string]*replicaPresence // keyed by instance ID
+	relayFrames     chan mq.Event               // frames and forwarded requests, set while RunRelay runs
+	read            chan RequestWs
+	write           chan ResponseWs
+	presenceChanged chan struct{}
+	cancel          context.CancelFunc
+	instanceID      string
+	config          ManagerConfig
+	readLimit       atomic.Int64 // frame size limit of new sockets, see Router
+	wg              sync.WaitGroup
+	shutdownOnce    sync.Once
+	mu              sync.Mutex
 }
 
-func NewManager() *Manager {
+func NewManager(config ManagerConfig) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Manager{
-		clients: make(map[uuid.UUID]*Client),
-		wg:      sync.WaitGroup{},
-		read:    make(chan RequestWs),
-		write:   make(chan ResponseWs),
-		ctx:     ctx,
-		cancel:  cancel,
+	m := &Manager{
+		clients:         make(map[uuid.UUID]map[*Client]struct{}),
+		streams:         make(map[uuid.UUID]*stream),
+		remote:          make(map[string]*replicaPresence),
+		wg:              sync.WaitGroup{},
+		read:            make(chan RequestWs),
+		write:           make(chan ResponseWs),
+		presenceChanged: make(chan struct{}, 1),
+		instanceID:      uuid.New().String(),
+		config:          config,
+		ctx:             ctx,
+		cancel:          cancel,
 	}
+	m.readLimit.Store(DefaultReadLimit)
+	return m
 }
 
-func (m *Manager) addClient(c *Client) {
+// addClient registers c. With cursor, the frames after it are queued for c
+// ahead of any frame written from now on, or a resync if some are gone
+func (m *Manager) addClient(c *Client, cursor *Cursor) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.clients[c.id] = c
+
+	if cursor != nil {
+		s := m.stream(c.id)
+		frames, ok := s.since(*cursor)
+		if !ok {
+			slog.Info("Replay log does not cover last_seq, asking for resync", "client_id", c.id.String(), "last_seq", cursor.Seq, "stream", cursor.Stream, "seq", s.seq)
+			resync, _ := json.Marshal(ResyncMessage{Type: MessageTypeResync, LastSeq: cursor.Seq, Seq: s.seq, Stream: s.id})
+			frames = [][]byte{resync}
+		}
+		c.replay = frames
+	}
+
+	sockets, ok := m.clients[c.id]
+	if !ok {
+		sockets = make(map[*Client]struct{})
+		m.clients[c.id] = sockets
+	}
+	sockets[c] = struct{}{}
+	m.notifyPresence()
+}
+
+// stream returns the stream of userID; the caller holds m.mu
+func (m *Manager) stream(userID uuid.UUID) *stream {
+	s, ok := m.streams[userID]
+	if !ok {
+		s = &stream{id: m.instanceID}
+		m.streams[userID] = s
+	}
+	return s
 }
 
-func (m *Manager) removeClient(c uuid.UUID) {
+// pruneStreams forgets users without sockets whose log has expired
+func (m *Manager) pruneStreams(now time.Time) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.clients, c)
+
+	for userID, s := range m.streams {
+		s.prune(now, m.config)
+		if len(s.frames) == 0 && len(m.clients[userID]) == 0 {
+			delete(m.streams, userID)
+		}
+	}
 }
 
-func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (m *Manager) removeClient(c *Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sockets := m.clients[c.id]
+	delete(sockets, c)
+	if len(sockets) == 0 {
+		delete(m.clients, c.id)
+	}
+	m.notifyPresence()
+}
+
+// Connected reports whether userID has a socket open on this replica or, while
+// RunRelay runs, on any other
+func (m *Manager) Connected(userID uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.clients[userID]) > 0 || m.remotelyConnected(userID, time.Now())
+}
+
+// Connections is the number of sockets userID has open on this replica
+func (m *Manager) Connections(userID uuid.UUID) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.clients[userID])
+}
+
+// ServeWS upgrades r to a websocket owned by the user authenticate accepts.
+// A token in the Authorization header is checked before the upgrade, so a bad
+// one gets an HTTP error; without one the socket must authenticate with its
+// first frame and is closed with an auth close code otherwise
+func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request, authenticate Authenticate) {
+	cursor, err := queryCursor(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte("failed to upgrade connection"))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	claims, ok := middleware.GetUserFromContext(r.Context())
-	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		_, _ = w.Write([]byte("unauthorized"))
+	var userID uuid.UUID
+	header := r.Header.Get("Authorization")
+	if header != "" {
+		id, err := authenticateHeader(r, header, authenticate)
+		if err != nil {
+			http.Error(w, err.Error(), authStatus(err))
+			return
+		}
+		userID = id
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		slog.Warn("Failed to upgrade websocket connection", "error", err)
 		return
 	}
-	slog.Info("WebSocket connection established", "client_id", claims.UserID)
 
-	client := NewClient(claims.UserID, conn, m)
-	m.addClient(client)
+	if header == "" {
+		frame, err := authenticateFrame(conn, r, authenticate)
+		if err != nil {
+			slog.Warn("WebSocket authentication failed", "remote_addr", r.RemoteAddr, "error", err)
+			closeWithError(conn, authCloseCode(err), err)
+			return
+		}
+		userID = frame.userID
+		if frame.cursor != nil {
+			cursor = frame.cursor
+		}
+	}
+	slog.Info("WebSocket connection established", "client_id", userID.String())
+
+	client := NewClient(userID, conn, m, m.config.OutboundBuffer)
+	m.addClient(client, cursor)
 	m.wg.Add(3)
 	go func() {
 		defer m.wg.Done()
@@ -86,6 +202,7 @@ func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
 			m.read <- RequestWs{
 				Payload:    message,
 				ProducerID: client.id,
+				client:     client,
 			}
 		}
 	}()
@@ -99,6 +216,7 @@ type ResponseWs struct {
 type RequestWs struct {
 	Payload    []byte
 	ProducerID uuid.UUID
+	client     *Client // the socket the frame came from
 }
 
 func (m *Manager) StartWrite(ctx context.Context) {
@@ -113,31 +231,95 @@ func (m *Manager) StartWrite(ctx context.Context) {
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
+		sweep := time.NewTicker(m.config.ReplayWindow)
+		defer sweep.Stop()
 		for {
 			select {
 			case <-m.ctx.Done():
 				return
+			case now := <-sweep.C:
+				m.pruneStreams(now)
 			case message, ok := <-m.write:
 				if !ok {
 					return
 				}
-				m.mu.Lock()
-				client, exists := m.clients[message.ConsumerID]
-				m.mu.Unlock()
-				if exists {
-					select {
-					case client.outbound <- message.Payload:
-					default:
-						slog.Warn("Client outbound channel full", "client_id", message.ConsumerID)
-					}
-				} else {
-					slog.Warn("Client not found for message", "client_id", message.ConsumerID)
-				}
+				m.route(message)
 			}
 		}
 	}()
 }
 
+// route writes message to the user's sockets on this replica, and queues it
+// for RunRelay when the user has sockets on another. A full relay queue drops
+// the frame rather than hold up the writes to local sockets
+func (m *Manager) route(message ResponseWs) {
+	m.mu.Lock()
+	frames := m.relayFrames
+	remote := frames != nil && m.remotelyConnected(message.ConsumerID, time.Now())
+	local := len(m.clients[message.ConsumerID]) > 0
+	m.mu.Unlock()
+
+	// a user connected nowhere gets the frame logged here, for a reconnect
+	if local || !remote {
+		m.deliver(message.ConsumerID, message.Payload)
+	}
+	if remote {
+		frame := mq.SocketFrameMessage{
+			Origin:  m.instanceID,
+			UserID:  message.ConsumerID.String(),
+			Payload: message.Payload,
+		}
+		select {
+		case frames <- frame:
+		default:
+			slog.Warn("Relay queue full, dropping websocket frame", "client_id", message.ConsumerID.String())
+		}
+	}
+}
+
+// deliver numbers payload in the user's stream and queues it on every socket
+// of the user on this replica. Sockets that cannot keep up under the
+// Disconnect policy are closed
+func (m *Manager) deliver(userID uuid.UUID, payload []byte) {
+	m.mu.Lock()
+	framed := m.stream(userID).append(payload, time.Now(), m.config)
+
+	var slow []*Client
+	for client := range m.clients[userID] {
+		if !client.enqueue(framed, m.config.SlowConsumer) {
+			slow = append(slow, client)
+		}
+	}
+	m.mu.Unlock()
+
+	// close takes m.mu to remove the client
+	for _, client := range slow {
+		slog.Warn("Disconnecting slow websocket client", "client_id", userID.String())
+		client.disconnect(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+// reply queues payload on the socket request came from only. Replies are not
+// sequenced or logged for replay, they answer a frame of that socket. Replies
+// to a forwarded frame go to the user's sockets wherever they are
+func (m *Manager) reply(request RequestWs, payload []byte) {
+	client := request.client
+	// a frame forwarded by another replica came from a socket held there
+	if client == nil {
+		m.route(ResponseWs{Payload: payload, ConsumerID: request.ProducerID})
+		return
+	}
+	m.mu.Lock()
+	_, open := m.clients[request.ProducerID][client]
+	queued := !open || client.enqueue(payload, m.config.SlowConsumer)
+	m.mu.Unlock()
+
+	if !queued {
+		slog.Warn("Disconnecting slow websocket client", "client_id", request.ProducerID.String())
+		client.disconnect(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
 func (m *Manager) ReadChannel() <-chan RequestWs {
 	return m.read
 }
@@ -152,14 +334,36 @@ func (m *Manager) Shutdown() {
 			m.cancel()
 		}
 
+		// close outside the lock, close removes the client from m.clients
 		m.mu.Lock()
-		for _, client := range m.clients {
-			client.close()
+		var clients []*Client
+		for _, sockets := range m.clients {
+			for client := range sockets {
+				clients = append(clients, client)
+			}
 		}
 		m.mu.Unlock()
+		for _, client := range clients {
+			client.close()
+		}
 
 		m.wg.Wait()
 
 		close(m.read)
 	})
 }
+
+// queryCursor reads the optional last_seq and stream query parameters. A
+// last_seq without its stream gets a resync
+func queryCursor(r *http.Request) (*Cursor, error) {
+	query := r.URL.Query()
+	value := query.Get("last_seq")
+	if value == "" {
+		return nil, nil
+	}
+	lastSeq, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, errors.New("last_seq must be a non-negative integer")
+	}
+	return &Cursor{Stream: query.Get("stream"), Seq: lastSeq}, nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ride-hail/pkg/uuid"
+)
+
+var (
+	testUserID = uuid.UUID{1}
+	otherID    = uuid.UUID{2}
+)
+
+// testStream is the instance ID of the managers of newTestServer and
+// newSSEServer, which numbers their frames
+const testStream = "replica-1"
+
+// testAuth accepts "valid" for the user in the path and "other" as another user
+func testAuth(r *http.Request, token string) (uuid.UUID, error) {
+	switch token {
+	case "valid":
+		return testUserID, nil
+	case "other":
+		return uuid.UUID{}, ErrForbidden
+	default:
+		return uuid.UUID{}, ErrUnauthorized
+	}
+}
+
+func newTestServer(t *testing.T) (*Manager, string) {
+	t.Helper()
+	manager := NewManager(DefaultManagerConfig())
+	manager.instanceID = testStream
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.ServeWS(w, r, testAuth)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		manager.Shutdown()
+	})
+	return manager, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// expectClose reads until the server closes conn and checks the close code
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("Expected a close frame, got %v", err)
+	}
+	if closeErr.Code != code {
+		t.Errorf("Expected close code %d, got %d (%s)", code, closeErr.Code, closeErr.Text)
+	}
+}
+
+func expectRead(t *testing.T, manager *Manager, payload string) {
+	t.Helper()
+	select {
+	case request := <-manager.ReadChannel():
+		if request.ProducerID != testUserID || string(request.Payload) != payload {
+			t.Errorf("Unexpected request %s from %s", request.Payload, request.ProducerID.String())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected %s from the socket", payload)
+	}
+}
+
+func TestServeWS_AuthFrame(t *testing.T) {
+	manager, url := newTestServer(t)
+	conn := dial(t, url, nil)
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"auth","token":"Bearer valid"}`)); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`)); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	expectRead(t, manager, `{"type":"ping"}`)
+}
+
+func TestServeWS_AuthHeader(t *testing.T) {
+	manager, url := newTestServer(t)
+	conn := dial(t, url, http.Header{"Authorization": {"Bearer valid"}})
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`)); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	expectRead(t, manager, `{"type":"ping"}`)
+}
+
+func TestServeWS_RejectsBadHeaderBeforeUpgrade(t *testing.T) {
+	_, url := newTestServer(t)
+
+	for header, status := range map[string]int{"Bearer expired": http.StatusUnauthorized, "Bearer other": http.StatusForbidden, "valid": http.StatusUnauthorized} {
+		_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {header}})
+		if err == nil {
+			t.Fatalf("Expected %q to be rejected", header)
+		}
+		if resp == nil || resp.StatusCode != status {
+			t.Errorf("Expected HTTP %d for %q, got %+v", status, header, resp)
+		}
+	}
+}
+
+func TestServeWS_ClosesUnauthenticatedSockets(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		code  int
+	}{
+		{"invalid token", `{"type":"auth","token":"Bearer expired"}`, CloseUnauthorized},
+		{"missing bearer prefix", `{"type":"auth","token":"valid"}`, CloseUnauthorized},
+		{"another user's socket", `{"type":"auth","token":"Bearer other"}`, CloseForbidden},
+		{"not an auth frame", `{"type":"ping"}`, CloseBadAuthFrame},
+		{"not json", `hello`, CloseBadAuthFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, url := newTestServer(t)
+			conn := dial(t, url, nil)
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+				t.Fatalf("Unexpected write error: %v", err)
+			}
+			expectClose(t, conn, tt.code)
+		})
+	}
+}
+
+func TestServeWS_ClosesSocketsThatNeverAuthenticate(t *testing.T) {
+	previous := authTimeout
+	authTimeout = 50 * time.Millisecond
+	defer func() { authTimeout = previous }()
+
+	_, url := newTestServer(t)
+	expectClose(t, dial(t, url, nil), CloseAuthTimeout)
+}
@@ -134,10 +134,10 @@ const findNearbyDrivers = `-- name: FindNearbyDrivers :many
 SELECT d.id, d.vehicle_type, d.rating, d.status, u.email,
        d.vehicle_attrs,
        c.latitude, c.longitude,
-       ST_Distance(
+       (ST_Distance(
          ST_MakePoint(c.longitude, c.latitude)::geography,
-         ST_MakePoint($1, $2)::geography
-       ) / 1000 as distance_km
+         ST_MakePoint($1::float8, $2::float8)::geography
+       ) / 1000)::float8 as distance_km
 FROM drivers d
 JOIN users u ON d.id = u.id
 JOIN coordinates c ON c.entity_id = d.id
@@ -148,19 +148,19 @@ WHERE d.status = 'AVAILABLE'
   AND d.is_verified = true
   AND ST_DWithin(
     ST_MakePoint(c.longitude, c.latitude)::geography,
-    ST_MakePoint($1, $2)::geography,
-    $4 * 1000
+    ST_MakePoint($1::float8, $2::float8)::geography,
+    $4::float8 * 1000
   )
 ORDER BY distance_km, d.rating DESC
 LIMIT $5
 `
 
 type FindNearbyDriversParams struct {
-	StMakepoint   interface{}
-	StMakepoint_2 interface{}
-	VehicleType   *string
-	Column4       interface{}
-	Limit         int
+	Longitude   float64
+	Latitude    float64
+	VehicleType *string
+	RadiusKm    float64
+	MaxResults  int
 }
 
 type FindNearbyDriversRow struct {
@@ -172,16 +172,16 @@ type FindNearbyDriversRow struct {
 	VehicleAttrs any
 	Latitude     pgtype.Numeric
 	Longitude    pgtype.Numeric
-	DistanceKm   int32
+	DistanceKm   float64
 }
 
 func (q *Queries) FindNearbyDrivers(ctx context.Context, arg FindNearbyDriversParams) ([]FindNearbyDriversRow, error) {
 	rows, err := q.db.Query(ctx, findNearbyDrivers,
-		arg.StMakepoint,
-		arg.StMakepoint_2,
+		arg.Longitude,
+		arg.Latitude,
 		arg.VehicleType,
-		arg.Column4,
-		arg.Limit,
+		arg.RadiusKm,
+		arg.MaxResults,
 	)
 	if err != nil {
 		return nil, err
@@ -258,6 +258,38 @@ func (q *Queries) GetDriverCurrentLocation(ctx context.Context, entityID uuid.UU
 	return i, err
 }
 
+const getDriverProfile = `-- name: GetDriverProfile :one
+SELECT d.id, d.vehicle_type, d.vehicle_attrs, d.rating, d.status, u.email, u.attrs
+FROM drivers d
+JOIN users u ON d.id = u.id
+WHERE d.id = $1
+`
+
+type GetDriverProfileRow struct {
+	ID           uuid.UUID
+	VehicleType  *string
+	VehicleAttrs any
+	Rating       pgtype.Numeric
+	Status       string
+	Email        string
+	Attrs        any
+}
+
+func (q *Queries) GetDriverProfile(ctx context.Context, id uuid.UUID) (GetDriverProfileRow, error) {
+	row := q.db.QueryRow(ctx, getDriverProfile, id)
+	var i GetDriverProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.VehicleType,
+		&i.VehicleAttrs,
+		&i.Rating,
+		&i.Status,
+		&i.Email,
+		&i.Attrs,
+	)
+	return i, err
+}
+
 const markDriverCoordinatesAsOld = `-- name: MarkDriverCoordinatesAsOld :exec
 UPDATE coordinates
 SET is_current = false, updated_at = NOW()
@@ -269,6 +301,77 @@ func (q *Queries) MarkDriverCoordinatesAsOld(ctx context.Context, entityID uuid.
 	return err
 }
 
+const transitionDriverStatus = `-- name: TransitionDriverStatus :execrows
+UPDATE drivers
+SET status = $1::text, updated_at = NOW()
+WHERE id = $2
+  AND status = $3::text
+`
+
+type TransitionDriverStatusParams struct {
+	NewStatus  string
+	ID         uuid.UUID
+	FromStatus string
+}
+
+// compare-and-set on the expected prior status; affects no rows when the driver has moved on
+func (q *Queries) TransitionDriverStatus(ctx context.Context, arg TransitionDriverStatusParams) (int64, error) {
+	result, err := q.db.Exec(ctx, transitionDriverStatus, arg.NewStatus, arg.ID, arg.FromStatus)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const transitionRideStatus = `-- name: TransitionRideStatus :one
+UPDATE rides
+SET status = $1::text,
+    matched_at = CASE WHEN $1::text = 'MATCHED' THEN NOW() ELSE matched_at END,
+    arrived_at = CASE WHEN $1::text = 'ARRIVED' THEN NOW() ELSE arrived_at END,
+    started_at = CASE WHEN $1::text = 'IN_PROGRESS' THEN NOW() ELSE started_at END,
+    completed_at = CASE WHEN $1::text = 'COMPLETED' THEN NOW() ELSE completed_at END,
+    cancelled_at = CASE WHEN $1::text = 'CANCELLED' THEN NOW() ELSE cancelled_at END,
+    updated_at = NOW()
+WHERE id = $2
+  AND status = $3::text
+RETURNING id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id
+`
+
+type TransitionRideStatusParams struct {
+	NewStatus      string
+	ID             uuid.UUID
+	ExpectedStatus string
+}
+
+// compare-and-set on the expected prior status; stamps the column for the new status
+func (q *Queries) TransitionRideStatus(ctx context.Context, arg TransitionRideStatusParams) (Ride, error) {
+	row := q.db.QueryRow(ctx, transitionRideStatus, arg.NewStatus, arg.ID, arg.ExpectedStatus)
+	var i Ride
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RideNumber,
+		&i.PassengerID,
+		&i.DriverID,
+		&i.VehicleType,
+		&i.Status,
+		&i.Priority,
+		&i.RequestedAt,
+		&i.MatchedAt,
+		&i.ArrivedAt,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.CancelledAt,
+		&i.CancellationReason,
+		&i.EstimatedFare,
+		&i.FinalFare,
+		&i.PickupCoordinateID,
+		&i.DestinationCoordinateID,
+	)
+	return i, err
+}
+
 const updateDriverRide = `-- name: UpdateDriverRide :exec
 UPDATE drivers
 SET updated_at = NOW()
@@ -321,16 +424,20 @@ SET status = 'COMPLETED',
     final_fare = $2,
     updated_at = NOW()
 WHERE id = $1
+  AND driver_id = $3
+  AND status = $4::text
 RETURNING id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id
 `
 
 type UpdateRideCompletedParams struct {
-	ID        uuid.UUID
-	FinalFare pgtype.Numeric
+	ID             uuid.UUID
+	FinalFare      pgtype.Numeric
+	DriverID       uuid.UUID
+	ExpectedStatus string
 }
 
 func (q *Queries) UpdateRideCompleted(ctx context.Context, arg UpdateRideCompletedParams) (Ride, error) {
-	row := q.db.QueryRow(ctx, updateRideCompleted, arg.ID, arg.FinalFare)
+	row := q.db.QueryRow(ctx, updateRideCompleted, arg.ID, arg.FinalFare, arg.DriverID, arg.ExpectedStatus)
 	var i Ride
 	err := row.Scan(
 		&i.ID,
@@ -357,52 +464,94 @@ func (q *Queries) UpdateRideCompleted(ctx context.Context, arg UpdateRideComplet
 	return i, err
 }
 
-const updateRideMatched = `-- name: UpdateRideMatched :exec
+const updateRideMatched = `-- name: UpdateRideMatched :one
 UPDATE rides
 SET status = 'MATCHED',
     driver_id = $1,
     matched_at = NOW(),
     updated_at = NOW()
 WHERE id = $2
+  AND status = $3::text
+RETURNING id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id
 `
 
 type UpdateRideMatchedParams struct {
-	DriverID uuid.UUID
-	ID       uuid.UUID
+	DriverID       uuid.UUID
+	ID             uuid.UUID
+	ExpectedStatus string
 }
 
-func (q *Queries) UpdateRideMatched(ctx context.Context, arg UpdateRideMatchedParams) error {
-	_, err := q.db.Exec(ctx, updateRideMatched, arg.DriverID, arg.ID)
-	return err
+func (q *Queries) UpdateRideMatched(ctx context.Context, arg UpdateRideMatchedParams) (Ride, error) {
+	row := q.db.QueryRow(ctx, updateRideMatched, arg.DriverID, arg.ID, arg.ExpectedStatus)
+	var i Ride
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RideNumber,
+		&i.PassengerID,
+		&i.DriverID,
+		&i.VehicleType,
+		&i.Status,
+		&i.Priority,
+		&i.RequestedAt,
+		&i.MatchedAt,
+		&i.ArrivedAt,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.CancelledAt,
+		&i.CancellationReason,
+		&i.EstimatedFare,
+		&i.FinalFare,
+		&i.PickupCoordinateID,
+		&i.DestinationCoordinateID,
+	)
+	return i, err
 }
 
-const updateRideStarted = `-- name: UpdateRideStarted :exec
+const updateRideStarted = `-- name: UpdateRideStarted :one
 UPDATE rides
 SET status = 'IN_PROGRESS',
     started_at = NOW(),
     updated_at = NOW()
 WHERE id = $1
+  AND driver_id = $2
+  AND status = $3::text
+RETURNING id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id
 `
 
-func (q *Queries) UpdateRideStarted(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.Exec(ctx, updateRideStarted, id)
-	return err
-}
-
-const updateRideStatus = `-- name: UpdateRideStatus :exec
-UPDATE rides
-SET status = $1, updated_at = NOW()
-WHERE id = $2
-`
-
-type UpdateRideStatusParams struct {
-	Status *string
-	ID     uuid.UUID
+type UpdateRideStartedParams struct {
+	ID             uuid.UUID
+	DriverID       uuid.UUID
+	ExpectedStatus string
 }
 
-func (q *Queries) UpdateRideStatus(ctx context.Context, arg UpdateRideStatusParams) error {
-	_, err := q.db.Exec(ctx, updateRideStatus, arg.Status, arg.ID)
-	return err
+func (q *Queries) UpdateRideStarted(ctx context.Context, arg UpdateRideStartedParams) (Ride, error) {
+	row := q.db.QueryRow(ctx, updateRideStarted, arg.ID, arg.DriverID, arg.ExpectedStatus)
+	var i Ride
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RideNumber,
+		&i.PassengerID,
+		&i.DriverID,
+		&i.VehicleType,
+		&i.Status,
+		&i.Priority,
+		&i.RequestedAt,
+		&i.MatchedAt,
+		&i.ArrivedAt,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.CancelledAt,
+		&i.CancellationReason,
+		&i.EstimatedFare,
+		&i.FinalFare,
+		&i.PickupCoordinateID,
+		&i.DestinationCoordinateID,
+	)
+	return i, err
 }
 
 const updateSessionStats = `-- name: UpdateSessionStats :exec
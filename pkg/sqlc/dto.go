@@ -23,3 +23,11 @@ func TimeToPgxTime(t time.Time) pgtype.Timestamp {
 	_ = ts.Scan(t)
 	return ts
 }
+
+func FloatFromNumeric(n pgtype.Numeric) float64 {
+	f8, err := n.Float64Value()
+	if err != nil || !f8.Valid {
+		return 0
+	}
+	return f8.Float64
+}
@@ -35,6 +35,22 @@ type DriverSession struct {
 	TotalEarnings pgtype.Numeric
 }
 
+type Outbox struct {
+	ID            int64
+	CreatedAt     time.Time
+	AggregateID   uuid.UUID
+	Exchange      string
+	RoutingKey    string
+	CorrelationID string
+	Payload       []byte
+	Attempts      int
+	LastError     *string
+	SentAt        *time.Time
+	NextAttemptAt time.Time
+	ClaimedUntil  *time.Time
+	DeadAt        *time.Time
+}
+
 type Ride struct {
 	ID                      uuid.UUID
 	CreatedAt               time.Time
@@ -63,6 +79,14 @@ type RideCounter struct {
 	Counter int32
 }
 
+type RideEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	RideID    uuid.UUID
+	EventType string
+	EventData []byte
+}
+
 type User struct {
 	ID           uuid.UUID
 	CreatedAt    time.Time
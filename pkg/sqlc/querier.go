@@ -13,15 +13,25 @@ import (
 
 type Querier interface {
 	CancelRide(ctx context.Context, arg CancelRideParams) (Ride, error)
+	// locks due timeouts so concurrent sweepers never process the same ride
+	ClaimDueRideTimeouts(ctx context.Context, limit int) ([]uuid.UUID, error)
+	// leases the oldest ready rows to the caller. A row waits while an earlier
+	// unsent row of its ride is backing off or leased, so a ride's messages never
+	// overtake each other
+	ClaimPendingOutbox(ctx context.Context, arg ClaimPendingOutboxParams) ([]Outbox, error)
 	CreateCoordinate(ctx context.Context, arg CreateCoordinateParams) (Coordinate, error)
 	CreateCoordinateForDriver(ctx context.Context, arg CreateCoordinateForDriverParams) (Coordinate, error)
 	CreateDriverSession(ctx context.Context, driverID uuid.UUID) (DriverSession, error)
 	CreateLocationHistory(ctx context.Context, arg CreateLocationHistoryParams) error
+	CreateOutboxMessage(ctx context.Context, arg CreateOutboxMessageParams) error
 	CreateRide(ctx context.Context, arg CreateRideParams) (Ride, error)
 	CreateRideEvent(ctx context.Context, arg CreateRideEventParams) error
+	CreateRideTimeout(ctx context.Context, arg CreateRideTimeoutParams) error
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteProcessedMessagesBefore(ctx context.Context, processedAt time.Time) (int64, error)
 	EndDriverSession(ctx context.Context, arg EndDriverSessionParams) (DriverSession, error)
 	FindNearbyDrivers(ctx context.Context, arg FindNearbyDriversParams) ([]FindNearbyDriversRow, error)
+	GetActiveRideByDriver(ctx context.Context, driverID uuid.UUID) (Ride, error)
 	// Admin Service Queries
 	GetActiveRidesCount(ctx context.Context) (int64, error)
 	GetActiveRidesPaginated(ctx context.Context, arg GetActiveRidesPaginatedParams) ([]GetActiveRidesPaginatedRow, error)
@@ -31,22 +41,42 @@ type Querier interface {
 	GetAverageWaitTime(ctx context.Context) (interface{}, error)
 	GetBusyDriversCount(ctx context.Context) (int64, error)
 	GetCancellationRate(ctx context.Context) (interface{}, error)
+	GetCoordinateByID(ctx context.Context, id uuid.UUID) (Coordinate, error)
 	GetCurrentDriverSession(ctx context.Context, driverID uuid.UUID) (DriverSession, error)
 	GetDriverCurrentLocation(ctx context.Context, entityID uuid.UUID) (Coordinate, error)
 	GetDriverDistributionByVehicleType(ctx context.Context) ([]GetDriverDistributionByVehicleTypeRow, error)
+	GetDriverProfile(ctx context.Context, id uuid.UUID) (GetDriverProfileRow, error)
+	GetOutboxBacklog(ctx context.Context) (GetOutboxBacklogRow, error)
 	GetRideByID(ctx context.Context, id uuid.UUID) (Ride, error)
+	GetRideDetails(ctx context.Context, id uuid.UUID) (GetRideDetailsRow, error)
 	GetTodayRevenue(ctx context.Context) (interface{}, error)
 	GetTodayRidesCount(ctx context.Context) (int64, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	IncrementRideCounter(ctx context.Context, date time.Time) (RideCounter, error)
+	// keyset pagination on (requested_at, id), newest first
+	ListPassengerRides(ctx context.Context, arg ListPassengerRidesParams) ([]ListPassengerRidesRow, error)
+	ListRideEvents(ctx context.Context, rideID uuid.UUID) ([]RideEvent, error)
 	MarkDriverCoordinatesAsOld(ctx context.Context, entityID uuid.UUID) error
+	// affects no rows when the consumer has already processed the message
+	MarkMessageProcessed(ctx context.Context, arg MarkMessageProcessedParams) (int64, error)
+	// backs the row off, or parks it as dead when it has no attempts left
+	MarkOutboxFailed(ctx context.Context, arg MarkOutboxFailedParams) error
+	MarkOutboxSent(ctx context.Context, id int64) error
+	MarkRideTimeoutProcessed(ctx context.Context, rideID uuid.UUID) error
+	// hands leased rows back without counting an attempt
+	ReleaseOutbox(ctx context.Context, ids []int64) error
+	// compare-and-set on the expected prior status; affects no rows when the driver has moved on
+	TransitionDriverStatus(ctx context.Context, arg TransitionDriverStatusParams) (int64, error)
+	// compare-and-set on the expected prior status; stamps the column for the new status
+	TransitionRideStatus(ctx context.Context, arg TransitionRideStatusParams) (Ride, error)
+	// held until the transaction ends; claims are serialized so two relays never lease rows of one ride out of order
+	TryLockOutboxRelay(ctx context.Context) (bool, error)
 	UpdateDriverRide(ctx context.Context, id uuid.UUID) error
 	UpdateDriverStats(ctx context.Context, arg UpdateDriverStatsParams) error
 	UpdateDriverStatus(ctx context.Context, arg UpdateDriverStatusParams) error
 	UpdateRideCompleted(ctx context.Context, arg UpdateRideCompletedParams) (Ride, error)
-	UpdateRideMatched(ctx context.Context, arg UpdateRideMatchedParams) error
-	UpdateRideStarted(ctx context.Context, id uuid.UUID) error
-	UpdateRideStatus(ctx context.Context, arg UpdateRideStatusParams) error
+	UpdateRideMatched(ctx context.Context, arg UpdateRideMatchedParams) (Ride, error)
+	UpdateRideStarted(ctx context.Context, arg UpdateRideStartedParams) (Ride, error)
 	UpdateSessionStats(ctx context.Context, arg UpdateSessionStatsParams) error
 }
 
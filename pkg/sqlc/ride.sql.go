@@ -17,22 +17,22 @@ const cancelRide = `-- name: CancelRide :one
 update rides
 set
     status = 'CANCELLED',
-    cancellation_reason = $2,
+    cancellation_reason = $1,
     cancelled_at = now(),
     updated_at = now()
-where id = $1
-  and status != 'COMPLETED'
-  and status != 'CANCELLED'
+where id = $2
+  and status = $3::text
 returning id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id
 `
 
 type CancelRideParams struct {
-	ID                 uuid.UUID
 	CancellationReason *string
+	ID                 uuid.UUID
+	ExpectedStatus     string
 }
 
 func (q *Queries) CancelRide(ctx context.Context, arg CancelRideParams) (Ride, error) {
-	row := q.db.QueryRow(ctx, cancelRide, arg.ID, arg.CancellationReason)
+	row := q.db.QueryRow(ctx, cancelRide, arg.CancellationReason, arg.ID, arg.ExpectedStatus)
 	var i Ride
 	err := row.Scan(
 		&i.ID,
@@ -59,6 +59,36 @@ func (q *Queries) CancelRide(ctx context.Context, arg CancelRideParams) (Ride, e
 	return i, err
 }
 
+const claimDueRideTimeouts = `-- name: ClaimDueRideTimeouts :many
+select ride_id from ride_timeouts
+where processed_at is null
+  and expires_at <= now()
+order by expires_at
+limit $1
+for update skip locked
+`
+
+// locks due timeouts so concurrent sweepers never process the same ride
+func (q *Queries) ClaimDueRideTimeouts(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, claimDueRideTimeouts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var ride_id uuid.UUID
+		if err := rows.Scan(&ride_id); err != nil {
+			return nil, err
+		}
+		items = append(items, ride_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createCoordinate = `-- name: CreateCoordinate :one
 insert into coordinates (
     entity_id,
@@ -202,6 +232,83 @@ func (q *Queries) CreateRideEvent(ctx context.Context, arg CreateRideEventParams
 	return err
 }
 
+const createRideTimeout = `-- name: CreateRideTimeout :exec
+insert into ride_timeouts (ride_id, expires_at)
+values ($1, now() + $2::integer * interval '1 second')
+`
+
+type CreateRideTimeoutParams struct {
+	RideID         uuid.UUID
+	TimeoutSeconds int
+}
+
+func (q *Queries) CreateRideTimeout(ctx context.Context, arg CreateRideTimeoutParams) error {
+	_, err := q.db.Exec(ctx, createRideTimeout, arg.RideID, arg.TimeoutSeconds)
+	return err
+}
+
+const getActiveRideByDriver = `-- name: GetActiveRideByDriver :one
+select id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id from rides
+where driver_id = $1
+  and status in ('MATCHED', 'EN_ROUTE', 'ARRIVED', 'IN_PROGRESS')
+order by matched_at desc
+limit 1
+`
+
+func (q *Queries) GetActiveRideByDriver(ctx context.Context, driverID uuid.UUID) (Ride, error) {
+	row := q.db.QueryRow(ctx, getActiveRideByDriver, driverID)
+	var i Ride
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RideNumber,
+		&i.PassengerID,
+		&i.DriverID,
+		&i.VehicleType,
+		&i.Status,
+		&i.Priority,
+		&i.RequestedAt,
+		&i.MatchedAt,
+		&i.ArrivedAt,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.CancelledAt,
+		&i.CancellationReason,
+		&i.EstimatedFare,
+		&i.FinalFare,
+		&i.PickupCoordinateID,
+		&i.DestinationCoordinateID,
+	)
+	return i, err
+}
+
+const getCoordinateByID = `-- name: GetCoordinateByID :one
+select id, created_at, updated_at, entity_id, entity_type, address, latitude, longitude, fare_amount, distance_km, duration_minutes, is_current from coordinates
+where id = $1
+limit 1
+`
+
+func (q *Queries) GetCoordinateByID(ctx context.Context, id uuid.UUID) (Coordinate, error) {
+	row := q.db.QueryRow(ctx, getCoordinateByID, id)
+	var i Coordinate
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EntityID,
+		&i.EntityType,
+		&i.Address,
+		&i.Latitude,
+		&i.Longitude,
+		&i.FareAmount,
+		&i.DistanceKm,
+		&i.DurationMinutes,
+		&i.IsCurrent,
+	)
+	return i, err
+}
+
 const getRideByID = `-- name: GetRideByID :one
 select id, created_at, updated_at, ride_number, passenger_id, driver_id, vehicle_type, status, priority, requested_at, matched_at, arrived_at, started_at, completed_at, cancelled_at, cancellation_reason, estimated_fare, final_fare, pickup_coordinate_id, destination_coordinate_id from rides
 where id = $1
@@ -236,6 +343,95 @@ func (q *Queries) GetRideByID(ctx context.Context, id uuid.UUID) (Ride, error) {
 	return i, err
 }
 
+const getRideDetails = `-- name: GetRideDetails :one
+select
+    r.id,
+    r.ride_number,
+    r.passenger_id,
+    r.driver_id,
+    r.vehicle_type,
+    r.status,
+    r.requested_at,
+    r.matched_at,
+    r.arrived_at,
+    r.started_at,
+    r.completed_at,
+    r.cancelled_at,
+    r.cancellation_reason,
+    r.estimated_fare,
+    r.final_fare,
+    pickup.address as pickup_address,
+    pickup.latitude as pickup_latitude,
+    pickup.longitude as pickup_longitude,
+    pickup.distance_km as estimated_distance_km,
+    pickup.duration_minutes as estimated_duration_minutes,
+    dest.address as destination_address,
+    dest.latitude as destination_latitude,
+    dest.longitude as destination_longitude
+from rides r
+join coordinates pickup on pickup.id = r.pickup_coordinate_id
+join coordinates dest on dest.id = r.destination_coordinate_id
+where r.id = $1
+limit 1
+`
+
+type GetRideDetailsRow struct {
+	ID                       uuid.UUID
+	RideNumber               string
+	PassengerID              uuid.UUID
+	DriverID                 uuid.UUID
+	VehicleType              *string
+	Status                   *string
+	RequestedAt              *time.Time
+	MatchedAt                *time.Time
+	ArrivedAt                *time.Time
+	StartedAt                *time.Time
+	CompletedAt              *time.Time
+	CancelledAt              *time.Time
+	CancellationReason       *string
+	EstimatedFare            pgtype.Numeric
+	FinalFare                pgtype.Numeric
+	PickupAddress            string
+	PickupLatitude           pgtype.Numeric
+	PickupLongitude          pgtype.Numeric
+	EstimatedDistanceKm      pgtype.Numeric
+	EstimatedDurationMinutes pgtype.Int4
+	DestinationAddress       string
+	DestinationLatitude      pgtype.Numeric
+	DestinationLongitude     pgtype.Numeric
+}
+
+func (q *Queries) GetRideDetails(ctx context.Context, id uuid.UUID) (GetRideDetailsRow, error) {
+	row := q.db.QueryRow(ctx, getRideDetails, id)
+	var i GetRideDetailsRow
+	err := row.Scan(
+		&i.ID,
+		&i.RideNumber,
+		&i.PassengerID,
+		&i.DriverID,
+		&i.VehicleType,
+		&i.Status,
+		&i.RequestedAt,
+		&i.MatchedAt,
+		&i.ArrivedAt,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.CancelledAt,
+		&i.CancellationReason,
+		&i.EstimatedFare,
+		&i.FinalFare,
+		&i.PickupAddress,
+		&i.PickupLatitude,
+		&i.PickupLongitude,
+		&i.EstimatedDistanceKm,
+		&i.EstimatedDurationMinutes,
+		&i.DestinationAddress,
+		&i.DestinationLatitude,
+		&i.DestinationLongitude,
+	)
+	return i, err
+}
+
 const incrementRideCounter = `-- name: IncrementRideCounter :one
 INSERT INTO ride_counters (day, counter)
 VALUES ($1::date, 1)
@@ -250,3 +446,142 @@ func (q *Queries) IncrementRideCounter(ctx context.Context, date time.Time) (Rid
 	err := row.Scan(&i.Day, &i.Counter)
 	return i, err
 }
+
+const listPassengerRides = `-- name: ListPassengerRides :many
+select
+    r.id,
+    r.ride_number,
+    r.driver_id,
+    r.vehicle_type,
+    r.status,
+    r.requested_at,
+    r.completed_at,
+    r.cancelled_at,
+    r.estimated_fare,
+    r.final_fare,
+    pickup.address as pickup_address,
+    dest.address as destination_address
+from rides r
+join coordinates pickup on pickup.id = r.pickup_coordinate_id
+join coordinates dest on dest.id = r.destination_coordinate_id
+where r.passenger_id = $1
+  and ($2::text is null or r.status = $2::text)
+  and ($3::timestamptz is null or r.requested_at >= $3::timestamptz)
+  and ($4::timestamptz is null or r.requested_at < $4::timestamptz)
+  and (
+    $5::timestamptz is null
+    or (r.requested_at, r.id) < ($5::timestamptz, $6::uuid)
+  )
+order by r.requested_at desc, r.id desc
+limit $7::integer
+`
+
+type ListPassengerRidesParams struct {
+	PassengerID       uuid.UUID
+	Status            *string
+	RequestedFrom     *time.Time
+	RequestedTo       *time.Time
+	CursorRequestedAt *time.Time
+	CursorID          uuid.UUID
+	PageSize          int
+}
+
+type ListPassengerRidesRow struct {
+	ID                 uuid.UUID
+	RideNumber         string
+	DriverID           uuid.UUID
+	VehicleType        *string
+	Status             *string
+	RequestedAt        *time.Time
+	CompletedAt        *time.Time
+	CancelledAt        *time.Time
+	EstimatedFare      pgtype.Numeric
+	FinalFare          pgtype.Numeric
+	PickupAddress      string
+	DestinationAddress string
+}
+
+// keyset pagination on (requested_at, id), newest first
+func (q *Queries) ListPassengerRides(ctx context.Context, arg ListPassengerRidesParams) ([]ListPassengerRidesRow, error) {
+	rows, err := q.db.Query(ctx, listPassengerRides,
+		arg.PassengerID,
+		arg.Status,
+		arg.RequestedFrom,
+		arg.RequestedTo,
+		arg.CursorRequestedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPassengerRidesRow
+	for rows.Next() {
+		var i ListPassengerRidesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RideNumber,
+			&i.DriverID,
+			&i.VehicleType,
+			&i.Status,
+			&i.RequestedAt,
+			&i.CompletedAt,
+			&i.CancelledAt,
+			&i.EstimatedFare,
+			&i.FinalFare,
+			&i.PickupAddress,
+			&i.DestinationAddress,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRideEvents = `-- name: ListRideEvents :many
+select id, created_at, ride_id, event_type, event_data from ride_events
+where ride_id = $1
+order by created_at asc, id asc
+`
+
+func (q *Queries) ListRideEvents(ctx context.Context, rideID uuid.UUID) ([]RideEvent, error) {
+	rows, err := q.db.Query(ctx, listRideEvents, rideID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RideEvent
+	for rows.Next() {
+		var i RideEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.RideID,
+			&i.EventType,
+			&i.EventData,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markRideTimeoutProcessed = `-- name: MarkRideTimeoutProcessed :exec
+update ride_timeouts
+set processed_at = now()
+where ride_id = $1
+`
+
+func (q *Queries) MarkRideTimeoutProcessed(ctx context.Context, rideID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, markRideTimeoutProcessed, rideID)
+	return err
+}
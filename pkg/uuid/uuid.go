@@ -64,3 +64,32 @@ func Validate(s string) error {
 	}
 	return nil
 }
+
+// Scan implements sql.Scanner so nullable uuid columns scan NULL into Nil
+func (u *UUID) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*u = Nil
+		return nil
+	case string:
+		parsed, err := FromString(v)
+		if err != nil {
+			return err
+		}
+		*u = parsed
+		return nil
+	case []byte:
+		if len(v) == 16 {
+			copy(u[:], v)
+			return nil
+		}
+		parsed, err := FromString(string(v))
+		if err != nil {
+			return err
+		}
+		*u = parsed
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into uuid", src)
+	}
+}
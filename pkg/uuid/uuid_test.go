@@ -0,0 +1,35 @@
+package uuid
+
+import "testing"
+
+func TestScan(t *testing.T) {
+	want := New()
+
+	tests := []struct {
+		name string
+		src  any
+		want UUID
+	}{
+		{name: "NULL", src: nil, want: Nil},
+		{name: "binary", src: want[:], want: want},
+		{name: "text", src: want.String(), want: want},
+		{name: "text bytes", src: []byte(want.String()), want: want},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New()
+			if err := got.Scan(tt.src); err != nil {
+				t.Fatalf("Expected scan to succeed, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	var u UUID
+	if err := u.Scan(42); err == nil {
+		t.Error("Expected an error scanning an int")
+	}
+}
@@ -3,6 +3,13 @@ UPDATE drivers
 SET status = $1, updated_at = NOW()
 WHERE id = $2;
 
+-- name: TransitionDriverStatus :execrows
+-- compare-and-set on the expected prior status; affects no rows when the driver has moved on
+UPDATE drivers
+SET status = sqlc.arg(new_status)::text, updated_at = NOW()
+WHERE id = sqlc.arg(id)
+  AND status = sqlc.arg(from_status)::text;
+
 -- name: CreateDriverSession :one
 INSERT INTO driver_sessions (driver_id, started_at)
 VALUES ($1, NOW())
@@ -48,25 +55,31 @@ INSERT INTO location_history (
 SELECT d.id, d.vehicle_type, d.rating, d.status, u.email,
        d.vehicle_attrs,
        c.latitude, c.longitude,
-       ST_Distance(
+       (ST_Distance(
          ST_MakePoint(c.longitude, c.latitude)::geography,
-         ST_MakePoint($1, $2)::geography
-       ) / 1000 as distance_km
+         ST_MakePoint(sqlc.arg(longitude)::float8, sqlc.arg(latitude)::float8)::geography
+       ) / 1000)::float8 as distance_km
 FROM drivers d
 JOIN users u ON d.id = u.id
 JOIN coordinates c ON c.entity_id = d.id
   AND c.entity_type = 'driver'
   AND c.is_current = true
 WHERE d.status = 'AVAILABLE'
-  AND d.vehicle_type = $3
+  AND d.vehicle_type = sqlc.arg(vehicle_type)
   AND d.is_verified = true
   AND ST_DWithin(
     ST_MakePoint(c.longitude, c.latitude)::geography,
-    ST_MakePoint($1, $2)::geography,
-    $4 * 1000
+    ST_MakePoint(sqlc.arg(longitude)::float8, sqlc.arg(latitude)::float8)::geography,
+    sqlc.arg(radius_km)::float8 * 1000
   )
 ORDER BY distance_km, d.rating DESC
-LIMIT $5;
+LIMIT sqlc.arg(max_results);
+
+-- name: GetDriverProfile :one
+SELECT d.id, d.vehicle_type, d.vehicle_attrs, d.rating, d.status, u.email, u.attrs
+FROM drivers d
+JOIN users u ON d.id = u.id
+WHERE d.id = $1;
 
 -- name: UpdateDriverRide :exec
 UPDATE drivers
@@ -74,25 +87,39 @@ SET updated_at = NOW()
 WHERE id = $1;
 
 
--- name: UpdateRideStatus :exec
+-- name: TransitionRideStatus :one
+-- compare-and-set on the expected prior status; stamps the column for the new status
 UPDATE rides
-SET status = $1, updated_at = NOW()
-WHERE id = $2;
+SET status = sqlc.arg(new_status)::text,
+    matched_at = CASE WHEN sqlc.arg(new_status)::text = 'MATCHED' THEN NOW() ELSE matched_at END,
+    arrived_at = CASE WHEN sqlc.arg(new_status)::text = 'ARRIVED' THEN NOW() ELSE arrived_at END,
+    started_at = CASE WHEN sqlc.arg(new_status)::text = 'IN_PROGRESS' THEN NOW() ELSE started_at END,
+    completed_at = CASE WHEN sqlc.arg(new_status)::text = 'COMPLETED' THEN NOW() ELSE completed_at END,
+    cancelled_at = CASE WHEN sqlc.arg(new_status)::text = 'CANCELLED' THEN NOW() ELSE cancelled_at END,
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+  AND status = sqlc.arg(expected_status)::text
+RETURNING *;
 
--- name: UpdateRideMatched :exec
+-- name: UpdateRideMatched :one
 UPDATE rides
 SET status = 'MATCHED',
     driver_id = $1,
     matched_at = NOW(),
     updated_at = NOW()
-WHERE id = $2;
+WHERE id = $2
+  AND status = $3::text
+RETURNING *;
 
--- name: UpdateRideStarted :exec
+-- name: UpdateRideStarted :one
 UPDATE rides
 SET status = 'IN_PROGRESS',
     started_at = NOW(),
     updated_at = NOW()
-WHERE id = $1;
+WHERE id = sqlc.arg(id)
+  AND driver_id = sqlc.arg(driver_id)
+  AND status = sqlc.arg(expected_status)::text
+RETURNING *;
 
 -- name: UpdateRideCompleted :one
 UPDATE rides
@@ -101,6 +128,8 @@ SET status = 'COMPLETED',
     final_fare = $2,
     updated_at = NOW()
 WHERE id = $1
+  AND driver_id = $3
+  AND status = $4::text
 RETURNING *;
 
 -- name: UpdateDriverStats :exec
@@ -0,0 +1,9 @@
+-- name: MarkMessageProcessed :execrows
+-- affects no rows when the consumer has already processed the message
+insert into processed_messages (consumer, message_id)
+values ($1, $2)
+on conflict do nothing;
+
+-- name: DeleteProcessedMessagesBefore :execrows
+delete from processed_messages
+where processed_at < $1;
@@ -0,0 +1,62 @@
+-- name: CreateOutboxMessage :exec
+insert into outbox (aggregate_id, exchange, routing_key, correlation_id, payload)
+values ($1, $2, $3, $4, $5);
+
+-- name: TryLockOutboxRelay :one
+-- held until the transaction ends; claims are serialized so two relays never lease rows of one ride out of order
+select pg_try_advisory_xact_lock(hashtext('outbox_relay'))::boolean;
+
+-- name: ClaimPendingOutbox :many
+-- leases the oldest ready rows to the caller. A row waits while an earlier
+-- unsent row of its ride is backing off or leased, so a ride's messages never
+-- overtake each other
+update outbox
+set claimed_until = now() + make_interval(secs => sqlc.arg(lease_seconds)::double precision)
+where id in (
+    select o.id from outbox o
+    where o.sent_at is null
+      and o.dead_at is null
+      and o.next_attempt_at <= now()
+      and (o.claimed_until is null or o.claimed_until < now())
+      and not exists (
+          select 1 from outbox earlier
+          where earlier.aggregate_id = o.aggregate_id
+            and earlier.id < o.id
+            and earlier.sent_at is null
+            and earlier.dead_at is null
+            and (earlier.next_attempt_at > now() or earlier.claimed_until >= now())
+      )
+    order by o.id
+    limit sqlc.arg(batch_size)
+)
+returning *;
+
+-- name: MarkOutboxSent :exec
+update outbox
+set sent_at = now(),
+    attempts = attempts + 1,
+    last_error = null,
+    claimed_until = null
+where id = $1;
+
+-- name: MarkOutboxFailed :exec
+-- backs the row off, or parks it as dead when it has no attempts left
+update outbox
+set attempts = attempts + 1,
+    last_error = sqlc.arg(last_error),
+    claimed_until = null,
+    next_attempt_at = now() + make_interval(secs => sqlc.arg(backoff_seconds)::double precision),
+    dead_at = case when sqlc.arg(dead)::boolean then now() end
+where id = sqlc.arg(id);
+
+-- name: ReleaseOutbox :exec
+-- hands leased rows back without counting an attempt
+update outbox
+set claimed_until = null
+where id = any(sqlc.arg(ids)::bigint[]);
+
+-- name: GetOutboxBacklog :one
+select
+    count(*) filter (where sent_at is null and dead_at is null) as pending,
+    count(*) filter (where dead_at is not null) as dead
+from outbox;
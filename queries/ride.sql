@@ -49,16 +49,92 @@ select * from rides
 where id = $1
 limit 1;
 
+-- name: GetRideDetails :one
+select
+    r.id,
+    r.ride_number,
+    r.passenger_id,
+    r.driver_id,
+    r.vehicle_type,
+    r.status,
+    r.requested_at,
+    r.matched_at,
+    r.arrived_at,
+    r.started_at,
+    r.completed_at,
+    r.cancelled_at,
+    r.cancellation_reason,
+    r.estimated_fare,
+    r.final_fare,
+    pickup.address as pickup_address,
+    pickup.latitude as pickup_latitude,
+    pickup.longitude as pickup_longitude,
+    pickup.distance_km as estimated_distance_km,
+    pickup.duration_minutes as estimated_duration_minutes,
+    dest.address as destination_address,
+    dest.latitude as destination_latitude,
+    dest.longitude as destination_longitude
+from rides r
+join coordinates pickup on pickup.id = r.pickup_coordinate_id
+join coordinates dest on dest.id = r.destination_coordinate_id
+where r.id = $1
+limit 1;
+
+-- name: ListPassengerRides :many
+-- keyset pagination on (requested_at, id), newest first
+select
+    r.id,
+    r.ride_number,
+    r.driver_id,
+    r.vehicle_type,
+    r.status,
+    r.requested_at,
+    r.completed_at,
+    r.cancelled_at,
+    r.estimated_fare,
+    r.final_fare,
+    pickup.address as pickup_address,
+    dest.address as destination_address
+from rides r
+join coordinates pickup on pickup.id = r.pickup_coordinate_id
+join coordinates dest on dest.id = r.destination_coordinate_id
+where r.passenger_id = sqlc.arg(passenger_id)
+  and (sqlc.narg(status)::text is null or r.status = sqlc.narg(status)::text)
+  and (sqlc.narg(requested_from)::timestamptz is null or r.requested_at >= sqlc.narg(requested_from)::timestamptz)
+  and (sqlc.narg(requested_to)::timestamptz is null or r.requested_at < sqlc.narg(requested_to)::timestamptz)
+  and (
+    sqlc.narg(cursor_requested_at)::timestamptz is null
+    or (r.requested_at, r.id) < (sqlc.narg(cursor_requested_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+  )
+order by r.requested_at desc, r.id desc
+limit sqlc.arg(page_size)::integer;
+
+-- name: ListRideEvents :many
+select * from ride_events
+where ride_id = $1
+order by created_at asc, id asc;
+
+-- name: GetActiveRideByDriver :one
+select * from rides
+where driver_id = $1
+  and status in ('MATCHED', 'EN_ROUTE', 'ARRIVED', 'IN_PROGRESS')
+order by matched_at desc
+limit 1;
+
+-- name: GetCoordinateByID :one
+select * from coordinates
+where id = $1
+limit 1;
+
 -- name: CancelRide :one
 update rides
 set
     status = 'CANCELLED',
-    cancellation_reason = $2,
+    cancellation_reason = sqlc.narg(cancellation_reason),
     cancelled_at = now(),
     updated_at = now()
-where id = $1
-  and status != 'COMPLETED'
-  and status != 'CANCELLED'
+where id = sqlc.arg(id)
+  and status = sqlc.arg(expected_status)::text
 returning *;
 
 -- name: IncrementRideCounter :one
@@ -67,3 +143,21 @@ VALUES (@date::date, 1)
 ON CONFLICT (day) DO UPDATE
   SET counter = ride_counters.counter + 1
 RETURNING day,counter;
+
+-- name: CreateRideTimeout :exec
+insert into ride_timeouts (ride_id, expires_at)
+values (sqlc.arg(ride_id), now() + sqlc.arg(timeout_seconds)::integer * interval '1 second');
+
+-- name: ClaimDueRideTimeouts :many
+-- locks due timeouts so concurrent sweepers never process the same ride
+select ride_id from ride_timeouts
+where processed_at is null
+  and expires_at <= now()
+order by expires_at
+limit $1
+for update skip locked;
+
+-- name: MarkRideTimeoutProcessed :exec
+update ride_timeouts
+set processed_at = now()
+where ride_id = $1;